@@ -0,0 +1,158 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/grpclog"
+)
+
+var asyncLogger = grpclog.Component("authz-audit")
+
+// asyncQueueSize is the default bound on each worker's queue of events
+// waiting for delivery. Events are dropped when a queue is full so the RPC
+// path never blocks on a slow delegate; NewBufferedAsyncLogger picks a
+// different bound.
+const asyncQueueSize = 256
+
+// AsyncLogger wraps a delegate logger and delivers events to it from
+// background worker goroutines, so a slow delegate does not hold up the RPC
+// path. It comes in two modes:
+//
+//   - Sharded-parallel, from NewAsyncLogger with more than one worker: events
+//     are sharded across the workers by (principal, method) key, so events of
+//     one key are delivered in order relative to each other while keys
+//     proceed in parallel. There is no total order across keys.
+//
+//   - Ordered-single-worker, from NewOrderedAsyncLogger: a single drain
+//     goroutine delivers events to the delegate in exactly the order Log
+//     enqueued them. This trades the throughput of parallel delivery for a
+//     strict total order, for single-sink setups that replay or tail the
+//     audit log and need it.
+//
+// In both modes, when a full queue forces a drop the oldest queued event is
+// discarded in favor of the new one, so the buffer holds the most recent
+// events; drops are counted and readable through Dropped. The events that are
+// delivered are never reordered relative to each other, though in either mode
+// delivery happens after Log returns, so events may reach the delegate out of
+// RPC order.
+type AsyncLogger struct {
+	delegate Logger
+	queues   []chan *Event
+	wg       sync.WaitGroup
+	dropped  atomic.Uint64
+
+	closeOnce sync.Once
+}
+
+// NewAsyncLogger returns an AsyncLogger delivering events to the delegate
+// from the given number of sharded workers. Values below 1 are treated as 1,
+// which is equivalent to NewOrderedAsyncLogger.
+func NewAsyncLogger(delegate Logger, workers int) *AsyncLogger {
+	return newAsyncLogger(delegate, workers, asyncQueueSize)
+}
+
+// NewBufferedAsyncLogger returns a single-worker AsyncLogger whose queue
+// holds at most bufferSize events, for callers that want to size the
+// latency buffer to their sink rather than take the default. Values below 1
+// are treated as 1. Delivery is FIFO, as with NewOrderedAsyncLogger.
+func NewBufferedAsyncLogger(delegate Logger, bufferSize int) *AsyncLogger {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return newAsyncLogger(delegate, 1, bufferSize)
+}
+
+func newAsyncLogger(delegate Logger, workers, bufferSize int) *AsyncLogger {
+	if workers < 1 {
+		workers = 1
+	}
+	l := &AsyncLogger{delegate: delegate, queues: make([]chan *Event, workers)}
+	for i := range l.queues {
+		queue := make(chan *Event, bufferSize)
+		l.queues[i] = queue
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			for event := range queue {
+				l.delegate.Log(event)
+			}
+		}()
+	}
+	return l
+}
+
+// NewOrderedAsyncLogger returns an AsyncLogger with a single drain goroutine
+// that preserves the FIFO order of enqueued events exactly. See the
+// AsyncLogger documentation for the trade-off against the sharded mode.
+func NewOrderedAsyncLogger(delegate Logger) *AsyncLogger {
+	return NewAsyncLogger(delegate, 1)
+}
+
+// Log enqueues the event for background delivery. It never blocks: when the
+// responsible worker's queue is full the oldest queued event is dropped to
+// make room, the drop counter advances, and a warning is logged the first
+// time it happens.
+func (l *AsyncLogger) Log(event *Event) {
+	e := *event
+	queue := l.queues[0]
+	if len(l.queues) > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(event.Principal))
+		h.Write([]byte{0})
+		h.Write([]byte(event.FullMethodName))
+		queue = l.queues[h.Sum32()%uint32(len(l.queues))]
+	}
+	for {
+		select {
+		case queue <- &e:
+			return
+		default:
+		}
+		// Evict the oldest queued event; the worker may have raced us to
+		// it, in which case the enqueue above is retried without a drop.
+		select {
+		case <-queue:
+			if l.dropped.Add(1) == 1 {
+				asyncLogger.Warningf("async audit logger queue is full, dropping oldest events")
+			}
+		default:
+		}
+	}
+}
+
+// Dropped reports how many events have been discarded because their worker's
+// queue was full when Log ran.
+func (l *AsyncLogger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close drains the queues and waits until every enqueued event has been
+// delivered to the delegate. Log must not be called after Close.
+func (l *AsyncLogger) Close() {
+	l.closeOnce.Do(func() {
+		for _, queue := range l.queues {
+			close(queue)
+		}
+		l.wg.Wait()
+	})
+}
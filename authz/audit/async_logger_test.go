@@ -0,0 +1,149 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+)
+
+// TestOrderedAsyncLogger verifies that the single-worker mode delivers
+// concurrently enqueued events to the delegate without reordering: the
+// delegate's sequence, filtered to one producer, matches that producer's
+// FIFO enqueue order.
+func (s) TestOrderedAsyncLogger(t *testing.T) {
+	rec := &recordingLogger{}
+	l := audit.NewOrderedAsyncLogger(rec)
+	const producers, perProducer = 4, 50
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for n := 0; n < perProducer; n++ {
+				l.Log(&audit.Event{
+					Principal:      fmt.Sprintf("producer-%d", p),
+					FullMethodName: fmt.Sprintf("/pkg.Service/Method%d", n),
+				})
+			}
+		}(p)
+	}
+	wg.Wait()
+	l.Close()
+	events := rec.Events()
+	if got := len(events); got != producers*perProducer {
+		t.Fatalf("Delivered %d events, want %d", got, producers*perProducer)
+	}
+	next := make(map[string]int, producers)
+	for i, event := range events {
+		want := fmt.Sprintf("/pkg.Service/Method%d", next[event.Principal])
+		if event.FullMethodName != want {
+			t.Fatalf("Event %d for %v is %v, want %v (FIFO order violated)", i, event.Principal, event.FullMethodName, want)
+		}
+		next[event.Principal]++
+	}
+}
+
+// TestAsyncLoggerSharded verifies that the sharded mode delivers every event
+// and keeps per-key order, and that Close is idempotent.
+func (s) TestAsyncLoggerSharded(t *testing.T) {
+	rec := &recordingLogger{}
+	l := audit.NewAsyncLogger(rec, 4)
+	const perKey = 50
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for n := 0; n < perKey; n++ {
+				l.Log(&audit.Event{
+					Principal:      fmt.Sprintf("producer-%d", p),
+					FullMethodName: "/pkg.Service/Api",
+					MatchedRule:    fmt.Sprintf("rule-%d", n),
+				})
+			}
+		}(p)
+	}
+	wg.Wait()
+	l.Close()
+	l.Close()
+	events := rec.Events()
+	if got := len(events); got != 4*perKey {
+		t.Fatalf("Delivered %d events, want %d", got, 4*perKey)
+	}
+	next := make(map[string]int, 4)
+	for i, event := range events {
+		if want := fmt.Sprintf("rule-%d", next[event.Principal]); event.MatchedRule != want {
+			t.Fatalf("Event %d for %v is %v, want %v (per-key order violated)", i, event.Principal, event.MatchedRule, want)
+		}
+		next[event.Principal]++
+	}
+}
+
+// blockableLogger records events but blocks each delivery until release is
+// closed, so tests can fill an AsyncLogger's queue deterministically.
+type blockableLogger struct {
+	recordingLogger
+	release chan struct{}
+}
+
+func (l *blockableLogger) Log(event *audit.Event) {
+	<-l.release
+	l.recordingLogger.Log(event)
+}
+
+// TestBufferedAsyncLoggerDrops verifies that flooding a bounded buffer drops
+// the oldest events, advances the drop counter, and still delivers the most
+// recent events in order.
+func (s) TestBufferedAsyncLoggerDrops(t *testing.T) {
+	rec := &blockableLogger{release: make(chan struct{})}
+	const bufferSize, total = 8, 100
+	l := audit.NewBufferedAsyncLogger(rec, bufferSize)
+	for n := 0; n < total; n++ {
+		l.Log(&audit.Event{FullMethodName: fmt.Sprintf("/pkg.Service/Method%d", n)})
+	}
+	if got := l.Dropped(); got == 0 {
+		t.Error("Dropped() = 0 after flooding the buffer, want > 0")
+	}
+	close(rec.release)
+	l.Close()
+	events := rec.Events()
+	delivered := uint64(len(events))
+	if got := l.Dropped(); got+delivered != total {
+		t.Errorf("Dropped() + delivered = %d + %d, want %d", got, delivered, total)
+	}
+	// The survivors are the newest events, still in FIFO order.
+	if got, want := events[len(events)-1].FullMethodName, fmt.Sprintf("/pkg.Service/Method%d", total-1); got != want {
+		t.Errorf("Last delivered event = %v, want %v", got, want)
+	}
+	last := -1
+	for i, event := range events {
+		var n int
+		if _, err := fmt.Sscanf(event.FullMethodName, "/pkg.Service/Method%d", &n); err != nil {
+			t.Fatalf("Event %d has unexpected method %v", i, event.FullMethodName)
+		}
+		if n <= last {
+			t.Fatalf("Event %d out of order: %v after Method%d", i, event.FullMethodName, last)
+		}
+		last = n
+	}
+}
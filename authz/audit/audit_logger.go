@@ -21,7 +21,12 @@ package audit
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
 )
 
 // loggerBuilderRegistry holds a map of audit logger builders and a mutex
@@ -40,23 +45,103 @@ var (
 // RegisterLoggerBuilder registers the builder in a global map
 // using b.Name() as the key.
 //
-// This should only be called during initialization time (i.e. in an init()
-// function). If multiple builders are registered with the same name,
-// the one registered last will take effect.
+// Built-in builders register themselves in an init() function, but
+// registration is safe for concurrent use at any time, so plugin-style sinks
+// can also register after startup. If multiple builders are registered with
+// the same name, the one registered last will take effect. Policies built
+// before the registration keep whatever logger they built; only subsequent
+// policy construction sees the new builder. Callers that want a duplicate
+// name surfaced instead of silently overwritten should use
+// RegisterLoggerBuilderErr.
 func RegisterLoggerBuilder(b LoggerBuilder) {
 	registry.mu.Lock()
 	defer registry.mu.Unlock()
 	registry.builders[b.Name()] = b
 }
 
+// RegisterLoggerBuilderErr registers the builder like RegisterLoggerBuilder,
+// but returns an error, leaving the registry untouched, when a builder is
+// already registered under b.Name(). This catches a transitively imported
+// package clobbering a custom sink, which the silent last-wins semantics of
+// RegisterLoggerBuilder would hide.
+func RegisterLoggerBuilderErr(b LoggerBuilder) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if _, ok := registry.builders[b.Name()]; ok {
+		return fmt.Errorf("an audit logger builder is already registered under %q", b.Name())
+	}
+	registry.builders[b.Name()] = b
+	return nil
+}
+
+// UnregisterLoggerBuilder removes the builder registered under name, e.g.
+// when a plugin providing it is torn down or between test cases. It is safe
+// for concurrent use and is a no-op when no builder is registered under name.
+//
+// Unregistering only affects subsequent policy construction: loggers already
+// built from the builder keep running and policies holding them are
+// unaffected.
+func UnregisterLoggerBuilder(name string) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	delete(registry.builders, name)
+}
+
 // GetLoggerBuilder returns a builder with the given name.
 // It returns nil if the builder is not found in the registry.
+// It is safe for concurrent use with registration.
 func GetLoggerBuilder(name string) LoggerBuilder {
 	registry.mu.Lock()
 	defer registry.mu.Unlock()
 	return registry.builders[name]
 }
 
+// GetRegisteredBuilderNames returns the names of all registered builders, in
+// sorted order, so startup tests can assert the registration state. It is
+// safe for concurrent use with registration.
+func GetRegisteredBuilderNames() []string {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	names := make([]string, 0, len(registry.builders))
+	for name := range registry.builders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Event types used in the EventType field of an audit event. Decision events
+// carry an empty event type.
+const (
+	// EventTypeStreamOpen is emitted when an authorized stream starts, if
+	// stream lifecycle auditing is enabled.
+	EventTypeStreamOpen = "open"
+	// EventTypeStreamClose is emitted when an audited stream ends, if stream
+	// lifecycle auditing is enabled.
+	EventTypeStreamClose = "close"
+	// EventTypeSummary is emitted periodically with aggregated decision
+	// counts, if periodic summaries are enabled.
+	EventTypeSummary = "summary"
+	// EventTypeResult marks decision events emitted after handler completion,
+	// if post-handler auditing is enabled. They carry the RPC's final status
+	// in ResultCode and ResultMessage.
+	EventTypeResult = "result"
+)
+
+// Outcomes used in the Outcome field of an audit event.
+const (
+	// OutcomeAllow indicates the audited RPC was authorized.
+	OutcomeAllow = "allow"
+	// OutcomeDeny indicates the audited RPC was denied.
+	OutcomeDeny = "deny"
+	// OutcomeWarn indicates the audited RPC was allowed by a warn rule and
+	// flagged as a policy concern.
+	OutcomeWarn = "warn"
+	// OutcomeUnenforced indicates the audited RPC would have been denied but
+	// was allowed because an enforcement gate turned enforcement off for it.
+	OutcomeUnenforced = "unenforced"
+)
+
 // Event contains information passed to the audit logger as part of an
 // audit logging event.
 type Event struct {
@@ -66,13 +151,118 @@ type Event struct {
 	// Principal is the identity of the caller. Currently it will only be
 	// available in certificate-based TLS authentication.
 	Principal string
+	// PeerAddress is the network address of the caller, in the form the
+	// transport reports, e.g. "10.0.0.1:52341", joining audit events with
+	// network-level telemetry. It is empty when the connection carries no
+	// peer address, e.g. on in-memory test listeners.
+	PeerAddress string
+	// PrincipalSource names the source that resolved Principal when the
+	// engine is configured with multiple principal sources. It is empty
+	// otherwise.
+	PrincipalSource string
+	// CertFingerprintSHA256 is the SHA-256 fingerprint of the caller's leaf
+	// certificate, as lowercase hex over its DER encoding. It is empty when
+	// the connection is not authenticated with a client certificate.
+	CertFingerprintSHA256 string
+	// CertificateSubject is the subject distinguished name of the caller's
+	// leaf certificate, in RFC 2253 form. It is empty when the connection is
+	// not authenticated with a client certificate. It complements the
+	// SPIFFE-derived Principal for callers whose certificates carry a
+	// meaningful subject but no URI SAN.
+	CertificateSubject string
+	// Country is the ISO 3166-1 alpha-2 country code the peer IP resolves
+	// to. It is only populated when a GeoIP resolver is configured and the
+	// lookup succeeds.
+	Country string
 	// PolicyName is the authorization policy name or the xDS RBAC filter name.
 	PolicyName string
+	// PolicyHash is a stable hash of the active policy, computed once per
+	// loaded policy, so analysts can verify every fleet member runs the
+	// identical policy. It is empty for engines that don't populate it, such
+	// as the xDS RBAC filter.
+	PolicyHash string
 	// MatchedRule is the matched rule or policy name in the xDS RBAC filter.
 	// It will be empty if there is no match.
 	MatchedRule string
+	// MatchedRuleIndex is the zero-based position of the matched rule within
+	// its allow, warn or deny list, disambiguating rules sharing a name. It
+	// is -1 when no policy rule matched, and 0 for events emitted by engines
+	// that don't populate it, such as the xDS RBAC filter.
+	MatchedRuleIndex int
 	// Authorized indicates whether the audited RPC is authorized or not.
 	Authorized bool
+	// Outcome refines Authorized with one of the Outcome constants. In
+	// particular it distinguishes RPCs allowed by a warn rule from regular
+	// allows. It may be empty for events emitted by engines that don't
+	// populate it, such as the xDS RBAC filter.
+	Outcome string
+	// EventType distinguishes supplemental events, such as the stream
+	// lifecycle events, from authorization decision events. It is empty for
+	// decision events.
+	EventType string
+	// CorrelationID joins related events, such as the open and close events
+	// of a single audited stream. It is empty when no correlation applies.
+	CorrelationID string
+	// StreamDuration is how long an audited stream was open. It is only set
+	// on stream close events.
+	StreamDuration time.Duration
+	// Latency is how long the engine spent evaluating the policy for this
+	// RPC, from interceptor entry to decision. It covers only the authz
+	// work, not the RPC itself, and is measured on the monotonic clock. It
+	// is zero on events emitted outside the decision path, such as stream
+	// lifecycle events.
+	Latency time.Duration
+	// StatusCode is the terminal status of the audited RPC as far as the
+	// engine observed it: the status returned to the client on denied
+	// decision events, the handler's final status on stream close and
+	// post-handler result events, and OK on allowed decision events, whose
+	// handler outcome is not observed unless post-handler auditing is
+	// enabled.
+	StatusCode codes.Code
+	// ResultCode and ResultMessage are the final status the handler returned
+	// for an allowed RPC, turning the audit log into a combined authz and
+	// access log. They are only meaningful on EventTypeResult events, emitted
+	// when the engine is configured to audit after handler completion, and
+	// stay zero-valued otherwise.
+	ResultCode    codes.Code
+	ResultMessage string
+	// DeadlineMillis is the time remaining until the audited RPC's deadline,
+	// in milliseconds, rounded up to at least 1. It is -1 when the RPC has no
+	// deadline and 0 when deadline auditing is not enabled.
+	DeadlineMillis int64
+	// Labels carries additional context attached by an event enricher, such
+	// as the team owning the calling principal. It is nil when no enricher is
+	// configured.
+	Labels map[string]string
+	// ForensicHeaders is a dump of the request headers attached to a sampled
+	// subset of denial events when forensic denial sampling is enabled. Values
+	// under sensitive keys are redacted like Metadata. It is nil on events
+	// that were not sampled.
+	ForensicHeaders map[string][]string
+	// Metadata is a snapshot of the request metadata, populated by
+	// deployments that capture it, e.g. through the interceptor's metadata
+	// allowlist option or an event enricher. Values
+	// under keys the interceptor considers sensitive, such as
+	// "authorization", are redacted before the event reaches loggers. It is
+	// nil when no metadata was captured.
+	Metadata map[string][]string
+	// TraceID and SpanID are the hex-encoded OpenTelemetry trace and span IDs
+	// of the audited RPC, joining audit events with distributed traces. They
+	// are empty when the RPC context carries no valid span context.
+	TraceID string
+	SpanID  string
+	// Sequence is the process-wide monotonic sequence number of the event,
+	// assigned atomically by the engine in emission order starting at 1, so a
+	// consumer observing a gap knows events were dropped. Emission order may
+	// differ from decision order when loggers deliver asynchronously; wrap
+	// sinks with NewOrderedAsyncLogger when gap detection matters, so events
+	// arrive in sequence order. It is zero on events not emitted by the
+	// engine.
+	Sequence uint64
+	// RunID identifies the process run the sequence belongs to. It is fixed
+	// for the lifetime of the process, so a consumer seeing a new RunID knows
+	// the sequence restarted rather than that events were lost.
+	RunID string
 }
 
 // LoggerConfig represents an opaque data structure holding an audit
@@ -100,6 +290,50 @@ type Logger interface {
 	Log(*Event)
 }
 
+// FallibleLogger is an optional interface for loggers that can report
+// delivery failures, such as loggers writing to a network sink. Engines that
+// are configured to fail closed on audit logging errors invoke LogWithError
+// instead of Log for loggers implementing it; plain loggers are assumed to
+// have handled any failure internally.
+type FallibleLogger interface {
+	Logger
+
+	// LogWithError performs audit logging for the provided audit event and
+	// reports whether the event was accepted for delivery. Like Log, it is
+	// invoked in the RPC path and must not block.
+	LogWithError(*Event) error
+}
+
+// HealthChecker is an optional interface for loggers that can verify their
+// sink is usable, such as loggers writing to a network backend. Engines call
+// HealthCheck while constructing an interceptor: a failing mandatory logger
+// fails construction, so misconfigured sinks surface at startup rather than
+// at the first audited RPC, while a failing optional logger only produces a
+// warning.
+type HealthChecker interface {
+	// HealthCheck reports whether the logger can currently deliver events.
+	// It must be cheap — at most one round trip to the backend — as it may
+	// be called on every policy reload.
+	HealthCheck() error
+}
+
+// Closer is an optional interface for loggers that buffer events or hold
+// resources such as file handles or network connections. Engines invoke
+// Close on loggers implementing it when the policy owning them is replaced,
+// e.g. by a file-watcher reload, and when the interceptor is torn down, so
+// buffered events are flushed rather than dropped on shutdown. Loggers that
+// do not implement the method need no shutdown and are treated as no-ops;
+// loggers exposing the plain Close() shape without an error, such as the
+// built-in sink loggers, are closed the same way.
+type Closer interface {
+	Logger
+
+	// Close flushes any buffered events and releases the logger's
+	// resources. It is called at most once, and no Log call is made to the
+	// logger after Close returns.
+	Close() error
+}
+
 // LoggerBuilder is the interface to be implemented by audit logger
 // builders that are used at runtime to configure and instantiate audit loggers.
 //
@@ -26,6 +26,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,6 +36,7 @@ import (
 	"google.golang.org/grpc/authz/audit"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/internal/grpctest"
 	"google.golang.org/grpc/internal/stubserver"
 	testgrpc "google.golang.org/grpc/interop/grpc_testing"
@@ -375,3 +377,129 @@ func loadCACerts(t *testing.T, certPath string) *x509.CertPool {
 	}
 	return roots
 }
+
+// recordingLogger is an audit logger that appends every received event to an
+// internal slice.
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []*audit.Event
+}
+
+func (l *recordingLogger) Log(event *audit.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e := *event
+	l.events = append(l.events, &e)
+}
+
+func (l *recordingLogger) Events() []*audit.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*audit.Event(nil), l.events...)
+}
+
+type recordingLoggerBuilder struct {
+	logger *recordingLogger
+}
+
+func (*recordingLoggerBuilder) Name() string {
+	return "recording_logger"
+}
+
+func (lb *recordingLoggerBuilder) Build(audit.LoggerConfig) audit.Logger {
+	return lb.logger
+}
+
+func (*recordingLoggerBuilder) ParseLoggerConfig(json.RawMessage) (audit.LoggerConfig, error) {
+	return nil, nil
+}
+
+// TestStreamLifecycleAudit verifies that the WithStreamLifecycleAudit option
+// emits an "open" and a "close" event per authorized stream, sharing a
+// correlation ID.
+func (s) TestStreamLifecycleAudit(t *testing.T) {
+	authzPolicy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_all"
+			}
+		],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY_AND_ALLOW",
+			"audit_loggers": [
+				{
+					"name": "recording_logger"
+				}
+			]
+		}
+	}`
+	rl := &recordingLogger{}
+	audit.RegisterLoggerBuilder(&recordingLoggerBuilder{logger: rl})
+	i, err := authz.NewStatic(authzPolicy, authz.WithStreamLifecycleAudit())
+	if err != nil {
+		t.Fatalf("authz.NewStatic(%v) failed: %v", authzPolicy, err)
+	}
+
+	ss := &stubserver.StubServer{
+		FullDuplexCallF: func(stream testgrpc.TestService_FullDuplexCallServer) error {
+			_, err := stream.Recv()
+			if err != io.EOF {
+				return err
+			}
+			return nil
+		},
+	}
+	s := grpc.NewServer(grpc.ChainStreamInterceptor(i.StreamInterceptor))
+	defer s.Stop()
+	testgrpc.RegisterTestServiceServer(s, ss)
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	go s.Serve(lis)
+
+	clientConn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.Dial(%v) failed: %v", lis.Addr().String(), err)
+	}
+	defer clientConn.Close()
+	client := testgrpc.NewTestServiceClient(clientConn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.FullDuplexCall(ctx)
+	if err != nil {
+		t.Fatalf("FullDuplexCall failed: %v", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("stream.CloseSend failed: %v", err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("stream.Recv() = %v, want io.EOF", err)
+	}
+
+	events := rl.Events()
+	if len(events) != 2 {
+		t.Fatalf("Got %d audit events, want 2: %+v", len(events), events)
+	}
+	open, closeEvent := events[0], events[1]
+	if open.EventType != audit.EventTypeStreamOpen {
+		t.Errorf("events[0].EventType = %q, want %q", open.EventType, audit.EventTypeStreamOpen)
+	}
+	if closeEvent.EventType != audit.EventTypeStreamClose {
+		t.Errorf("events[1].EventType = %q, want %q", closeEvent.EventType, audit.EventTypeStreamClose)
+	}
+	if open.CorrelationID == "" || open.CorrelationID != closeEvent.CorrelationID {
+		t.Errorf("Correlation IDs do not join the events: open %q, close %q", open.CorrelationID, closeEvent.CorrelationID)
+	}
+	if !open.Authorized || !closeEvent.Authorized {
+		t.Errorf("Lifecycle events should be authorized: open %v, close %v", open.Authorized, closeEvent.Authorized)
+	}
+	if closeEvent.StreamDuration <= 0 {
+		t.Errorf("events[1].StreamDuration = %v, want > 0", closeEvent.StreamDuration)
+	}
+	if closeEvent.StatusCode != codes.OK {
+		t.Errorf("events[1].StatusCode = %v, want %v", closeEvent.StatusCode, codes.OK)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package audittest provides test helpers for authors of audit logger
+// implementations.
+package audittest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/codes"
+)
+
+// RunBuilderConformance exercises the builder against the audit.LoggerBuilder
+// contract: Name is non-empty, ParseLoggerConfig handles nil and empty JSON
+// configs without panicking, Build returns a non-nil logger for every config
+// ParseLoggerConfig accepts, and the logger's Log tolerates zero-value and
+// fully populated events. Logger authors can call it from their own tests as
+// a drop-in contract check.
+//
+// Builders requiring a non-empty config may reject the nil and empty configs
+// with an error; that is treated as conforming and Build is not called for
+// the rejected config.
+func RunBuilderConformance(t *testing.T, builder audit.LoggerBuilder) {
+	t.Helper()
+	if builder.Name() == "" {
+		t.Error("builder.Name() is empty")
+	}
+	configs := map[string]json.RawMessage{
+		"nil config":   nil,
+		"empty config": json.RawMessage("{}"),
+	}
+	events := []*audit.Event{
+		{},
+		{
+			FullMethodName: "/pkg.Service/Method",
+			Principal:      "spiffe://example.org/ns/default/sa/default/backend",
+			PolicyName:     "example-policy",
+			MatchedRule:    "example-policy_rule",
+			Authorized:     true,
+			Outcome:        audit.OutcomeAllow,
+			EventType:      audit.EventTypeStreamClose,
+			CorrelationID:  "conformance-correlation-id",
+			StreamDuration: time.Second,
+			StatusCode:     codes.OK,
+			DeadlineMillis: 1000,
+		},
+	}
+	for name, config := range configs {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("builder panicked: %v", r)
+				}
+			}()
+			parsed, err := builder.ParseLoggerConfig(config)
+			if err != nil {
+				// Builders may require configuration; rejecting the config
+				// with an error conforms to the contract.
+				t.Logf("ParseLoggerConfig(%s) rejected the config: %v", config, err)
+				return
+			}
+			logger := builder.Build(parsed)
+			if logger == nil {
+				t.Fatalf("builder.Build() returned a nil logger for a config accepted by ParseLoggerConfig(%s)", config)
+			}
+			for _, event := range events {
+				logger.Log(event)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion identifies the canonical audit event JSON schema produced by
+// MarshalJSON. It is bumped whenever an existing field changes meaning or
+// shape; adding optional fields does not bump it.
+const SchemaVersion = "v1"
+
+// jsonEvent is the wire shape of the canonical audit event JSON schema.
+type jsonEvent struct {
+	Version          string              `json:"version"`
+	RPCMethod        string              `json:"rpc_method"`
+	Principal        string              `json:"principal"`
+	PeerAddress      string              `json:"peer_address,omitempty"`
+	PrincipalSource  string              `json:"principal_source,omitempty"`
+	CertFingerprint  string              `json:"cert_fingerprint_sha256,omitempty"`
+	CertSubject      string              `json:"certificate_subject,omitempty"`
+	Country          string              `json:"country,omitempty"`
+	PolicyName       string              `json:"policy_name"`
+	PolicyHash       string              `json:"policy_hash,omitempty"`
+	MatchedRule      string              `json:"matched_rule"`
+	MatchedRuleIndex int                 `json:"matched_rule_index"`
+	Authorized       bool                `json:"authorized"`
+	Outcome          string              `json:"outcome,omitempty"`
+	EventType        string              `json:"event_type,omitempty"`
+	CorrelationID    string              `json:"correlation_id,omitempty"`
+	StreamDuration   int64               `json:"stream_duration_ms,omitempty"`
+	LatencyNanos     int64               `json:"latency_nanos,omitempty"`
+	StatusCode       string              `json:"status_code,omitempty"`
+	NumericStatus    uint32              `json:"status_code_value"`
+	ResultCode       string              `json:"result_code,omitempty"`
+	ResultMessage    string              `json:"result_message,omitempty"`
+	DeadlineMillis   int64               `json:"deadline_millis,omitempty"`
+	Labels           map[string]string   `json:"labels,omitempty"`
+	ForensicHeaders  map[string][]string `json:"forensic_headers,omitempty"`
+	Metadata         map[string][]string `json:"metadata,omitempty"`
+	TraceID          string              `json:"trace_id,omitempty"`
+	SpanID           string              `json:"span_id,omitempty"`
+	Sequence         uint64              `json:"seq,omitempty"`
+	RunID            string              `json:"run_id,omitempty"`
+	Timestamp        any                 `json:"timestamp"`
+}
+
+// Timestamp formats accepted by loggers that expose a "timestamp_format"
+// config field. The JSON type of the "timestamp" field follows the format —
+// a string for RFC 3339, a number for Unix microseconds — so a downstream
+// schema keyed on one format is never fed the other type.
+const (
+	// TimestampFormatRFC3339 emits "timestamp" as an RFC 3339 string with
+	// nanoseconds. This is the default.
+	TimestampFormatRFC3339 = "RFC3339"
+	// TimestampFormatUnixMicros emits "timestamp" as an integer count of
+	// microseconds since the Unix epoch, for analytics backends such as
+	// BigQuery whose schemas want numeric timestamps.
+	TimestampFormatUnixMicros = "UnixMicros"
+)
+
+// JSONMarshalerForTimestampFormat returns a MarshalJSON variant emitting the
+// "timestamp" field in the named format; an empty format selects
+// TimestampFormatRFC3339. It returns an error for unknown formats, so logger
+// builders can validate a "timestamp_format" config field at parse time.
+func JSONMarshalerForTimestampFormat(format string) (func(*Event) ([]byte, error), error) {
+	switch format {
+	case "", TimestampFormatRFC3339:
+		return MarshalJSON, nil
+	case TimestampFormatUnixMicros:
+		return marshalJSONUnixMicros, nil
+	}
+	return nil, fmt.Errorf(`unsupported timestamp format %q, must be %q or %q`, format, TimestampFormatRFC3339, TimestampFormatUnixMicros)
+}
+
+// MarshalJSON serializes the event into the canonical, versioned JSON
+// representation shared by the built-in audit loggers, so consumers parse one
+// stable schema regardless of sink. The representation is a single JSON
+// object with the following fields:
+//
+//   - "version": the schema version, currently "v1"
+//   - "rpc_method", "principal", "policy_name", "matched_rule", "authorized":
+//     the corresponding Event fields
+//   - "peer_address": the caller's network address, omitted when the
+//     connection carries none
+//   - "principal_source", "outcome", "event_type", "correlation_id": the
+//     corresponding Event fields, omitted when empty
+//   - "cert_fingerprint_sha256": CertFingerprintSHA256, omitted when empty
+//   - "certificate_subject": the subject DN of the caller's certificate,
+//     omitted when empty
+//   - "country": the GeoIP-resolved peer country, omitted when empty
+//   - "policy_hash": the stable hash of the active policy, omitted when empty
+//   - "matched_rule_index": the zero-based position of the matched rule
+//     within its rule list, or -1 when no rule matched
+//   - "stream_duration_ms": StreamDuration in milliseconds, omitted when zero
+//   - "latency_nanos": Latency in nanoseconds, the time spent on policy
+//     evaluation alone; omitted when zero
+//   - "status_code": the string form of StatusCode, only set on stream close
+//     events
+//   - "status_code_value": the numeric terminal status of the RPC as the
+//     engine observed it — the denial status on denied events, the handler's
+//     status on stream close and result events, and 0 (OK) on allowed
+//     decision events
+//   - "result_code", "result_message": the string form of ResultCode and the
+//     ResultMessage, only set on post-handler result events
+//   - "deadline_millis": DeadlineMillis, omitted when not recorded
+//   - "labels": the enricher-attached labels, omitted when empty
+//   - "forensic_headers": the sampled header dump of a denial, omitted when
+//     the event was not sampled
+//   - "metadata": the captured request metadata, omitted when empty
+//   - "trace_id", "span_id": the OpenTelemetry trace context, omitted when
+//     empty
+//   - "seq", "run_id": the process-wide emission sequence number and the run
+//     it belongs to, for gap and restart detection; omitted on events the
+//     engine did not stamp
+//   - "timestamp": the marshaling time in RFC 3339 format with nanoseconds
+func MarshalJSON(event *Event) ([]byte, error) {
+	return marshalJSON(event, time.Now().Format(time.RFC3339Nano))
+}
+
+// MarshalJSONAtTime is MarshalJSON with the "timestamp" field taken from t
+// instead of the wall clock, so loggers with an injectable clock can produce
+// byte-exact deterministic output in tests. Everything else about the
+// representation is unchanged.
+func MarshalJSONAtTime(event *Event, t time.Time) ([]byte, error) {
+	return marshalJSON(event, t.Format(time.RFC3339Nano))
+}
+
+// marshalJSONUnixMicros is MarshalJSON with the timestamp as integer Unix
+// microseconds.
+func marshalJSONUnixMicros(event *Event) ([]byte, error) {
+	return marshalJSON(event, time.Now().UnixMicro())
+}
+
+func marshalJSON(event *Event, timestamp any) ([]byte, error) {
+	e := &jsonEvent{
+		Version:          SchemaVersion,
+		RPCMethod:        event.FullMethodName,
+		Principal:        event.Principal,
+		PeerAddress:      event.PeerAddress,
+		PrincipalSource:  event.PrincipalSource,
+		CertFingerprint:  event.CertFingerprintSHA256,
+		CertSubject:      event.CertificateSubject,
+		Country:          event.Country,
+		PolicyName:       event.PolicyName,
+		PolicyHash:       event.PolicyHash,
+		MatchedRule:      event.MatchedRule,
+		MatchedRuleIndex: event.MatchedRuleIndex,
+		Authorized:       event.Authorized,
+		Outcome:          event.Outcome,
+		EventType:        event.EventType,
+		CorrelationID:    event.CorrelationID,
+		StreamDuration:   event.StreamDuration.Milliseconds(),
+		LatencyNanos:     event.Latency.Nanoseconds(),
+		NumericStatus:    uint32(event.StatusCode),
+		DeadlineMillis:   event.DeadlineMillis,
+		Labels:           event.Labels,
+		ForensicHeaders:  event.ForensicHeaders,
+		Metadata:         event.Metadata,
+		TraceID:          event.TraceID,
+		SpanID:           event.SpanID,
+		Sequence:         event.Sequence,
+		RunID:            event.RunID,
+		Timestamp:        timestamp,
+	}
+	if event.EventType == EventTypeStreamClose {
+		e.StatusCode = event.StatusCode.String()
+	}
+	if event.EventType == EventTypeResult {
+		e.ResultCode = event.ResultCode.String()
+		e.ResultMessage = event.ResultMessage
+	}
+	return json.Marshal(e)
+}
@@ -0,0 +1,87 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/codes"
+)
+
+// TestMarshalJSON pins down the canonical audit event JSON schema shared by
+// the built-in loggers.
+func (s) TestMarshalJSON(t *testing.T) {
+	tests := map[string]struct {
+		event *audit.Event
+		want  string
+	}{
+		"decision event": {
+			event: &audit.Event{
+				FullMethodName: "/helloworld.Greeter/SayHello",
+				Principal:      "spiffe://example.org/ns/default/sa/default/backend",
+				PolicyName:     "example-policy",
+				MatchedRule:    "dev-access",
+				Authorized:     true,
+				Outcome:        audit.OutcomeAllow,
+			},
+			want: `{"version":"v1","rpc_method":"/helloworld.Greeter/SayHello",` +
+				`"principal":"spiffe://example.org/ns/default/sa/default/backend","policy_name":"example-policy",` +
+				`"matched_rule":"dev-access","matched_rule_index":0,"authorized":true,"outcome":"allow"`,
+		},
+		"stream close event": {
+			event: &audit.Event{
+				FullMethodName: "/helloworld.Greeter/Chat",
+				PolicyName:     "example-policy",
+				Authorized:     true,
+				Outcome:        audit.OutcomeAllow,
+				EventType:      audit.EventTypeStreamClose,
+				CorrelationID:  "id-1",
+				StreamDuration: 1500 * time.Millisecond,
+				StatusCode:     codes.Canceled,
+			},
+			want: `{"version":"v1","rpc_method":"/helloworld.Greeter/Chat","principal":"",` +
+				`"policy_name":"example-policy","matched_rule":"","matched_rule_index":0,"authorized":true,"outcome":"allow",` +
+				`"event_type":"close","correlation_id":"id-1","stream_duration_ms":1500,"status_code":"Canceled"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := audit.MarshalJSON(test.event)
+			if err != nil {
+				t.Fatalf("MarshalJSON() failed: %v", err)
+			}
+			if !strings.HasPrefix(string(got), test.want) {
+				t.Errorf("MarshalJSON() = %s, want prefix %s", got, test.want)
+			}
+			var parsed struct {
+				Timestamp string `json:"timestamp"`
+			}
+			if err := json.Unmarshal(got, &parsed); err != nil {
+				t.Fatalf("Failed to unmarshal canonical event: %v", err)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, parsed.Timestamp); err != nil {
+				t.Errorf("Canonical event timestamp %q is not RFC 3339: %v", parsed.Timestamp, err)
+			}
+		})
+	}
+}
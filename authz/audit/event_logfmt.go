@@ -0,0 +1,57 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalLogfmt serializes the event into a single logfmt-style key=value
+// line, for ingestion tooling that cannot parse JSON. Unlike the canonical
+// JSON schema it carries only the core decision fields: fullMethodName,
+// principal, policyName, matchedRule, authorized and timestamp. Values
+// containing spaces, equals signs or quotes are quoted with Go string
+// escaping; the line has no trailing newline.
+func MarshalLogfmt(event *Event) ([]byte, error) {
+	var b bytes.Buffer
+	logfmtField(&b, "fullMethodName", event.FullMethodName)
+	logfmtField(&b, "principal", event.Principal)
+	logfmtField(&b, "policyName", event.PolicyName)
+	logfmtField(&b, "matchedRule", event.MatchedRule)
+	logfmtField(&b, "authorized", strconv.FormatBool(event.Authorized))
+	logfmtField(&b, "timestamp", time.Now().Format(time.RFC3339Nano))
+	return b.Bytes(), nil
+}
+
+// logfmtField appends a key=value pair, quoting the value when it is empty
+// or contains characters that would break key=value parsing.
+func logfmtField(b *bytes.Buffer, key, value string) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(key)
+	b.WriteByte('=')
+	if value == "" || strings.ContainsAny(value, " =\"") {
+		value = strconv.Quote(value)
+	}
+	b.WriteString(value)
+}
@@ -0,0 +1,258 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Format names accepted by loggers that support configurable event
+// serialization through a "format" config field.
+const (
+	// FormatJSON is the canonical JSON representation produced by
+	// MarshalJSON. It is the default.
+	FormatJSON = "json"
+	// FormatMsgpack is the msgpack representation produced by
+	// MarshalMsgpack.
+	FormatMsgpack = "msgpack"
+	// FormatLogfmt is the key=value line representation produced by
+	// MarshalLogfmt.
+	FormatLogfmt = "logfmt"
+)
+
+// MarshalerForFormat returns the event marshaler for the named format; an
+// empty name selects JSON. Loggers with a "format" config field should
+// resolve it through this function so format names and errors stay uniform
+// across loggers.
+func MarshalerForFormat(format string) (func(*Event) ([]byte, error), error) {
+	switch format {
+	case "", FormatJSON:
+		return MarshalJSON, nil
+	case FormatMsgpack:
+		return MarshalMsgpack, nil
+	case FormatLogfmt:
+		return MarshalLogfmt, nil
+	}
+	return nil, fmt.Errorf(`unsupported audit event format %q, must be %q, %q or %q`, format, FormatJSON, FormatMsgpack, FormatLogfmt)
+}
+
+// MarshalMsgpack serializes the event into msgpack, for log stores that are
+// msgpack-native and would pay a size and parse penalty for JSON. The
+// representation is a single msgpack map with the same string keys, values
+// and omission rules as the canonical JSON schema produced by MarshalJSON,
+// including the "version" field, so it is self-describing and decodable by
+// any msgpack library without a side-channel schema.
+func MarshalMsgpack(event *Event) ([]byte, error) {
+	var e msgpackEncoder
+	e.str("version", SchemaVersion)
+	e.str("rpc_method", event.FullMethodName)
+	e.str("principal", event.Principal)
+	e.strOmitEmpty("peer_address", event.PeerAddress)
+	e.strOmitEmpty("principal_source", event.PrincipalSource)
+	e.strOmitEmpty("cert_fingerprint_sha256", event.CertFingerprintSHA256)
+	e.strOmitEmpty("certificate_subject", event.CertificateSubject)
+	e.strOmitEmpty("country", event.Country)
+	e.str("policy_name", event.PolicyName)
+	e.strOmitEmpty("policy_hash", event.PolicyHash)
+	e.str("matched_rule", event.MatchedRule)
+	e.integer("matched_rule_index", int64(event.MatchedRuleIndex))
+	e.boolean("authorized", event.Authorized)
+	e.strOmitEmpty("outcome", event.Outcome)
+	e.strOmitEmpty("event_type", event.EventType)
+	e.strOmitEmpty("correlation_id", event.CorrelationID)
+	e.intOmitZero("stream_duration_ms", event.StreamDuration.Milliseconds())
+	e.intOmitZero("latency_nanos", event.Latency.Nanoseconds())
+	if event.EventType == EventTypeStreamClose {
+		e.str("status_code", event.StatusCode.String())
+	}
+	e.integer("status_code_value", int64(event.StatusCode))
+	if event.EventType == EventTypeResult {
+		e.str("result_code", event.ResultCode.String())
+		e.strOmitEmpty("result_message", event.ResultMessage)
+	}
+	e.intOmitZero("deadline_millis", event.DeadlineMillis)
+	e.labels("labels", event.Labels)
+	e.multimap("forensic_headers", event.ForensicHeaders)
+	e.multimap("metadata", event.Metadata)
+	e.strOmitEmpty("trace_id", event.TraceID)
+	e.strOmitEmpty("span_id", event.SpanID)
+	e.intOmitZero("seq", int64(event.Sequence))
+	e.strOmitEmpty("run_id", event.RunID)
+	e.str("timestamp", time.Now().Format(time.RFC3339Nano))
+	return e.finish(), nil
+}
+
+// msgpackEncoder accumulates the key-value pairs of a msgpack map. The map
+// header depends on the number of pairs, so pairs are buffered and the header
+// is prepended by finish.
+type msgpackEncoder struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (e *msgpackEncoder) str(key, v string) {
+	e.writeString(key)
+	e.writeString(v)
+	e.n++
+}
+
+func (e *msgpackEncoder) strOmitEmpty(key, v string) {
+	if v != "" {
+		e.str(key, v)
+	}
+}
+
+func (e *msgpackEncoder) boolean(key string, v bool) {
+	e.writeString(key)
+	if v {
+		e.buf.WriteByte(0xc3)
+	} else {
+		e.buf.WriteByte(0xc2)
+	}
+	e.n++
+}
+
+func (e *msgpackEncoder) integer(key string, v int64) {
+	e.writeString(key)
+	e.writeInt(v)
+	e.n++
+}
+
+func (e *msgpackEncoder) intOmitZero(key string, v int64) {
+	if v == 0 {
+		return
+	}
+	e.integer(key, v)
+}
+
+func (e *msgpackEncoder) labels(key string, v map[string]string) {
+	if len(v) == 0 {
+		return
+	}
+	e.writeString(key)
+	e.writeMapHeader(len(v))
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.writeString(k)
+		e.writeString(v[k])
+	}
+	e.n++
+}
+
+func (e *msgpackEncoder) multimap(key string, v map[string][]string) {
+	if len(v) == 0 {
+		return
+	}
+	e.writeString(key)
+	e.writeMapHeader(len(v))
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		e.writeString(k)
+		e.writeArrayHeader(len(v[k]))
+		for _, value := range v[k] {
+			e.writeString(value)
+		}
+	}
+	e.n++
+}
+
+func (e *msgpackEncoder) finish() []byte {
+	var hdr msgpackEncoder
+	hdr.writeMapHeader(e.n)
+	return append(hdr.buf.Bytes(), e.buf.Bytes()...)
+}
+
+func (e *msgpackEncoder) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x80 | byte(n))
+	case n < 65536:
+		e.buf.WriteByte(0xde)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		e.buf.Write(b[:])
+	default:
+		e.buf.WriteByte(0xdf)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		e.buf.Write(b[:])
+	}
+}
+
+func (e *msgpackEncoder) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x90 | byte(n))
+	case n < 65536:
+		e.buf.WriteByte(0xdc)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		e.buf.Write(b[:])
+	default:
+		e.buf.WriteByte(0xdd)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		e.buf.Write(b[:])
+	}
+}
+
+func (e *msgpackEncoder) writeString(s string) {
+	switch {
+	case len(s) < 32:
+		e.buf.WriteByte(0xa0 | byte(len(s)))
+	case len(s) < 256:
+		e.buf.WriteByte(0xd9)
+		e.buf.WriteByte(byte(len(s)))
+	case len(s) < 65536:
+		e.buf.WriteByte(0xda)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(len(s)))
+		e.buf.Write(b[:])
+	default:
+		e.buf.WriteByte(0xdb)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(len(s)))
+		e.buf.Write(b[:])
+	}
+	e.buf.WriteString(s)
+}
+
+func (e *msgpackEncoder) writeInt(v int64) {
+	if v >= -32 && v < 128 {
+		// Positive and negative fixints.
+		e.buf.WriteByte(byte(v))
+		return
+	}
+	e.buf.WriteByte(0xd3)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.buf.Write(b[:])
+}
@@ -0,0 +1,234 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/authz/audit"
+)
+
+// representativeEvent returns an event with the fields a typical production
+// decision event carries.
+func representativeEvent() *audit.Event {
+	return &audit.Event{
+		FullMethodName: "/helloworld.Greeter/SayHello",
+		Principal:      "spiffe://example.org/ns/default/sa/default/backend",
+		PolicyName:     "example-policy",
+		MatchedRule:    "dev-access",
+		Authorized:     true,
+		Outcome:        audit.OutcomeAllow,
+		TraceID:        "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:         "00f067aa0ba902b7",
+	}
+}
+
+// decodeMsgpackValue decodes a single msgpack value from b, covering the
+// subset of types MarshalMsgpack produces. It returns the value and the
+// remaining bytes.
+func decodeMsgpackValue(t *testing.T, b []byte) (any, []byte) {
+	t.Helper()
+	if len(b) == 0 {
+		t.Fatal("Unexpected end of msgpack data")
+	}
+	c := b[0]
+	b = b[1:]
+	readString := func(n int) (string, []byte) {
+		if len(b) < n {
+			t.Fatalf("Truncated msgpack string of length %d", n)
+		}
+		return string(b[:n]), b[n:]
+	}
+	switch {
+	case c <= 0x7f: // positive fixint
+		return int64(c), b
+	case c >= 0xe0: // negative fixint
+		return int64(int8(c)), b
+	case c >= 0xa0 && c <= 0xbf: // fixstr
+		s, rest := readString(int(c & 0x1f))
+		return s, rest
+	case c >= 0x80 && c <= 0x8f: // fixmap
+		return decodeMsgpackMap(t, b, int(c&0x0f))
+	case c >= 0x90 && c <= 0x9f: // fixarray
+		return decodeMsgpackArray(t, b, int(c&0x0f))
+	}
+	switch c {
+	case 0xc2:
+		return false, b
+	case 0xc3:
+		return true, b
+	case 0xd9: // str8
+		n := int(b[0])
+		b = b[1:]
+		s, rest := readString(n)
+		return s, rest
+	case 0xda: // str16
+		n := int(binary.BigEndian.Uint16(b[:2]))
+		b = b[2:]
+		s, rest := readString(n)
+		return s, rest
+	case 0xdb: // str32
+		n := int(binary.BigEndian.Uint32(b[:4]))
+		b = b[4:]
+		s, rest := readString(n)
+		return s, rest
+	case 0xd3: // int64
+		return int64(binary.BigEndian.Uint64(b[:8])), b[8:]
+	case 0xde: // map16
+		n := int(binary.BigEndian.Uint16(b[:2]))
+		return decodeMsgpackMap(t, b[2:], n)
+	}
+	t.Fatalf("Unsupported msgpack type byte %#x", c)
+	return nil, nil
+}
+
+func decodeMsgpackArray(t *testing.T, b []byte, n int) ([]any, []byte) {
+	t.Helper()
+	a := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		var v any
+		v, b = decodeMsgpackValue(t, b)
+		a = append(a, v)
+	}
+	return a, b
+}
+
+func decodeMsgpackMap(t *testing.T, b []byte, n int) (map[string]any, []byte) {
+	t.Helper()
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		var k, v any
+		k, b = decodeMsgpackValue(t, b)
+		v, b = decodeMsgpackValue(t, b)
+		ks, ok := k.(string)
+		if !ok {
+			t.Fatalf("Msgpack map key %v is not a string", k)
+		}
+		m[ks] = v
+	}
+	return m, b
+}
+
+// TestMarshalMsgpack verifies that the msgpack representation is a single
+// self-describing map carrying the canonical schema fields.
+func (s) TestMarshalMsgpack(t *testing.T) {
+	event := representativeEvent()
+	event.Labels = map[string]string{"team": "billing"}
+	event.DeadlineMillis = 250
+	got, err := audit.MarshalMsgpack(event)
+	if err != nil {
+		t.Fatalf("MarshalMsgpack() failed: %v", err)
+	}
+	decoded, rest := decodeMsgpackValue(t, got)
+	if len(rest) != 0 {
+		t.Fatalf("MarshalMsgpack() left %d undecoded trailing bytes", len(rest))
+	}
+	m, ok := decoded.(map[string]any)
+	if !ok {
+		t.Fatalf("MarshalMsgpack() produced a %T, want a map", decoded)
+	}
+	if _, ok := m["timestamp"].(string); !ok {
+		t.Errorf(`Decoded event "timestamp" = %v, want an RFC 3339 string`, m["timestamp"])
+	}
+	delete(m, "timestamp")
+	want := map[string]any{
+		"version":            audit.SchemaVersion,
+		"rpc_method":         "/helloworld.Greeter/SayHello",
+		"principal":          "spiffe://example.org/ns/default/sa/default/backend",
+		"policy_name":        "example-policy",
+		"matched_rule":       "dev-access",
+		"matched_rule_index": int64(0),
+		"authorized":         true,
+		"outcome":            "allow",
+		"status_code_value":  int64(0),
+		"deadline_millis":    int64(250),
+		"labels":             map[string]any{"team": "billing"},
+		"trace_id":           "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":            "00f067aa0ba902b7",
+	}
+	if diff := cmp.Diff(want, m); diff != "" {
+		t.Errorf("Decoded msgpack event mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestMarshalMsgpackLongString verifies that strings of 65536+ bytes, which
+// forensic header or metadata dumps can reach, round-trip through the str32
+// encoding instead of having their length truncated.
+func (s) TestMarshalMsgpackLongString(t *testing.T) {
+	event := representativeEvent()
+	long := strings.Repeat("x", 70000)
+	event.Metadata = map[string][]string{"dump": {long}}
+	got, err := audit.MarshalMsgpack(event)
+	if err != nil {
+		t.Fatalf("MarshalMsgpack() failed: %v", err)
+	}
+	decoded, rest := decodeMsgpackValue(t, got)
+	if len(rest) != 0 {
+		t.Fatalf("MarshalMsgpack() left %d undecoded trailing bytes", len(rest))
+	}
+	m, ok := decoded.(map[string]any)
+	if !ok {
+		t.Fatalf("MarshalMsgpack() produced a %T, want a map", decoded)
+	}
+	want := map[string]any{"dump": []any{long}}
+	if diff := cmp.Diff(want, m["metadata"]); diff != "" {
+		t.Errorf(`Decoded "metadata" mismatch (-want +got):\n%s`, diff)
+	}
+}
+
+// TestMarshalerForFormat verifies format name resolution and rejection of
+// unknown formats.
+func (s) TestMarshalerForFormat(t *testing.T) {
+	for _, format := range []string{"", audit.FormatJSON, audit.FormatMsgpack} {
+		if _, err := audit.MarshalerForFormat(format); err != nil {
+			t.Errorf("MarshalerForFormat(%q) failed: %v", format, err)
+		}
+	}
+	if _, err := audit.MarshalerForFormat("xml"); err == nil {
+		t.Error(`MarshalerForFormat("xml") succeeded, want error`)
+	}
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	benchmarkMarshal(b, audit.MarshalJSON)
+}
+
+func BenchmarkMarshalMsgpack(b *testing.B) {
+	benchmarkMarshal(b, audit.MarshalMsgpack)
+}
+
+// benchmarkMarshal reports encoding speed and, via the event_bytes metric,
+// the encoded size of a representative event for each format.
+func benchmarkMarshal(b *testing.B, marshal func(*audit.Event) ([]byte, error)) {
+	event := representativeEvent()
+	var size int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		out, err := marshal(event)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(out)
+	}
+	b.ReportMetric(float64(size), "event_bytes")
+}
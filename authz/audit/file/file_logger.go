@@ -0,0 +1,240 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package file defines an audit logger that writes audit events to a
+// dedicated file with size-based rotation, for log shippers that tail a
+// rotating file rather than a process's standard output.
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/grpclog"
+)
+
+var grpcLogger = grpclog.Component("authz-audit")
+
+// Name is the string to identify this logger type in the registry
+const Name = "file_logger"
+
+// defaultMaxSizeMB is the rotation threshold when "max_size_mb" is not
+// configured.
+const defaultMaxSizeMB = 100
+
+// defaultMaxBackups is how many rotated files are kept when "max_backups" is
+// not configured.
+const defaultMaxBackups = 1
+
+func init() {
+	audit.RegisterLoggerBuilder(&loggerBuilder{})
+}
+
+// loggerConfig represents the validated configuration for the file logger.
+type loggerConfig struct {
+	audit.LoggerConfig
+
+	path       string
+	maxSize    int64
+	maxBackups int
+}
+
+type config struct {
+	// Path is the file audit events are appended to, one canonical JSON
+	// event per line.
+	Path string `json:"path"`
+	// MaxSizeMB is the size in mebibytes from which the file is rotated.
+	// Defaults to 100.
+	MaxSizeMB int `json:"max_size_mb"`
+	// MaxBackups is how many rotated files are kept, named "<path>.1" for
+	// the most recent through "<path>.N" for the oldest; older ones are
+	// deleted. 0 deletes the file on rotation without keeping a backup.
+	// Defaults to 1.
+	MaxBackups *int `json:"max_backups"`
+}
+
+// logger implements the audit.Logger interface by appending one JSON event
+// per line to the configured file, rotating it when it exceeds the size
+// threshold. All file access is serialized by a mutex, so concurrent Log
+// calls never interleave lines.
+type logger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+	// warnedRotation suppresses repeated rotation failure warnings until a
+	// rotation succeeds again.
+	warnedRotation bool
+}
+
+// Log appends the serialized audit.Event to the file, rotating first when
+// the write would push the file past the size threshold. When rotation
+// fails, e.g. because a backup path is not writable, the event is appended
+// to the existing file instead — rotation failures never lose events — and
+// a warning is logged once until a rotation succeeds again.
+func (l *logger) Log(event *audit.Event) {
+	line, err := audit.MarshalJSON(event)
+	if err != nil {
+		grpcLogger.Errorf("failed to marshal AuditEvent data: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.ensureOpen(); err != nil {
+		grpcLogger.Errorf("failed to open audit log file %q: %v", l.path, err)
+		return
+	}
+	if l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			if !l.warnedRotation {
+				grpcLogger.Warningf("failed to rotate audit log file %q, continuing on the current file: %v", l.path, err)
+				l.warnedRotation = true
+			}
+		} else {
+			l.warnedRotation = false
+		}
+		if l.f == nil {
+			grpcLogger.Errorf("failed to reopen audit log file %q, dropping event for %v", l.path, event.FullMethodName)
+			return
+		}
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		grpcLogger.Errorf("failed to write to audit log file %q: %v", l.path, err)
+	}
+}
+
+// ensureOpen opens the file in append mode when it is not already open and
+// initializes the tracked size from the existing content.
+func (l *logger) ensureOpen() error {
+	if l.f != nil {
+		return nil
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f = f
+	l.size = st.Size()
+	return nil
+}
+
+// rotate closes the current file, shifts the numbered backups up by one —
+// deleting the oldest when the backup count is reached — renames the file to
+// "<path>.1" and opens a fresh one. On failure the original file is reopened
+// so the pending event is appended there.
+func (l *logger) rotate() error {
+	l.f.Close()
+	l.f = nil
+	backup := func(n int) string { return fmt.Sprintf("%s.%d", l.path, n) }
+	var rotateErr error
+	if l.maxBackups == 0 {
+		rotateErr = os.Remove(l.path)
+	} else {
+		os.Remove(backup(l.maxBackups))
+		for n := l.maxBackups - 1; n >= 1; n-- {
+			os.Rename(backup(n), backup(n+1))
+		}
+		rotateErr = os.Rename(l.path, backup(1))
+	}
+	if err := l.ensureOpen(); err != nil {
+		return err
+	}
+	return rotateErr
+}
+
+// Close implements audit.Closer: it closes the file after any in-flight
+// write. No Log call may be made after it returns.
+func (l *logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+// HealthCheck reports whether the configured file is writable by opening it
+// in append mode, so a misconfigured path surfaces at interceptor
+// construction rather than at the first audited RPC.
+func (l *logger) HealthCheck() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ensureOpen()
+}
+
+type loggerBuilder struct{}
+
+func (loggerBuilder) Name() string {
+	return Name
+}
+
+// Build returns a file logger for the parsed config. A nil or unexpected
+// config returns a no-op logger, since the file logger is unusable without a
+// path.
+func (*loggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	lc, ok := c.(*loggerConfig)
+	if !ok || lc.path == "" {
+		grpcLogger.Error("file logger built without a parsed config, audit events will be dropped")
+		return &logger{}
+	}
+	return &logger{path: lc.path, maxSize: lc.maxSize, maxBackups: lc.maxBackups}
+}
+
+// ParseLoggerConfig validates the "path", "max_size_mb" and "max_backups"
+// fields and applies the documented defaults.
+func (*loggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	var c config
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+		}
+	}
+	if c.Path == "" {
+		return nil, fmt.Errorf(`"path" must be specified`)
+	}
+	if c.MaxSizeMB < 0 {
+		return nil, fmt.Errorf(`"max_size_mb" must not be negative, got %d`, c.MaxSizeMB)
+	}
+	if c.MaxSizeMB == 0 {
+		c.MaxSizeMB = defaultMaxSizeMB
+	}
+	maxBackups := defaultMaxBackups
+	if c.MaxBackups != nil {
+		if *c.MaxBackups < 0 {
+			return nil, fmt.Errorf(`"max_backups" must not be negative, got %d`, *c.MaxBackups)
+		}
+		maxBackups = *c.MaxBackups
+	}
+	return &loggerConfig{path: c.Path, maxSize: int64(c.MaxSizeMB) << 20, maxBackups: maxBackups}, nil
+}
@@ -0,0 +1,141 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/internal/grpctest"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+func (s) TestFileLoggerWritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	builder := audit.GetLoggerBuilder(Name)
+	config, err := builder.ParseLoggerConfig(json.RawMessage(`{"path": "` + path + `"}`))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	built := builder.Build(config)
+	var wg sync.WaitGroup
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 25; k++ {
+				built.Log(&audit.Event{FullMethodName: "/pkg.Service/Api", PolicyName: "test", MatchedRule: "test_all", Authorized: true})
+			}
+		}()
+	}
+	wg.Wait()
+	if err := built.(audit.Closer).Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Opening the audit log failed: %v", err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v\n%s", lines, err, scanner.Text())
+		}
+		if event["rpc_method"] != "/pkg.Service/Api" {
+			t.Fatalf("Line %d rpc_method = %v, want /pkg.Service/Api", lines, event["rpc_method"])
+		}
+		lines++
+	}
+	if lines != 100 {
+		t.Errorf("Logged lines = %d, want 100", lines)
+	}
+}
+
+func (s) TestFileLoggerRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l := &logger{path: path, maxSize: 2048, maxBackups: 2}
+	defer l.Close()
+	event := &audit.Event{FullMethodName: "/pkg.Service/Api", PolicyName: "test", Authorized: true}
+	for n := 0; n < 100; n++ {
+		l.Log(event)
+	}
+	for _, backup := range []string{path + ".1", path + ".2"} {
+		if _, err := os.Stat(backup); err != nil {
+			t.Errorf("Backup %s does not exist: %v", backup, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("Backup %s exists, want at most 2 backups", path+".3")
+	}
+	st, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() of the current file failed: %v", err)
+	}
+	if st.Size() > 2048 {
+		t.Errorf("Current file size = %d, want at most 2048", st.Size())
+	}
+}
+
+func (s) TestFileLoggerConfigErrors(t *testing.T) {
+	builder := audit.GetLoggerBuilder(Name)
+	for name, raw := range map[string]string{
+		"missing path":         `{}`,
+		"negative max_size_mb": `{"path": "/tmp/audit.log", "max_size_mb": -1}`,
+		"negative max_backups": `{"path": "/tmp/audit.log", "max_backups": -1}`,
+		"malformed":            `{"path": 42}`,
+	} {
+		if _, err := builder.ParseLoggerConfig(json.RawMessage(raw)); err == nil {
+			t.Errorf("ParseLoggerConfig() with %s succeeded, want error", name)
+		}
+	}
+	if _, err := builder.ParseLoggerConfig(json.RawMessage(`{"path": "` + filepath.Join(t.TempDir(), "a.log") + `", "max_size_mb": 5, "max_backups": 0}`)); err != nil {
+		t.Errorf("ParseLoggerConfig() with a valid config failed: %v", err)
+	}
+}
+
+func (s) TestFileLoggerHealthCheck(t *testing.T) {
+	good := &logger{path: filepath.Join(t.TempDir(), "audit.log")}
+	defer good.Close()
+	if err := good.HealthCheck(); err != nil {
+		t.Errorf("HealthCheck() on a writable path failed: %v", err)
+	}
+	bad := &logger{path: filepath.Join(t.TempDir(), "missing", "audit.log")}
+	if err := bad.HealthCheck(); err == nil {
+		t.Error("HealthCheck() on an unwritable path succeeded, want error")
+	}
+	if !strings.Contains(filepath.Dir(bad.path), "missing") {
+		t.Fatal("test setup: expected a missing parent directory")
+	}
+}
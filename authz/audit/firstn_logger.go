@@ -0,0 +1,139 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// suppressionReportEvery is how often a suppressed event is still forwarded
+// to the delegate, so sustained conditions stay visible while suppressed.
+const suppressionReportEvery = 100
+
+// firstNKeyThreshold is the number of tracked keys above which idle keys are
+// swept from the suppression state.
+const firstNKeyThreshold = 1024
+
+// FirstNLogger wraps a delegate logger and forwards only the first n events
+// per (principal, method, decision) key within each window, surfacing new
+// patterns, such as a fresh denial source, without drowning the sink in
+// repeats.
+//
+// Windows are tracked per key and start at the key's first event; when a
+// window has elapsed the key's counters reset and the next n events are
+// forwarded again. While a key is suppressed, every suppressionReportEvery-th
+// event is still forwarded so long-running conditions remain visible.
+// Suppressed events are counted cumulatively and exposed through
+// SuppressedCount. A non-positive window never resets.
+type FirstNLogger struct {
+	delegate Logger
+	n        int
+	window   time.Duration
+
+	mu   sync.Mutex
+	keys map[firstNKey]*firstNState
+}
+
+type firstNKey struct {
+	principal  string
+	method     string
+	authorized bool
+}
+
+type firstNState struct {
+	windowStart time.Time
+	forwarded   int
+	// suppressedInWindow counts suppressed events in the current window;
+	// suppressedTotal counts them since the logger was created.
+	suppressedInWindow uint64
+	suppressedTotal    uint64
+	lastEvent          time.Time
+}
+
+// NewFirstNLogger returns a FirstNLogger forwarding at most n events per
+// (principal, method, decision) key per window to the delegate. Values of n
+// below 1 are treated as 1.
+func NewFirstNLogger(delegate Logger, n int, window time.Duration) *FirstNLogger {
+	if n < 1 {
+		n = 1
+	}
+	return &FirstNLogger{
+		delegate: delegate,
+		n:        n,
+		window:   window,
+		keys:     make(map[firstNKey]*firstNState),
+	}
+}
+
+// Log forwards the event to the delegate unless its key is suppressed.
+func (l *FirstNLogger) Log(event *Event) {
+	key := firstNKey{principal: event.Principal, method: event.FullMethodName, authorized: event.Authorized}
+	now := time.Now()
+	l.mu.Lock()
+	state := l.keys[key]
+	if state == nil {
+		l.maybeSweep(now)
+		state = &firstNState{windowStart: now}
+		l.keys[key] = state
+	} else if l.window > 0 && now.Sub(state.windowStart) >= l.window {
+		state.windowStart = now
+		state.forwarded = 0
+		state.suppressedInWindow = 0
+	}
+	state.lastEvent = now
+	forward := state.forwarded < l.n
+	if forward {
+		state.forwarded++
+	} else {
+		state.suppressedInWindow++
+		state.suppressedTotal++
+		// Keep sustained conditions visible with a periodic sample.
+		forward = state.suppressedInWindow%suppressionReportEvery == 0
+	}
+	l.mu.Unlock()
+	if forward {
+		l.delegate.Log(event)
+	}
+}
+
+// SuppressedCount returns the number of events suppressed for the given
+// (principal, method, decision) key since the logger was created.
+func (l *FirstNLogger) SuppressedCount(principal, method string, authorized bool) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state := l.keys[firstNKey{principal: principal, method: method, authorized: authorized}]
+	if state == nil {
+		return 0
+	}
+	return state.suppressedTotal
+}
+
+// maybeSweep drops keys that have been idle for at least a full window. The
+// caller must hold l.mu.
+func (l *FirstNLogger) maybeSweep(now time.Time) {
+	if l.window <= 0 || len(l.keys) <= firstNKeyThreshold {
+		return
+	}
+	for key, state := range l.keys {
+		if now.Sub(state.lastEvent) >= l.window {
+			delete(l.keys, key)
+		}
+	}
+}
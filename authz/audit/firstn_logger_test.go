@@ -0,0 +1,72 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+)
+
+// TestFirstNLogger verifies per-key suppression after n events, key
+// isolation, the suppressed-count getter and window resets.
+func (s) TestFirstNLogger(t *testing.T) {
+	rec := &recordingLogger{}
+	l := audit.NewFirstNLogger(rec, 2, time.Hour)
+	denied := &audit.Event{Principal: "alice", FullMethodName: "/pkg.Service/Api", Authorized: false}
+	for n := 0; n < 5; n++ {
+		l.Log(denied)
+	}
+	if got := len(rec.Events()); got != 2 {
+		t.Fatalf("Forwarded %d events for suppressed key, want 2", got)
+	}
+	if got := l.SuppressedCount("alice", "/pkg.Service/Api", false); got != 3 {
+		t.Fatalf("SuppressedCount() = %d, want 3", got)
+	}
+	// A different decision for the same principal and method is a distinct
+	// key.
+	l.Log(&audit.Event{Principal: "alice", FullMethodName: "/pkg.Service/Api", Authorized: true})
+	if got := len(rec.Events()); got != 3 {
+		t.Fatalf("Forwarded %d events after distinct key, want 3", got)
+	}
+	if got := l.SuppressedCount("alice", "/pkg.Service/Api", true); got != 0 {
+		t.Fatalf("SuppressedCount() for fresh key = %d, want 0", got)
+	}
+}
+
+func (s) TestFirstNLoggerWindowReset(t *testing.T) {
+	rec := &recordingLogger{}
+	l := audit.NewFirstNLogger(rec, 1, 10*time.Millisecond)
+	event := &audit.Event{Principal: "alice", FullMethodName: "/pkg.Service/Api"}
+	l.Log(event)
+	l.Log(event)
+	if got := len(rec.Events()); got != 1 {
+		t.Fatalf("Forwarded %d events before window reset, want 1", got)
+	}
+	time.Sleep(20 * time.Millisecond)
+	l.Log(event)
+	if got := len(rec.Events()); got != 2 {
+		t.Fatalf("Forwarded %d events after window reset, want 2", got)
+	}
+	// The cumulative suppressed count survives the reset.
+	if got := l.SuppressedCount("alice", "/pkg.Service/Api", false); got != 1 {
+		t.Fatalf("SuppressedCount() = %d, want 1", got)
+	}
+}
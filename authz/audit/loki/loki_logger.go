@@ -0,0 +1,273 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package loki defines an audit logger that pushes audit events to a Grafana
+// Loki server through its push API.
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/grpclog"
+)
+
+var grpcLogger = grpclog.Component("authz-audit")
+
+// Name is the string to identify this logger type in the registry
+const Name = "loki_logger"
+
+// eventBufferSize bounds the number of audit events waiting to be pushed.
+// Events are dropped, with a warning log, when the buffer is full so the RPC
+// path never blocks on the Loki server.
+const eventBufferSize = 256
+
+// flushTimeout bounds how long Close waits for buffered events to be pushed.
+const flushTimeout = 5 * time.Second
+
+// defaultBatchSize is the number of events per push when "batch_size" is not
+// configured.
+const defaultBatchSize = 100
+
+// defaultFlushInterval is how often a partial batch is pushed when
+// "flush_interval_ms" is not configured.
+const defaultFlushInterval = time.Second
+
+func init() {
+	audit.RegisterLoggerBuilder(&loggerBuilder{})
+}
+
+// loggerConfig represents the validated configuration for the Loki logger.
+type loggerConfig struct {
+	audit.LoggerConfig
+
+	url           string
+	labels        map[string]string
+	batchSize     int
+	flushInterval time.Duration
+}
+
+type config struct {
+	// URL is the full push endpoint of the Loki server, e.g.
+	// "http://localhost:3100/loki/api/v1/push".
+	URL string `json:"url"`
+	// Labels are the static stream labels attached to every pushed event, in
+	// addition to the dynamic "authorized" label.
+	Labels map[string]string `json:"labels"`
+	// BatchSize is the number of events per push; a partial batch is pushed
+	// when the flush interval elapses. Defaults to 100.
+	BatchSize int `json:"batch_size"`
+	// FlushIntervalMillis is how often partial batches are pushed, in
+	// milliseconds. Defaults to 1000.
+	FlushIntervalMillis int64 `json:"flush_interval_ms"`
+}
+
+// entry is one serialized event with its capture time, held until its batch
+// is pushed.
+type entry struct {
+	ts         time.Time
+	line       []byte
+	authorized bool
+}
+
+// logger implements the audit.Logger interface by batching serialized events
+// and pushing them to Loki's push API from a background goroutine.
+type logger struct {
+	cfg    *loggerConfig
+	client *http.Client
+
+	events chan *entry
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+// Log enqueues the audit event for pushing. It never blocks: when the buffer
+// is full the event is dropped and a warning is logged.
+func (l *logger) Log(event *audit.Event) {
+	line, err := audit.MarshalJSON(event)
+	if err != nil {
+		grpcLogger.Errorf("failed to marshal AuditEvent data: %v", err)
+		return
+	}
+	select {
+	case l.events <- &entry{ts: time.Now(), line: line, authorized: event.Authorized}:
+	default:
+		grpcLogger.Warningf("Loki audit logger buffer is full, dropping event for %v", event.FullMethodName)
+	}
+}
+
+// Close pushes buffered events and stops the background flusher. It waits at
+// most flushTimeout for the flush.
+func (l *logger) Close() {
+	l.closeOnce.Do(func() {
+		close(l.events)
+		select {
+		case <-l.done:
+		case <-time.After(flushTimeout):
+			grpcLogger.Warningf("Loki audit logger timed out flushing buffered events")
+		}
+	})
+}
+
+// run batches events and pushes them when a batch is full or the flush
+// interval elapses, then pushes the remainder when the event channel is
+// closed.
+func (l *logger) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.cfg.flushInterval)
+	defer ticker.Stop()
+	var batch []*entry
+	for {
+		select {
+		case e, ok := <-l.events:
+			if !ok {
+				l.push(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= l.cfg.batchSize {
+				l.push(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			l.push(batch)
+			batch = nil
+		}
+	}
+}
+
+// push POSTs the batch to the configured push endpoint, as one stream per
+// distinct label set. Push failures are logged and the batch is dropped, so
+// an unavailable Loki server never backs up into the RPC path.
+func (l *logger) push(batch []*entry) {
+	if len(batch) == 0 {
+		return
+	}
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	// Events split into at most two streams, by the dynamic "authorized"
+	// label.
+	streams := make(map[bool]*stream, 2)
+	for _, e := range batch {
+		s := streams[e.authorized]
+		if s == nil {
+			labels := make(map[string]string, len(l.cfg.labels)+1)
+			for k, v := range l.cfg.labels {
+				labels[k] = v
+			}
+			labels["authorized"] = strconv.FormatBool(e.authorized)
+			s = &stream{Stream: labels}
+			streams[e.authorized] = s
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), string(e.line)})
+	}
+	var payload struct {
+		Streams []*stream `json:"streams"`
+	}
+	for _, s := range streams {
+		payload.Streams = append(payload.Streams, s)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		grpcLogger.Errorf("failed to marshal Loki push payload: %v", err)
+		return
+	}
+	resp, err := l.client.Post(l.cfg.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		grpcLogger.Errorf("failed to push %d audit events to Loki at %q: %v", len(batch), l.cfg.url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		grpcLogger.Errorf("Loki push endpoint %q returned status %v for %d audit events", l.cfg.url, resp.Status, len(batch))
+	}
+}
+
+type loggerBuilder struct{}
+
+func (loggerBuilder) Name() string {
+	return Name
+}
+
+// Build returns a new instance of the Loki logger with its background flusher
+// started.
+func (*loggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	lc, ok := c.(*loggerConfig)
+	if !ok {
+		grpcLogger.Errorf("Failed to build Loki audit logger: unexpected config type %T", c)
+		return nil
+	}
+	l := &logger{
+		cfg:    lc,
+		client: &http.Client{Timeout: flushTimeout},
+		events: make(chan *entry, eventBufferSize),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// ParseLoggerConfig parses and validates the config, returning an error when
+// the push URL is missing or malformed.
+func (*loggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	var c config
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+		}
+	}
+	if c.URL == "" {
+		return nil, fmt.Errorf(`missing required field "url" in Loki logger config`)
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid "url" in Loki logger config: %v`, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(`invalid "url" %q in Loki logger config: want an absolute http or https URL`, c.URL)
+	}
+	if c.BatchSize < 0 {
+		return nil, fmt.Errorf(`"batch_size" in Loki logger config must not be negative`)
+	}
+	if c.FlushIntervalMillis < 0 {
+		return nil, fmt.Errorf(`"flush_interval_ms" in Loki logger config must not be negative`)
+	}
+	lc := &loggerConfig{
+		url:           c.URL,
+		labels:        c.Labels,
+		batchSize:     c.BatchSize,
+		flushInterval: time.Duration(c.FlushIntervalMillis) * time.Millisecond,
+	}
+	if lc.batchSize == 0 {
+		lc.batchSize = defaultBatchSize
+	}
+	if lc.flushInterval == 0 {
+		lc.flushInterval = defaultFlushInterval
+	}
+	return lc, nil
+}
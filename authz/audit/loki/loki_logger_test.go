@@ -0,0 +1,192 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/internal/grpctest"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// pushPayload is the shape of a Loki push request body.
+type pushPayload struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+// pushServer records the push requests it receives.
+type pushServer struct {
+	mu     sync.Mutex
+	pushes []pushPayload
+
+	*httptest.Server
+}
+
+func newPushServer(t *testing.T) *pushServer {
+	t.Helper()
+	ps := &pushServer{}
+	ps.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read push request body: %v", err)
+			return
+		}
+		var payload pushPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Failed to unmarshal push request body %s: %v", body, err)
+			return
+		}
+		ps.mu.Lock()
+		ps.pushes = append(ps.pushes, payload)
+		ps.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(ps.Server.Close)
+	return ps
+}
+
+func (s) TestLokiLoggerPushesOnClose(t *testing.T) {
+	ps := newPushServer(t)
+	builder := audit.GetLoggerBuilder(Name)
+	if builder == nil {
+		t.Fatalf("Failed to find %v builder in the registry", Name)
+	}
+	config, err := builder.ParseLoggerConfig(json.RawMessage(fmt.Sprintf(`{"url": %q, "labels": {"app": "payments"}}`, ps.URL)))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	l := builder.Build(config)
+	const eventCount = 5
+	for i := 0; i < eventCount; i++ {
+		l.Log(&audit.Event{FullMethodName: fmt.Sprintf("/pkg.Service/Method%d", i), PolicyName: "test policy", Authorized: i%2 == 0})
+	}
+	l.(*logger).Close()
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if len(ps.pushes) != 1 {
+		t.Fatalf("Server received %d pushes, want 1", len(ps.pushes))
+	}
+	streams := ps.pushes[0].Streams
+	if len(streams) != 2 {
+		t.Fatalf("Push carries %d streams, want 2 (authorized and denied)", len(streams))
+	}
+	total := 0
+	for _, stream := range streams {
+		if got := stream.Stream["app"]; got != "payments" {
+			t.Errorf("Stream label app = %q, want %q", got, "payments")
+		}
+		authorized := stream.Stream["authorized"]
+		if authorized != "true" && authorized != "false" {
+			t.Fatalf("Stream label authorized = %q, want true or false", authorized)
+		}
+		for _, value := range stream.Values {
+			var got map[string]any
+			if err := json.Unmarshal([]byte(value[1]), &got); err != nil {
+				t.Fatalf("Failed to unmarshal pushed event %q: %v", value[1], err)
+			}
+			if got["policy_name"] != "test policy" || fmt.Sprintf("%v", got["authorized"]) != authorized {
+				t.Errorf("Pushed event %+v does not match its stream labels %v", got, stream.Stream)
+			}
+			total++
+		}
+	}
+	if total != eventCount {
+		t.Errorf("Pushed %d events in total, want %d", total, eventCount)
+	}
+}
+
+func (s) TestLokiLoggerBatchSize(t *testing.T) {
+	ps := newPushServer(t)
+	builder := audit.GetLoggerBuilder(Name)
+	config, err := builder.ParseLoggerConfig(json.RawMessage(fmt.Sprintf(`{"url": %q, "batch_size": 2, "flush_interval_ms": 60000}`, ps.URL)))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	l := builder.Build(config)
+	for i := 0; i < 5; i++ {
+		l.Log(&audit.Event{FullMethodName: "/pkg.Service/Method", Authorized: true})
+	}
+	l.(*logger).Close()
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	// 5 events with a batch size of 2: two full batches plus the remainder
+	// pushed by Close.
+	if len(ps.pushes) != 3 {
+		t.Fatalf("Server received %d pushes, want 3", len(ps.pushes))
+	}
+	for i, want := range []int{2, 2, 1} {
+		if got := len(ps.pushes[i].Streams[0].Values); got != want {
+			t.Errorf("Push %d carries %d events, want %d", i, got, want)
+		}
+	}
+}
+
+func (s) TestLokiLoggerConfigErrors(t *testing.T) {
+	builder := audit.GetLoggerBuilder(Name)
+	tests := map[string]struct {
+		config  string
+		wantErr string
+	}{
+		"missing url": {
+			config:  `{"labels": {"app": "payments"}}`,
+			wantErr: `missing required field "url"`,
+		},
+		"relative url": {
+			config:  `{"url": "loki/api/v1/push"}`,
+			wantErr: `want an absolute http or https URL`,
+		},
+		"bad scheme": {
+			config:  `{"url": "nats://localhost:4222"}`,
+			wantErr: `want an absolute http or https URL`,
+		},
+		"negative batch size": {
+			config:  `{"url": "http://localhost:3100/loki/api/v1/push", "batch_size": -1}`,
+			wantErr: `"batch_size"`,
+		},
+		"negative flush interval": {
+			config:  `{"url": "http://localhost:3100/loki/api/v1/push", "flush_interval_ms": -1}`,
+			wantErr: `"flush_interval_ms"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := builder.ParseLoggerConfig(json.RawMessage(test.config)); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("ParseLoggerConfig(%v) = %v, want error containing %q", test.config, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package nats defines an audit logger that publishes audit events to a NATS
+// JetStream subject.
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	natsgo "github.com/nats-io/nats.go"
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/grpclog"
+)
+
+var grpcLogger = grpclog.Component("authz-audit")
+
+// Name is the string to identify this logger type in the registry
+const Name = "nats_logger"
+
+// eventBufferSize bounds the number of audit events waiting to be published.
+// Events are dropped, with a warning log, when the buffer is full so the RPC
+// path never blocks on the NATS connection.
+const eventBufferSize = 256
+
+// flushTimeout bounds how long Close waits for buffered events to be
+// published.
+const flushTimeout = 5 * time.Second
+
+func init() {
+	audit.RegisterLoggerBuilder(&loggerBuilder{})
+}
+
+// conn is the subset of a JetStream-enabled NATS connection the logger uses.
+// Tests inject fake implementations through the dial hook.
+type conn interface {
+	// Publish publishes data to the subject and waits for the JetStream ack.
+	Publish(subject string, data []byte) error
+	// HealthCheck reports whether the connection is currently usable.
+	HealthCheck() error
+	// Close closes the connection.
+	Close()
+}
+
+// natsConn adapts a nats.go connection to the conn interface.
+type natsConn struct {
+	nc *natsgo.Conn
+	js natsgo.JetStreamContext
+}
+
+func (c *natsConn) Publish(subject string, data []byte) error {
+	_, err := c.js.Publish(subject, data)
+	return err
+}
+
+func (c *natsConn) HealthCheck() error {
+	if !c.nc.IsConnected() {
+		return fmt.Errorf("not connected to NATS server %q", c.nc.ConnectedUrl())
+	}
+	return nil
+}
+
+func (c *natsConn) Close() {
+	c.nc.Close()
+}
+
+// dial connects to the NATS server at url and validates that the stream, when
+// named, exists. It is a variable so tests can inject a fake connection.
+var dial = func(url, stream string) (conn, error) {
+	nc, err := natsgo.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS server %q: %v", url, err)
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %v", err)
+	}
+	if stream != "" {
+		if _, err := js.StreamInfo(stream); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("failed to look up JetStream stream %q: %v", stream, err)
+		}
+	}
+	return &natsConn{nc: nc, js: js}, nil
+}
+
+// loggerConfig represents the configuration for the NATS logger. The
+// connection is established while parsing the config, so that a mandatory
+// logger pointing at an unreachable server fails policy construction.
+// Connections are shared: configs naming the same server and stream reuse one
+// connection across policies in the process.
+type loggerConfig struct {
+	audit.LoggerConfig
+
+	subject string
+	conn    conn
+	shared  *audit.SharedResource
+	marshal func(*audit.Event) ([]byte, error)
+}
+
+type config struct {
+	// URL is the address of the NATS server, e.g. "nats://localhost:4222".
+	URL string `json:"url"`
+	// Subject is the JetStream subject events are published to.
+	Subject string `json:"subject"`
+	// Stream optionally names the JetStream stream expected to capture the
+	// subject; its existence is verified at config parsing time.
+	Stream string `json:"stream"`
+	// Format selects the event serialization: "json" (the default) or
+	// "msgpack".
+	Format string `json:"format"`
+}
+
+// logger implements the audit.Logger interface by publishing serialized
+// events to a NATS JetStream subject from a background goroutine.
+type logger struct {
+	subject string
+	conn    conn
+	shared  *audit.SharedResource
+	marshal func(*audit.Event) ([]byte, error)
+
+	events chan *audit.Event
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+// Log enqueues the audit event for publishing. It never blocks: when the
+// buffer is full the event is dropped and a warning is logged.
+func (l *logger) Log(event *audit.Event) {
+	e := *event
+	select {
+	case l.events <- &e:
+	default:
+		grpcLogger.Warningf("NATS audit logger buffer is full, dropping event for %v", event.FullMethodName)
+	}
+}
+
+// HealthCheck implements audit.HealthChecker by checking the state of the
+// NATS connection, so a mandatory logger whose connection has dropped fails
+// interceptor construction.
+func (l *logger) HealthCheck() error {
+	return l.conn.HealthCheck()
+}
+
+// Close flushes buffered events and releases the logger's reference on the
+// shared NATS connection, closing it when this was the last logger using it.
+// It waits at most flushTimeout for the flush.
+func (l *logger) Close() {
+	l.closeOnce.Do(func() {
+		close(l.events)
+		select {
+		case <-l.done:
+		case <-time.After(flushTimeout):
+			grpcLogger.Warningf("NATS audit logger timed out flushing buffered events")
+		}
+		l.shared.Release()
+	})
+}
+
+// run publishes events until the event channel is closed and drained.
+func (l *logger) run() {
+	defer close(l.done)
+	for event := range l.events {
+		data, err := l.marshal(event)
+		if err != nil {
+			grpcLogger.Errorf("failed to marshal AuditEvent data: %v", err)
+			continue
+		}
+		if err := l.conn.Publish(l.subject, data); err != nil {
+			grpcLogger.Errorf("failed to publish audit event to NATS subject %q: %v", l.subject, err)
+		}
+	}
+}
+
+type loggerBuilder struct{}
+
+func (loggerBuilder) Name() string {
+	return Name
+}
+
+// Build returns a new instance of the NATS logger using the connection
+// established when the config was parsed.
+func (*loggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	lc, ok := c.(*loggerConfig)
+	if !ok {
+		grpcLogger.Errorf("Failed to build NATS audit logger: unexpected config type %T", c)
+		return nil
+	}
+	l := &logger{
+		subject: lc.subject,
+		conn:    lc.conn,
+		shared:  lc.shared,
+		marshal: lc.marshal,
+		events:  make(chan *audit.Event, eventBufferSize),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// ParseLoggerConfig parses the config and connects to the configured NATS
+// server, returning an error when the server is unreachable or the configured
+// stream does not exist. Configs naming the same server and stream share one
+// reference-counted connection, so several policies pointing at the same
+// backend do not open redundant connections.
+func (*loggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	var c config
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+		}
+	}
+	if c.URL == "" {
+		return nil, fmt.Errorf(`missing required field "url" in NATS logger config`)
+	}
+	if c.Subject == "" {
+		return nil, fmt.Errorf(`missing required field "subject" in NATS logger config`)
+	}
+	marshal, err := audit.MarshalerForFormat(c.Format)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := audit.AcquireShared(Name+"|"+c.URL+"|"+c.Stream, func() (any, func(), error) {
+		cc, err := dial(c.URL, c.Stream)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cc, cc.Close, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &loggerConfig{subject: c.Subject, conn: shared.Value().(conn), shared: shared, marshal: marshal}, nil
+}
@@ -0,0 +1,204 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/internal/grpctest"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// fakeConn records published messages in place of a NATS connection.
+type fakeConn struct {
+	mu        sync.Mutex
+	published []publishedMsg
+	closed    bool
+	healthErr error
+}
+
+func (c *fakeConn) HealthCheck() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.healthErr
+}
+
+type publishedMsg struct {
+	subject string
+	data    []byte
+}
+
+func (c *fakeConn) Publish(subject string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, publishedMsg{subject: subject, data: data})
+	return nil
+}
+
+func (c *fakeConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+// injectConn overrides the dial hook with one returning the fake connection
+// and restores it when the test ends.
+func injectConn(t *testing.T, c conn, dialErr error) {
+	t.Helper()
+	origDial := dial
+	dial = func(string, string) (conn, error) {
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		return c, nil
+	}
+	t.Cleanup(func() { dial = origDial })
+}
+
+func (s) TestNatsLoggerPublishesOnClose(t *testing.T) {
+	fc := &fakeConn{}
+	injectConn(t, fc, nil)
+	builder := audit.GetLoggerBuilder(Name)
+	if builder == nil {
+		t.Fatalf("Failed to find %v builder in the registry", Name)
+	}
+	config, err := builder.ParseLoggerConfig(json.RawMessage(`{"url": "nats://localhost:4222", "subject": "authz.audit", "stream": "AUTHZ"}`))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	l := builder.Build(config)
+	const eventCount = 5
+	for i := 0; i < eventCount; i++ {
+		l.Log(&audit.Event{FullMethodName: fmt.Sprintf("/pkg.Service/Method%d", i), PolicyName: "test policy", Authorized: true})
+	}
+	l.(*logger).Close()
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if len(fc.published) != eventCount {
+		t.Fatalf("Published %d events, want %d", len(fc.published), eventCount)
+	}
+	for i, msg := range fc.published {
+		if msg.subject != "authz.audit" {
+			t.Errorf("Event %d published to subject %q, want %q", i, msg.subject, "authz.audit")
+		}
+		var got map[string]any
+		if err := json.Unmarshal(msg.data, &got); err != nil {
+			t.Fatalf("Failed to unmarshal published event %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("/pkg.Service/Method%d", i); got["rpc_method"] != want || got["policy_name"] != "test policy" || got["authorized"] != true {
+			t.Errorf("Published event %d = %+v, want rpc_method %q, policy_name %q, authorized true", i, got, want, "test policy")
+		}
+	}
+	if !fc.closed {
+		t.Error("Close() did not close the NATS connection")
+	}
+}
+
+func (s) TestNatsLoggerConfigErrors(t *testing.T) {
+	builder := audit.GetLoggerBuilder(Name)
+	tests := map[string]struct {
+		config  string
+		dialErr error
+		wantErr string
+	}{
+		"missing url": {
+			config:  `{"subject": "authz.audit"}`,
+			wantErr: `missing required field "url"`,
+		},
+		"missing subject": {
+			config:  `{"url": "nats://localhost:4222"}`,
+			wantErr: `missing required field "subject"`,
+		},
+		"unreachable server": {
+			config:  `{"url": "nats://localhost:4222", "subject": "authz.audit"}`,
+			dialErr: fmt.Errorf("failed to connect to NATS server"),
+			wantErr: "failed to connect to NATS server",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			injectConn(t, &fakeConn{}, test.dialErr)
+			if _, err := builder.ParseLoggerConfig(json.RawMessage(test.config)); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("ParseLoggerConfig(%v) = %v, want error containing %q", test.config, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func (s) TestNatsLoggerSharedConnection(t *testing.T) {
+	fc := &fakeConn{}
+	dials := 0
+	origDial := dial
+	dial = func(string, string) (conn, error) {
+		dials++
+		return fc, nil
+	}
+	t.Cleanup(func() { dial = origDial })
+	builder := audit.GetLoggerBuilder(Name)
+
+	newLogger := func(configJSON string) *logger {
+		t.Helper()
+		config, err := builder.ParseLoggerConfig(json.RawMessage(configJSON))
+		if err != nil {
+			t.Fatalf("ParseLoggerConfig() failed: %v", err)
+		}
+		return builder.Build(config).(*logger)
+	}
+	// Two loggers with the same server and stream share one connection, even
+	// with different subjects.
+	l1 := newLogger(`{"url": "nats://shared:4222", "subject": "authz.audit.a", "stream": "AUTHZ"}`)
+	l2 := newLogger(`{"url": "nats://shared:4222", "subject": "authz.audit.b", "stream": "AUTHZ"}`)
+	if dials != 1 {
+		t.Fatalf("Dialed %d times for two identically-pointed loggers, want 1", dials)
+	}
+
+	l1.Close()
+	fc.mu.Lock()
+	closed := fc.closed
+	fc.mu.Unlock()
+	if closed {
+		t.Fatal("Connection closed while another logger still uses it")
+	}
+	l2.Close()
+	fc.mu.Lock()
+	closed = fc.closed
+	fc.mu.Unlock()
+	if !closed {
+		t.Error("Connection not closed after the last logger released it")
+	}
+
+	// A different server gets its own connection.
+	l3 := newLogger(`{"url": "nats://other:4222", "subject": "authz.audit", "stream": "AUTHZ"}`)
+	if dials != 2 {
+		t.Errorf("Dialed %d times in total, want 2: one shared plus one for the new server", dials)
+	}
+	l3.Close()
+}
@@ -0,0 +1,25 @@
+module google.golang.org/grpc/authz/audit/otel
+
+go 1.19
+
+require (
+	github.com/google/go-cmp v0.6.0
+	go.opentelemetry.io/otel/log v0.0.1-alpha
+	google.golang.org/grpc v1.59.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	go.opentelemetry.io/otel v1.24.0 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	go.opentelemetry.io/otel/trace v1.24.0 // indirect
+	golang.org/x/net v0.18.0 // indirect
+	golang.org/x/sys v0.14.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20231106174013-bbf56f31fb17 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
+
+replace google.golang.org/grpc => ../../..
@@ -0,0 +1,309 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package otel defines an audit logger that exports audit events as
+// OpenTelemetry log records over OTLP/HTTP, so authz audit records flow
+// through the same pipeline as the rest of an OpenTelemetry-based stack.
+package otel
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	otellog "go.opentelemetry.io/otel/log"
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/grpclog"
+)
+
+var grpcLogger = grpclog.Component("authz-audit")
+
+// Name is the string to identify this logger type in the registry
+const Name = "otel_logger"
+
+// scopeName identifies this logger as the instrumentation scope of the
+// exported records.
+const scopeName = "grpc-authz-audit"
+
+// eventBufferSize bounds the number of audit events waiting to be exported.
+// Events are dropped, with a warning log, when the buffer is full so the RPC
+// path never blocks on the collector.
+const eventBufferSize = 256
+
+// flushTimeout bounds how long Close waits for buffered events to be
+// exported.
+const flushTimeout = 5 * time.Second
+
+// batchSize is the number of records per export request; a partial batch is
+// exported when flushInterval elapses.
+const batchSize = 100
+
+// flushInterval is how often partial batches are exported.
+const flushInterval = time.Second
+
+func init() {
+	audit.RegisterLoggerBuilder(&OTelLoggerBuilder{})
+}
+
+// loggerConfig represents the validated configuration for the OTel logger.
+type loggerConfig struct {
+	audit.LoggerConfig
+
+	url      string
+	resource map[string]string
+}
+
+type config struct {
+	// Endpoint is the OTLP/HTTP endpoint of the collector, e.g.
+	// "http://localhost:4318". When the URL carries no path, the standard
+	// "/v1/logs" logs path is appended.
+	Endpoint string `json:"endpoint"`
+	// ResourceAttributes are attached to the resource of every exported
+	// record, e.g. a "service.name".
+	ResourceAttributes map[string]string `json:"resource_attributes"`
+}
+
+// toRecord translates the audit event into an OpenTelemetry log record. The
+// record's body is a short human-readable summary; its attributes carry the
+// event fields under OpenTelemetry-style dotted names: "rpc.method",
+// "authz.principal", "authz.policy", "authz.matched_rule" and
+// "authz.authorized". The severity is SeverityInfo for authorized events and
+// SeverityWarn for denied ones.
+func toRecord(event *audit.Event) otellog.Record {
+	var r otellog.Record
+	r.SetTimestamp(time.Now())
+	severity := otellog.SeverityInfo
+	severityText := "INFO"
+	body := "authorized RPC"
+	if !event.Authorized {
+		severity = otellog.SeverityWarn
+		severityText = "WARN"
+		body = "unauthorized RPC"
+	}
+	r.SetSeverity(severity)
+	r.SetSeverityText(severityText)
+	r.SetBody(otellog.StringValue(body + " " + event.FullMethodName))
+	r.AddAttributes(
+		otellog.String("rpc.method", event.FullMethodName),
+		otellog.String("authz.principal", event.Principal),
+		otellog.String("authz.policy", event.PolicyName),
+		otellog.String("authz.matched_rule", event.MatchedRule),
+		otellog.Bool("authz.authorized", event.Authorized),
+	)
+	return r
+}
+
+// logger implements the audit.Logger interface by batching translated
+// records and exporting them over OTLP/HTTP from a background goroutine.
+type logger struct {
+	cfg    *loggerConfig
+	client *http.Client
+
+	records chan otellog.Record
+	done    chan struct{}
+
+	closeOnce sync.Once
+}
+
+// Log translates the audit event and enqueues the record for export. It
+// never blocks: when the buffer is full the event is dropped and a warning
+// is logged.
+func (l *logger) Log(event *audit.Event) {
+	select {
+	case l.records <- toRecord(event):
+	default:
+		grpcLogger.Warningf("OTel audit logger buffer is full, dropping event for %v", event.FullMethodName)
+	}
+}
+
+// Close exports buffered records and stops the background flusher. It waits
+// at most flushTimeout for the flush.
+func (l *logger) Close() {
+	l.closeOnce.Do(func() {
+		close(l.records)
+		select {
+		case <-l.done:
+		case <-time.After(flushTimeout):
+			grpcLogger.Warningf("OTel audit logger timed out flushing buffered events")
+		}
+	})
+}
+
+// run batches records and exports them when a batch is full or the flush
+// interval elapses, then exports the remainder when the record channel is
+// closed.
+func (l *logger) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []otellog.Record
+	for {
+		select {
+		case r, ok := <-l.records:
+			if !ok {
+				l.export(batch)
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= batchSize {
+				l.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			l.export(batch)
+			batch = nil
+		}
+	}
+}
+
+// export POSTs the batch to the configured endpoint as one OTLP/HTTP JSON
+// logs request. Export failures are logged and the batch is dropped, so an
+// unavailable collector never backs up into the RPC path.
+func (l *logger) export(batch []otellog.Record) {
+	if len(batch) == 0 {
+		return
+	}
+	type keyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+	type logRecord struct {
+		TimeUnixNano   string         `json:"timeUnixNano"`
+		SeverityNumber int            `json:"severityNumber"`
+		SeverityText   string         `json:"severityText"`
+		Body           map[string]any `json:"body"`
+		Attributes     []keyValue     `json:"attributes"`
+	}
+	records := make([]logRecord, 0, len(batch))
+	for _, r := range batch {
+		lr := logRecord{
+			TimeUnixNano:   strconv.FormatInt(r.Timestamp().UnixNano(), 10),
+			SeverityNumber: int(r.Severity()),
+			SeverityText:   r.SeverityText(),
+			Body:           otlpValue(r.Body()),
+		}
+		r.WalkAttributes(func(kv otellog.KeyValue) bool {
+			lr.Attributes = append(lr.Attributes, keyValue{Key: kv.Key, Value: otlpValue(kv.Value)})
+			return true
+		})
+		records = append(records, lr)
+	}
+	resourceKeys := make([]string, 0, len(l.cfg.resource))
+	for k := range l.cfg.resource {
+		resourceKeys = append(resourceKeys, k)
+	}
+	sort.Strings(resourceKeys)
+	resource := make([]keyValue, 0, len(resourceKeys))
+	for _, k := range resourceKeys {
+		resource = append(resource, keyValue{Key: k, Value: map[string]any{"stringValue": l.cfg.resource[k]}})
+	}
+	payload := map[string]any{
+		"resourceLogs": []map[string]any{{
+			"resource": map[string]any{"attributes": resource},
+			"scopeLogs": []map[string]any{{
+				"scope":      map[string]any{"name": scopeName},
+				"logRecords": records,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		grpcLogger.Errorf("failed to marshal OTLP logs payload: %v", err)
+		return
+	}
+	resp, err := l.client.Post(l.cfg.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		grpcLogger.Errorf("failed to export %d audit events to %q: %v", len(batch), l.cfg.url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		grpcLogger.Errorf("OTLP logs endpoint %q returned status %v for %d audit events", l.cfg.url, resp.Status, len(batch))
+	}
+}
+
+// otlpValue converts a record value into its OTLP JSON representation,
+// covering the kinds toRecord produces.
+func otlpValue(v otellog.Value) map[string]any {
+	switch v.Kind() {
+	case otellog.KindBool:
+		return map[string]any{"boolValue": v.AsBool()}
+	case otellog.KindInt64:
+		return map[string]any{"intValue": strconv.FormatInt(v.AsInt64(), 10)}
+	default:
+		return map[string]any{"stringValue": v.AsString()}
+	}
+}
+
+// OTelLoggerBuilder builds OTel audit loggers from their parsed
+// configuration.
+type OTelLoggerBuilder struct{}
+
+// Name returns the registry name of the OTel logger.
+func (OTelLoggerBuilder) Name() string {
+	return Name
+}
+
+// Build returns a new instance of the OTel logger with its background
+// flusher started.
+func (*OTelLoggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	lc, ok := c.(*loggerConfig)
+	if !ok {
+		grpcLogger.Errorf("Failed to build OTel audit logger: unexpected config type %T", c)
+		return nil
+	}
+	l := &logger{
+		cfg:     lc,
+		client:  &http.Client{Timeout: flushTimeout},
+		records: make(chan otellog.Record, eventBufferSize),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// ParseLoggerConfig parses and validates the config, returning an error when
+// the endpoint is missing or malformed.
+func (*OTelLoggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	var c config
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+		}
+	}
+	if c.Endpoint == "" {
+		return nil, fmt.Errorf(`missing required field "endpoint" in OTel logger config`)
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid "endpoint" in OTel logger config: %v`, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(`invalid "endpoint" %q in OTel logger config: want an absolute http or https URL`, c.Endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/logs"
+	}
+	return &loggerConfig{url: u.String(), resource: c.ResourceAttributes}, nil
+}
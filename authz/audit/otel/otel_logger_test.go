@@ -0,0 +1,200 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package otel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/internal/grpctest"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// otlpKeyValue is the OTLP JSON shape of one attribute.
+type otlpKeyValue struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// otlpPayload is the OTLP/HTTP JSON shape of a logs export request.
+type otlpPayload struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []struct {
+				TimeUnixNano   string         `json:"timeUnixNano"`
+				SeverityNumber int            `json:"severityNumber"`
+				SeverityText   string         `json:"severityText"`
+				Body           map[string]any `json:"body"`
+				Attributes     []otlpKeyValue `json:"attributes"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+// collectorServer records the OTLP export requests it receives.
+type collectorServer struct {
+	mu      sync.Mutex
+	exports []otlpPayload
+
+	*httptest.Server
+}
+
+func newCollectorServer(t *testing.T) *collectorServer {
+	t.Helper()
+	cs := &collectorServer{}
+	cs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" {
+			t.Errorf("Export request path = %q, want %q", r.URL.Path, "/v1/logs")
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read export request body: %v", err)
+			return
+		}
+		var payload otlpPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Failed to unmarshal export request body %s: %v", body, err)
+			return
+		}
+		cs.mu.Lock()
+		cs.exports = append(cs.exports, payload)
+		cs.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(cs.Server.Close)
+	return cs
+}
+
+func attributesByKey(attrs []otlpKeyValue) map[string]map[string]any {
+	m := make(map[string]map[string]any, len(attrs))
+	for _, kv := range attrs {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func (s) TestOTelLoggerExport(t *testing.T) {
+	cs := newCollectorServer(t)
+	builder := audit.GetLoggerBuilder(Name)
+	if builder == nil {
+		t.Fatalf("Failed to find %v builder in the registry", Name)
+	}
+	config, err := builder.ParseLoggerConfig(json.RawMessage(fmt.Sprintf(`{"endpoint": %q, "resource_attributes": {"service.name": "payments"}}`, cs.URL)))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	l := builder.Build(config)
+	l.Log(&audit.Event{
+		FullMethodName: "/pkg.Service/Allowed",
+		Principal:      "spiffe://example.org/backend",
+		PolicyName:     "example",
+		MatchedRule:    "dev-access",
+		Authorized:     true,
+	})
+	l.Log(&audit.Event{
+		FullMethodName: "/pkg.Service/Denied",
+		PolicyName:     "example",
+		MatchedRule:    "deny-all",
+		Authorized:     false,
+	})
+	l.(*logger).Close()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if len(cs.exports) != 1 {
+		t.Fatalf("Collector received %d exports, want 1", len(cs.exports))
+	}
+	rl := cs.exports[0].ResourceLogs
+	if len(rl) != 1 || len(rl[0].ScopeLogs) != 1 {
+		t.Fatalf("Export carries %d resourceLogs, want 1 with 1 scopeLogs", len(rl))
+	}
+	resource := attributesByKey(rl[0].Resource.Attributes)
+	if got := resource["service.name"]["stringValue"]; got != "payments" {
+		t.Errorf(`Resource attribute service.name = %v, want "payments"`, got)
+	}
+	sl := rl[0].ScopeLogs[0]
+	if sl.Scope.Name != scopeName {
+		t.Errorf("Scope name = %q, want %q", sl.Scope.Name, scopeName)
+	}
+	if len(sl.LogRecords) != 2 {
+		t.Fatalf("Export carries %d log records, want 2", len(sl.LogRecords))
+	}
+	allowed, denied := sl.LogRecords[0], sl.LogRecords[1]
+	if allowed.SeverityText != "INFO" || denied.SeverityText != "WARN" {
+		t.Errorf("Severities = %q and %q, want INFO and WARN", allowed.SeverityText, denied.SeverityText)
+	}
+	if allowed.SeverityNumber >= denied.SeverityNumber {
+		t.Errorf("Severity numbers = %d and %d, want the denial more severe", allowed.SeverityNumber, denied.SeverityNumber)
+	}
+	attrs := attributesByKey(allowed.Attributes)
+	for key, want := range map[string]any{
+		"rpc.method":         "/pkg.Service/Allowed",
+		"authz.principal":    "spiffe://example.org/backend",
+		"authz.policy":       "example",
+		"authz.matched_rule": "dev-access",
+	} {
+		if got := attrs[key]["stringValue"]; got != want {
+			t.Errorf("Allowed record attribute %v = %v, want %v", key, got, want)
+		}
+	}
+	if got := attrs["authz.authorized"]["boolValue"]; got != true {
+		t.Errorf("Allowed record attribute authz.authorized = %v, want true", got)
+	}
+	if got := attributesByKey(denied.Attributes)["authz.authorized"]["boolValue"]; got != false {
+		t.Errorf("Denied record attribute authz.authorized = %v, want false", got)
+	}
+}
+
+func (s) TestOTelLoggerConfigErrors(t *testing.T) {
+	builder := audit.GetLoggerBuilder(Name)
+	for _, raw := range []string{
+		`{}`,
+		`{"endpoint": "localhost:4318"}`,
+		`{"endpoint": "ftp://collector"}`,
+	} {
+		if _, err := builder.ParseLoggerConfig(json.RawMessage(raw)); err == nil {
+			t.Errorf("ParseLoggerConfig(%s) succeeded, want error", raw)
+		}
+	}
+	config, err := builder.ParseLoggerConfig(json.RawMessage(`{"endpoint": "http://collector:4318"}`))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	if got := config.(*loggerConfig).url; got != "http://collector:4318/v1/logs" {
+		t.Errorf("Parsed endpoint URL = %q, want the /v1/logs path appended", got)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package otel
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	otellog "go.opentelemetry.io/otel/log"
+	"google.golang.org/grpc/authz/audit"
+)
+
+// TestToOTelRecord verifies the attribute mapping and the severity
+// convention of the OpenTelemetry interop helper.
+func (s) TestToOTelRecord(t *testing.T) {
+	denied := &audit.Event{
+		FullMethodName: "/pkg.Service/Api",
+		Principal:      "spiffe://corp/ns/caller",
+		PolicyName:     "authz",
+		MatchedRule:    "authz_blocked",
+		Authorized:     false,
+		Outcome:        audit.OutcomeDeny,
+		CorrelationID:  "req-123",
+		Labels:         map[string]string{"team": "billing"},
+	}
+	r := ToOTelRecord(denied)
+	if got := r.Severity(); got != otellog.SeverityWarn {
+		t.Errorf("Denied record severity = %v, want %v", got, otellog.SeverityWarn)
+	}
+	if r.Timestamp().IsZero() {
+		t.Error("Record has no timestamp")
+	}
+	attrs := map[string]string{}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		if kv.Value.Kind() == otellog.KindBool {
+			attrs[kv.Key] = fmt.Sprintf("%v", kv.Value.AsBool())
+		} else {
+			attrs[kv.Key] = kv.Value.AsString()
+		}
+		return true
+	})
+	want := map[string]string{
+		"rpc_method":     "/pkg.Service/Api",
+		"principal":      "spiffe://corp/ns/caller",
+		"policy_name":    "authz",
+		"matched_rule":   "authz_blocked",
+		"authorized":     "false",
+		"outcome":        "deny",
+		"correlation_id": "req-123",
+		"labels.team":    "billing",
+	}
+	if diff := cmp.Diff(want, attrs); diff != "" {
+		t.Errorf("Attribute mismatch (-want +got):\n%s", diff)
+	}
+
+	allowed := ToOTelRecord(&audit.Event{FullMethodName: "/pkg.Service/Api", Authorized: true})
+	if got := allowed.Severity(); got != otellog.SeverityInfo {
+		t.Errorf("Authorized record severity = %v, want %v", got, otellog.SeverityInfo)
+	}
+	if got := allowed.AttributesLen(); got != 5 {
+		t.Errorf("Authorized record has %d attributes, want only the 5 always-set ones", got)
+	}
+}
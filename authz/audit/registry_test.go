@@ -0,0 +1,132 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+)
+
+// pluginBuilder is a minimal builder for registry tests.
+type pluginBuilder struct {
+	name string
+}
+
+func (b *pluginBuilder) Name() string { return b.name }
+
+func (b *pluginBuilder) Build(audit.LoggerConfig) audit.Logger { return nil }
+
+func (b *pluginBuilder) ParseLoggerConfig(json.RawMessage) (audit.LoggerConfig, error) {
+	return nil, nil
+}
+
+func (s) TestRegistryRegisterUnregister(t *testing.T) {
+	const name = "test_plugin_logger"
+	if audit.GetLoggerBuilder(name) != nil {
+		t.Fatalf("Builder %q is registered before the test starts", name)
+	}
+	b := &pluginBuilder{name: name}
+	audit.RegisterLoggerBuilder(b)
+	if got := audit.GetLoggerBuilder(name); got != audit.LoggerBuilder(b) {
+		t.Fatalf("GetLoggerBuilder(%q) = %v, want the registered builder", name, got)
+	}
+	// Re-registering under the same name replaces the builder.
+	b2 := &pluginBuilder{name: name}
+	audit.RegisterLoggerBuilder(b2)
+	if got := audit.GetLoggerBuilder(name); got != audit.LoggerBuilder(b2) {
+		t.Fatalf("GetLoggerBuilder(%q) after re-registration = %v, want the new builder", name, got)
+	}
+	audit.UnregisterLoggerBuilder(name)
+	if got := audit.GetLoggerBuilder(name); got != nil {
+		t.Fatalf("GetLoggerBuilder(%q) after unregistration = %v, want nil", name, got)
+	}
+	// Unregistering an absent builder is a no-op.
+	audit.UnregisterLoggerBuilder(name)
+}
+
+func (s) TestRegistryConcurrentUse(t *testing.T) {
+	const goroutines = 8
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		name := fmt.Sprintf("test_concurrent_logger_%d", g)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				audit.RegisterLoggerBuilder(&pluginBuilder{name: name})
+				if audit.GetLoggerBuilder(name) == nil {
+					t.Errorf("GetLoggerBuilder(%q) = nil after registration", name)
+					return
+				}
+				audit.UnregisterLoggerBuilder(name)
+			}
+		}()
+	}
+	wg.Wait()
+	for g := 0; g < goroutines; g++ {
+		if name := fmt.Sprintf("test_concurrent_logger_%d", g); audit.GetLoggerBuilder(name) != nil {
+			t.Errorf("Builder %q is still registered after the cycles", name)
+		}
+	}
+}
+
+func (s) TestRegistryRegisterErr(t *testing.T) {
+	const name = "test_err_plugin_logger"
+	b := &pluginBuilder{name: name}
+	if err := audit.RegisterLoggerBuilderErr(b); err != nil {
+		t.Fatalf("RegisterLoggerBuilderErr() on a fresh name failed: %v", err)
+	}
+	defer audit.UnregisterLoggerBuilder(name)
+	// A duplicate is rejected and the registry keeps the first builder.
+	if err := audit.RegisterLoggerBuilderErr(&pluginBuilder{name: name}); err == nil {
+		t.Fatal("RegisterLoggerBuilderErr() on a duplicate name succeeded, want error")
+	}
+	if got := audit.GetLoggerBuilder(name); got != audit.LoggerBuilder(b) {
+		t.Fatalf("GetLoggerBuilder(%q) after rejected duplicate = %v, want the first builder", name, got)
+	}
+}
+
+func (s) TestRegistryBuilderNames(t *testing.T) {
+	const name = "test_names_plugin_logger"
+	contains := func(names []string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	if contains(audit.GetRegisteredBuilderNames()) {
+		t.Fatalf("Builder %q is registered before the test starts", name)
+	}
+	audit.RegisterLoggerBuilder(&pluginBuilder{name: name})
+	defer audit.UnregisterLoggerBuilder(name)
+	names := audit.GetRegisteredBuilderNames()
+	if !contains(names) {
+		t.Fatalf("GetRegisteredBuilderNames() = %v, want it to contain %q", names, name)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("GetRegisteredBuilderNames() = %v, want sorted order", names)
+	}
+}
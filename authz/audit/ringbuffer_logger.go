@@ -0,0 +1,77 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import "sync"
+
+// RingBufferLogger holds the most recent audit events in a fixed-size
+// in-memory ring, so operators can wire it behind a debug endpoint and
+// inspect recent decisions during an incident without depending on an
+// external log sink. It is a diagnostics aid, not durable auditing: events
+// older than the capacity are overwritten and nothing survives a restart.
+//
+// Memory use is bounded by the capacity times the size of a retained event,
+// including whatever labels and captured metadata the events carry.
+type RingBufferLogger struct {
+	mu sync.Mutex
+	// events is the ring storage; next is the slot the next event goes into.
+	// Until the ring has wrapped, len(events) is the number of events seen.
+	events   []*Event
+	next     int
+	capacity int
+}
+
+// NewRingBufferLogger returns a RingBufferLogger retaining the most recent
+// capacity events. Capacities below 1 are treated as 1.
+func NewRingBufferLogger(capacity int) *RingBufferLogger {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &RingBufferLogger{capacity: capacity}
+}
+
+// Log records the event, evicting the oldest retained event once the ring is
+// full. The event is shared with the other loggers of the policy and must not
+// be mutated.
+func (l *RingBufferLogger) Log(event *Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) < l.capacity {
+		l.events = append(l.events, event)
+		l.next = (l.next + 1) % l.capacity
+		return
+	}
+	l.events[l.next] = event
+	l.next = (l.next + 1) % l.capacity
+}
+
+// Snapshot returns the retained events, oldest first. The returned slice is
+// the caller's; the events it points to are shared and must be treated as
+// read-only.
+func (l *RingBufferLogger) Snapshot() []*Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]*Event, 0, len(l.events))
+	if len(l.events) == l.capacity {
+		out = append(out, l.events[l.next:]...)
+		out = append(out, l.events[:l.next]...)
+		return out
+	}
+	return append(out, l.events...)
+}
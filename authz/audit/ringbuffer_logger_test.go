@@ -0,0 +1,84 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/authz/audit"
+)
+
+// TestRingBufferLogger verifies that the ring retains the most recent events
+// in order, both before and after wrapping, and that a sub-minimum capacity
+// is clamped.
+func (s) TestRingBufferLogger(t *testing.T) {
+	l := audit.NewRingBufferLogger(3)
+	methods := func(events []*audit.Event) []string {
+		var out []string
+		for _, e := range events {
+			out = append(out, e.FullMethodName)
+		}
+		return out
+	}
+	if got := l.Snapshot(); len(got) != 0 {
+		t.Fatalf("Snapshot() of an empty ring returned %d events, want 0", len(got))
+	}
+	l.Log(&audit.Event{FullMethodName: "/m/1"})
+	l.Log(&audit.Event{FullMethodName: "/m/2"})
+	if diff := cmp.Diff([]string{"/m/1", "/m/2"}, methods(l.Snapshot())); diff != "" {
+		t.Errorf("Snapshot() before wrapping mismatch (-want +got):\n%s", diff)
+	}
+	l.Log(&audit.Event{FullMethodName: "/m/3"})
+	l.Log(&audit.Event{FullMethodName: "/m/4"})
+	l.Log(&audit.Event{FullMethodName: "/m/5"})
+	if diff := cmp.Diff([]string{"/m/3", "/m/4", "/m/5"}, methods(l.Snapshot())); diff != "" {
+		t.Errorf("Snapshot() after wrapping mismatch (-want +got):\n%s", diff)
+	}
+
+	l = audit.NewRingBufferLogger(0)
+	l.Log(&audit.Event{FullMethodName: "/m/1"})
+	l.Log(&audit.Event{FullMethodName: "/m/2"})
+	if diff := cmp.Diff([]string{"/m/2"}, methods(l.Snapshot())); diff != "" {
+		t.Errorf("Snapshot() with clamped capacity mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestRingBufferLoggerConcurrency exercises concurrent logging and snapshots
+// under the race detector.
+func (s) TestRingBufferLoggerConcurrency(t *testing.T) {
+	l := audit.NewRingBufferLogger(8)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				l.Log(&audit.Event{FullMethodName: fmt.Sprintf("/m/%d-%d", g, n)})
+				l.Snapshot()
+			}
+		}(g)
+	}
+	wg.Wait()
+	if got := len(l.Snapshot()); got != 8 {
+		t.Fatalf("Snapshot() returned %d events, want 8", got)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import (
+	"sync/atomic"
+)
+
+// samplingLogger wraps a delegate logger and forwards only a sample of the
+// allowed events. See NewSamplingLogger.
+type samplingLogger struct {
+	delegate Logger
+	rate     float64
+	// allowed counts the allowed events seen, driving the deterministic
+	// stride sampler in Log.
+	allowed atomic.Uint64
+}
+
+// NewSamplingLogger returns a logger that forwards every denied event to the
+// delegate but forwards allowed events at the given sample rate, for
+// deployments whose allow volume would otherwise drown the audit sink.
+// Sampling is deterministic: out of every n allowed events, the delegate
+// receives floor(n*rate), selected by an atomic counter rather than a PRNG,
+// so the wrapper is lock-free and the observed rate converges exactly to the
+// configured one. Rates below 0 are treated as 0 and rates above 1 as 1,
+// matching how other wrappers in this package handle out-of-range
+// construction values.
+func NewSamplingLogger(delegate Logger, allowSampleRate float64) Logger {
+	if allowSampleRate < 0 || allowSampleRate != allowSampleRate {
+		allowSampleRate = 0
+	}
+	if allowSampleRate > 1 {
+		allowSampleRate = 1
+	}
+	return &samplingLogger{delegate: delegate, rate: allowSampleRate}
+}
+
+// Log forwards the event to the delegate, unless it is an allowed event the
+// sampler leaves out.
+func (l *samplingLogger) Log(event *Event) {
+	if !event.Authorized {
+		l.delegate.Log(event)
+		return
+	}
+	// Forward the events at which the running total n*rate crosses an
+	// integer boundary, so any window of allowed events is sampled evenly at
+	// the configured rate.
+	n := l.allowed.Add(1)
+	if uint64(float64(n)*l.rate) > uint64(float64(n-1)*l.rate) {
+		l.delegate.Log(event)
+	}
+}
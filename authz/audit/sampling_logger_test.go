@@ -0,0 +1,98 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+)
+
+// TestSamplingLoggerRate verifies that denied events always reach the
+// delegate while allowed events arrive at the configured rate, within a
+// small tolerance, including under concurrent producers.
+func (s) TestSamplingLoggerRate(t *testing.T) {
+	const rate = 0.1
+	const producers, perProducer = 4, 2500
+	const allows = producers * perProducer
+
+	rec := &recordingLogger{}
+	l := audit.NewSamplingLogger(rec, rate)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				l.Log(&audit.Event{FullMethodName: "/pkg.Service/Api", Authorized: true})
+				l.Log(&audit.Event{FullMethodName: "/pkg.Service/Api", Authorized: false})
+			}
+		}()
+	}
+	wg.Wait()
+
+	var gotAllows, gotDenies int
+	for _, e := range rec.Events() {
+		if e.Authorized {
+			gotAllows++
+		} else {
+			gotDenies++
+		}
+	}
+	if gotDenies != allows {
+		t.Errorf("delegate received %d denied events, want all %d", gotDenies, allows)
+	}
+	if observed := float64(gotAllows) / allows; math.Abs(observed-rate) > 0.01 {
+		t.Errorf("delegate received %d of %d allowed events (rate %.4f), want rate %v within 0.01", gotAllows, allows, observed, rate)
+	}
+}
+
+// TestSamplingLoggerBounds verifies the degenerate rates and that
+// out-of-range rates are clamped.
+func (s) TestSamplingLoggerBounds(t *testing.T) {
+	tests := []struct {
+		name       string
+		rate       float64
+		wantAllows int
+	}{
+		{name: "zero", rate: 0, wantAllows: 0},
+		{name: "one", rate: 1, wantAllows: 100},
+		{name: "below range", rate: -0.5, wantAllows: 0},
+		{name: "above range", rate: 2, wantAllows: 100},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := &recordingLogger{}
+			l := audit.NewSamplingLogger(rec, test.rate)
+			for i := 0; i < 100; i++ {
+				l.Log(&audit.Event{Authorized: true})
+			}
+			l.Log(&audit.Event{Authorized: false})
+			events := rec.Events()
+			if got := len(events) - 1; got != test.wantAllows {
+				t.Errorf("delegate received %d allowed events, want %d", got, test.wantAllows)
+			}
+			if last := events[len(events)-1]; last.Authorized {
+				t.Error("delegate did not receive the denied event")
+			}
+		})
+	}
+}
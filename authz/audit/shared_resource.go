@@ -0,0 +1,100 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit
+
+import "sync"
+
+// sharedEntry is one resource in the process-wide shared pool, together with
+// its teardown and the number of outstanding handles.
+type sharedEntry struct {
+	value any
+	close func()
+	refs  int
+}
+
+var (
+	sharedMu   sync.Mutex
+	sharedPool = make(map[string]*sharedEntry)
+)
+
+// SharedResource is a handle on a reference-counted resource shared by audit
+// loggers across policies in the process, such as a connection to a common
+// backend. Every logger holding a handle sees the same underlying value; the
+// resource is torn down when the last handle is released.
+type SharedResource struct {
+	key         string
+	value       any
+	releaseOnce sync.Once
+}
+
+// AcquireShared returns a handle on the process-wide resource registered
+// under key, creating it with create on the first acquisition. Loggers should
+// derive key from the connection-relevant part of their effective config,
+// prefixed with the logger name — e.g. "nats_logger|nats://host:4222|STREAM"
+// — so identical sinks share one resource while differing configs get their
+// own. create returns the resource and its teardown function, which runs when
+// the last handle is released.
+//
+// The pool is safe for concurrent use; create runs under the pool lock, so
+// concurrent acquirers of one key never create duplicate resources, at the
+// cost of serializing slow dials.
+func AcquireShared(key string, create func() (value any, close func(), err error)) (*SharedResource, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	e := sharedPool[key]
+	if e == nil {
+		value, closeFn, err := create()
+		if err != nil {
+			return nil, err
+		}
+		e = &sharedEntry{value: value, close: closeFn}
+		sharedPool[key] = e
+	}
+	e.refs++
+	return &SharedResource{key: key, value: e.value}, nil
+}
+
+// Value returns the shared resource the handle refers to.
+func (r *SharedResource) Value() any {
+	return r.value
+}
+
+// Release gives up the handle, tearing the resource down when this was the
+// last one outstanding. Releasing the same handle again is a no-op; the value
+// must not be used after Release.
+func (r *SharedResource) Release() {
+	r.releaseOnce.Do(func() {
+		sharedMu.Lock()
+		e := sharedPool[r.key]
+		if e == nil {
+			sharedMu.Unlock()
+			return
+		}
+		e.refs--
+		if e.refs > 0 {
+			sharedMu.Unlock()
+			return
+		}
+		delete(sharedPool, r.key)
+		sharedMu.Unlock()
+		if e.close != nil {
+			e.close()
+		}
+	})
+}
@@ -0,0 +1,81 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package audit_test
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+)
+
+// TestSharedResource verifies the reference counting of the shared pool: one
+// creation per key, teardown only when the last handle is released, and
+// recreation after teardown.
+func (s) TestSharedResource(t *testing.T) {
+	created, closed := 0, 0
+	create := func() (any, func(), error) {
+		created++
+		return "resource", func() { closed++ }, nil
+	}
+	a, err := audit.AcquireShared("test_logger|backend-1", create)
+	if err != nil {
+		t.Fatalf("AcquireShared() failed: %v", err)
+	}
+	b, err := audit.AcquireShared("test_logger|backend-1", create)
+	if err != nil {
+		t.Fatalf("AcquireShared() failed: %v", err)
+	}
+	if created != 1 {
+		t.Fatalf("create ran %d times for one key, want 1", created)
+	}
+	if a.Value() != b.Value() {
+		t.Error("Handles on one key hold different values")
+	}
+
+	a.Release()
+	a.Release() // A second release of the same handle is a no-op.
+	if closed != 0 {
+		t.Fatal("Resource torn down while a handle is outstanding")
+	}
+	b.Release()
+	if closed != 1 {
+		t.Fatalf("Resource torn down %d times after the last release, want 1", closed)
+	}
+
+	// A released key is recreated on the next acquisition.
+	c, err := audit.AcquireShared("test_logger|backend-1", create)
+	if err != nil {
+		t.Fatalf("AcquireShared() failed: %v", err)
+	}
+	if created != 2 {
+		t.Errorf("create ran %d times after teardown and reacquisition, want 2", created)
+	}
+	c.Release()
+
+	// A failing create caches nothing.
+	if _, err := audit.AcquireShared("test_logger|backend-2", func() (any, func(), error) {
+		return nil, nil, errors.New("dial failed")
+	}); err == nil {
+		t.Error("AcquireShared() with a failing create succeeded, want error")
+	}
+	if _, err := audit.AcquireShared("test_logger|backend-2", create); err != nil {
+		t.Errorf("AcquireShared() after a failed create failed: %v", err)
+	}
+}
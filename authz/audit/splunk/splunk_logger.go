@@ -0,0 +1,271 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package splunk defines an audit logger that sends audit events to Splunk
+// through its HTTP Event Collector (HEC) endpoint.
+package splunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/grpclog"
+)
+
+var grpcLogger = grpclog.Component("authz-audit")
+
+// Name is the string to identify this logger type in the registry
+const Name = "splunk_hec_logger"
+
+// eventBufferSize bounds the number of audit events waiting to be sent.
+// Events are dropped, with a warning log, when the buffer is full so the RPC
+// path never blocks on the collector.
+const eventBufferSize = 256
+
+// flushTimeout bounds how long Close waits for buffered events to be sent.
+const flushTimeout = 5 * time.Second
+
+// defaultBatchSize is the number of events per request when "batch_size" is
+// not configured.
+const defaultBatchSize = 50
+
+// flushInterval is how often a partial batch is sent.
+const flushInterval = time.Second
+
+func init() {
+	audit.RegisterLoggerBuilder(&loggerBuilder{})
+}
+
+// loggerConfig represents the validated configuration for the Splunk HEC
+// logger.
+type loggerConfig struct {
+	audit.LoggerConfig
+
+	url       string
+	token     string
+	index     string
+	source    string
+	batchSize int
+}
+
+type config struct {
+	// URL is the full event collector endpoint, e.g.
+	// "https://splunk.example.com:8088/services/collector/event".
+	URL string `json:"url"`
+	// Token is the HEC token sent in the Authorization header.
+	Token string `json:"token"`
+	// Index is the Splunk index events are sent to. When empty the token's
+	// default index applies.
+	Index string `json:"index"`
+	// Source is the source field stamped on every event. When empty the
+	// collector's default applies.
+	Source string `json:"source"`
+	// BatchSize is the number of events per request; a partial batch is sent
+	// when the flush interval elapses. Defaults to 50.
+	BatchSize int `json:"batch_size"`
+}
+
+// entry is one serialized event with its capture time, held until its batch
+// is sent.
+type entry struct {
+	ts    time.Time
+	event []byte
+}
+
+// logger implements the audit.Logger interface by batching serialized events
+// and sending them to Splunk's HTTP Event Collector from a background
+// goroutine.
+type logger struct {
+	cfg    *loggerConfig
+	client *http.Client
+
+	events chan *entry
+	done   chan struct{}
+
+	closeOnce sync.Once
+}
+
+// Log enqueues the audit event for sending. It never blocks: when the buffer
+// is full the event is dropped and a warning is logged.
+func (l *logger) Log(event *audit.Event) {
+	line, err := audit.MarshalJSON(event)
+	if err != nil {
+		grpcLogger.Errorf("failed to marshal AuditEvent data: %v", err)
+		return
+	}
+	select {
+	case l.events <- &entry{ts: time.Now(), event: line}:
+	default:
+		grpcLogger.Warningf("Splunk audit logger buffer is full, dropping event for %v", event.FullMethodName)
+	}
+}
+
+// Close sends buffered events and stops the background flusher. It waits at
+// most flushTimeout for the flush.
+func (l *logger) Close() {
+	l.closeOnce.Do(func() {
+		close(l.events)
+		select {
+		case <-l.done:
+		case <-time.After(flushTimeout):
+			grpcLogger.Warningf("Splunk audit logger timed out flushing buffered events")
+		}
+	})
+}
+
+// run batches events and sends them when a batch is full or the flush
+// interval elapses, then sends the remainder when the event channel is
+// closed.
+func (l *logger) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []*entry
+	for {
+		select {
+		case e, ok := <-l.events:
+			if !ok {
+				l.send(batch)
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= l.cfg.batchSize {
+				l.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			l.send(batch)
+			batch = nil
+		}
+	}
+}
+
+// send POSTs the batch to the collector, each event wrapped in the HEC
+// envelope and the envelopes concatenated as the collector expects. Failures
+// are logged and the batch is dropped, so an unavailable collector never
+// backs up into the RPC path.
+func (l *logger) send(batch []*entry) {
+	if len(batch) == 0 {
+		return
+	}
+	type envelope struct {
+		Time   json.Number     `json:"time"`
+		Index  string          `json:"index,omitempty"`
+		Source string          `json:"source,omitempty"`
+		Event  json.RawMessage `json:"event"`
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		env := envelope{
+			Time:   json.Number(strconv.FormatFloat(float64(e.ts.UnixMilli())/1e3, 'f', 3, 64)),
+			Index:  l.cfg.index,
+			Source: l.cfg.source,
+			Event:  e.event,
+		}
+		if err := enc.Encode(env); err != nil {
+			grpcLogger.Errorf("failed to marshal HEC envelope: %v", err)
+			return
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, l.cfg.url, &body)
+	if err != nil {
+		grpcLogger.Errorf("failed to build HEC request for %q: %v", l.cfg.url, err)
+		return
+	}
+	req.Header.Set("Authorization", "Splunk "+l.cfg.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		grpcLogger.Errorf("failed to send %d audit events to Splunk at %q: %v", len(batch), l.cfg.url, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		grpcLogger.Errorf("Splunk collector %q returned status %v for %d audit events", l.cfg.url, resp.Status, len(batch))
+	}
+}
+
+type loggerBuilder struct{}
+
+func (loggerBuilder) Name() string {
+	return Name
+}
+
+// Build returns a new instance of the Splunk HEC logger with its background
+// flusher started.
+func (*loggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	lc, ok := c.(*loggerConfig)
+	if !ok {
+		grpcLogger.Errorf("Failed to build Splunk audit logger: unexpected config type %T", c)
+		return nil
+	}
+	l := &logger{
+		cfg:    lc,
+		client: &http.Client{Timeout: flushTimeout},
+		events: make(chan *entry, eventBufferSize),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// ParseLoggerConfig parses and validates the config, returning an error when
+// the collector URL or the token is missing or the URL is malformed.
+func (*loggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	var c config
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+		}
+	}
+	if c.URL == "" {
+		return nil, fmt.Errorf(`missing required field "url" in Splunk logger config`)
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid "url" in Splunk logger config: %v`, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(`invalid "url" %q in Splunk logger config: want an absolute http or https URL`, c.URL)
+	}
+	if c.Token == "" {
+		return nil, fmt.Errorf(`missing required field "token" in Splunk logger config`)
+	}
+	if c.BatchSize < 0 {
+		return nil, fmt.Errorf(`"batch_size" in Splunk logger config must not be negative`)
+	}
+	lc := &loggerConfig{
+		url:       c.URL,
+		token:     c.Token,
+		index:     c.Index,
+		source:    c.Source,
+		batchSize: c.BatchSize,
+	}
+	if lc.batchSize == 0 {
+		lc.batchSize = defaultBatchSize
+	}
+	return lc, nil
+}
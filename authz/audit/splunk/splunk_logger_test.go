@@ -0,0 +1,190 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package splunk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/internal/grpctest"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// envelope is the shape of one HEC event envelope.
+type envelope struct {
+	Time   json.Number    `json:"time"`
+	Index  string         `json:"index"`
+	Source string         `json:"source"`
+	Event  map[string]any `json:"event"`
+}
+
+// collector records the HEC requests it receives.
+type collector struct {
+	mu       sync.Mutex
+	requests [][]envelope
+	auth     []string
+
+	*httptest.Server
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read collector request body: %v", err)
+			return
+		}
+		var envelopes []envelope
+		dec := json.NewDecoder(strings.NewReader(string(body)))
+		for dec.More() {
+			var env envelope
+			if err := dec.Decode(&env); err != nil {
+				t.Errorf("Failed to decode HEC envelope in body %s: %v", body, err)
+				return
+			}
+			envelopes = append(envelopes, env)
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, envelopes)
+		c.auth = append(c.auth, r.Header.Get("Authorization"))
+		c.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(c.Server.Close)
+	return c
+}
+
+func (s) TestSplunkLoggerSendsOnClose(t *testing.T) {
+	c := newCollector(t)
+	builder := audit.GetLoggerBuilder(Name)
+	if builder == nil {
+		t.Fatalf("Failed to find %v builder in the registry", Name)
+	}
+	config, err := builder.ParseLoggerConfig(json.RawMessage(fmt.Sprintf(`{"url": %q, "token": "hec-token", "index": "grpc_audit", "source": "payments"}`, c.URL)))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	l := builder.Build(config)
+	const eventCount = 5
+	for i := 0; i < eventCount; i++ {
+		l.Log(&audit.Event{FullMethodName: fmt.Sprintf("/pkg.Service/Method%d", i), PolicyName: "test policy", Authorized: i%2 == 0})
+	}
+	l.(*logger).Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) != 1 {
+		t.Fatalf("Collector received %d requests, want 1", len(c.requests))
+	}
+	if got, want := c.auth[0], "Splunk hec-token"; got != want {
+		t.Errorf("Authorization header = %q, want %q", got, want)
+	}
+	envelopes := c.requests[0]
+	if len(envelopes) != eventCount {
+		t.Fatalf("Request carries %d envelopes, want %d", len(envelopes), eventCount)
+	}
+	for i, env := range envelopes {
+		if env.Index != "grpc_audit" || env.Source != "payments" {
+			t.Errorf("Envelope %d has index %q, source %q, want %q, %q", i, env.Index, env.Source, "grpc_audit", "payments")
+		}
+		if env.Time == "" {
+			t.Errorf("Envelope %d is missing its capture time", i)
+		}
+		if got, want := env.Event["rpc_method"], fmt.Sprintf("/pkg.Service/Method%d", i); got != want {
+			t.Errorf("Envelope %d wraps event for %v, want %v", i, got, want)
+		}
+	}
+}
+
+func (s) TestSplunkLoggerBatchSize(t *testing.T) {
+	c := newCollector(t)
+	builder := audit.GetLoggerBuilder(Name)
+	config, err := builder.ParseLoggerConfig(json.RawMessage(fmt.Sprintf(`{"url": %q, "token": "hec-token", "batch_size": 2}`, c.URL)))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	l := builder.Build(config)
+	for i := 0; i < 5; i++ {
+		l.Log(&audit.Event{FullMethodName: "/pkg.Service/Method", Authorized: true})
+	}
+	l.(*logger).Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 5 events with a batch size of 2: two full batches plus the remainder
+	// sent by Close.
+	if len(c.requests) != 3 {
+		t.Fatalf("Collector received %d requests, want 3", len(c.requests))
+	}
+	for i, want := range []int{2, 2, 1} {
+		if got := len(c.requests[i]); got != want {
+			t.Errorf("Request %d carries %d envelopes, want %d", i, got, want)
+		}
+	}
+}
+
+func (s) TestSplunkLoggerConfigErrors(t *testing.T) {
+	builder := audit.GetLoggerBuilder(Name)
+	tests := map[string]struct {
+		config  string
+		wantErr string
+	}{
+		"missing url": {
+			config:  `{"token": "hec-token"}`,
+			wantErr: `missing required field "url"`,
+		},
+		"missing token": {
+			config:  `{"url": "https://splunk.example.com:8088/services/collector/event"}`,
+			wantErr: `missing required field "token"`,
+		},
+		"relative url": {
+			config:  `{"url": "services/collector/event", "token": "hec-token"}`,
+			wantErr: `want an absolute http or https URL`,
+		},
+		"bad scheme": {
+			config:  `{"url": "nats://localhost:4222", "token": "hec-token"}`,
+			wantErr: `want an absolute http or https URL`,
+		},
+		"negative batch size": {
+			config:  `{"url": "https://splunk.example.com:8088/services/collector/event", "token": "hec-token", "batch_size": -1}`,
+			wantErr: `"batch_size"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := builder.ParseLoggerConfig(json.RawMessage(test.config)); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("ParseLoggerConfig(%v) = %v, want error containing %q", test.config, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -21,8 +21,11 @@ package stdout
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc/authz/audit"
@@ -40,37 +43,135 @@ func init() {
 	})
 }
 
-type event struct {
-	FullMethodName string `json:"rpc_method"`
-	Principal      string `json:"principal"`
-	PolicyName     string `json:"policy_name"`
-	MatchedRule    string `json:"matched_rule"`
-	Authorized     bool   `json:"authorized"`
-	Timestamp      string `json:"timestamp"` // Time when the audit event is logged via Log method
-}
-
 // logger implements the audit.logger interface by logging to standard output.
 type logger struct {
 	goLogger *log.Logger
+	msgpack  bool
+	logfmt   bool
+	// marshalJSON serializes events in the JSON format, with the configured
+	// timestamp format applied.
+	marshalJSON func(*audit.Event) ([]byte, error)
+	// mu serializes msgpack writes; the JSON path is already serialized by
+	// the log.Logger, which issues each line as a single write under its own
+	// mutex.
+	mu sync.Mutex
+	// nowFunc, when non-nil, replaces the wall clock for the JSON
+	// "timestamp" field, so tests can assert byte-exact lines without racing
+	// a second boundary. It is nil in production, where the marshalers stamp
+	// time.Now themselves. See SetClockForTesting.
+	nowFunc func() time.Time
+}
+
+// NewStdoutLoggerWithWriter returns a logger writing events to w in the
+// default JSON format, one "grpc_audit_log" container per line, for embedding
+// in tests and custom pipelines, e.g. a named pipe a sidecar reads from.
+// Concurrent Log calls are serialized, so lines never interleave; each event
+// is issued to w as a single Write call.
+func NewStdoutLoggerWithWriter(w io.Writer) audit.Logger {
+	return &logger{
+		goLogger:    log.New(w, "", 0),
+		marshalJSON: audit.MarshalJSON,
+	}
 }
 
-// Log marshals the audit.Event to json and prints it to standard output.
+// Log serializes the audit.Event and prints it to standard output. In the
+// default JSON format the canonical representation is wrapped in a
+// "grpc_audit_log" container and terminated with a newline. In msgpack
+// format the raw msgpack bytes are written with no container and no framing;
+// msgpack values are self-delimiting, so the output is a decodable stream,
+// but it is binary and meant to be redirected to a file or pipe rather than
+// a terminal. In logfmt format each event is a key=value line with no
+// container.
 func (l *logger) Log(event *audit.Event) {
+	if l.msgpack {
+		msgpackBytes, err := audit.MarshalMsgpack(event)
+		if err != nil {
+			grpcLogger.Errorf("failed to marshal AuditEvent data to msgpack: %v", err)
+			return
+		}
+		l.mu.Lock()
+		_, err = l.goLogger.Writer().Write(msgpackBytes)
+		l.mu.Unlock()
+		if err != nil {
+			grpcLogger.Errorf("failed to write msgpack AuditEvent data: %v", err)
+		}
+		return
+	}
+	if l.logfmt {
+		line, err := audit.MarshalLogfmt(event)
+		if err != nil {
+			grpcLogger.Errorf("failed to marshal AuditEvent data to logfmt: %v", err)
+			return
+		}
+		l.goLogger.Println(string(line))
+		return
+	}
+	marshal := l.marshalJSON
+	if l.nowFunc != nil {
+		marshal = func(event *audit.Event) ([]byte, error) {
+			return audit.MarshalJSONAtTime(event, l.nowFunc())
+		}
+	}
+	jsonBytes, err := marshal(event)
+	if err != nil {
+		grpcLogger.Errorf("failed to marshal AuditEvent data to JSON: %v", err)
+		return
+	}
 	jsonContainer := map[string]any{
-		"grpc_audit_log": convertEvent(event),
+		"grpc_audit_log": json.RawMessage(jsonBytes),
 	}
-	jsonBytes, err := json.Marshal(jsonContainer)
+	containerBytes, err := json.Marshal(jsonContainer)
 	if err != nil {
 		grpcLogger.Errorf("failed to marshal AuditEvent data to JSON: %v", err)
 		return
 	}
-	l.goLogger.Println(string(jsonBytes))
+	l.goLogger.Println(string(containerBytes))
+}
+
+// SetClockForTesting makes a logger produced by this package stamp the JSON
+// "timestamp" field from nowFunc instead of the wall clock, so tests can
+// assert byte-exact output. The injected clock always stamps in the default
+// RFC 3339 format, overriding a configured "timestamp_format". A nil nowFunc
+// restores the wall clock; loggers not produced by this package are left
+// untouched. It must not be called concurrently with Log.
+func SetClockForTesting(l audit.Logger, nowFunc func() time.Time) {
+	if sl, ok := l.(*logger); ok {
+		sl.nowFunc = nowFunc
+	}
+}
+
+// Close implements audit.Closer. The stdout logger writes each event
+// synchronously with no buffering of its own, so Close only waits for an
+// in-flight msgpack write to finish; no Log call may be made after it
+// returns.
+func (l *logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return nil
 }
 
 // loggerConfig represents the configuration for the stdout logger.
-// It is currently empty and implements the audit.Logger interface by embedding it.
 type loggerConfig struct {
 	audit.LoggerConfig
+
+	msgpack         bool
+	logfmt          bool
+	timestampFormat string
+	output          string
+}
+
+type config struct {
+	// Format selects the event serialization: "json" (the default),
+	// "msgpack" or "logfmt".
+	Format string `json:"format"`
+	// TimestampFormat selects the JSON "timestamp" representation: "RFC3339"
+	// (the default, a string) or "UnixMicros" (an integer microsecond value,
+	// for analytics backends such as BigQuery). It only applies to the JSON
+	// format.
+	TimestampFormat string `json:"timestamp_format"`
+	// Output selects the destination stream: "stdout" or "stderr". When
+	// empty, the builder's default destination is used.
+	Output string `json:"output"`
 }
 
 type loggerBuilder struct {
@@ -81,30 +182,54 @@ func (loggerBuilder) Name() string {
 	return Name
 }
 
-// Build returns a new instance of the stdout logger.
-// Passed in configuration is ignored as the stdout logger does not
-// expect any configuration to be provided.
-func (lb *loggerBuilder) Build(audit.LoggerConfig) audit.Logger {
-	return &logger{
-		goLogger: lb.goLogger,
+// Build returns a new instance of the stdout logger using the serialization
+// format recorded when the config was parsed. A nil or unexpected config
+// selects the default JSON format.
+func (lb *loggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	lc, _ := c.(*loggerConfig)
+	l := &logger{
+		goLogger:    lb.goLogger,
+		msgpack:     lc != nil && lc.msgpack,
+		logfmt:      lc != nil && lc.logfmt,
+		marshalJSON: audit.MarshalJSON,
 	}
-}
-
-// ParseLoggerConfig is a no-op since the stdout logger does not accept any configuration.
-func (*loggerBuilder) ParseLoggerConfig(config json.RawMessage) (audit.LoggerConfig, error) {
-	if len(config) != 0 && string(config) != "{}" {
-		grpcLogger.Warningf("Stdout logger doesn't support custom configs. Ignoring:\n%s", string(config))
+	if lc != nil && lc.timestampFormat != "" {
+		// The format was validated when the config was parsed.
+		l.marshalJSON, _ = audit.JSONMarshalerForTimestampFormat(lc.timestampFormat)
 	}
-	return &loggerConfig{}, nil
+	// The output was validated when the config was parsed.
+	if lc != nil && lc.output == "stderr" {
+		l.goLogger = log.New(os.Stderr, "", 0)
+	} else if lc != nil && lc.output == "stdout" {
+		l.goLogger = log.New(os.Stdout, "", 0)
+	}
+	return l
 }
 
-func convertEvent(auditEvent *audit.Event) *event {
-	return &event{
-		FullMethodName: auditEvent.FullMethodName,
-		Principal:      auditEvent.Principal,
-		PolicyName:     auditEvent.PolicyName,
-		MatchedRule:    auditEvent.MatchedRule,
-		Authorized:     auditEvent.Authorized,
-		Timestamp:      time.Now().Format(time.RFC3339Nano),
+// ParseLoggerConfig parses the optional "format", "timestamp_format" and
+// "output" fields; other fields are ignored with a warning since the stdout
+// logger does not use them.
+func (*loggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	var c config
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			grpcLogger.Warningf("Stdout logger doesn't support custom configs. Ignoring:\n%s", string(raw))
+			return &loggerConfig{}, nil
+		}
+	}
+	if _, err := audit.MarshalerForFormat(c.Format); err != nil {
+		return nil, err
+	}
+	if _, err := audit.JSONMarshalerForTimestampFormat(c.TimestampFormat); err != nil {
+		return nil, err
+	}
+	if c.TimestampFormat != "" && c.Format != "" && c.Format != audit.FormatJSON {
+		return nil, fmt.Errorf(`"timestamp_format" only applies to the %q format`, audit.FormatJSON)
+	}
+	switch c.Output {
+	case "", "stdout", "stderr":
+	default:
+		return nil, fmt.Errorf(`unsupported "output" %q, must be "stdout" or "stderr"`, c.Output)
 	}
+	return &loggerConfig{msgpack: c.Format == audit.FormatMsgpack, logfmt: c.Format == audit.FormatLogfmt, timestampFormat: c.TimestampFormat, output: c.Output}, nil
 }
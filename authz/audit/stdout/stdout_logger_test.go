@@ -21,13 +21,17 @@ package stdout
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"log"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/authz/audit/audittest"
 	"google.golang.org/grpc/internal/grpctest"
 )
 
@@ -35,6 +39,16 @@ type s struct {
 	grpctest.Tester
 }
 
+// event mirrors the audit event fields in the logged JSON, for assertions.
+type event struct {
+	FullMethodName string `json:"rpc_method"`
+	Principal      string `json:"principal"`
+	PolicyName     string `json:"policy_name"`
+	MatchedRule    string `json:"matched_rule"`
+	Authorized     bool   `json:"authorized"`
+	Timestamp      string `json:"timestamp"` // Time when the audit event is logged via Log method
+}
+
 func Test(t *testing.T) {
 	grpctest.RunSubTests(t, s{})
 }
@@ -138,3 +152,151 @@ func trimEvent(testEvent event) *audit.Event {
 		Authorized:     testEvent.Authorized,
 	}
 }
+
+func (s) TestStdoutLoggerBuilder_Conformance(t *testing.T) {
+	audittest.RunBuilderConformance(t, &loggerBuilder{goLogger: log.New(io.Discard, "", 0)})
+}
+
+func (s) TestStdoutLoggerTimestampFormat(t *testing.T) {
+	var buf bytes.Buffer
+	builder := &loggerBuilder{goLogger: log.New(&buf, "", 0)}
+	config, err := builder.ParseLoggerConfig(json.RawMessage(`{"timestamp_format": "UnixMicros"}`))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	before := time.Now().UnixMicro()
+	builder.Build(config).Log(&audit.Event{PolicyName: "test policy"})
+	after := time.Now().UnixMicro()
+
+	var container map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &container); err != nil {
+		t.Fatalf("Failed to unmarshal audit log event: %v", err)
+	}
+	var inner struct {
+		Timestamp json.Number `json:"timestamp"`
+	}
+	if err := json.Unmarshal(container["grpc_audit_log"], &inner); err != nil {
+		t.Fatalf("Failed to unmarshal inner audit event: %v", err)
+	}
+	// The value must be a JSON number, not a string, so schemas expecting an
+	// integer microsecond column don't break.
+	ts, err := inner.Timestamp.Int64()
+	if err != nil {
+		t.Fatalf("Timestamp %q is not an integer: %v", inner.Timestamp, err)
+	}
+	if ts < before || ts > after {
+		t.Errorf("Timestamp %d is outside of the test interval [%d, %d]", ts, before, after)
+	}
+
+	if _, err := builder.ParseLoggerConfig(json.RawMessage(`{"timestamp_format": "UnixNanos"}`)); err == nil {
+		t.Error("ParseLoggerConfig() with an unsupported timestamp_format succeeded, want error")
+	}
+	if _, err := builder.ParseLoggerConfig(json.RawMessage(`{"format": "msgpack", "timestamp_format": "UnixMicros"}`)); err == nil {
+		t.Error("ParseLoggerConfig() with timestamp_format under msgpack succeeded, want error")
+	}
+}
+
+func (s) TestStdoutLoggerWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdoutLoggerWithWriter(&buf)
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for k := 0; k < 25; k++ {
+				logger.Log(&audit.Event{FullMethodName: "/pkg.Service/Api", PolicyName: "test", Authorized: true})
+			}
+		}(n)
+	}
+	wg.Wait()
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 200 {
+		t.Fatalf("Logged lines = %d, want 200", len(lines))
+	}
+	for i, line := range lines {
+		var container map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &container); err != nil {
+			t.Fatalf("Line %d is not valid JSON: %v\n%s", i, err, line)
+		}
+		if _, ok := container["grpc_audit_log"]; !ok {
+			t.Fatalf("Line %d has no grpc_audit_log container: %s", i, line)
+		}
+	}
+}
+
+func (s) TestStdoutLoggerOutputConfig(t *testing.T) {
+	builder := audit.GetLoggerBuilder(Name)
+	for _, output := range []string{"", "stdout", "stderr"} {
+		config, err := builder.ParseLoggerConfig(json.RawMessage(`{"output": "` + output + `"}`))
+		if err != nil {
+			t.Fatalf("ParseLoggerConfig() with output %q failed: %v", output, err)
+		}
+		if builder.Build(config) == nil {
+			t.Fatalf("Build() with output %q returned nil", output)
+		}
+	}
+	if _, err := builder.ParseLoggerConfig(json.RawMessage(`{"output": "file"}`)); err == nil {
+		t.Error(`ParseLoggerConfig() with output "file" succeeded, want error`)
+	}
+}
+
+// TestStdoutLoggerFixedClock verifies that an injected clock yields a
+// byte-exact, deterministic JSON line.
+func (s) TestStdoutLoggerFixedClock(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewStdoutLoggerWithWriter(&buf)
+	SetClockForTesting(logger, func() time.Time {
+		return time.Date(2023, time.November, 14, 12, 30, 15, 0, time.UTC)
+	})
+	logger.Log(&audit.Event{
+		FullMethodName: "/pkg.Service/Api",
+		Principal:      "spiffe://example.org/backend",
+		PolicyName:     "example",
+		MatchedRule:    "dev-access",
+		Authorized:     true,
+	})
+	want := `{"grpc_audit_log":{"version":"v1","rpc_method":"/pkg.Service/Api","principal":"spiffe://example.org/backend","policy_name":"example","matched_rule":"dev-access","matched_rule_index":0,"authorized":true,"status_code_value":0,"timestamp":"2023-11-14T12:30:15Z"}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Logged line with fixed clock = %q, want %q", got, want)
+	}
+	// Restoring the wall clock returns to production behavior.
+	SetClockForTesting(logger, nil)
+	buf.Reset()
+	logger.Log(&audit.Event{FullMethodName: "/pkg.Service/Api", PolicyName: "example", Authorized: true})
+	if got := buf.String(); strings.Contains(got, "2023-11-14T12:30:15Z") {
+		t.Errorf("Logged line after clock reset still carries the fixed time: %q", got)
+	}
+}
+
+func (s) TestStdoutLoggerLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	builder := &loggerBuilder{goLogger: log.New(&buf, "", 0)}
+	config, err := builder.ParseLoggerConfig(json.RawMessage(`{"format": "logfmt"}`))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig() failed: %v", err)
+	}
+	builder.Build(config).Log(&audit.Event{
+		FullMethodName: "/pkg.Service/Api",
+		Principal:      "CN=test client, O=example",
+		PolicyName:     "test_policy",
+		MatchedRule:    "test_policy_allow",
+		Authorized:     true,
+	})
+
+	line := strings.TrimSuffix(buf.String(), "\n")
+	// The principal contains spaces and must be quoted; the other values are
+	// plain tokens and must not be.
+	wantPrefix := `fullMethodName=/pkg.Service/Api principal="CN=test client, O=example" policyName=test_policy matchedRule=test_policy_allow authorized=true timestamp=`
+	if !strings.HasPrefix(line, wantPrefix) {
+		t.Errorf("Log() produced %q, want prefix %q", line, wantPrefix)
+	}
+	ts := strings.TrimPrefix(line, wantPrefix)
+	if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		t.Errorf("Log() produced timestamp %q, want an RFC 3339 value: %v", ts, err)
+	}
+
+	if _, err := builder.ParseLoggerConfig(json.RawMessage(`{"format": "logfmt", "timestamp_format": "UnixMicros"}`)); err == nil {
+		t.Error("ParseLoggerConfig() with timestamp_format under logfmt succeeded, want error")
+	}
+}
@@ -0,0 +1,241 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package webhook defines an audit logger that POSTs audit events to an HTTP
+// ingest endpoint, e.g. a SIEM, retrying transient failures with exponential
+// backoff.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/grpclog"
+)
+
+var grpcLogger = grpclog.Component("authz-audit")
+
+// Name is the string to identify this logger type in the registry
+const Name = "webhook_logger"
+
+// eventBufferSize bounds the number of audit events waiting to be posted.
+// Events are dropped, with a warning log, when the buffer is full so the RPC
+// path never blocks on the ingest endpoint.
+const eventBufferSize = 256
+
+// flushTimeout bounds how long Close waits for buffered events to be posted.
+const flushTimeout = 5 * time.Second
+
+// defaultTimeout is the per-request timeout when "timeout_ms" is not
+// configured.
+const defaultTimeout = 5 * time.Second
+
+// defaultMaxRetries is the number of retries after a failed post when
+// "max_retries" is not configured.
+const defaultMaxRetries = 3
+
+// backoffBase is the delay before the first retry; each further retry
+// doubles it.
+const backoffBase = 100 * time.Millisecond
+
+func init() {
+	audit.RegisterLoggerBuilder(&WebhookLoggerBuilder{})
+}
+
+// loggerConfig represents the validated configuration for the webhook
+// logger.
+type loggerConfig struct {
+	audit.LoggerConfig
+
+	url        string
+	timeout    time.Duration
+	maxRetries int
+}
+
+type config struct {
+	// URL is the ingest endpoint events are POSTed to.
+	URL string `json:"url"`
+	// TimeoutMillis is the per-request timeout in milliseconds. Defaults to
+	// 5000.
+	TimeoutMillis int64 `json:"timeout_ms"`
+	// MaxRetries is how many times a post is retried after a 5xx response or
+	// a network error, with exponential backoff. Defaults to 3; 0 disables
+	// retries. Other responses are not retried.
+	MaxRetries *int `json:"max_retries"`
+}
+
+// logger implements the audit.Logger interface by posting serialized events
+// to the ingest endpoint from a background goroutine.
+type logger struct {
+	cfg    *loggerConfig
+	client *http.Client
+
+	events   chan *audit.Event
+	done     chan struct{}
+	failures atomic.Uint64
+
+	closeOnce sync.Once
+}
+
+// Log enqueues the audit event for posting. It never blocks: when the buffer
+// is full the event is dropped and a warning is logged.
+func (l *logger) Log(event *audit.Event) {
+	e := *event
+	select {
+	case l.events <- &e:
+	default:
+		grpcLogger.Warningf("webhook audit logger buffer is full, dropping event for %v", event.FullMethodName)
+	}
+}
+
+// Failures reports how many events were dropped after their posts failed,
+// including after exhausting all retries.
+func (l *logger) Failures() uint64 {
+	return l.failures.Load()
+}
+
+// Close posts buffered events and stops the background worker. It waits at
+// most flushTimeout for the flush.
+func (l *logger) Close() {
+	l.closeOnce.Do(func() {
+		close(l.events)
+		select {
+		case <-l.done:
+		case <-time.After(flushTimeout):
+			grpcLogger.Warningf("webhook audit logger timed out flushing buffered events")
+		}
+	})
+}
+
+// run posts events one at a time until the event channel is closed.
+func (l *logger) run() {
+	defer close(l.done)
+	for event := range l.events {
+		l.post(event)
+	}
+}
+
+// post POSTs the event to the configured endpoint, retrying 5xx responses
+// and network errors with exponential backoff. After exhausting the retries
+// the event is dropped and the failure counter advances, so an unavailable
+// endpoint never backs up into the RPC path.
+func (l *logger) post(event *audit.Event) {
+	body, err := audit.MarshalJSON(event)
+	if err != nil {
+		grpcLogger.Errorf("failed to marshal AuditEvent data: %v", err)
+		l.failures.Add(1)
+		return
+	}
+	backoff := backoffBase
+	for attempt := 0; ; attempt++ {
+		resp, err := l.client.Post(l.cfg.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return
+			}
+			if resp.StatusCode < 500 {
+				// Client errors will not heal on retry.
+				grpcLogger.Errorf("webhook endpoint %q rejected audit event for %v with status %v", l.cfg.url, event.FullMethodName, resp.Status)
+				l.failures.Add(1)
+				return
+			}
+			err = fmt.Errorf("status %v", resp.Status)
+		}
+		if attempt >= l.cfg.maxRetries {
+			grpcLogger.Errorf("dropping audit event for %v after %d attempts to post to %q: %v", event.FullMethodName, attempt+1, l.cfg.url, err)
+			l.failures.Add(1)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// WebhookLoggerBuilder builds webhook audit loggers from their parsed
+// configuration.
+type WebhookLoggerBuilder struct{}
+
+// Name returns the registry name of the webhook logger.
+func (WebhookLoggerBuilder) Name() string {
+	return Name
+}
+
+// Build returns a new instance of the webhook logger with its background
+// worker started.
+func (*WebhookLoggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	lc, ok := c.(*loggerConfig)
+	if !ok {
+		grpcLogger.Errorf("Failed to build webhook audit logger: unexpected config type %T", c)
+		return nil
+	}
+	l := &logger{
+		cfg:    lc,
+		client: &http.Client{Timeout: lc.timeout},
+		events: make(chan *audit.Event, eventBufferSize),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// ParseLoggerConfig parses and validates the config, returning an error when
+// the URL is missing or malformed or a numeric field is negative.
+func (*WebhookLoggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	var c config
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+		}
+	}
+	if c.URL == "" {
+		return nil, fmt.Errorf(`missing required field "url" in webhook logger config`)
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid "url" in webhook logger config: %v`, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf(`invalid "url" %q in webhook logger config: want an absolute http or https URL`, c.URL)
+	}
+	if c.TimeoutMillis < 0 {
+		return nil, fmt.Errorf(`"timeout_ms" in webhook logger config must not be negative`)
+	}
+	lc := &loggerConfig{
+		url:        c.URL,
+		timeout:    time.Duration(c.TimeoutMillis) * time.Millisecond,
+		maxRetries: defaultMaxRetries,
+	}
+	if lc.timeout == 0 {
+		lc.timeout = defaultTimeout
+	}
+	if c.MaxRetries != nil {
+		if *c.MaxRetries < 0 {
+			return nil, fmt.Errorf(`"max_retries" in webhook logger config must not be negative`)
+		}
+		lc.maxRetries = *c.MaxRetries
+	}
+	return lc, nil
+}
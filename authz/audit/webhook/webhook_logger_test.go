@@ -0,0 +1,169 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/internal/grpctest"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// flakyServer fails the first failCount requests with a 500 and records the
+// bodies of the requests that succeed.
+type flakyServer struct {
+	mu        sync.Mutex
+	failCount int
+	requests  int
+	bodies    []map[string]any
+}
+
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+	if f.requests <= f.failCount {
+		http.Error(w, "try again", http.StatusInternalServerError)
+		return
+	}
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.bodies = append(f.bodies, body)
+	w.WriteHeader(http.StatusOK)
+}
+
+func buildLogger(t *testing.T, configJSON string) *logger {
+	t.Helper()
+	builder := &WebhookLoggerBuilder{}
+	cfg, err := builder.ParseLoggerConfig(json.RawMessage(configJSON))
+	if err != nil {
+		t.Fatalf("ParseLoggerConfig(%v) failed: %v", configJSON, err)
+	}
+	l := builder.Build(cfg)
+	if l == nil {
+		t.Fatalf("Build(%v) returned nil", configJSON)
+	}
+	return l.(*logger)
+}
+
+func (s) TestWebhookLoggerRetriesThenSucceeds(t *testing.T) {
+	backend := &flakyServer{failCount: 2}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	l := buildLogger(t, `{"url": "`+server.URL+`", "max_retries": 3}`)
+	l.Log(&audit.Event{
+		FullMethodName: "/pkg.Service/Api",
+		Principal:      "spiffe://example.org/frontend",
+		PolicyName:     "test_policy",
+		MatchedRule:    "test_policy_allow",
+		Authorized:     true,
+	})
+	l.Close()
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.requests != 3 {
+		t.Errorf("backend received %d requests, want 3 (two failures then success)", backend.requests)
+	}
+	if len(backend.bodies) != 1 {
+		t.Fatalf("backend received %d events, want 1", len(backend.bodies))
+	}
+	body := backend.bodies[0]
+	if got, want := body["rpc_method"], "/pkg.Service/Api"; got != want {
+		t.Errorf("event rpc_method = %v, want %v", got, want)
+	}
+	if got, want := body["authorized"], true; got != want {
+		t.Errorf("event authorized = %v, want %v", got, want)
+	}
+	if got := l.Failures(); got != 0 {
+		t.Errorf("Failures() = %v, want 0", got)
+	}
+}
+
+func (s) TestWebhookLoggerDropsAfterRetriesExhausted(t *testing.T) {
+	backend := &flakyServer{failCount: 100}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	grpctest.TLogger.ExpectError("dropping audit event")
+	l := buildLogger(t, `{"url": "`+server.URL+`", "max_retries": 1}`)
+	l.Log(&audit.Event{FullMethodName: "/pkg.Service/Api"})
+	l.Close()
+
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if backend.requests != 2 {
+		t.Errorf("backend received %d requests, want 2 (initial attempt plus one retry)", backend.requests)
+	}
+	if got := l.Failures(); got != 1 {
+		t.Errorf("Failures() = %v, want 1", got)
+	}
+}
+
+func (s) TestWebhookLoggerConfigErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		configJSON string
+	}{
+		{
+			name:       "missing url",
+			configJSON: `{}`,
+		},
+		{
+			name:       "relative url",
+			configJSON: `{"url": "logs/ingest"}`,
+		},
+		{
+			name:       "unsupported scheme",
+			configJSON: `{"url": "ftp://siem.example.com/logs"}`,
+		},
+		{
+			name:       "negative timeout",
+			configJSON: `{"url": "https://siem.example.com/logs", "timeout_ms": -1}`,
+		},
+		{
+			name:       "negative max retries",
+			configJSON: `{"url": "https://siem.example.com/logs", "max_retries": -1}`,
+		},
+	}
+	builder := &WebhookLoggerBuilder{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := builder.ParseLoggerConfig(json.RawMessage(test.configJSON)); err == nil {
+				t.Fatalf("ParseLoggerConfig(%v) succeeded, want error", test.configJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// auditPredicate decides per authorization decision whether an audit event is
+// emitted, generalizing the ON_DENY/ON_ALLOW condition enum.
+type auditPredicate func(d *decision) bool
+
+// parseAuditConditionExpression compiles the "audit_condition_expression"
+// DSL into a predicate. The grammar is:
+//
+//	expr      := term { "or" term }
+//	term      := factor { "and" factor }
+//	factor    := "not" factor | "(" expr ")" | predicate
+//	predicate := "allow" | "deny" | "warn"
+//	           | method("<pattern>") | principal("<pattern>")
+//
+// "allow", "deny" and "warn" match the decision's outcome; a warn outcome is
+// distinct from allow. method and principal take a pattern in the same syntax
+// as the policy's "paths" and "principals" matchers: "*" matches anything, a
+// trailing "*" matches a prefix and a leading "*" matches a suffix. "and"
+// binds tighter than "or". For example, the expression
+//
+//	deny or (allow and method("/admin.*"))
+//
+// audits every denial, and allows only for admin methods.
+func parseAuditConditionExpression(expr string) (auditPredicate, error) {
+	p := &conditionParser{input: expr}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.input) {
+		return nil, fmt.Errorf("audit condition expression has trailing input at position %d: %q", p.pos, p.input[p.pos:])
+	}
+	return pred, nil
+}
+
+// conditionParser is a recursive-descent parser over the audit condition
+// expression DSL.
+type conditionParser struct {
+	input string
+	pos   int
+}
+
+func (p *conditionParser) parseOr() (auditPredicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consumeWord("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		prev := left
+		left = func(d *decision) bool { return prev(d) || right(d) }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (auditPredicate, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.consumeWord("and") {
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		prev := left
+		left = func(d *decision) bool { return prev(d) && right(d) }
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseFactor() (auditPredicate, error) {
+	if p.consumeWord("not") {
+		inner, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decision) bool { return !inner(d) }, nil
+	}
+	if p.consume("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("audit condition expression is missing %q at position %d", ")", p.pos)
+		}
+		return inner, nil
+	}
+	pos := p.pos
+	switch word := p.word(); word {
+	case "allow":
+		return func(d *decision) bool { return d.authorized && !d.warn }, nil
+	case "deny":
+		return func(d *decision) bool { return !d.authorized }, nil
+	case "warn":
+		return func(d *decision) bool { return d.warn }, nil
+	case "method":
+		m, err := p.patternArgument(word)
+		if err != nil {
+			return nil, err
+		}
+		return func(d *decision) bool { return m.match(d.in.fullMethod) }, nil
+	case "principal":
+		m, err := p.patternArgument(word)
+		if err != nil {
+			return nil, err
+		}
+		pm := &principalPatternMatcher{m: m}
+		return func(d *decision) bool { return pm.match(d.in) }, nil
+	default:
+		return nil, fmt.Errorf("audit condition expression has unknown predicate %q at position %d", word, pos)
+	}
+}
+
+// patternArgument parses the parenthesized, quoted pattern of a method or
+// principal predicate.
+func (p *conditionParser) patternArgument(predicate string) (*stringPatternMatcher, error) {
+	if !p.consume("(") {
+		return nil, fmt.Errorf("audit condition predicate %q is missing %q at position %d", predicate, "(", p.pos)
+	}
+	p.skipSpace()
+	if !p.consume(`"`) {
+		return nil, fmt.Errorf("audit condition predicate %q requires a quoted pattern at position %d", predicate, p.pos)
+	}
+	end := strings.IndexByte(p.input[p.pos:], '"')
+	if end < 0 {
+		return nil, fmt.Errorf("audit condition predicate %q has an unterminated pattern at position %d", predicate, p.pos)
+	}
+	pattern := p.input[p.pos : p.pos+end]
+	p.pos += end + 1
+	p.skipSpace()
+	if !p.consume(")") {
+		return nil, fmt.Errorf("audit condition predicate %q is missing %q at position %d", predicate, ")", p.pos)
+	}
+	return newStringPatternMatcher(pattern), nil
+}
+
+func (p *conditionParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume advances past the literal when it is next in the input.
+func (p *conditionParser) consume(literal string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], literal) {
+		p.pos += len(literal)
+		return true
+	}
+	return false
+}
+
+// consumeWord advances past the keyword when it is the next word in the
+// input. Unlike consume it does not match a prefix of a longer word.
+func (p *conditionParser) consumeWord(keyword string) bool {
+	pos := p.pos
+	if p.word() == keyword {
+		return true
+	}
+	p.pos = pos
+	return false
+}
+
+// word reads the next run of letters and underscores.
+func (p *conditionParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			break
+		}
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
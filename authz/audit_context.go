@@ -0,0 +1,54 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import "context"
+
+// auditContextKey is the context key under which WithAuditContextValue
+// accumulates its values.
+type auditContextKey struct{}
+
+// WithAuditContextValue returns a context carrying a key-value pair to be
+// copied into the Labels of every audit event emitted for the RPC. It lets
+// interceptors earlier in the chain contribute fields they compute, such as a
+// request ID or a tenant, without the authz package knowing about them: an
+// interceptor attaches the value to the context it passes down, and the
+// attached values reach the authorization interceptors through both the unary
+// and the stream paths.
+//
+// All values share one flat namespace with each other and with labels set by
+// an event enricher, so keys should carry an application prefix, e.g.
+// "myapp.request_id". Values must already be strings; stringify other types
+// before attaching them. Attaching a key again overwrites its value for the
+// returned context.
+func WithAuditContextValue(ctx context.Context, key, value string) context.Context {
+	prev, _ := ctx.Value(auditContextKey{}).(map[string]string)
+	merged := make(map[string]string, len(prev)+1)
+	for k, v := range prev {
+		merged[k] = v
+	}
+	merged[key] = value
+	return context.WithValue(ctx, auditContextKey{}, merged)
+}
+
+// auditContextValues returns the values attached to the context with
+// WithAuditContextValue, or nil when there are none. The returned map must
+// not be mutated.
+func auditContextValues(ctx context.Context) map[string]string {
+	m, _ := ctx.Value(auditContextKey{}).(map[string]string)
+	return m
+}
@@ -0,0 +1,61 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package authztest_test
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/authz/authztest"
+	"google.golang.org/grpc/metadata"
+)
+
+// BenchmarkStaticPolicy demonstrates how to benchmark an authorization policy
+// with a representative mix of allowed and denied RPCs.
+func BenchmarkStaticPolicy(b *testing.B) {
+	policy := `{
+		"name": "authz",
+		"allow_rules":
+		[
+			{
+				"name": "allow_UnaryCall",
+				"request": {
+					"paths": ["/grpc.testing.TestService/UnaryCall"]
+				}
+			}
+		],
+		"deny_rules":
+		[
+			{
+				"name": "deny_admin",
+				"request": {
+					"paths": ["/grpc.testing.TestService/Admin*"]
+				}
+			}
+		]
+	}`
+	inputs := []authztest.Input{
+		{FullMethod: "/grpc.testing.TestService/UnaryCall"},
+		{FullMethod: "/grpc.testing.TestService/AdminCall"},
+		{
+			FullMethod: "/grpc.testing.TestService/UnaryCall",
+			Metadata:   metadata.Pairs("key-abc", "val-abc"),
+		},
+	}
+	authztest.BenchmarkPolicy(b, policy, inputs)
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"unsafe"
+)
+
+// candidateState is an immutable snapshot of a staged candidate policy: the
+// compiled engine that promotion flips to, and the engine shadow decisions
+// are evaluated against.
+type candidateState struct {
+	policy *authorizationPolicy
+	engine *staticEngine
+	// shadow evaluates mirrored decisions. It is built without audit loggers,
+	// so shadow decisions emit no audit events, and is nil when no decision
+	// callback is configured.
+	shadow *policyEngine
+	// report is the decision callback shadow decisions are reported through.
+	report func(DecisionInfo)
+	// canary holds the principals of WithCanaryPrincipals, which are enforced
+	// against the candidate while it is staged.
+	canary map[string]bool
+}
+
+// StageCandidate compiles the given policy and holds it alongside the active
+// one, for a two-phase rollout within one process: stage, observe, then flip
+// atomically with PromoteCandidate. While a candidate is staged, the
+// interceptor keeps two compiled policies in memory; the candidate is
+// released on promotion or discard. Staging again replaces a previously
+// staged candidate.
+//
+// When a decision callback is configured with WithDecisionCallback, every
+// RPC's decision is additionally mirrored to the staged candidate and
+// reported through the callback with DecisionInfo.Shadow set. Shadow
+// decisions never affect the RPC and emit no audit events, but evaluating
+// them doubles the policy evaluation work per RPC.
+//
+// When canary principals are configured with WithCanaryPrincipals, RPCs from
+// those principals are evaluated and enforced against the staged candidate,
+// with audit events carrying the candidate's policy hash, while all other
+// traffic stays on the active policy.
+func (i *StaticInterceptor) StageCandidate(authzPolicy string) error {
+	policy, err := parseAuthorizationPolicy(authzPolicy)
+	if err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	engine, err := newStaticEngine(policy, i.opts)
+	if err != nil {
+		return err
+	}
+	cs := &candidateState{policy: policy, engine: engine}
+	var io interceptorOptions
+	for _, opt := range i.opts {
+		opt.apply(&io)
+	}
+	if len(io.canaryPrincipals) > 0 {
+		cs.canary = make(map[string]bool, len(io.canaryPrincipals))
+		for _, p := range io.canaryPrincipals {
+			cs.canary[p] = true
+		}
+	}
+	if io.decisionCallback != nil {
+		cs.report = io.decisionCallback
+		// Build a dedicated policy engine for the silent shadow decisions:
+		// without audit loggers, so shadowing emits no audit events, without
+		// the decision callback, which the interceptor invokes itself with
+		// the shadow flag set, and without periodic summaries, which only
+		// the active policy emits.
+		shadowPolicy := *policy
+		shadowPolicy.AuditLoggingOptions = auditLoggingOptions{}
+		io.decisionCallback = nil
+		io.summaryInterval = 0
+		io.summaryLogger = nil
+		if cs.shadow, err = newPolicyEngine(&shadowPolicy, io); err != nil {
+			engine.release()
+			return err
+		}
+	}
+	if prev := (*candidateState)(atomic.SwapPointer(&i.candidate, unsafe.Pointer(cs))); prev != nil {
+		prev.engine.release()
+	}
+	return nil
+}
+
+// PromoteCandidate atomically makes the staged candidate the active policy.
+// In-flight RPCs finish against the engine snapshot they loaded; the replaced
+// policy's audit loggers are closed once the last of them does. Subsequent
+// RPCs are evaluated by the promoted policy. It is an error when no candidate
+// is staged.
+func (i *StaticInterceptor) PromoteCandidate() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	cs := (*candidateState)(atomic.LoadPointer(&i.candidate))
+	if cs == nil {
+		return errors.New("authz: no candidate policy staged")
+	}
+	i.policy = cs.policy
+	// The candidate slot's reference on cs.engine transfers to the active
+	// engine slot, so only the replaced engine is released.
+	old := (*staticEngine)(atomic.SwapPointer(&i.engine, unsafe.Pointer(cs.engine)))
+	old.release()
+	atomic.StorePointer(&i.candidate, nil)
+	reportMissingLoggers(cs.policy, i.opts)
+	return nil
+}
+
+// DiscardCandidate drops the staged candidate, if any, keeping the active
+// policy unchanged.
+func (i *StaticInterceptor) DiscardCandidate() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if cs := (*candidateState)(atomic.SwapPointer(&i.candidate, nil)); cs != nil {
+		cs.engine.release()
+	}
+}
+
+// engineFor returns the engine snapshot to enforce the RPC with: the staged
+// candidate when the RPC's principal is a canary principal, otherwise the
+// active engine. Principal resolution failures fall back to the active
+// engine, so canary routing never affects callers outside the canary set.
+func (i *StaticInterceptor) engineFor(ctx context.Context) *staticEngine {
+	cs := (*candidateState)(atomic.LoadPointer(&i.candidate))
+	if cs == nil || len(cs.canary) == 0 {
+		return i.currentEngine()
+	}
+	in, err := newRPCInput(ctx)
+	if err != nil {
+		return i.currentEngine()
+	}
+	if pe := cs.engine.policyEngine; pe != nil {
+		pe.resolvePrincipal(in)
+	}
+	if cs.canary[in.principal()] {
+		return cs.engine
+	}
+	return i.currentEngine()
+}
+
+// shadowDecide mirrors the RPC's decision to the staged candidate policy and
+// reports it through the decision callback with the shadow flag set. It is a
+// no-op when no candidate is staged or no callback is configured, and shadow
+// evaluation failures are ignored: shadowing must never affect the RPC.
+func (i *StaticInterceptor) shadowDecide(ctx context.Context) {
+	cs := (*candidateState)(atomic.LoadPointer(&i.candidate))
+	if cs == nil || cs.shadow == nil {
+		return
+	}
+	d, err := cs.shadow.decide(ctx)
+	if err != nil {
+		return
+	}
+	cs.report(DecisionInfo{FullMethodName: d.in.fullMethod, Authorized: d.authorized, MatchedRule: d.matchedRule, Shadow: true})
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cel provides the CEL evaluator behind the "condition" field of
+// authorization policy rules. It lives in its own module so that the core
+// authz package does not carry the CEL runtime; importing this package, for
+// its side effect alone, enables conditions:
+//
+//	import _ "google.golang.org/grpc/authz/cel"
+package cel
+
+import (
+	"fmt"
+
+	celgo "github.com/google/cel-go/cel"
+	"google.golang.org/grpc/authz/internal"
+)
+
+func init() {
+	internal.CELConditionCompiler = compile
+}
+
+// celEnv is the shared compilation environment for rule "condition"
+// expressions. The environment is immutable, so one instance serves every
+// rule.
+var celEnv = func() *celgo.Env {
+	env, err := celgo.NewEnv(
+		celgo.Variable("request", celgo.MapType(celgo.StringType, celgo.DynType)),
+		celgo.Variable("source", celgo.MapType(celgo.StringType, celgo.DynType)),
+	)
+	if err != nil {
+		panic(fmt.Sprintf("authz/cel: building CEL environment: %v", err))
+	}
+	return env
+}()
+
+// compile compiles a rule's "condition" CEL expression into an evaluation
+// function over the request attributes. The expression sees two variables:
+//
+//   - request: a map with "method", the full RPC method name, and "headers",
+//     a map of lowercase metadata keys to their first value
+//   - source: a map with "principal", the caller identity as audit events
+//     record it
+//
+// Evaluation errors, such as indexing a missing key, make the condition
+// false.
+func compile(expr string) (func(method string, headers map[string]string, principal string) bool, error) {
+	ast, iss := celEnv.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf(`"condition" %v`, iss.Err())
+	}
+	if ast.OutputType() != celgo.BoolType {
+		return nil, fmt.Errorf(`"condition" must evaluate to a boolean, got %v`, ast.OutputType())
+	}
+	program, err := celEnv.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf(`"condition" %v`, err)
+	}
+	return func(method string, headers map[string]string, principal string) bool {
+		out, _, err := program.Eval(map[string]any{
+			"request": map[string]any{"method": method, "headers": headers},
+			"source":  map[string]any{"principal": principal},
+		})
+		if err != nil {
+			return false
+		}
+		b, ok := out.Value().(bool)
+		return ok && b
+	}, nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cel_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz"
+	_ "google.golang.org/grpc/authz/cel"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/internal/grpctest"
+	"google.golang.org/grpc/internal/transport"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// fakeServerTransportStream is a minimal grpc.ServerTransportStream carrying
+// the method name.
+type fakeServerTransportStream struct {
+	method string
+}
+
+func (s *fakeServerTransportStream) Method() string               { return s.method }
+func (s *fakeServerTransportStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeServerTransportStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeServerTransportStream) SetTrailer(metadata.MD) error { return nil }
+
+// testConn returns a connection to attach to test contexts, shared across
+// tests, as the RBAC engines resolve the local address from it.
+var testConn = func() func() net.Conn {
+	var once sync.Once
+	var conn net.Conn
+	return func() net.Conn {
+		once.Do(func() {
+			lis, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				panic(err)
+			}
+			go func() {
+				c, _ := lis.Accept()
+				if c != nil {
+					defer c.Close()
+				}
+			}()
+			if conn, err = net.Dial("tcp", lis.Addr().String()); err != nil {
+				panic(err)
+			}
+		})
+		return conn
+	}
+}()
+
+// rpcContext returns a context shaped like an incoming RPC for the given
+// method and metadata.
+func rpcContext(method string, md metadata.MD) context.Context {
+	if md == nil {
+		md = metadata.MD{}
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}})
+	ctx = transport.SetConnection(ctx, testConn())
+	return grpc.NewContextWithServerTransportStream(ctx, &fakeServerTransportStream{method: method})
+}
+
+// TestCELCondition verifies that a rule's "condition" CEL expression gates
+// the rule alongside its structural matchers and that invalid expressions
+// are rejected at construction.
+func (s) TestCELCondition(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "tenant_acme",
+				"request": {"paths": ["/pkg.Service/*"]},
+				"condition": "request.headers['x-tenant'] == 'acme'"
+			}
+		]
+	}`
+	i, err := authz.NewStatic(policy)
+	if err != nil {
+		t.Fatalf("authz.NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	ctx := rpcContext("/pkg.Service/Api", metadata.Pairs("x-tenant", "acme"))
+	if _, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Errorf("RPC with matching condition failed: %v", err)
+	}
+	ctx = rpcContext("/pkg.Service/Api", metadata.Pairs("x-tenant", "globex"))
+	if _, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RPC with non-matching condition returned %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	// A missing header makes the condition false rather than erroring.
+	ctx = rpcContext("/pkg.Service/Api", nil)
+	if _, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RPC without the header returned %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+
+	// The condition composes with the structural matchers: a path outside
+	// the rule is denied even when the condition holds.
+	ctx = rpcContext("/other.Service/Api", metadata.Pairs("x-tenant", "acme"))
+	if _, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RPC outside the rule paths returned %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+
+	invalid := []struct {
+		name      string
+		condition string
+	}{
+		{"malformed", "request.headers['x-tenant'] =="},
+		{"non-boolean", "request.method"},
+	}
+	for _, test := range invalid {
+		policy := fmt.Sprintf(`{
+			"name": "authz",
+			"allow_rules": [
+				{
+					"name": "all",
+					"request": {"paths": ["*"]},
+					"condition": %q
+				}
+			]
+		}`, test.condition)
+		if _, err := authz.NewStatic(policy); err == nil || !strings.Contains(err.Error(), `"condition"`) {
+			t.Errorf("authz.NewStatic() with %s condition returned error %v, want one mentioning \"condition\"", test.name, err)
+		}
+	}
+}
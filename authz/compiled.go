@@ -0,0 +1,349 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	v3rbacpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
+	internalmatcher "google.golang.org/grpc/internal/xds/matcher"
+	"google.golang.org/grpc/internal/xds/rbac"
+	"google.golang.org/protobuf/proto"
+)
+
+// compiledPolicyVersion identifies the compiled policy format produced by
+// Compile. It is bumped whenever the format changes incompatibly; loads of a
+// mismatched version are rejected.
+const compiledPolicyVersion = "v2"
+
+// compiledPolicy is the serialized form produced by Compile: the parsed
+// policy, the marshaled RBAC translation and the compiled matcher sets, so
+// loading needs neither a JSON parse, a translation pass nor a rule
+// compilation pass.
+type compiledPolicy struct {
+	Version    string
+	PolicyName string
+	// PolicyHash is the precomputed stable hash stamped on audit events.
+	PolicyHash string
+	// Policy is the parsed policy, kept for the parts of engine construction
+	// that are process-local by nature: extended matchers, audit loggers and
+	// the interceptor's own policy bookkeeping.
+	Policy *authorizationPolicy
+	// Rbacs holds the proto-marshaled RBAC translation of the policy, used to
+	// rebuild the RBAC engines for policies that do not require the authz
+	// policy engine.
+	Rbacs [][]byte
+	// Deny, Warn and Allow are the compiled matcher sets of the corresponding
+	// rule lists, for policies evaluated by the authz policy engine.
+	Deny  []compiledRuleSpec
+	Warn  []compiledRuleSpec
+	Allow []compiledRuleSpec
+}
+
+// compiledPattern is the serialized form of a classified string pattern: the
+// patternKind plus the pattern with its "*" markers already stripped.
+type compiledPattern struct {
+	Kind    int
+	Pattern string
+}
+
+// compiledHeader is the serialized form of one "headers" entry: the
+// lowercased key and the classified value patterns.
+type compiledHeader struct {
+	Key      string
+	Patterns []compiledPattern
+}
+
+// compiledRuleSpec is the serialized form of a compiledRule. Regex paths are
+// carried as their sources — a compiled *regexp.Regexp has no serializable
+// form — and extended matchers are not carried at all, since they hold
+// process-local state; both are rebuilt by restoreRules.
+type compiledRuleSpec struct {
+	Name              string
+	Index             int
+	Principals        []compiledPattern
+	Paths             []compiledPattern
+	RegexPaths        []string
+	Headers           []compiledHeader
+	Lockout           bool
+	DelayMillis       int64
+	RateLimited       bool
+	StreamLimited     bool
+	DecompressionBomb bool
+	OCSPStapled       bool
+	RedirectAuthority string
+	AuditCondition    *int32
+}
+
+// Compile parses, validates, translates and compiles the authorization policy
+// and serializes the result, so short-lived workloads can pay the policy
+// compilation cost once ahead of time and load the compiled form at process
+// start with NewFromCompiled. Policies using extension-module matchers, such
+// as "condition" or "require_ocsp_stapled", need the corresponding module
+// imported by the compiling binary as well. The compiled format is versioned
+// and is not stable across releases: a compiled policy is only loadable by
+// the version that produced it and should be regenerated on upgrade.
+func Compile(authzPolicy string) ([]byte, error) {
+	policy, err := parseAuthorizationPolicy(authzPolicy)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+	rbacs, policyName, err := translatePolicy(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	hash, err := policyHash(policy)
+	if err != nil {
+		return nil, err
+	}
+	deny, warn, allow, err := compileRuleSets(policy)
+	if err != nil {
+		return nil, err
+	}
+	cp := &compiledPolicy{
+		Version:    compiledPolicyVersion,
+		PolicyName: policyName,
+		PolicyHash: hash,
+		Policy:     policy,
+		Deny:       ruleSpecs(deny, policy.DenyRules),
+		Warn:       ruleSpecs(warn, policy.WarnRules),
+		Allow:      ruleSpecs(allow, policy.AllowRules),
+	}
+	for _, r := range rbacs {
+		marshaled, err := proto.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		cp.Rbacs = append(cp.Rbacs, marshaled)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ruleSpecs converts compiled rules into their serialized form. Header
+// matchers do not expose their classification, so it is recovered from the
+// source rules instead.
+func ruleSpecs(compiled []*compiledRule, rules []rule) []compiledRuleSpec {
+	specs := make([]compiledRuleSpec, 0, len(compiled))
+	for i, cr := range compiled {
+		spec := compiledRuleSpec{
+			Name:              cr.name,
+			Index:             cr.index,
+			Lockout:           cr.lockout,
+			DelayMillis:       cr.delay.Milliseconds(),
+			RateLimited:       cr.rateLimited,
+			StreamLimited:     cr.streamLimited,
+			DecompressionBomb: cr.decompressionBomb,
+			OCSPStapled:       cr.ocspStapled,
+			RedirectAuthority: cr.redirectAuthority,
+		}
+		if cr.auditCondition != nil {
+			c := int32(*cr.auditCondition)
+			spec.AuditCondition = &c
+		}
+		for _, p := range cr.principals {
+			spec.Principals = append(spec.Principals, compiledPattern{Kind: int(p.m.kind), Pattern: p.m.pattern})
+		}
+		for _, p := range cr.paths {
+			spec.Paths = append(spec.Paths, compiledPattern{Kind: int(p.kind), Pattern: p.pattern})
+		}
+		for _, re := range cr.pathRegexps {
+			spec.RegexPaths = append(spec.RegexPaths, re.String())
+		}
+		for _, h := range rules[i].Request.Headers {
+			ch := compiledHeader{Key: strings.ToLower(h.Key)}
+			for _, value := range h.Values {
+				m := newStringPatternMatcher(value)
+				ch.Patterns = append(ch.Patterns, compiledPattern{Kind: int(m.kind), Pattern: m.pattern})
+			}
+			spec.Headers = append(spec.Headers, ch)
+		}
+		specs = append(specs, spec)
+	}
+	return specs
+}
+
+// restoreRules rebuilds compiled rules from their serialized form. The
+// classified patterns load as-is; regex programs are recompiled from their
+// sources and extended matchers are rebuilt from the source rules, the two
+// parts of a compiled rule that cannot be serialized.
+func restoreRules(specs []compiledRuleSpec, rules []rule) ([]*compiledRule, error) {
+	if len(specs) != len(rules) {
+		return nil, fmt.Errorf("malformed compiled policy: %d compiled rules for %d policy rules", len(specs), len(rules))
+	}
+	compiled := make([]*compiledRule, 0, len(specs))
+	for i, spec := range specs {
+		cr := &compiledRule{
+			name:              spec.Name,
+			index:             spec.Index,
+			lockout:           spec.Lockout,
+			delay:             time.Duration(spec.DelayMillis) * time.Millisecond,
+			rateLimited:       spec.RateLimited,
+			streamLimited:     spec.StreamLimited,
+			decompressionBomb: spec.DecompressionBomb,
+			ocspStapled:       spec.OCSPStapled,
+			redirectAuthority: spec.RedirectAuthority,
+		}
+		if spec.AuditCondition != nil {
+			c := v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition(*spec.AuditCondition)
+			cr.auditCondition = &c
+		}
+		for _, p := range spec.Principals {
+			cr.principals = append(cr.principals, &principalPatternMatcher{m: &stringPatternMatcher{kind: patternKind(p.Kind), pattern: p.Pattern}})
+		}
+		for _, p := range spec.Paths {
+			cr.paths = append(cr.paths, &stringPatternMatcher{kind: patternKind(p.Kind), pattern: p.Pattern})
+		}
+		for _, src := range spec.RegexPaths {
+			re, err := regexp.Compile(src)
+			if err != nil {
+				return nil, fmt.Errorf("malformed compiled policy: %v", err)
+			}
+			cr.pathRegexps = append(cr.pathRegexps, re)
+		}
+		for _, h := range spec.Headers {
+			values := make([]internalmatcher.HeaderMatcher, 0, len(h.Patterns))
+			for _, p := range h.Patterns {
+				values = append(values, headerMatcherForKind(h.Key, patternKind(p.Kind), p.Pattern))
+			}
+			cr.headers = append(cr.headers, values)
+		}
+		ext, err := compileRuleExt(rules[i])
+		if err != nil {
+			return nil, err
+		}
+		cr.ext = ext
+		compiled = append(compiled, cr)
+	}
+	return compiled, nil
+}
+
+// restorePolicyEngine rebuilds the policy engine from the compiled matcher
+// sets, taking the place of compilePolicy on the load path.
+func restorePolicyEngine(cp *compiledPolicy, opts interceptorOptions) (*policyEngine, error) {
+	policy := cp.Policy
+	e := &policyEngine{policyName: policy.Name, policyHash: cp.PolicyHash, opts: opts}
+	var err error
+	if e.denyRules, err = restoreRules(cp.Deny, policy.DenyRules); err != nil {
+		return nil, fmt.Errorf(`"deny_rules" %v`, err)
+	}
+	if e.warnRules, err = restoreRules(cp.Warn, policy.WarnRules); err != nil {
+		return nil, fmt.Errorf(`"warn_rules" %v`, err)
+	}
+	if e.allowRules, err = restoreRules(cp.Allow, policy.AllowRules); err != nil {
+		return nil, fmt.Errorf(`"allow_rules" %v`, err)
+	}
+	if e.auditCondition, err = parseAuditCondition(policy.AuditLoggingOptions.AuditCondition); err != nil {
+		return nil, err
+	}
+	if expr := policy.AuditLoggingOptions.AuditConditionExpression; expr != "" {
+		if e.auditPredicate, err = parseAuditConditionExpression(expr); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.wireMatchers(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// NewFromCompiled returns a new StaticInterceptor from a compiled policy
+// produced by Compile, skipping the JSON parse, the RBAC translation and the
+// rule compilation that NewStatic performs: the classified principal, path
+// and header patterns load as serialized. Regex paths are recompiled from
+// their sources and extended matchers are rebuilt, since compiled regex
+// programs and matcher state such as rate-limiter buckets cannot be
+// serialized; audit loggers are likewise built fresh, as they hold
+// connections and other process-local state.
+func NewFromCompiled(compiled []byte, opts ...Option) (*StaticInterceptor, error) {
+	var cp compiledPolicy
+	if err := gob.NewDecoder(bytes.NewReader(compiled)).Decode(&cp); err != nil {
+		return nil, fmt.Errorf("malformed compiled policy: %v", err)
+	}
+	if cp.Version != compiledPolicyVersion {
+		return nil, fmt.Errorf("compiled policy version %q is not supported, want %q; regenerate it with Compile", cp.Version, compiledPolicyVersion)
+	}
+	if cp.Policy == nil {
+		return nil, fmt.Errorf("malformed compiled policy: no policy present")
+	}
+	var engine *staticEngine
+	if cp.Policy.requiresPolicyEngine() || len(opts) > 0 {
+		var io interceptorOptions
+		for _, opt := range opts {
+			opt.apply(&io)
+		}
+		if len(cp.Policy.AllowRules) == 0 && !io.defaultAllow {
+			return nil, fmt.Errorf(`"allow_rules" is not present and WithDefaultAllow is not set`)
+		}
+		pe, err := restorePolicyEngine(&cp, io)
+		if err != nil {
+			return nil, err
+		}
+		if err := pe.initRuntime(cp.Policy, io); err != nil {
+			return nil, err
+		}
+		engine = &staticEngine{policyEngine: pe}
+	} else {
+		if len(cp.Policy.AllowRules) == 0 {
+			return nil, fmt.Errorf(`"allow_rules" is not present and WithDefaultAllow is not set`)
+		}
+		rbacs := make([]*v3rbacpb.RBAC, 0, len(cp.Rbacs))
+		for _, marshaled := range cp.Rbacs {
+			r := &v3rbacpb.RBAC{}
+			if err := proto.Unmarshal(marshaled, r); err != nil {
+				return nil, fmt.Errorf("malformed compiled policy: %v", err)
+			}
+			rbacs = append(rbacs, r)
+		}
+		chainEngine, err := rbac.NewChainEngine(rbacs, cp.PolicyName)
+		if err != nil {
+			return nil, err
+		}
+		engine = &staticEngine{engines: *chainEngine}
+	}
+	engine.refs.Store(1)
+	i := &StaticInterceptor{policy: cp.Policy, opts: opts}
+	atomic.StorePointer(&i.engine, unsafe.Pointer(engine))
+	reportMissingLoggers(cp.Policy, opts)
+	return i, nil
+}
+
+// GobEncode serializes the logger config through its JSON form, as the
+// structpb config value has no gob representation.
+func (a *auditLogger) GobEncode() ([]byte, error) {
+	return json.Marshal(a)
+}
+
+// GobDecode is the inverse of GobEncode.
+func (a *auditLogger) GobDecode(data []byte) error {
+	return json.Unmarshal(data, a)
+}
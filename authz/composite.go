@@ -0,0 +1,158 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CompositeInterceptor evaluates several authorization policies as one unit,
+// with deny overriding allow across all of them, and emits exactly one audit
+// event per RPC. Chaining the policies' interceptors instead would log one
+// event per policy for the same RPC; the composite avoids that
+// double-emission.
+//
+// Policies are evaluated in the order they were passed to NewComposite and
+// evaluation stops at the first policy that denies the RPC. The decisive
+// policy, through whose loggers and audit condition the single event is
+// emitted, is the denying policy when one denies, and the first policy
+// otherwise.
+type CompositeInterceptor struct {
+	engines []*staticEngine
+}
+
+// NewComposite returns a CompositeInterceptor evaluating the given policies
+// as one unit. The composite captures each policy as it is at construction
+// time and holds a reference on each captured engine: later dynamic rule
+// changes on and Close calls to the member interceptors are not reflected,
+// and the members' audit loggers stay usable until the composite itself is
+// closed. Interceptor options such as stream lifecycle auditing only apply
+// to the member interceptors themselves, not to the composite.
+func NewComposite(policies ...*StaticInterceptor) (*CompositeInterceptor, error) {
+	if len(policies) == 0 {
+		return nil, errors.New("authz: no policies to compose")
+	}
+	engines := make([]*staticEngine, 0, len(policies))
+	releaseAll := func() {
+		for _, e := range engines {
+			e.release()
+		}
+	}
+	for _, p := range policies {
+		e := p.currentEngine()
+		if e.policyEngine == nil {
+			// The member evaluates through the RBAC engines, which couple
+			// deciding and audit logging. Rebuild it as a policy engine the
+			// composite owns, so the composite can decide first and log once.
+			var io interceptorOptions
+			for _, opt := range p.opts {
+				opt.apply(&io)
+			}
+			engine, err := newPolicyEngine(p.policy, io)
+			if err != nil {
+				releaseAll()
+				return nil, err
+			}
+			e = &staticEngine{policyEngine: engine}
+			e.refs.Store(1)
+			engines = append(engines, e)
+			continue
+		}
+		if !e.acquire() {
+			releaseAll()
+			return nil, errors.New("authz: cannot compose a closed interceptor")
+		}
+		engines = append(engines, e)
+	}
+	return &CompositeInterceptor{engines: engines}, nil
+}
+
+// Close releases the composite's references on the captured engines. An
+// engine shared with a member interceptor is stopped, and its audit loggers
+// closed, once both sides have released it and in-flight RPCs have finished.
+// The composite must not be used after Close.
+func (c *CompositeInterceptor) Close() {
+	for _, e := range c.engines {
+		e.release()
+	}
+}
+
+// isAuthorized evaluates the policies in order and emits one audit event
+// through the decisive policy.
+func (c *CompositeInterceptor) isAuthorized(ctx context.Context) error {
+	var decisive *policyEngine
+	var d *decision
+	for _, e := range c.engines {
+		engine := e.policyEngine
+		di, err := engine.decide(ctx)
+		if err != nil {
+			return err
+		}
+		if !di.authorized {
+			decisive, d = engine, di
+			break
+		}
+		if d == nil {
+			decisive, d = engine, di
+		}
+	}
+	auditErr := decisive.doAuditLogging(d, nil)
+	if stErr := d.statusErr(); stErr != nil {
+		d.tarpit()
+		return stErr
+	}
+	return auditErr
+}
+
+// UnaryInterceptor intercepts incoming Unary RPC requests.
+// Only authorized requests are allowed to pass. Otherwise, an unauthorized
+// error is returned to the client.
+func (c *CompositeInterceptor) UnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	err := c.isAuthorized(ctx)
+	if err != nil {
+		if status.Code(err) == codes.PermissionDenied {
+			if logger.V(2) {
+				logger.Infof("unauthorized RPC request rejected: %v", err)
+			}
+			return nil, status.Errorf(codes.PermissionDenied, "unauthorized RPC request rejected")
+		}
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor intercepts incoming Stream RPC requests.
+// Only authorized requests are allowed to pass. Otherwise, an unauthorized
+// error is returned to the client.
+func (c *CompositeInterceptor) StreamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := c.isAuthorized(ss.Context())
+	if err != nil {
+		if status.Code(err) == codes.PermissionDenied {
+			if logger.V(2) {
+				logger.Infof("unauthorized RPC request rejected: %v", err)
+			}
+			return status.Errorf(codes.PermissionDenied, "unauthorized RPC request rejected")
+		}
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"sync"
+)
+
+// concurrentStreamsMatch is the JSON shape of the "max_concurrent_streams"
+// matcher.
+type concurrentStreamsMatch struct {
+	Limit int    `json:"limit"`
+	Per   string `json:"per"`
+}
+
+// concurrentStreamsMatcher matches RPCs admitted while the caller already has
+// limit or more streams running, so a deny rule carrying it caps how many
+// concurrent streams a single identity can hold; exceeded RPCs are denied
+// with RESOURCE_EXHAUSTED and audited like any other deny. Counts are keyed
+// by the RPC's principal, method or both, per "per".
+//
+// The stream interceptor increments the count when an authorized stream's
+// handler starts and decrements it when the handler returns, which covers
+// abnormal termination: a cancelled, aborted or panicking stream still
+// unwinds through the handler. Only streaming RPCs are counted; unary RPCs
+// evaluate the matcher against the current stream counts but never change
+// them. All state is guarded by a single mutex, making the matcher safe for
+// concurrent RPCs, and a key's entry is removed when its last stream ends, so
+// the map only holds identities with streams in flight.
+type concurrentStreamsMatcher struct {
+	limit int
+	per   string
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newConcurrentStreamsMatcher(m *concurrentStreamsMatch) (*concurrentStreamsMatcher, error) {
+	if m.Limit < 1 {
+		return nil, fmt.Errorf(`"max_concurrent_streams" requires "limit" of at least 1`)
+	}
+	switch m.Per {
+	case "principal", "method", "principal_method":
+	case "":
+		m.Per = "principal"
+	default:
+		return nil, fmt.Errorf(`"max_concurrent_streams" has unsupported "per" %q, must be one of "principal", "method", "principal_method"`, m.Per)
+	}
+	return &concurrentStreamsMatcher{limit: m.Limit, per: m.Per, active: make(map[string]int)}, nil
+}
+
+// key returns the counting key for the RPC per the configured scope.
+func (m *concurrentStreamsMatcher) key(in *rpcInput) string {
+	switch m.per {
+	case "principal":
+		return in.principal()
+	case "method":
+		return in.fullMethod
+	default:
+		return in.principal() + "|" + in.fullMethod
+	}
+}
+
+// match reports whether admitting the RPC would exceed the stream limit.
+func (m *concurrentStreamsMatcher) match(in *rpcInput) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active[m.key(in)] >= m.limit
+}
+
+// acquire counts a started stream and returns the release that uncounts it.
+func (m *concurrentStreamsMatcher) acquire(in *rpcInput) func() {
+	key := m.key(in)
+	m.mu.Lock()
+	m.active[key]++
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.active[key] <= 1 {
+			delete(m.active, key)
+			return
+		}
+		m.active[key]--
+	}
+}
+
+// trackStream counts the stream into the policy's "max_concurrent_streams"
+// matchers and returns the release the interceptor defers to uncount it when
+// the handler returns.
+func (e *policyEngine) trackStream(in *rpcInput) func() {
+	releases := make([]func(), 0, len(e.streamLimits))
+	for _, m := range e.streamLimits {
+		releases = append(releases, m.acquire(in))
+	}
+	return func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/authz/internal"
+)
+
+// conditionMatcher evaluates a rule's "condition" CEL expression against the
+// request attributes, so a rule can combine attributes the structural
+// matchers cannot express, e.g. a header value together with a principal
+// prefix. The rule matches only when both its structural matchers and the
+// condition evaluate to true.
+//
+// The CEL runtime lives in the separate google.golang.org/grpc/authz/cel
+// module and is reached through internal.CELConditionCompiler, so that
+// policies without conditions do not pull it into the build. Compiling a
+// policy that uses "condition" fails unless that package is imported.
+type conditionMatcher struct {
+	eval func(method string, headers map[string]string, principal string) bool
+}
+
+func newConditionMatcher(expr string) (*conditionMatcher, error) {
+	compile, ok := internal.CELConditionCompiler.(func(string) (func(string, map[string]string, string) bool, error))
+	if !ok {
+		return nil, fmt.Errorf(`"condition" requires the CEL evaluator: import "google.golang.org/grpc/authz/cel" to enable it`)
+	}
+	eval, err := compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &conditionMatcher{eval: eval}, nil
+}
+
+func (m *conditionMatcher) match(in *rpcInput) bool {
+	headers := make(map[string]string, len(in.md))
+	for k, vs := range in.md {
+		if len(vs) > 0 {
+			headers[k] = vs[0]
+		}
+	}
+	return m.eval(in.fullMethod, headers, in.principal())
+}
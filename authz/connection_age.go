@@ -0,0 +1,91 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// connAgeKey is the context key under which the connection's establishment
+// time recorded by ConnectionAgeTracking is stored.
+type connAgeKey struct{}
+
+// ConnectionAgeTracking returns a grpc.ServerOption that records the
+// establishment time of every accepted connection, enabling the
+// "connection_age" matcher:
+//
+//	"request": {"connection_age": {"max_ms": 3600000}}
+//
+// The time is recorded by a stats handler when the connection is tagged and
+// stored in the connection's context, from which every RPC context on that
+// connection inherits it. The state lives and dies with the connection: it is
+// released when the connection ends, with no per-connection bookkeeping
+// outside the context. Without this option installed on the server, no
+// establishment time is recorded and "connection_age" matchers never match.
+func ConnectionAgeTracking() grpc.ServerOption {
+	return grpc.StatsHandler(&connAgeTracker{})
+}
+
+// connAgeTracker is a stats.Handler whose only job is to stamp the
+// establishment time into each connection context.
+type connAgeTracker struct{}
+
+func (c *connAgeTracker) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connAgeKey{}, time.Now())
+}
+
+func (c *connAgeTracker) HandleConn(context.Context, stats.ConnStats) {}
+
+func (c *connAgeTracker) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connAgeTracker) HandleRPC(context.Context, stats.RPCStats) {}
+
+// connectionAgeMatch is the JSON shape of the "connection_age" matcher.
+type connectionAgeMatch struct {
+	MaxMillis *int64 `json:"max_ms"`
+}
+
+// connectionAgeMatcher matches RPCs arriving over connections older than
+// max_ms, e.g. in a deny rule forcing clients on connections that predate a
+// certificate rotation to reconnect and re-handshake. It requires the stats
+// handler installed by ConnectionAgeTracking; RPCs on connections without a
+// recorded establishment time never match.
+type connectionAgeMatcher struct {
+	max time.Duration
+}
+
+func newConnectionAgeMatcher(m *connectionAgeMatch) (*connectionAgeMatcher, error) {
+	if m.MaxMillis == nil {
+		return nil, fmt.Errorf(`"connection_age" requires "max_ms"`)
+	}
+	if *m.MaxMillis <= 0 {
+		return nil, fmt.Errorf(`"connection_age" requires a positive "max_ms", got %d`, *m.MaxMillis)
+	}
+	return &connectionAgeMatcher{max: time.Duration(*m.MaxMillis) * time.Millisecond}, nil
+}
+
+func (m *connectionAgeMatcher) match(in *rpcInput) bool {
+	established, ok := in.ctx.Value(connAgeKey{}).(time.Time)
+	return ok && time.Since(established) > m.max
+}
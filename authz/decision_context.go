@@ -0,0 +1,62 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+)
+
+// Decision describes the authorization decision made for an allowed RPC. It
+// is stored in the RPC context so interceptors chained after the authz
+// interceptor can tell which rule allowed a request without re-evaluating
+// the policy.
+type Decision struct {
+	// PolicyName is the name of the authorization policy that was evaluated.
+	PolicyName string
+	// MatchedRule is the absolute name of the rule that allowed the RPC,
+	// e.g. "policy_rule". It is empty when the RPC was allowed without a
+	// matching rule, such as by WithDefaultAllow.
+	MatchedRule string
+	// Principal is the peer identity the decision was made for, resolved
+	// from the client certificate or a configured principal source. It is
+	// empty for unauthenticated peers.
+	Principal string
+}
+
+// decisionContextKey is the context key the Decision of an allowed RPC is
+// stored under.
+type decisionContextKey struct{}
+
+// newDecisionContext returns a context carrying the Decision derived from an
+// allowing policy engine decision.
+func newDecisionContext(ctx context.Context, policyName string, d *decision) context.Context {
+	return context.WithValue(ctx, decisionContextKey{}, &Decision{
+		PolicyName:  policyName,
+		MatchedRule: d.matchedRule,
+		Principal:   d.in.principal(),
+	})
+}
+
+// DecisionFromContext returns the authorization Decision made for the RPC,
+// if any. A Decision is present in handlers and interceptors chained after
+// the authz interceptor when the RPC was allowed by the authz policy engine;
+// denied RPCs never reach them, and policies translated directly to RBAC
+// engines do not record one.
+func DecisionFromContext(ctx context.Context) (*Decision, bool) {
+	d, ok := ctx.Value(decisionContextKey{}).(*Decision)
+	return d, ok
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+)
+
+// AddRule appends the rule described by ruleJSON, in the same JSON format as
+// the rules in an authorization policy, to the policy's list selected by
+// action: "allow", "deny" or "warn". The compiled matchers are rebuilt with
+// the change applied and swapped in atomically; in-flight RPCs keep using the
+// snapshot they were admitted under. If the resulting policy is invalid, the
+// active policy is left unchanged and the validation error is returned.
+//
+// Rules added this way bypass any policy source the interceptor was loaded
+// from: when the interceptor is managed by a FileWatcherInterceptor, the next
+// file reload builds a fresh interceptor from the file contents and rules
+// added here are discarded.
+func (i *StaticInterceptor) AddRule(action string, ruleJSON string) error {
+	var r rule
+	d := json.NewDecoder(bytes.NewReader([]byte(ruleJSON)))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&r); err != nil {
+		return fmt.Errorf("failed to unmarshal rule: %v", err)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	policy := i.policy.clone()
+	switch action {
+	case "allow":
+		policy.AllowRules = append(policy.AllowRules, r)
+	case "deny":
+		policy.DenyRules = append(policy.DenyRules, r)
+	case "warn":
+		policy.WarnRules = append(policy.WarnRules, r)
+	default:
+		return fmt.Errorf(`unsupported action %q, must be one of "allow", "deny", "warn"`, action)
+	}
+	return i.updatePolicy(policy)
+}
+
+// RemoveRule removes the rule with the given name, as written in the policy,
+// from whichever rule list contains it and atomically rebuilds the compiled
+// matchers. In-flight RPCs keep using the snapshot they were admitted under.
+// It is an error if no rule with that name exists. The same file reload
+// caveat as for AddRule applies.
+func (i *StaticInterceptor) RemoveRule(name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	policy := i.policy.clone()
+	found := false
+	for _, rules := range []*[]rule{&policy.DenyRules, &policy.WarnRules, &policy.AllowRules} {
+		kept := (*rules)[:0:0]
+		for _, r := range *rules {
+			if r.Name == name {
+				found = true
+				continue
+			}
+			kept = append(kept, r)
+		}
+		*rules = kept
+	}
+	if !found {
+		return fmt.Errorf("no rule named %q in the policy", name)
+	}
+	return i.updatePolicy(policy)
+}
+
+// updatePolicy validates the policy by compiling it and, on success, swaps in
+// the new engine snapshot. The replaced snapshot is released rather than
+// stopped outright: RPCs admitted under it keep using it, and its audit
+// loggers are closed once the last of them finishes. The caller must hold
+// i.mu.
+func (i *StaticInterceptor) updatePolicy(policy *authorizationPolicy) error {
+	engine, err := newStaticEngine(policy, i.opts)
+	if err != nil {
+		return err
+	}
+	i.policy = policy
+	old := (*staticEngine)(atomic.SwapPointer(&i.engine, unsafe.Pointer(engine)))
+	old.release()
+	return nil
+}
+
+// clone returns a copy of the policy whose rule lists can be modified without
+// affecting the original.
+func (p *authorizationPolicy) clone() *authorizationPolicy {
+	out := *p
+	out.DenyRules = append([]rule(nil), p.DenyRules...)
+	out.WarnRules = append([]rule(nil), p.WarnRules...)
+	out.AllowRules = append([]rule(nil), p.AllowRules...)
+	return &out
+}
@@ -0,0 +1,736 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/authz/internal"
+	"google.golang.org/grpc/credentials"
+)
+
+// timeoutBucketMatch is the JSON shape of the "timeout_bucket" matcher.
+type timeoutBucketMatch struct {
+	MinMillis  *int64 `json:"min_millis"`
+	MaxMillis  *int64 `json:"max_millis"`
+	NoDeadline bool   `json:"no_deadline"`
+}
+
+// timeoutBucketMatcher classifies RPCs by their declared timeout. Clients
+// send the timeout on the wire in the "grpc-timeout" header as a value and a
+// unit ("H", "M", "S", "m", "u" or "n", e.g. "10S"); the transport parses it
+// into the context deadline, from which the engine reads the remaining time
+// when the RPC reaches the interceptor. An RPC matches when that time, in
+// milliseconds, is at least min_millis (when set) and less than max_millis
+// (when set). RPCs without a deadline only match when no_deadline is set, in
+// which case the bounds are ignored.
+type timeoutBucketMatcher struct {
+	minMillis  int64
+	maxMillis  int64
+	noDeadline bool
+}
+
+func newTimeoutBucketMatcher(m *timeoutBucketMatch) (*timeoutBucketMatcher, error) {
+	if !m.NoDeadline && m.MinMillis == nil && m.MaxMillis == nil {
+		return nil, fmt.Errorf(`"timeout_bucket" requires at least one of "min_millis", "max_millis", "no_deadline"`)
+	}
+	out := &timeoutBucketMatcher{maxMillis: int64(^uint64(0) >> 1), noDeadline: m.NoDeadline}
+	if m.MinMillis != nil {
+		if *m.MinMillis < 0 {
+			return nil, fmt.Errorf(`"timeout_bucket" requires a non-negative "min_millis", got %d`, *m.MinMillis)
+		}
+		out.minMillis = *m.MinMillis
+	}
+	if m.MaxMillis != nil {
+		if *m.MaxMillis <= out.minMillis {
+			return nil, fmt.Errorf(`"timeout_bucket" requires "max_millis" greater than "min_millis"`)
+		}
+		out.maxMillis = *m.MaxMillis
+	}
+	return out, nil
+}
+
+func (m *timeoutBucketMatcher) match(in *rpcInput) bool {
+	if in.deadlineMillis < 0 {
+		return m.noDeadline
+	}
+	if m.noDeadline {
+		return false
+	}
+	return in.deadlineMillis >= m.minMillis && in.deadlineMillis < m.maxMillis
+}
+
+// This file holds the extended request matchers that have no RBAC proto
+// representation and are evaluated by the authz policy engine.
+
+// retryAttemptMatch is the JSON shape of the "retry_attempt" matcher.
+type retryAttemptMatch struct {
+	Min *int `json:"min"`
+}
+
+// retryAttemptMatcher matches RPCs whose retry attempt count, read from the
+// "grpc-previous-rpc-attempts" metadata header, is at least min. The header is
+// set by the gRPC client retry machinery on transparent and configured
+// retries; when it is absent or unparsable the RPC is treated as attempt 0.
+type retryAttemptMatcher struct {
+	min int
+}
+
+func newRetryAttemptMatcher(m *retryAttemptMatch) (*retryAttemptMatcher, error) {
+	if m.Min == nil {
+		return nil, fmt.Errorf(`"retry_attempt" requires "min"`)
+	}
+	if *m.Min < 0 {
+		return nil, fmt.Errorf(`"retry_attempt" requires a non-negative "min", got %d`, *m.Min)
+	}
+	return &retryAttemptMatcher{min: *m.Min}, nil
+}
+
+func (m *retryAttemptMatcher) match(in *rpcInput) bool {
+	attempts := 0
+	if values := in.md.Get("grpc-previous-rpc-attempts"); len(values) > 0 {
+		if parsed, err := strconv.Atoi(values[0]); err == nil && parsed > 0 {
+			attempts = parsed
+		}
+	}
+	return attempts >= m.min
+}
+
+// certExtensionMatch is the JSON shape of the "cert_extension" matcher.
+type certExtensionMatch struct {
+	OID      string   `json:"oid"`
+	Values   []string `json:"values"`
+	Encoding string   `json:"encoding"`
+}
+
+// certExtensionMatcher matches RPCs by the value of a custom X.509 extension
+// in the verified peer certificate, identified by its OID in dotted-decimal
+// form. How the extension bytes are compared against the configured values
+// depends on "encoding":
+//
+//   - "raw" (the default): the raw DER-encoded extension value is compared
+//     byte-for-byte against the configured values
+//   - "asn1_string": the extension value is decoded as a single ASN.1 string
+//     (UTF8String, PrintableString or IA5String) before comparison
+//
+// Connections not authenticated with a client certificate over TLS never
+// match.
+type certExtensionMatcher struct {
+	oid        []int
+	values     map[string]bool
+	asn1String bool
+}
+
+func newCertExtensionMatcher(m *certExtensionMatch) (*certExtensionMatcher, error) {
+	if m.OID == "" {
+		return nil, fmt.Errorf(`"cert_extension" requires "oid"`)
+	}
+	var oid []int
+	for _, part := range strings.Split(m.OID, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf(`"cert_extension" has malformed "oid" %q`, m.OID)
+		}
+		oid = append(oid, n)
+	}
+	if len(m.Values) == 0 {
+		return nil, fmt.Errorf(`"cert_extension" requires at least one entry in "values"`)
+	}
+	asn1String := false
+	switch m.Encoding {
+	case "", "raw":
+	case "asn1_string":
+		asn1String = true
+	default:
+		return nil, fmt.Errorf(`"cert_extension" has unsupported "encoding" %q, must be "raw" or "asn1_string"`, m.Encoding)
+	}
+	values := make(map[string]bool, len(m.Values))
+	for _, v := range m.Values {
+		values[v] = true
+	}
+	return &certExtensionMatcher{oid: oid, values: values, asn1String: asn1String}, nil
+}
+
+func (m *certExtensionMatcher) match(in *rpcInput) bool {
+	if in.authType != "tls" || len(in.certs) == 0 {
+		return false
+	}
+	for _, ext := range in.certs[0].Extensions {
+		if !oidEqual(ext.Id, m.oid) {
+			continue
+		}
+		value := string(ext.Value)
+		if m.asn1String {
+			var s string
+			if _, err := asn1.Unmarshal(ext.Value, &s); err != nil {
+				return false
+			}
+			value = s
+		}
+		return m.values[value]
+	}
+	return false
+}
+
+func oidEqual(id asn1.ObjectIdentifier, oid []int) bool {
+	if len(id) != len(oid) {
+		return false
+	}
+	for i, n := range oid {
+		if id[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// certFingerprintsMatch is the JSON shape of the "cert_fingerprints" matcher.
+type certFingerprintsMatch struct {
+	SHA256 []string `json:"sha256"`
+}
+
+// certFingerprintsMatcher matches RPCs by the SHA-256 fingerprint of the
+// peer's leaf certificate, e.g. in a deny rule blocking specific compromised
+// certificates while their revocation propagates. Fingerprints are lowercase
+// hex over the DER-encoded certificate, the same encoding recorded in
+// audit.Event.CertFingerprintSHA256; uppercase hex in the policy is accepted
+// and normalized. Connections not authenticated with a client certificate
+// never match.
+type certFingerprintsMatcher struct {
+	sha256 map[string]bool
+}
+
+func newCertFingerprintsMatcher(m *certFingerprintsMatch) (*certFingerprintsMatcher, error) {
+	if len(m.SHA256) == 0 {
+		return nil, fmt.Errorf(`"cert_fingerprints" requires at least one fingerprint in "sha256"`)
+	}
+	fingerprints := make(map[string]bool, len(m.SHA256))
+	for _, fp := range m.SHA256 {
+		fp = strings.ToLower(fp)
+		if raw, err := hex.DecodeString(fp); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf(`"cert_fingerprints" fingerprint %q is not a hex-encoded SHA-256 digest`, fp)
+		}
+		fingerprints[fp] = true
+	}
+	return &certFingerprintsMatcher{sha256: fingerprints}, nil
+}
+
+func (m *certFingerprintsMatcher) match(in *rpcInput) bool {
+	fp := in.certFingerprint()
+	return fp != "" && m.sha256[fp]
+}
+
+// requestCompressionMatch is the JSON shape of the "request_compression"
+// matcher.
+type requestCompressionMatch struct {
+	Required *bool `json:"required"`
+}
+
+// requestCompressionMatcher matches RPCs by whether the request payload is
+// compressed, read from the "grpc-encoding" metadata header the client sends
+// when it applies a message compressor. An RPC is considered compressed when
+// the header is present with a value other than "identity"; an absent header
+// means no compression was negotiated and the RPC is treated as uncompressed.
+// With "required" set, uncompressed RPCs match, so a deny rule can block
+// uncompressed requests to specific methods; with "required" unset,
+// compressed RPCs match.
+type requestCompressionMatcher struct {
+	required bool
+}
+
+func newRequestCompressionMatcher(m *requestCompressionMatch) (*requestCompressionMatcher, error) {
+	if m.Required == nil {
+		return nil, fmt.Errorf(`"request_compression" requires "required"`)
+	}
+	return &requestCompressionMatcher{required: *m.Required}, nil
+}
+
+func (m *requestCompressionMatcher) match(in *rpcInput) bool {
+	compressed := false
+	if values := in.md.Get("grpc-encoding"); len(values) > 0 && values[0] != "identity" {
+		compressed = true
+	}
+	if m.required {
+		return !compressed
+	}
+	return compressed
+}
+
+// messageSizesKey is the context key under which WithMessageSizes stores the
+// request's wire sizes.
+type messageSizesKey struct{}
+
+// messageSizes holds the compressed and decompressed sizes of a request
+// payload.
+type messageSizes struct {
+	compressed   int64
+	decompressed int64
+}
+
+// WithMessageSizes returns a context carrying the compressed and decompressed
+// sizes of the request payload, for the "max_decompression_ratio" matcher. The
+// interceptor itself runs before the request payload is read, so the sizes
+// must be piped in by whatever component observes them, e.g. a stats handler
+// or a wrapping codec; without them the matcher is skipped.
+//
+// # Experimental
+//
+// Notice: This API is EXPERIMENTAL and may be changed or removed in a later
+// release.
+func WithMessageSizes(ctx context.Context, compressedBytes, decompressedBytes int64) context.Context {
+	return context.WithValue(ctx, messageSizesKey{}, messageSizes{compressed: compressedBytes, decompressed: decompressedBytes})
+}
+
+// decompressionRatioMatcher guards against decompression bombs: it matches
+// RPCs whose decompressed-to-compressed payload size ratio exceeds the
+// configured maximum, so a deny rule can reject them on specific methods. It
+// only matches when both sizes were piped into the RPC context with
+// WithMessageSizes and the compressed size is positive; RPCs without size
+// information never match.
+//
+// # Experimental
+//
+// Notice: This matcher is EXPERIMENTAL and may be changed or removed in a
+// later release.
+type decompressionRatioMatcher struct {
+	max float64
+}
+
+func newDecompressionRatioMatcher(max float64) (*decompressionRatioMatcher, error) {
+	if max < 1 {
+		return nil, fmt.Errorf(`"max_decompression_ratio" must be at least 1, got %v`, max)
+	}
+	return &decompressionRatioMatcher{max: max}, nil
+}
+
+func (m *decompressionRatioMatcher) match(in *rpcInput) bool {
+	sizes, ok := in.ctx.Value(messageSizesKey{}).(messageSizes)
+	if !ok || sizes.compressed <= 0 {
+		return false
+	}
+	return float64(sizes.decompressed)/float64(sizes.compressed) > m.max
+}
+
+// userAgentMatch is the JSON shape of the "user_agent" matcher.
+type userAgentMatch struct {
+	RegexMatch string   `json:"regex_match"`
+	Values     []string `json:"values"`
+}
+
+// userAgentMatcher matches RPCs by the "user-agent" metadata header, so a
+// deny rule can block outdated client library versions on sensitive methods.
+// grpc-go clients send "grpc-go/<version>" (e.g. "grpc-go/1.59.0"), with an
+// application-supplied prefix in front when grpc.WithUserAgent is used; other
+// gRPC implementations send their own analogous identifiers. The header
+// matches when the regex in "regex_match" matches it or when it matches one
+// of the patterns in "values", which use the same syntax as the policy's
+// "paths" matchers. RPCs without a user-agent header never match, so a deny
+// rule on this matcher alone does not block clients that omit the header.
+//
+// Version enforcement is best rolled out by first pairing the rule with audit
+// logging to observe matching clients, then enforcing.
+type userAgentMatcher struct {
+	re     *regexp.Regexp
+	values []*stringPatternMatcher
+}
+
+func newUserAgentMatcher(m *userAgentMatch) (*userAgentMatcher, error) {
+	if m.RegexMatch == "" && len(m.Values) == 0 {
+		return nil, fmt.Errorf(`"user_agent" requires at least one of "regex_match", "values"`)
+	}
+	out := &userAgentMatcher{}
+	if m.RegexMatch != "" {
+		re, err := regexp.Compile(m.RegexMatch)
+		if err != nil {
+			return nil, fmt.Errorf(`"user_agent" has invalid "regex_match": %v`, err)
+		}
+		out.re = re
+	}
+	for _, v := range m.Values {
+		out.values = append(out.values, newStringPatternMatcher(v))
+	}
+	return out, nil
+}
+
+func (m *userAgentMatcher) match(in *rpcInput) bool {
+	values := in.md.Get("user-agent")
+	if len(values) == 0 {
+		return false
+	}
+	ua := values[0]
+	if m.re != nil && m.re.MatchString(ua) {
+		return true
+	}
+	for _, v := range m.values {
+		if v.match(ua) {
+			return true
+		}
+	}
+	return false
+}
+
+// ocspStapledMatcher matches RPCs arriving over TLS connections whose
+// handshake carried a stapled OCSP response reporting the certificate status
+// as good, for methods that need a revocation freshness guarantee beyond the
+// certificate's own validity period. The response is read from the TLS
+// connection state; when the peer's issuing certificate is available in the
+// presented chain the response signature is verified against it, and a
+// NextUpdate time in the past makes the staple stale and the matcher not
+// match.
+//
+// Stapling for client certificates is only possible from TLS 1.3 onward and
+// depends on the TLS stack exposing the response in the connection state;
+// connections that are not mutual TLS, or whose handshake did not carry a
+// staple, never match.
+//
+// The OCSP response parser lives in the separate
+// google.golang.org/grpc/authz/ocsp module and is reached through
+// internal.VerifyOCSPStaple, so that policies without the matcher do not pull
+// golang.org/x/crypto into the build. Compiling a policy that uses
+// "require_ocsp_stapled" fails unless that package is imported.
+type ocspStapledMatcher struct {
+	verify func(staple []byte, issuer *x509.Certificate) bool
+}
+
+func newOCSPStapledMatcher(required *bool) (*ocspStapledMatcher, error) {
+	if !*required {
+		return nil, fmt.Errorf(`"require_ocsp_stapled" only supports the value true`)
+	}
+	verify, ok := internal.VerifyOCSPStaple.(func([]byte, *x509.Certificate) bool)
+	if !ok {
+		return nil, fmt.Errorf(`"require_ocsp_stapled" requires the OCSP parser: import "google.golang.org/grpc/authz/ocsp" to enable it`)
+	}
+	return &ocspStapledMatcher{verify: verify}, nil
+}
+
+func (m *ocspStapledMatcher) match(in *rpcInput) bool {
+	if in.peerInfo == nil || in.peerInfo.AuthInfo == nil {
+		return false
+	}
+	tlsInfo, ok := in.peerInfo.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.OCSPResponse) == 0 {
+		return false
+	}
+	var issuer *x509.Certificate
+	if len(in.certs) > 1 {
+		issuer = in.certs[1]
+	}
+	return m.verify(tlsInfo.State.OCSPResponse, issuer)
+}
+
+// sharedSecretKey is one accepted secret of the "shared_secret" matcher and
+// the principal recorded for callers presenting it.
+type sharedSecretKey struct {
+	Principal string `json:"principal"`
+	// Value is the secret in the clear. Exactly one of Value and HMACSHA256
+	// must be set.
+	Value string `json:"value"`
+	// HMACSHA256 is the lowercase hex HMAC-SHA256 of the secret under the
+	// matcher's "hmac_key", so policy files need not contain the secret
+	// itself.
+	HMACSHA256 string `json:"hmac_sha256"`
+}
+
+// sharedSecretMatch is the JSON shape of the "shared_secret" matcher.
+type sharedSecretMatch struct {
+	Header  string            `json:"header"`
+	HMACKey string            `json:"hmac_key"`
+	Keys    []sharedSecretKey `json:"keys"`
+}
+
+// sharedSecretMatcher matches RPCs presenting a configured shared secret in
+// a metadata header, for legacy clients that cannot authenticate with mTLS
+// or JWTs. Comparisons are constant time, every configured key is checked on
+// every RPC so the number of keys does not leak through timing, and a
+// matching key's principal is recorded as the caller identity in audit
+// events, with "shared_secret" as the principal source. An absent header or
+// a value matching no key never matches.
+//
+// A shared secret in a header is weaker than mTLS: it is replayable and
+// visible to anything that can read the request metadata. Scope rules using
+// it narrowly, to the specific legacy methods that need it.
+type sharedSecretMatcher struct {
+	header  string
+	hmacKey []byte
+	keys    []compiledSharedSecretKey
+}
+
+type compiledSharedSecretKey struct {
+	principal string
+	value     []byte
+	hmac      []byte
+}
+
+func newSharedSecretMatcher(m *sharedSecretMatch) (*sharedSecretMatcher, error) {
+	if m.Header == "" {
+		return nil, fmt.Errorf(`"shared_secret" requires "header"`)
+	}
+	if len(m.Keys) == 0 {
+		return nil, fmt.Errorf(`"shared_secret" requires at least one entry in "keys"`)
+	}
+	sm := &sharedSecretMatcher{header: strings.ToLower(m.Header), hmacKey: []byte(m.HMACKey)}
+	for i, k := range m.Keys {
+		if k.Principal == "" {
+			return nil, fmt.Errorf(`"shared_secret" key %d requires "principal"`, i)
+		}
+		if (k.Value == "") == (k.HMACSHA256 == "") {
+			return nil, fmt.Errorf(`"shared_secret" key %q requires exactly one of "value" and "hmac_sha256"`, k.Principal)
+		}
+		ck := compiledSharedSecretKey{principal: k.Principal, value: []byte(k.Value)}
+		if k.HMACSHA256 != "" {
+			if m.HMACKey == "" {
+				return nil, fmt.Errorf(`"shared_secret" requires "hmac_key" when keys use "hmac_sha256"`)
+			}
+			digest, err := hex.DecodeString(strings.ToLower(k.HMACSHA256))
+			if err != nil || len(digest) != sha256.Size {
+				return nil, fmt.Errorf(`"shared_secret" key %q has an invalid "hmac_sha256": want a hex-encoded HMAC-SHA256 digest`, k.Principal)
+			}
+			ck.value = nil
+			ck.hmac = digest
+		}
+		sm.keys = append(sm.keys, ck)
+	}
+	return sm, nil
+}
+
+func (m *sharedSecretMatcher) match(in *rpcInput) bool {
+	values := in.md.Get(m.header)
+	if len(values) == 0 {
+		return false
+	}
+	presented := []byte(values[0])
+	var presentedHMAC []byte
+	if len(m.hmacKey) > 0 {
+		mac := hmac.New(sha256.New, m.hmacKey)
+		mac.Write(presented)
+		presentedHMAC = mac.Sum(nil)
+	}
+	// Check every key so the position of the matching one does not leak
+	// through timing.
+	principal := ""
+	for _, k := range m.keys {
+		if k.hmac != nil {
+			if hmac.Equal(presentedHMAC, k.hmac) {
+				principal = k.principal
+			}
+		} else if subtle.ConstantTimeCompare(presented, k.value) == 1 {
+			principal = k.principal
+		}
+	}
+	if principal == "" {
+		return false
+	}
+	in.extractedPrincipal = principal
+	in.principalSource = "shared_secret"
+	return true
+}
+
+// knownMethodMatcher implements the "known_method" matcher, which matches on
+// whether the method is in the known-method set supplied with
+// WithKnownMethods. With "known_method": false a deny rule blocks probes for
+// methods the server does not implement, distinctly from denials of real
+// methods. Without WithKnownMethods the set is empty and no method is known.
+type knownMethodMatcher struct {
+	want bool
+	// methods is the shared known-method set, injected by compilePolicy after
+	// the rules are compiled. It is static after construction.
+	methods map[string]bool
+}
+
+func newKnownMethodMatcher(want *bool) (*knownMethodMatcher, error) {
+	return &knownMethodMatcher{want: *want}, nil
+}
+
+func (m *knownMethodMatcher) match(in *rpcInput) bool {
+	return m.methods[in.fullMethod] == m.want
+}
+
+// tlsMatch is the JSON shape of the "tls" matcher.
+type tlsMatch struct {
+	// MinVersion is the minimum negotiated TLS protocol version, as "1.0",
+	// "1.1", "1.2" or "1.3".
+	MinVersion string `json:"min_version"`
+	// CipherSuites are the acceptable negotiated cipher suites, by the IANA
+	// names crypto/tls uses, e.g. "TLS_AES_256_GCM_SHA384" or
+	// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+	CipherSuites []string `json:"cipher_suites"`
+}
+
+// tlsVersions maps the "min_version" strings of the "tls" matcher to the
+// protocol version constants of crypto/tls.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsConnectionMatcher implements the "tls" matcher, which matches RPCs on
+// connections whose negotiated TLS version and cipher suite meet the
+// configured bar, so crypto compliance can be enforced per method: an allow
+// rule requiring "1.3" only admits TLS 1.3 callers, and a deny rule blocks
+// weak connections on sensitive methods. Non-TLS connections never match.
+type tlsConnectionMatcher struct {
+	minVersion uint16
+	ciphers    map[uint16]bool
+}
+
+func newTLSMatcher(m *tlsMatch) (*tlsConnectionMatcher, error) {
+	if m.MinVersion == "" && len(m.CipherSuites) == 0 {
+		return nil, fmt.Errorf(`"tls" requires at least one of "min_version" and "cipher_suites"`)
+	}
+	tm := &tlsConnectionMatcher{}
+	if m.MinVersion != "" {
+		version, ok := tlsVersions[m.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf(`"tls" has an unsupported "min_version" %q, must be "1.0", "1.1", "1.2" or "1.3"`, m.MinVersion)
+		}
+		tm.minVersion = version
+	}
+	if len(m.CipherSuites) > 0 {
+		tm.ciphers = make(map[uint16]bool, len(m.CipherSuites))
+		for _, name := range m.CipherSuites {
+			id, ok := cipherSuiteID(name)
+			if !ok {
+				return nil, fmt.Errorf(`"tls" has an unknown cipher suite %q, must be an IANA name known to crypto/tls`, name)
+			}
+			tm.ciphers[id] = true
+		}
+	}
+	return tm, nil
+}
+
+// cipherSuiteID resolves an IANA cipher suite name to its ID, consulting both
+// the secure and the insecure suites crypto/tls knows, since deny rules
+// legitimately name weak suites.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, cs := range suites {
+			if cs.Name == name {
+				return cs.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (m *tlsConnectionMatcher) match(in *rpcInput) bool {
+	if in.peerInfo == nil || in.peerInfo.AuthInfo == nil {
+		return false
+	}
+	tlsInfo, ok := in.peerInfo.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return false
+	}
+	if m.minVersion != 0 && tlsInfo.State.Version < m.minVersion {
+		return false
+	}
+	if m.ciphers != nil && !m.ciphers[tlsInfo.State.CipherSuite] {
+		return false
+	}
+	return true
+}
+
+// trustBoundaryMatch is the JSON shape of the "trust_boundary" matcher.
+type trustBoundaryMatch struct {
+	External *bool  `json:"external"`
+	Header   string `json:"header"`
+}
+
+// trustBoundaryMatcher matches RPCs by whether they originated outside the
+// mesh, read from a metadata header the ingress gateway sets on externally
+// originated traffic. An RPC is considered external when the header is
+// present, regardless of its value; an absent header means the RPC is treated
+// as internal. With "external" set, external RPCs match, so a deny rule can
+// block externally originated requests to sensitive methods; with "external"
+// unset, internal RPCs match. The header defaults to "x-from-external" and
+// can be overridden with "header".
+//
+// The matcher is only as trustworthy as the header: the ingress gateway must
+// set it on traffic entering the mesh and every trusted entry point must
+// strip it from incoming requests, or external clients can spoof an internal
+// origin by simply omitting it.
+type trustBoundaryMatcher struct {
+	external bool
+	header   string
+}
+
+// defaultTrustBoundaryHeader is the metadata header consulted when the
+// "trust_boundary" matcher does not configure one.
+const defaultTrustBoundaryHeader = "x-from-external"
+
+func newTrustBoundaryMatcher(m *trustBoundaryMatch) (*trustBoundaryMatcher, error) {
+	if m.External == nil {
+		return nil, fmt.Errorf(`"trust_boundary" requires "external"`)
+	}
+	header := strings.ToLower(m.Header)
+	if header == "" {
+		header = defaultTrustBoundaryHeader
+	}
+	return &trustBoundaryMatcher{external: *m.External, header: header}, nil
+}
+
+func (m *trustBoundaryMatcher) match(in *rpcInput) bool {
+	external := len(in.md.Get(m.header)) > 0
+	return external == m.external
+}
+
+// metadataCardinalityMatch is the JSON shape of the "metadata_cardinality"
+// matcher.
+type metadataCardinalityMatch struct {
+	Key       string `json:"key"`
+	MaxValues *int   `json:"max_values"`
+}
+
+// metadataCardinalityMatcher matches RPCs that send more than a configured
+// number of values for one metadata key, so a deny rule can reject
+// header-injection attempts and other malformed or abusive requests that
+// repeat a header an unusual number of times. Keys are matched
+// case-insensitively and binary ("-bin") headers are counted like any other;
+// an absent key has zero values and never matches.
+type metadataCardinalityMatcher struct {
+	key string
+	max int
+}
+
+func newMetadataCardinalityMatcher(m *metadataCardinalityMatch) (*metadataCardinalityMatcher, error) {
+	if m.Key == "" {
+		return nil, fmt.Errorf(`"metadata_cardinality" requires "key"`)
+	}
+	if m.MaxValues == nil {
+		return nil, fmt.Errorf(`"metadata_cardinality" requires "max_values"`)
+	}
+	if *m.MaxValues < 0 {
+		return nil, fmt.Errorf(`"metadata_cardinality" must have a non-negative "max_values", got %d`, *m.MaxValues)
+	}
+	return &metadataCardinalityMatcher{key: strings.ToLower(m.Key), max: *m.MaxValues}, nil
+}
+
+func (m *metadataCardinalityMatcher) match(in *rpcInput) bool {
+	return len(in.md.Get(m.key)) > m.max
+}
@@ -725,3 +725,90 @@ func (s) TestFileWatcher_RecoversFromReloadFailure(t *testing.T) {
 		t.Fatalf("client.UnaryCall(_, _) = %v; want = %v", got, valid2.wantStatus.Err())
 	}
 }
+
+func (s) TestListenerMatcherEnd2End(t *testing.T) {
+	authzPolicy := `{
+				"name": "authz",
+				"allow_rules":
+				[
+					{
+						"name": "allow_admin_listener",
+						"request": {
+							"paths":
+							[
+								"/grpc.testing.TestService/UnaryCall"
+							],
+							"listener": {
+								"names":
+								[
+									"admin"
+								]
+							}
+						}
+					}
+				]
+			}`
+	tests := map[string]struct {
+		serverOptions func(i *authz.StaticInterceptor) []grpc.ServerOption
+		wantStatus    *status.Status
+	}{
+		"AllowsRPCOnTaggedListener": {
+			serverOptions: func(i *authz.StaticInterceptor) []grpc.ServerOption {
+				return []grpc.ServerOption{
+					grpc.ChainUnaryInterceptor(i.UnaryInterceptor),
+					authz.ListenerTag("admin"),
+				}
+			},
+			wantStatus: status.New(codes.OK, ""),
+		},
+		"DeniesRPCOnListenerWithDifferentTag": {
+			serverOptions: func(i *authz.StaticInterceptor) []grpc.ServerOption {
+				return []grpc.ServerOption{
+					grpc.ChainUnaryInterceptor(i.UnaryInterceptor),
+					authz.ListenerTag("public"),
+				}
+			},
+			wantStatus: status.New(codes.PermissionDenied, "unauthorized RPC request rejected"),
+		},
+		"DeniesRPCOnUntaggedListener": {
+			serverOptions: func(i *authz.StaticInterceptor) []grpc.ServerOption {
+				return []grpc.ServerOption{
+					grpc.ChainUnaryInterceptor(i.UnaryInterceptor),
+				}
+			},
+			wantStatus: status.New(codes.PermissionDenied, "unauthorized RPC request rejected"),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			i, err := authz.NewStatic(authzPolicy)
+			if err != nil {
+				t.Fatalf("authz.NewStatic(%v) failed: %v", authzPolicy, err)
+			}
+			s := grpc.NewServer(test.serverOptions(i)...)
+			defer s.Stop()
+			testgrpc.RegisterTestServiceServer(s, &testServer{})
+
+			lis, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				t.Fatalf("error listening: %v", err)
+			}
+			go s.Serve(lis)
+
+			clientConn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("grpc.Dial(%v) failed: %v", lis.Addr().String(), err)
+			}
+			defer clientConn.Close()
+			client := testgrpc.NewTestServiceClient(clientConn)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err = client.UnaryCall(ctx, &testpb.SimpleRequest{})
+			if got := status.Convert(err); got.Code() != test.wantStatus.Code() || got.Message() != test.wantStatus.Message() {
+				t.Fatalf("[UnaryCall] error want:{%v} got:{%v}", test.wantStatus.Err(), got.Err())
+			}
+		})
+	}
+}
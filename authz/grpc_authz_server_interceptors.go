@@ -19,16 +19,22 @@ package authz
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 	"unsafe"
 
+	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/authz/internal"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/internal/xds/rbac"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -36,36 +42,280 @@ var logger = grpclog.Component("authz")
 
 // StaticInterceptor contains engines used to make authorization decisions. It
 // either contains two engines deny engine followed by an allow engine or only
-// one allow engine.
+// one allow engine. Policies using extended matchers are evaluated by the
+// authz policy engine instead of the RBAC engines.
 type StaticInterceptor struct {
-	engines rbac.ChainEngine
+	engine unsafe.Pointer // *staticEngine
+	// candidate is the staged candidate policy, or nil. See StageCandidate.
+	candidate unsafe.Pointer // *candidateState
+	// mu serializes policy mutations (AddRule, RemoveRule) and guards policy.
+	mu sync.Mutex
+	// policy is the parsed policy the interceptor currently evaluates.
+	policy *authorizationPolicy
+	// opts are the options the interceptor was built with, kept for rebuilds.
+	opts []Option
+}
+
+// staticEngine is an immutable snapshot of the interceptor's compiled policy.
+// It either contains two RBAC engines, deny engine followed by an allow
+// engine, only one allow engine, or an authz policy engine for policies using
+// extended matchers or interceptor options. In-flight RPCs load the snapshot
+// once and are unaffected by concurrent policy mutations.
+type staticEngine struct {
+	engines      rbac.ChainEngine
+	policyEngine *policyEngine
+	// refs counts the references keeping the snapshot alive: one held by the
+	// slot the engine is installed in (the interceptor's active engine or a
+	// staged candidate) plus one per in-flight RPC evaluating against it.
+	// When it drops to zero the engine is stopped, so audit loggers are
+	// closed only after the last RPC using them has finished, honoring the
+	// audit.Closer contract that no Log call follows Close.
+	refs atomic.Int64
 }
 
 // NewStatic returns a new StaticInterceptor from a static authorization policy
-// JSON string.
-func NewStatic(authzPolicy string) (*StaticInterceptor, error) {
-	rbacs, policyName, err := translatePolicy(authzPolicy)
+// JSON string and optional interceptor options.
+func NewStatic(authzPolicy string, opts ...Option) (*StaticInterceptor, error) {
+	policy, err := parseAuthorizationPolicy(authzPolicy)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := newStaticEngine(policy, opts)
+	if err != nil {
+		return nil, err
+	}
+	i := &StaticInterceptor{policy: policy, opts: opts}
+	atomic.StorePointer(&i.engine, unsafe.Pointer(engine))
+	reportMissingLoggers(policy, opts)
+	return i, nil
+}
+
+// reportMissingLoggers invokes the missing-logger report callback, when one
+// is configured, with the names of the policy's optional audit loggers that
+// have no registered builder. The callback is not invoked when none are
+// missing.
+func reportMissingLoggers(policy *authorizationPolicy, opts []Option) {
+	var io interceptorOptions
+	for _, opt := range opts {
+		opt.apply(&io)
+	}
+	if io.missingLoggerReport == nil {
+		return
+	}
+	var missing []string
+	for _, config := range policy.AuditLoggingOptions.AuditLoggers {
+		if config.IsOptional && audit.GetLoggerBuilder(config.Name) == nil {
+			missing = append(missing, config.Name)
+		}
+	}
+	if len(missing) > 0 {
+		io.missingLoggerReport(missing)
+	}
+}
+
+// newStaticEngine compiles the policy into an engine snapshot.
+func newStaticEngine(policy *authorizationPolicy, opts []Option) (*staticEngine, error) {
+	raw, err := json.Marshal(policy)
 	if err != nil {
 		return nil, err
 	}
+	// The RBAC translation runs for every policy, so that policies evaluated
+	// by the authz policy engine go through exactly the same structural
+	// validation as translated ones.
+	rbacs, policyName, err := translatePolicy(string(raw))
+	if err != nil {
+		return nil, err
+	}
+	if policy.requiresPolicyEngine() || len(opts) > 0 {
+		var io interceptorOptions
+		for _, opt := range opts {
+			opt.apply(&io)
+		}
+		engine, err := newPolicyEngine(policy, io)
+		if err != nil {
+			return nil, err
+		}
+		e := &staticEngine{policyEngine: engine}
+		e.refs.Store(1)
+		return e, nil
+	}
+	if len(policy.AllowRules) == 0 {
+		return nil, fmt.Errorf(`"allow_rules" is not present and WithDefaultAllow is not set`)
+	}
 	chainEngine, err := rbac.NewChainEngine(rbacs, policyName)
 	if err != nil {
 		return nil, err
 	}
-	return &StaticInterceptor{*chainEngine}, nil
+	e := &staticEngine{engines: *chainEngine}
+	e.refs.Store(1)
+	return e, nil
+}
+
+// stop releases the engine's background resources. It is safe on nil
+// engines.
+func (e *staticEngine) stop() {
+	if e != nil {
+		e.policyEngine.stop()
+	}
+}
+
+// acquire takes a reference on the engine for the duration of one RPC. It
+// fails when the engine has already been stopped, which can only happen after
+// the engine was swapped out of the slot it was loaded from.
+func (e *staticEngine) acquire() bool {
+	for {
+		n := e.refs.Load()
+		if n <= 0 {
+			return false
+		}
+		if e.refs.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference taken by acquire, or the slot reference when the
+// engine is swapped out or the interceptor is closed. The engine is stopped
+// when the last reference is dropped, so a replaced policy's audit loggers
+// are flushed and closed once the RPCs admitted under it have finished —
+// immediately, when there are none. It is safe on nil engines.
+func (e *staticEngine) release() {
+	if e == nil {
+		return
+	}
+	if e.refs.Add(-1) == 0 {
+		e.stop()
+	}
+}
+
+// acquireEngine returns the engine snapshot to enforce the RPC with, holding
+// a reference the caller must release when the RPC finishes. The loop retries
+// when the loaded snapshot was concurrently swapped out and stopped; after
+// Close the stopped snapshot is returned as-is rather than spinning, since
+// using the interceptor after Close is invalid anyway.
+func (i *StaticInterceptor) acquireEngine(ctx context.Context) (*staticEngine, func()) {
+	for {
+		e := i.engineFor(ctx)
+		if e.acquire() {
+			return e, e.release
+		}
+		if e == i.engineFor(ctx) {
+			return e, func() {}
+		}
+	}
+}
+
+// Close releases the interceptor's background resources, such as the
+// periodic summary ticker of WithPeriodicSummary, for both the active policy
+// and a staged candidate. RPCs still in flight finish against the snapshot
+// they were admitted under; the audit loggers are closed when the last of
+// them does. The interceptor must not be used after Close.
+func (i *StaticInterceptor) Close() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.currentEngine().release()
+	if cs := (*candidateState)(atomic.LoadPointer(&i.candidate)); cs != nil {
+		cs.engine.release()
+		atomic.StorePointer(&i.candidate, nil)
+	}
+}
+
+// currentEngine returns the engine snapshot the interceptor currently
+// evaluates RPCs against.
+func (i *StaticInterceptor) currentEngine() *staticEngine {
+	return (*staticEngine)(atomic.LoadPointer(&i.engine))
+}
+
+// isAuthorized evaluates the incoming RPC against the engine snapshot.
+func (e *staticEngine) isAuthorized(ctx context.Context) error {
+	if e.policyEngine != nil {
+		return e.policyEngine.isAuthorized(ctx)
+	}
+	return e.engines.IsAuthorized(ctx)
+}
+
+// authorize evaluates the incoming RPC like isAuthorized and, when the RPC
+// is allowed by the authz policy engine, returns a context carrying the
+// resulting Decision for interceptors chained after this one. RBAC engines
+// do not record a Decision and return the context unchanged.
+func (e *staticEngine) authorize(ctx context.Context) (context.Context, error) {
+	if e.policyEngine == nil {
+		return ctx, e.engines.IsAuthorized(ctx)
+	}
+	d, err := e.policyEngine.authorize(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	return newDecisionContext(ctx, e.policyEngine.policyName, d), nil
+}
+
+// denialMessage returns the message sent to clients for denied RPCs.
+func (e *staticEngine) denialMessage() string {
+	if e.policyEngine != nil && e.policyEngine.opts.denialMessage != "" {
+		return e.policyEngine.opts.denialMessage
+	}
+	return "unauthorized RPC request rejected"
+}
+
+// denialError returns the client-facing PermissionDenied error for the
+// engine's denial err, replacing its message with the opaque denial message
+// while carrying over any status details the engine attached, such as a
+// redirect hint.
+func (e *staticEngine) denialError(err error) error {
+	st := status.New(codes.PermissionDenied, e.denialMessage()).Proto()
+	st.Details = status.Convert(err).Proto().GetDetails()
+	return status.FromProto(st).Err()
+}
+
+// inScope reports whether the method is subject to authorization. Methods
+// out of the scope configured with WithScopeMethods bypass the engine
+// entirely.
+func (e *staticEngine) inScope(method string) bool {
+	if e.policyEngine == nil || e.policyEngine.opts.scope == nil {
+		return true
+	}
+	return e.policyEngine.opts.scope.contains(method)
+}
+
+// withCorrelationID returns a context whose incoming metadata carries a
+// generated correlation ID under the configured correlation header, when one
+// is configured with generation enabled and the RPC arrived without the
+// header. Otherwise the context is returned unchanged.
+func (e *staticEngine) withCorrelationID(ctx context.Context) context.Context {
+	pe := e.policyEngine
+	if pe == nil || pe.opts.correlationHeader == "" || pe.opts.noCorrelationGeneration {
+		return ctx
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(pe.opts.correlationHeader)) > 0 {
+		return ctx
+	}
+	md = md.Copy()
+	md.Set(pe.opts.correlationHeader, uuid.NewString())
+	return metadata.NewIncomingContext(ctx, md)
 }
 
 // UnaryInterceptor intercepts incoming Unary RPC requests.
 // Only authorized requests are allowed to pass. Otherwise, an unauthorized
 // error is returned to the client.
-func (i *StaticInterceptor) UnaryInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
-	err := i.engines.IsAuthorized(ctx)
+func (i *StaticInterceptor) UnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	e, release := i.acquireEngine(ctx)
+	defer release()
+	if info != nil && !e.inScope(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx = e.withCorrelationID(ctx)
+	i.shadowDecide(ctx)
+	if e.policyEngine != nil && e.policyEngine.opts.postHandlerAudit {
+		return e.unaryPostHandlerInterceptor(ctx, req, handler)
+	}
+	ctx, err := e.authorize(ctx)
 	if err != nil {
 		if status.Code(err) == codes.PermissionDenied {
 			if logger.V(2) {
 				logger.Infof("unauthorized RPC request rejected: %v", err)
 			}
-			return nil, status.Errorf(codes.PermissionDenied, "unauthorized RPC request rejected")
+			return nil, e.denialError(err)
 		}
 		return nil, err
 	}
@@ -75,20 +325,218 @@ func (i *StaticInterceptor) UnaryInterceptor(ctx context.Context, req any, _ *gr
 // StreamInterceptor intercepts incoming Stream RPC requests.
 // Only authorized requests are allowed to pass. Otherwise, an unauthorized
 // error is returned to the client.
-func (i *StaticInterceptor) StreamInterceptor(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-	err := i.engines.IsAuthorized(ss.Context())
+func (i *StaticInterceptor) StreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	e, release := i.acquireEngine(ss.Context())
+	defer release()
+	if info != nil && !e.inScope(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	if ctx := e.withCorrelationID(ss.Context()); ctx != ss.Context() {
+		ss = &contextStream{ServerStream: ss, ctx: ctx}
+	}
+	i.shadowDecide(ss.Context())
+	if pe := e.policyEngine; pe != nil && len(pe.streamLimits) > 0 {
+		inner := handler
+		handler = func(srv any, ss grpc.ServerStream) error {
+			if in, err := newRPCInput(ss.Context()); err == nil {
+				pe.resolvePrincipal(in)
+				defer pe.trackStream(in)()
+			}
+			return inner(srv, ss)
+		}
+	}
+	if e.policyEngine != nil && e.policyEngine.opts.streamFirstMessageExtractor != nil && info != nil && info.IsClientStream {
+		return e.firstMessageInterceptor(srv, ss, handler)
+	}
+	if e.policyEngine != nil && e.policyEngine.opts.streamLifecycleAudit {
+		return e.streamLifecycleInterceptor(srv, ss, handler)
+	}
+	if e.policyEngine != nil && e.policyEngine.opts.postHandlerAudit {
+		return e.streamPostHandlerInterceptor(srv, ss, handler)
+	}
+	ctx, err := e.authorize(ss.Context())
 	if err != nil {
 		if status.Code(err) == codes.PermissionDenied {
 			if logger.V(2) {
 				logger.Infof("unauthorized RPC request rejected: %v", err)
 			}
-			return status.Errorf(codes.PermissionDenied, "unauthorized RPC request rejected")
+			return e.denialError(err)
 		}
 		return err
 	}
+	if ctx != ss.Context() {
+		ss = &contextStream{ServerStream: ss, ctx: ctx}
+	}
 	return handler(srv, ss)
 }
 
+// contextStream wraps a grpc.ServerStream to override its context, e.g. to
+// carry a generated correlation ID or the authorization Decision.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// unaryPostHandlerInterceptor implements the unary interceptor when
+// post-handler auditing is enabled: denied RPCs are audited at decision time
+// as usual, while the decision event of an allowed RPC is deferred until the
+// handler returns and records the handler's final status.
+func (e *staticEngine) unaryPostHandlerInterceptor(ctx context.Context, req any, handler grpc.UnaryHandler) (any, error) {
+	d, err := e.policyEngine.decide(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stErr := d.statusErr(); stErr != nil {
+		// The RPC is already failing; a logging failure doesn't change that.
+		_ = e.policyEngine.doAuditLogging(d, nil)
+		if logger.V(2) {
+			logger.Infof("unauthorized RPC request rejected: %v", stErr)
+		}
+		d.tarpit()
+		return nil, e.denialError(e.policyEngine.withRedirectDetail(d, stErr))
+	}
+	resp, err := handler(newDecisionContext(ctx, e.policyEngine.policyName, d), req)
+	e.auditResult(d, err)
+	return resp, err
+}
+
+// streamPostHandlerInterceptor is the streaming counterpart of
+// unaryPostHandlerInterceptor.
+func (e *staticEngine) streamPostHandlerInterceptor(srv any, ss grpc.ServerStream, handler grpc.StreamHandler) error {
+	d, err := e.policyEngine.decide(ss.Context())
+	if err != nil {
+		return err
+	}
+	if stErr := d.statusErr(); stErr != nil {
+		_ = e.policyEngine.doAuditLogging(d, nil)
+		if logger.V(2) {
+			logger.Infof("unauthorized RPC request rejected: %v", stErr)
+		}
+		d.tarpit()
+		return e.denialError(e.policyEngine.withRedirectDetail(d, stErr))
+	}
+	ss = &contextStream{ServerStream: ss, ctx: newDecisionContext(ss.Context(), e.policyEngine.policyName, d)}
+	err = handler(srv, ss)
+	e.auditResult(d, err)
+	return err
+}
+
+// auditResult emits the deferred decision event of an allowed RPC, carrying
+// the handler's final status. The RPC has already finished, so a logging
+// failure cannot fail it.
+func (e *staticEngine) auditResult(d *decision, handlerErr error) {
+	st := status.Convert(handlerErr)
+	_ = e.policyEngine.doAuditLogging(d, func(ev *audit.Event) {
+		ev.EventType = audit.EventTypeResult
+		ev.ResultCode = st.Code()
+		ev.StatusCode = st.Code()
+		ev.ResultMessage = st.Message()
+	})
+}
+
+// streamLifecycleInterceptor implements the stream interceptor when stream
+// lifecycle auditing is enabled: authorized streams emit an "open" event at
+// authorization time and a "close" event when the handler returns, joined by
+// a shared correlation ID.
+func (e *staticEngine) streamLifecycleInterceptor(srv any, ss grpc.ServerStream, handler grpc.StreamHandler) error {
+	d, err := e.policyEngine.decide(ss.Context())
+	if err != nil {
+		return err
+	}
+	if !d.authorized {
+		// The RPC is already failing; a logging failure doesn't change that.
+		_ = e.policyEngine.doAuditLogging(d, nil)
+		if logger.V(2) {
+			logger.Infof("unauthorized RPC request rejected: %v", d.statusErr())
+		}
+		d.tarpit()
+		return e.denialError(e.policyEngine.withRedirectDetail(d, d.statusErr()))
+	}
+	correlationID := e.policyEngine.correlationID(d.in)
+	if correlationID == "" {
+		correlationID = uuid.NewString()
+	}
+	start := time.Now()
+	if err := e.policyEngine.doAuditLogging(d, func(ev *audit.Event) {
+		ev.EventType = audit.EventTypeStreamOpen
+		ev.CorrelationID = correlationID
+	}); err != nil {
+		return err
+	}
+	ss = &contextStream{ServerStream: ss, ctx: newDecisionContext(ss.Context(), e.policyEngine.policyName, d)}
+	err = handler(srv, ss)
+	// The stream has already finished; a logging failure on the close event
+	// cannot fail it.
+	_ = e.policyEngine.doAuditLogging(d, func(ev *audit.Event) {
+		ev.EventType = audit.EventTypeStreamClose
+		ev.CorrelationID = correlationID
+		ev.StreamDuration = time.Since(start)
+		ev.StatusCode = status.Code(err)
+	})
+	return err
+}
+
+// firstMessageInterceptor implements the stream interceptor when a
+// first-message extractor is configured and the client sends messages: the
+// handler runs immediately, but its first RecvMsg evaluates the policy with
+// the extracted inputs before handing the message over.
+func (e *staticEngine) firstMessageInterceptor(srv any, ss grpc.ServerStream, handler grpc.StreamHandler) error {
+	fs := &firstMessageStream{ServerStream: ss, engine: e}
+	err := handler(srv, fs)
+	// Make sure a denial reaches the client even if the handler swallowed the
+	// error returned by RecvMsg.
+	if fs.denied != nil {
+		return fs.denied
+	}
+	return err
+}
+
+// firstMessageStream wraps a grpc.ServerStream to evaluate the authorization
+// policy when the first message arrives.
+type firstMessageStream struct {
+	grpc.ServerStream
+	engine  *staticEngine
+	decided bool
+	denied  error
+}
+
+func (s *firstMessageStream) RecvMsg(m any) error {
+	if s.denied != nil {
+		return s.denied
+	}
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.decided {
+		return nil
+	}
+	s.decided = true
+	engine := s.engine.policyEngine
+	principal, attrs := engine.opts.streamFirstMessageExtractor(m)
+	d, err := engine.decideExtracted(s.Context(), principal, attrs)
+	if err != nil {
+		s.denied = err
+		return err
+	}
+	if err := engine.doAuditLogging(d, nil); err != nil {
+		s.denied = err
+		return err
+	}
+	if !d.authorized {
+		if logger.V(2) {
+			logger.Infof("unauthorized RPC request rejected: %v", d.statusErr())
+		}
+		d.tarpit()
+		s.denied = s.engine.denialError(engine.withRedirectDetail(d, d.statusErr()))
+		return s.denied
+	}
+	return nil
+}
+
 // FileWatcherInterceptor contains details used to make authorization decisions
 // by watching a file path that contains authorization policy in JSON format.
 type FileWatcherInterceptor struct {
@@ -97,19 +545,37 @@ type FileWatcherInterceptor struct {
 	policyContents      []byte
 	refreshDuration     time.Duration
 	cancel              context.CancelFunc
+	// stopped is closed when the policy refresh goroutine exits, so Close
+	// can wait for it before closing the current internal interceptor.
+	stopped chan struct{}
+	// convert, when non-nil, converts the policy file contents to the JSON
+	// policy format on each refresh, e.g. from YAML.
+	convert func(string) (string, error)
+}
+
+func init() {
+	internal.NewFileWatcherWithConverter = newFileWatcher
 }
 
 // NewFileWatcher returns a new FileWatcherInterceptor from a policy file
 // that contains JSON string of authorization policy and a refresh duration to
 // specify the amount of time between policy refreshes.
 func NewFileWatcher(file string, duration time.Duration) (*FileWatcherInterceptor, error) {
+	return newFileWatcher(file, duration, nil)
+}
+
+// newFileWatcher backs NewFileWatcher and, through the
+// internal.NewFileWatcherWithConverter hook, constructors in submodules that
+// watch policy files in other formats; convert, when non-nil, converts the
+// file contents to JSON on each refresh.
+func newFileWatcher(file string, duration time.Duration, convert func(string) (string, error)) (*FileWatcherInterceptor, error) {
 	if file == "" {
 		return nil, fmt.Errorf("authorization policy file path is empty")
 	}
 	if duration <= time.Duration(0) {
 		return nil, fmt.Errorf("requires refresh interval(%v) greater than 0s", duration)
 	}
-	i := &FileWatcherInterceptor{policyFile: file, refreshDuration: duration}
+	i := &FileWatcherInterceptor{policyFile: file, refreshDuration: duration, convert: convert, stopped: make(chan struct{})}
 	if err := i.updateInternalInterceptor(); err != nil {
 		return nil, err
 	}
@@ -121,6 +587,7 @@ func NewFileWatcher(file string, duration time.Duration) (*FileWatcherIntercepto
 }
 
 func (i *FileWatcherInterceptor) run(ctx context.Context) {
+	defer close(i.stopped)
 	ticker := time.NewTicker(i.refreshDuration)
 	for {
 		if err := i.updateInternalInterceptor(); err != nil {
@@ -149,18 +616,33 @@ func (i *FileWatcherInterceptor) updateInternalInterceptor() error {
 	}
 	i.policyContents = policyContents
 	policyContentsString := string(policyContents)
+	if i.convert != nil {
+		if policyContentsString, err = i.convert(policyContentsString); err != nil {
+			return err
+		}
+	}
 	interceptor, err := NewStatic(policyContentsString)
 	if err != nil {
 		return err
 	}
-	atomic.StorePointer(&i.internalInterceptor, unsafe.Pointer(interceptor))
+	old := (*StaticInterceptor)(atomic.SwapPointer(&i.internalInterceptor, unsafe.Pointer(interceptor)))
+	if old != nil {
+		// Closing the replaced interceptor flushes and closes the previous
+		// policy's audit loggers once the RPCs admitted under it finish, so
+		// reloads do not leak logger goroutines or buffered events.
+		old.Close()
+	}
 	logger.Infof("authorization policy reload status: successfully loaded new policy %v", policyContentsString)
 	return nil
 }
 
-// Close cleans up resources allocated by the interceptor.
+// Close cleans up resources allocated by the interceptor: it stops the
+// policy refresh goroutine and closes the current policy's audit loggers,
+// flushing any buffered events, once in-flight RPCs have finished.
 func (i *FileWatcherInterceptor) Close() {
 	i.cancel()
+	<-i.stopped
+	((*StaticInterceptor)(atomic.LoadPointer(&i.internalInterceptor))).Close()
 }
 
 // UnaryInterceptor intercepts incoming Unary RPC requests.
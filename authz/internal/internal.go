@@ -0,0 +1,47 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package internal contains hooks shared between the authz package and its
+// submodules, which cannot reach its unexported identifiers directly.
+package internal
+
+// NewFileWatcherWithConverter is implemented by the authz package and
+// consumed by the yamlpolicy submodule. It builds a file-watcher interceptor
+// whose policy file contents are run through the given converter before
+// parsing on every refresh. Its type is
+// func(file string, refreshDuration time.Duration, convert func(string) (string, error)) (*authz.FileWatcherInterceptor, error).
+var NewFileWatcherWithConverter any
+
+// CELConditionCompiler is implemented by the cel submodule and consumed by
+// the authz package. It compiles a rule's "condition" CEL expression into an
+// evaluation function over the request attributes, keeping the CEL runtime
+// out of the core module for policies that do not use conditions. Its type is
+// func(expr string) (func(method string, headers map[string]string, principal string) bool, error).
+var CELConditionCompiler any
+
+// SpanContextFromContext is implemented by the otel submodule and consumed by
+// the authz package. It extracts the OpenTelemetry trace and span IDs from an
+// RPC context for stamping onto audit events, reporting ok false when the
+// context carries no valid span context. Its type is
+// func(ctx context.Context) (traceID, spanID string, ok bool).
+var SpanContextFromContext any
+
+// VerifyOCSPStaple is implemented by the ocsp submodule and consumed by the
+// authz package. It reports whether a stapled OCSP response parses, has
+// status good and is still fresh, verifying the response signature against
+// the issuer certificate when one is provided. Its type is
+// func(staple []byte, issuer *x509.Certificate) bool.
+var VerifyOCSPStaple any
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// This file holds the JWT claim handling shared by the JWT-based extended
+// matchers. Tokens are only decoded, never verified: signature verification
+// is assumed to happen upstream, e.g. in a credentials implementation or a
+// proxy, before the RPC reaches the authorization interceptor.
+
+// jwtClaims decodes the claims of the bearer token in the RPC's
+// "authorization" metadata, returning false when the RPC carries no
+// well-formed token.
+func jwtClaims(in *rpcInput) (map[string]any, bool) {
+	values := in.md.Get("authorization")
+	if len(values) == 0 {
+		return nil, false
+	}
+	token := values[0]
+	if len(token) < len("bearer ") || !strings.EqualFold(token[:len("bearer ")], "bearer ") {
+		return nil, false
+	}
+	token = token[len("bearer "):]
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// jwtAudiences returns the token's audiences from the "aud" claim, which RFC
+// 7519 allows to be either a single string or an array of strings.
+func jwtAudiences(claims map[string]any) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		audiences := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+		return audiences
+	default:
+		return nil
+	}
+}
+
+// jwtAudienceMatch is the JSON shape of the "jwt_audience" matcher.
+type jwtAudienceMatch struct {
+	Values []string `json:"values"`
+}
+
+// jwtAudienceMatcher matches RPCs whose bearer token's "aud" claim contains
+// one of the configured values, compared exactly. RPCs without a well-formed
+// token, tokens without the claim and mismatched audiences all fail the
+// matcher, so an allow rule using it denies them.
+type jwtAudienceMatcher struct {
+	values map[string]bool
+}
+
+func newJWTAudienceMatcher(m *jwtAudienceMatch) (*jwtAudienceMatcher, error) {
+	if len(m.Values) == 0 {
+		return nil, fmt.Errorf(`"jwt_audience" requires at least one entry in "values"`)
+	}
+	values := make(map[string]bool, len(m.Values))
+	for _, v := range m.Values {
+		values[v] = true
+	}
+	return &jwtAudienceMatcher{values: values}, nil
+}
+
+func (m *jwtAudienceMatcher) match(in *rpcInput) bool {
+	claims, ok := jwtClaims(in)
+	if !ok {
+		return false
+	}
+	for _, audience := range jwtAudiences(claims) {
+		if m.values[audience] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// LintWarning describes one suspect construct Lint found in a valid policy.
+type LintWarning struct {
+	// Rule is the qualified name of the affected rule, in the
+	// "<policy>_<rule>" form audit events use.
+	Rule string
+	// Message describes why the rule was flagged.
+	Message string
+}
+
+// Lint statically analyzes a valid authorization policy for rules that look
+// like logic errors, so they can be caught before deploy. It detects:
+//
+//   - Rules shadowed by an unconditional deny: a deny rule with no source,
+//     request or extended matcher constraints matches every RPC, so every
+//     rule evaluated after it can never decide anything.
+//   - Allow and warn rules whose paths are entirely covered by a deny rule
+//     that is constrained only by paths, using the rule pattern syntax; with
+//     deny-overrides evaluation such rules are unreachable.
+//   - Duplicate rules: a rule whose source and request are identical to an
+//     earlier rule in the same list.
+//
+// The analysis is best-effort, not exhaustive: it reasons over the policy's
+// literal patterns and flags only shadowing it can prove, so an empty result
+// does not mean the policy is free of unreachable rules. An error is returned
+// when the policy does not validate; warnings are only produced for valid
+// policies.
+func Lint(authzPolicy string) ([]LintWarning, error) {
+	if err := Validate(authzPolicy); err != nil {
+		return nil, err
+	}
+	policy, err := parseAuthorizationPolicy(authzPolicy)
+	if err != nil {
+		return nil, err
+	}
+	qualify := func(name string) string { return policy.Name + "_" + name }
+	var warnings []LintWarning
+
+	// An unconditional deny rule makes every rule evaluated after it
+	// unreachable: later deny rules in list order, and all warn and allow
+	// rules under deny-overrides.
+	unconditional := ""
+	for i, d := range policy.DenyRules {
+		if !ruleMatchesEverything(d) {
+			continue
+		}
+		unconditional = qualify(d.Name)
+		for _, r := range policy.DenyRules[i+1:] {
+			warnings = append(warnings, LintWarning{Rule: qualify(r.Name), Message: fmt.Sprintf("unreachable: deny rule %q matches every RPC and is evaluated first", unconditional)})
+		}
+		break
+	}
+	if unconditional != "" {
+		for _, rules := range [][]rule{policy.WarnRules, policy.AllowRules} {
+			for _, r := range rules {
+				warnings = append(warnings, LintWarning{Rule: qualify(r.Name), Message: fmt.Sprintf("unreachable: deny rule %q matches every RPC and is evaluated first", unconditional)})
+			}
+		}
+	} else {
+		// A deny rule constrained only by paths shadows every warn and allow
+		// rule whose paths it entirely covers.
+		for _, d := range policy.DenyRules {
+			denyPaths := pathOnlyDenyPaths(d)
+			if denyPaths == nil {
+				continue
+			}
+			for _, rules := range [][]rule{policy.WarnRules, policy.AllowRules} {
+				for _, r := range rules {
+					if len(r.Request.Paths) > 0 && pathsCovered(denyPaths, r.Request.Paths) {
+						warnings = append(warnings, LintWarning{Rule: qualify(r.Name), Message: fmt.Sprintf("unreachable: every path is covered by deny rule %q, which has no other constraints", qualify(d.Name))})
+					}
+				}
+			}
+		}
+	}
+
+	for _, rules := range [][]rule{policy.DenyRules, policy.WarnRules, policy.AllowRules} {
+		seen := make(map[string]string, len(rules))
+		for _, r := range rules {
+			key := ruleContentKey(r)
+			if prev, ok := seen[key]; ok {
+				warnings = append(warnings, LintWarning{Rule: qualify(r.Name), Message: fmt.Sprintf("duplicate: identical to earlier rule %q", prev)})
+				continue
+			}
+			seen[key] = qualify(r.Name)
+		}
+	}
+	return warnings, nil
+}
+
+// ruleMatchesEverything reports whether the rule carries no source, request
+// or extended matcher constraints, i.e. matches every RPC.
+func ruleMatchesEverything(r rule) bool {
+	return ruleContentKey(r) == ruleContentKey(rule{})
+}
+
+// pathOnlyDenyPaths returns the rule's path patterns when paths are its only
+// constraint, and nil otherwise.
+func pathOnlyDenyPaths(r rule) []string {
+	if len(r.Request.Paths) == 0 {
+		return nil
+	}
+	stripped := r
+	stripped.Request.Paths = nil
+	if !ruleMatchesEverything(stripped) {
+		return nil
+	}
+	return r.Request.Paths
+}
+
+// ruleContentKey returns a canonical representation of the rule's matching
+// behavior, ignoring its name, for comparing rules for equality.
+func ruleContentKey(r rule) string {
+	r.Name = ""
+	r.DelayMillis = 0
+	r.Redirect = nil
+	b, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// pathsCovered reports whether every pattern in paths is covered by some
+// pattern in denyPaths.
+func pathsCovered(denyPaths, paths []string) bool {
+	for _, p := range paths {
+		covered := false
+		for _, d := range denyPaths {
+			if patternCovers(d, p) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// patternCovers reports whether every string matched by pattern b is also
+// matched by pattern a, using the rule pattern syntax: "*" matches any
+// non-empty string, a trailing "*" matches a prefix, a leading "*" matches a
+// suffix and anything else matches exactly.
+func patternCovers(a, b string) bool {
+	pa, pb := newStringPatternMatcher(a), newStringPatternMatcher(b)
+	switch pa.kind {
+	case patternAny:
+		return true
+	case patternPrefix:
+		return (pb.kind == patternExact || pb.kind == patternPrefix) && strings.HasPrefix(pb.pattern, pa.pattern)
+	case patternSuffix:
+		return (pb.kind == patternExact || pb.kind == patternSuffix) && strings.HasSuffix(pb.pattern, pa.pattern)
+	default:
+		return pb.kind == patternExact && pb.pattern == pa.pattern
+	}
+}
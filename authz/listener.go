@@ -0,0 +1,84 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// listenerTagKey is the context key under which the listener name set by
+// ListenerTag is stored.
+type listenerTagKey struct{}
+
+// ListenerTag returns a grpc.ServerOption that tags every RPC accepted by the
+// server with the given listener name. Policies can then restrict rules to
+// RPCs arriving over that server with the "listener" matcher:
+//
+//	"request": {"listener": {"names": ["admin"]}}
+//
+// The tag is propagated into the RPC context by a stats handler installed by
+// the returned option, so it is visible to the authorization interceptors and
+// to any other interceptor running after tagging. A process serving multiple
+// listeners should use one grpc.Server per listener, each with its own tag.
+// RPCs on servers without a tag never match a "listener" matcher.
+func ListenerTag(name string) grpc.ServerOption {
+	return grpc.StatsHandler(&listenerTagger{name: name})
+}
+
+// listenerTagger is a stats.Handler whose only job is to stamp the listener
+// name into each RPC context.
+type listenerTagger struct {
+	name string
+}
+
+func (l *listenerTagger) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, listenerTagKey{}, l.name)
+}
+
+func (l *listenerTagger) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (l *listenerTagger) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (l *listenerTagger) HandleConn(context.Context, stats.ConnStats) {}
+
+// listenerMatcher matches RPCs tagged via ListenerTag with one of the
+// configured listener names. Untagged RPCs never match.
+type listenerMatcher struct {
+	names map[string]bool
+}
+
+func newListenerMatcher(config *listenerMatch) (*listenerMatcher, error) {
+	if len(config.Names) == 0 {
+		return nil, fmt.Errorf(`"listener" requires at least one entry in "names"`)
+	}
+	names := make(map[string]bool, len(config.Names))
+	for _, name := range config.Names {
+		names[name] = true
+	}
+	return &listenerMatcher{names: names}, nil
+}
+
+func (lm *listenerMatcher) match(in *rpcInput) bool {
+	tag, ok := in.ctx.Value(listenerTagKey{}).(string)
+	return ok && lm.names[tag]
+}
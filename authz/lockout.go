@@ -0,0 +1,135 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// lockoutMatch is the JSON shape of the "lockout" matcher.
+type lockoutMatch struct {
+	Threshold    int    `json:"threshold"`
+	WindowMillis int64  `json:"window_ms"`
+	Per          string `json:"per"`
+}
+
+// lockoutMatcher matches RPCs from callers that have accumulated threshold
+// consecutive denials within window_ms, so a deny rule carrying it imposes a
+// temporary lockout on principals that look like they are probing the policy.
+// The engine reports every decision back to the matcher: a denial extends the
+// caller's streak and an allow clears it. Once locked, a caller stays locked
+// until window_ms elapses after its last genuine denial; denials caused by
+// the lockout itself do not extend the streak, so the lockout always clears
+// on its own.
+//
+// Streaks are keyed by the RPC's principal or principal and method, per
+// "per". All state is guarded by a single mutex, making the matcher safe for
+// concurrent RPCs; like the "rate_limit" matcher, entries idle past the
+// window are swept once the map exceeds sweepThreshold keys, which bounds its
+// memory to the recently denied keys.
+type lockoutMatcher struct {
+	threshold int
+	window    time.Duration
+	per       string
+
+	mu        sync.Mutex
+	streaks   map[string]*denialStreak
+	lastSweep time.Time
+}
+
+type denialStreak struct {
+	count int
+	last  time.Time
+}
+
+func newLockoutMatcher(m *lockoutMatch) (*lockoutMatcher, error) {
+	if m.Threshold < 1 {
+		return nil, fmt.Errorf(`"lockout" requires a positive "threshold"`)
+	}
+	if m.WindowMillis < 1 {
+		return nil, fmt.Errorf(`"lockout" requires a positive "window_ms"`)
+	}
+	switch m.Per {
+	case "principal", "principal_method":
+	case "":
+		m.Per = "principal"
+	default:
+		return nil, fmt.Errorf(`"lockout" has unsupported "per" %q, must be "principal" or "principal_method"`, m.Per)
+	}
+	return &lockoutMatcher{
+		threshold: m.Threshold,
+		window:    time.Duration(m.WindowMillis) * time.Millisecond,
+		per:       m.Per,
+		streaks:   make(map[string]*denialStreak),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// key returns the streak key for the RPC per the configured scope.
+func (m *lockoutMatcher) key(in *rpcInput) string {
+	if m.per == "principal" {
+		return in.principal()
+	}
+	return in.principal() + "|" + in.fullMethod
+}
+
+// match reports whether the caller is currently locked out.
+func (m *lockoutMatcher) match(in *rpcInput) bool {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	streak := m.streaks[m.key(in)]
+	return streak != nil && streak.count >= m.threshold && now.Sub(streak.last) <= m.window
+}
+
+// record feeds a decision outcome back into the matcher: a denial starts or
+// extends the caller's streak and an allow clears it. Denials attributed to a
+// lockout rule are not recorded, so retries during a lockout do not prolong
+// it.
+func (m *lockoutMatcher) record(in *rpcInput, authorized bool) {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := m.key(in)
+	if authorized {
+		delete(m.streaks, key)
+		return
+	}
+	m.maybeSweep(now)
+	streak := m.streaks[key]
+	if streak == nil || now.Sub(streak.last) > m.window {
+		streak = &denialStreak{}
+		m.streaks[key] = streak
+	}
+	streak.count++
+	streak.last = now
+}
+
+// maybeSweep drops streaks idle past the window. The caller must hold m.mu.
+func (m *lockoutMatcher) maybeSweep(now time.Time) {
+	if len(m.streaks) <= sweepThreshold || now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, streak := range m.streaks {
+		if now.Sub(streak.last) > m.window {
+			delete(m.streaks, key)
+		}
+	}
+}
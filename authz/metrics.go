@@ -0,0 +1,36 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"time"
+)
+
+// MetricsRecorder receives one call per authorization decision when
+// WithMetrics is configured. The authz/otel package adapts a MetricsRecorder
+// onto an OpenTelemetry meter; keeping the interface here and the OpenTelemetry
+// types there spares users of this package the dependency.
+//
+// Implementations must be safe for concurrent use and should not block: the
+// recorder is invoked on the RPC path.
+type MetricsRecorder interface {
+	// RecordDecision records one authorization decision. latency is the time
+	// spent on policy evaluation alone, and matchedRule is the qualified name
+	// of the rule that decided the RPC, or empty when no rule matched.
+	RecordDecision(ctx context.Context, authorized bool, policyName, matchedRule string, latency time.Duration)
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package metrics exposes authz authorization decisions as Prometheus
+// metrics. It adapts an authz.MetricsCollector, which aggregates decision
+// counts without any metrics dependency, into a prometheus.Collector, so
+// only users who want Prometheus pay for the dependency:
+//
+//	c := authz.NewMetricsCollector()
+//	i, err := authz.NewStatic(policy, authz.WithMetricsCollector(c))
+//	prometheus.MustRegister(metrics.NewCollector(c))
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/authz"
+)
+
+// decisionsDesc describes the grpc_authz_decisions_total counter. The method
+// label is the full RPC method, so cardinality is bounded by the service
+// surface rather than by request contents.
+var decisionsDesc = prometheus.NewDesc(
+	"grpc_authz_decisions_total",
+	"Number of authorization decisions made by the gRPC authz interceptor.",
+	[]string{"authorized", "policy", "method"},
+	nil,
+)
+
+// collector reads an authz.MetricsCollector snapshot on every scrape.
+type collector struct {
+	c *authz.MetricsCollector
+}
+
+// NewCollector returns a prometheus.Collector exposing c's decision counts
+// as the grpc_authz_decisions_total counter, labeled with the decision
+// outcome, the policy name and the full RPC method.
+func NewCollector(c *authz.MetricsCollector) prometheus.Collector {
+	return &collector{c: c}
+}
+
+// Describe implements prometheus.Collector.
+func (col *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- decisionsDesc
+}
+
+// Collect implements prometheus.Collector.
+func (col *collector) Collect(ch chan<- prometheus.Metric) {
+	for _, dc := range col.c.DecisionCounts() {
+		ch <- prometheus.MustNewConstMetric(
+			decisionsDesc,
+			prometheus.CounterValue,
+			float64(dc.Count),
+			strconv.FormatBool(dc.Authorized),
+			dc.Policy,
+			dc.Method,
+		)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz"
+	"google.golang.org/grpc/authz/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/internal/grpctest"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// fakeServerTransportStream is a minimal grpc.ServerTransportStream carrying
+// the method name.
+type fakeServerTransportStream struct {
+	method string
+}
+
+func (s *fakeServerTransportStream) Method() string               { return s.method }
+func (s *fakeServerTransportStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeServerTransportStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeServerTransportStream) SetTrailer(metadata.MD) error { return nil }
+
+// rpcContext returns a context shaped like an incoming RPC for the given
+// method.
+func rpcContext(method string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}})
+	return grpc.NewContextWithServerTransportStream(ctx, &fakeServerTransportStream{method: method})
+}
+
+func (s) TestCollector(t *testing.T) {
+	c := authz.NewMetricsCollector()
+	i, err := authz.NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Allowed"]}
+			}
+		]
+	}`, authz.WithMetricsCollector(c))
+	if err != nil {
+		t.Fatalf("authz.NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	for n := 0; n < 2; n++ {
+		if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Allowed"), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+			t.Fatalf("UnaryInterceptor() on allowed RPC failed: %v", err)
+		}
+	}
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Denied"), nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("UnaryInterceptor() on denied RPC = %v, want code %v", err, codes.PermissionDenied)
+	}
+
+	want := `
+		# HELP grpc_authz_decisions_total Number of authorization decisions made by the gRPC authz interceptor.
+		# TYPE grpc_authz_decisions_total counter
+		grpc_authz_decisions_total{authorized="true",method="/pkg.Service/Allowed",policy="authz"} 2
+		grpc_authz_decisions_total{authorized="false",method="/pkg.Service/Denied",policy="authz"} 1
+	`
+	if err := testutil.CollectAndCompare(metrics.NewCollector(c), strings.NewReader(want)); err != nil {
+		t.Errorf("Collected metrics mismatch: %v", err)
+	}
+}
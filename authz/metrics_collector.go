@@ -0,0 +1,94 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"sort"
+	"sync"
+)
+
+// MetricsCollector aggregates authorization decision counts for an
+// interceptor built with WithMetricsCollector. It holds plain counters with
+// no dependency on a metrics library; the authz/metrics package exposes a
+// MetricsCollector as a Prometheus collector. A single MetricsCollector may
+// be shared by several interceptors. All methods are safe for concurrent
+// use.
+type MetricsCollector struct {
+	mu     sync.Mutex
+	counts map[decisionCountKey]uint64
+}
+
+type decisionCountKey struct {
+	authorized bool
+	policy     string
+	method     string
+}
+
+// DecisionCount is one (authorized, policy, method) counter of a
+// MetricsCollector snapshot.
+type DecisionCount struct {
+	// Authorized is the decision outcome the counter tracks.
+	Authorized bool
+	// Policy is the name of the authorization policy that made the decision.
+	Policy string
+	// Method is the full RPC method the decision was made for, in the format
+	// of "/pkg.Service/Method".
+	Method string
+	// Count is how many decisions with this key have been recorded.
+	Count uint64
+}
+
+// NewMetricsCollector returns an empty MetricsCollector to pass to
+// WithMetricsCollector.
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{counts: make(map[decisionCountKey]uint64)}
+}
+
+// record counts one decision.
+func (c *MetricsCollector) record(policy, method string, authorized bool) {
+	key := decisionCountKey{authorized: authorized, policy: policy, method: method}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[key]++
+}
+
+// DecisionCounts returns a snapshot of the recorded counters, sorted by
+// policy, method and outcome so output built from it is stable.
+func (c *MetricsCollector) DecisionCounts() []DecisionCount {
+	c.mu.Lock()
+	snapshot := make([]DecisionCount, 0, len(c.counts))
+	for key, count := range c.counts {
+		snapshot = append(snapshot, DecisionCount{
+			Authorized: key.authorized,
+			Policy:     key.policy,
+			Method:     key.method,
+			Count:      count,
+		})
+	}
+	c.mu.Unlock()
+	sort.Slice(snapshot, func(i, j int) bool {
+		a, b := snapshot[i], snapshot[j]
+		if a.Policy != b.Policy {
+			return a.Policy < b.Policy
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		return !a.Authorized && b.Authorized
+	})
+	return snapshot
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ocsp provides the OCSP response parsing behind the
+// "require_ocsp_stapled" matcher of authorization policy rules. It lives in
+// its own module so that the core authz package does not carry
+// golang.org/x/crypto; importing this package, for its side effect alone,
+// enables the matcher:
+//
+//	import _ "google.golang.org/grpc/authz/ocsp"
+package ocsp
+
+import (
+	"crypto/x509"
+	"time"
+
+	xocsp "golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc/authz/internal"
+)
+
+func init() {
+	internal.VerifyOCSPStaple = verifyStaple
+}
+
+// verifyStaple reports whether the stapled OCSP response parses, has status
+// good and is still fresh. When the issuer certificate is provided the
+// response signature is verified against it, and a NextUpdate time in the
+// past makes the staple stale.
+func verifyStaple(staple []byte, issuer *x509.Certificate) bool {
+	resp, err := xocsp.ParseResponse(staple, issuer)
+	if err != nil || resp.Status != xocsp.Good {
+		return false
+	}
+	return resp.NextUpdate.IsZero() || time.Now().Before(resp.NextUpdate)
+}
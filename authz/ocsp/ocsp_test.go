@@ -0,0 +1,163 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ocsp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz"
+	_ "google.golang.org/grpc/authz/ocsp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/internal/grpctest"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// fakeServerTransportStream is a minimal grpc.ServerTransportStream carrying
+// the method name.
+type fakeServerTransportStream struct {
+	method string
+}
+
+func (s *fakeServerTransportStream) Method() string               { return s.method }
+func (s *fakeServerTransportStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeServerTransportStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeServerTransportStream) SetTrailer(metadata.MD) error { return nil }
+
+// rpcContext returns a context shaped like an incoming RPC over the given TLS
+// connection state.
+func rpcContext(state tls.ConnectionState) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+	ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	return grpc.NewContextWithServerTransportStream(ctx, &fakeServerTransportStream{method: "/pkg.Service/Api"})
+}
+
+// TestRequireOCSPStapled verifies that importing this package enables the
+// "require_ocsp_stapled" matcher: a fresh good staple authorizes the RPC, and
+// missing, stale, revoked or malformed staples never do.
+func (s) TestRequireOCSPStapled(t *testing.T) {
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate issuer key: %v", err)
+	}
+	issuerTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+	}
+	issuerDER, err := x509.CreateCertificate(rand.Reader, issuerTemplate, issuerTemplate, &issuerKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("Failed to create issuer certificate: %v", err)
+	}
+	issuer, err := x509.ParseCertificate(issuerDER)
+	if err != nil {
+		t.Fatalf("Failed to parse issuer certificate: %v", err)
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate leaf key: %v", err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, issuer, &leafKey.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatalf("Failed to create leaf certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatalf("Failed to parse leaf certificate: %v", err)
+	}
+	staple := func(status int, nextUpdate time.Time) []byte {
+		resp, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			SerialNumber: leaf.SerialNumber,
+			Status:       status,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   nextUpdate,
+		}, issuerKey)
+		if err != nil {
+			t.Fatalf("Failed to create OCSP response: %v", err)
+		}
+		return resp
+	}
+	state := func(ocspResponse []byte) tls.ConnectionState {
+		return tls.ConnectionState{
+			OCSPResponse:     ocspResponse,
+			PeerCertificates: []*x509.Certificate{leaf, issuer},
+		}
+	}
+
+	i, err := authz.NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "stapled",
+				"request": {"require_ocsp_stapled": true}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("authz.NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(state tls.ConnectionState) error {
+		_, err := i.UnaryInterceptor(rpcContext(state), nil, &grpc.UnaryServerInfo{}, handler)
+		return err
+	}
+
+	if err := call(state(staple(ocsp.Good, time.Now().Add(time.Hour)))); err != nil {
+		t.Errorf("RPC with a fresh good staple failed: %v", err)
+	}
+	for name, st := range map[string]tls.ConnectionState{
+		"without a staple":        state(nil),
+		"with a revoked staple":   state(staple(ocsp.Revoked, time.Now().Add(time.Hour))),
+		"with a stale staple":     state(staple(ocsp.Good, time.Now().Add(-time.Minute))),
+		"with a malformed staple": state([]byte("not an ocsp response")),
+	} {
+		if got := status.Code(call(st)); got != codes.PermissionDenied {
+			t.Errorf("RPC %s = %v, want %v", name, got, codes.PermissionDenied)
+		}
+	}
+}
@@ -0,0 +1,637 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+)
+
+// Option configures the behavior of authorization interceptors beyond what
+// the policy itself expresses. Policies constructed with options are
+// evaluated by the authz policy engine.
+type Option interface {
+	apply(*interceptorOptions)
+}
+
+// interceptorOptions holds the resolved values of all interceptor options.
+type interceptorOptions struct {
+	streamLifecycleAudit        bool
+	denialMessage               string
+	streamFirstMessageExtractor func(msg any) (principal string, attrs map[string]string)
+	deadlineAudit               bool
+	loggerErrorGracePeriod      time.Duration
+	principalSources            []PrincipalSource
+	eventEnricher               func(ctx context.Context, e *audit.Event)
+	missingLoggerReport         func(names []string)
+	metricsRecorder             MetricsRecorder
+	metricsCollector            *MetricsCollector
+	sensitiveMetadataKeys       []string
+	auditMetadataKeys           []string
+	scope                       *methodScope
+	correlationHeader           string
+	noCorrelationGeneration     bool
+	decisionCallback            func(DecisionInfo)
+	enforcementGate             func(ctx context.Context, fullMethod string) bool
+	redirectDetails             bool
+	pathMethodConsistency       bool
+	summaryInterval             time.Duration
+	summaryLogger               audit.Logger
+	forensicSampleRate          float64
+	forensicHeaderKeys          []string
+	knownMethods                []string
+	evaluationTimeout           time.Duration
+	postHandlerAudit            bool
+	dynamicListSources          map[string]DynamicListSource
+	defaultAllow                bool
+	geoipResolver               GeoIPResolver
+	ruleHitCounts               bool
+	ruleHitReset                func(map[string]uint64)
+	canaryPrincipals            []string
+	signedIdentity              *signedIdentityConfig
+}
+
+// DecisionInfo describes one authorization decision reported to the callback
+// configured with WithDecisionCallback.
+type DecisionInfo struct {
+	// FullMethodName is the full RPC method name the decision was made for.
+	FullMethodName string
+	// Authorized reports whether the RPC was allowed.
+	Authorized bool
+	// MatchedRule is the qualified name of the rule that decided the RPC, or
+	// empty when no rule matched.
+	MatchedRule string
+	// Shadow marks decisions made by a staged candidate policy mirroring the
+	// active one. Shadow decisions never affect the RPC and emit no audit
+	// events; comparing them against the active decisions for the same
+	// traffic shows how a candidate would behave before it is promoted.
+	Shadow bool
+}
+
+// WithCanaryPrincipals designates test identities that always exercise a
+// staged candidate policy: while a candidate is staged with StageCandidate,
+// RPCs from the listed principals are evaluated and enforced against the
+// candidate instead of the active policy, and their audit events carry the
+// candidate's policy hash. All other callers stay on the active policy, so
+// known test callers can validate a candidate with real traffic before it is
+// rolled out.
+//
+// Principals are compared against the identity known when the RPC arrives:
+// the principal resolved by WithPrincipalSources when one applies, otherwise
+// the peer's SPIFFE ID. The option has no effect while no candidate is
+// staged, and
+// PromoteCandidate ends the split: after promotion the canary principals are
+// evaluated by the promoted policy like everyone else, with no change in the
+// decisions they observe.
+func WithCanaryPrincipals(principals ...string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.canaryPrincipals = principals
+	})
+}
+
+// WithDecisionCallback invokes f once per authorization decision with a
+// summary of its outcome, e.g. to feed rollout comparison metrics. When a
+// candidate policy is staged with StageCandidate, its mirrored shadow
+// decisions are reported through the same callback with DecisionInfo.Shadow
+// set. f runs on the RPC path and must be fast and non-blocking.
+func WithDecisionCallback(f func(DecisionInfo)) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.decisionCallback = f
+	})
+}
+
+// WithDefaultAllow inverts the engine's default-deny stance for RPCs no rule
+// matches: when no deny rule matches and no allow rule is present or matches,
+// the RPC is allowed and audited with the distinct matched rule
+// "<default_allow>". This supports running authz purely as a deny list, where
+// everything is permitted unless explicitly denied.
+//
+// Use deliberately: with this option a rule gap permits traffic instead of
+// blocking it, so typos in deny rules fail open. Explicit allow and warn
+// rules still behave as usual and take effect before the default applies.
+func WithDefaultAllow() Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.defaultAllow = true
+	})
+}
+
+// WithDynamicListSource registers source under name for "dynamic_list"
+// matchers to consult, e.g. a Redis-backed block list that security
+// automation updates outside the policy. The option can be repeated to
+// register several sources; a policy whose "dynamic_list" matchers name an
+// unregistered source fails construction.
+//
+// Sources are consulted on the RPC path and must answer from local state;
+// see DynamicListSource.
+func WithDynamicListSource(name string, source DynamicListSource) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		if o.dynamicListSources == nil {
+			o.dynamicListSources = make(map[string]DynamicListSource)
+		}
+		o.dynamicListSources[name] = source
+	})
+}
+
+// WithEvaluationTimeout bounds the time spent matching one RPC against the
+// policy's rules. When evaluation exceeds d the RPC fails closed: it is
+// denied and audited with the distinct matched rule "<eval_timeout>", so
+// timeouts are visible in audit streams rather than stalling the RPC path.
+//
+// The built-in matchers are cheap — table lookups, string comparisons and an
+// occasional signature check — so healthy policies never come near a sensible
+// timeout; the bound mainly guards custom and external extensions with
+// unpredictable cost. A timed-out evaluation is abandoned, not interrupted:
+// its goroutine runs to completion in the background, so a matcher that
+// blocks forever still leaks a goroutine.
+func WithEvaluationTimeout(d time.Duration) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.evaluationTimeout = d
+	})
+}
+
+// WithGeoIPResolver registers the resolver "geoip" matchers consult to place
+// the peer IP geographically; it is also used to stamp audit.Event.Country
+// on every audited decision. A policy with "geoip" matchers fails
+// construction without a registered resolver.
+//
+// The resolver runs on the RPC path, once for matching and once for audit
+// stamping, so it must answer from a local database or cache; see
+// GeoIPResolver.
+func WithGeoIPResolver(r GeoIPResolver) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.geoipResolver = r
+	})
+}
+
+// WithKnownMethods supplies the set of full method names the server actually
+// implements, consulted by "known_method" matchers. A deny rule with
+// "known_method": false then blocks probes for unimplemented methods
+// distinctly from denials of real methods, cutting scanner noise out of the
+// interesting denial events. The application typically builds the list from
+// its registered services, e.g. by iterating grpc.Server.GetServiceInfo after
+// all services are registered and before the server starts.
+//
+// The set is static after construction: methods registered later are unknown
+// to the matcher until the interceptor is rebuilt. Without this option the
+// set is empty, so "known_method": true matches nothing and
+// "known_method": false matches every method.
+func WithKnownMethods(methods []string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.knownMethods = methods
+	})
+}
+
+// WithForensicDenialSampling attaches a dump of the request headers to a
+// random sample of denial audit events, in audit.Event.ForensicHeaders, so
+// incident investigations have full request context for some denials without
+// the volume of logging every header of every denial. rate is the fraction of
+// denial events sampled, in (0, 1]; each denial is sampled independently. keys
+// restricts the dump to the named headers, matched case-insensitively; with no
+// keys all headers are dumped.
+//
+// The interceptor's sensitive-key redaction applies to the dump like it does
+// to captured metadata: values under "authorization" and the other keys of
+// WithSensitiveMetadataKeys are replaced with "<redacted>" before the event
+// reaches any logger. Allowed RPCs are never sampled.
+func WithForensicDenialSampling(rate float64, keys ...string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		if keys == nil {
+			keys = []string{}
+		}
+		o.forensicSampleRate = rate
+		o.forensicHeaderKeys = keys
+	})
+}
+
+// WithEnforcementGate consults gate before a denial takes effect, so
+// enforcement can be rolled out gradually behind a feature-flag system. When
+// gate returns false the policy is still evaluated and audited, but the RPC is
+// allowed regardless of the decision; when it returns true denials apply as
+// usual. Unlike staging a whole candidate policy, the gate is consulted per
+// RPC, so a flag system can flip enforcement per method, per tenant or by
+// percentage without rebuilding the interceptor.
+//
+// Audit events for gated-off denials record the would-be decision: Authorized
+// stays false and Outcome is audit.OutcomeUnenforced, distinguishing them from
+// both real denials and real allows. Denial side effects such as tarpit delays
+// and redirect details do not apply while enforcement is off.
+//
+// gate runs on the RPC path for every would-be denial and must be cheap and
+// non-blocking; flag lookups should be served from memory, not from a remote
+// call.
+func WithEnforcementGate(gate func(ctx context.Context, fullMethod string) bool) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.enforcementGate = gate
+	})
+}
+
+// WithPeriodicSummary emits a rollup audit event to the given logger every
+// interval, aggregating the decisions made since the previous summary. It
+// coexists with per-RPC auditing: the policy's audit loggers are unaffected
+// and the summary logger receives only summaries. Intervals in which no
+// decisions were made emit nothing.
+//
+// A summary is an audit.Event with EventType audit.EventTypeSummary and the
+// policy name set; the decision fields are unused. Its Labels carry the
+// rollup:
+//
+//   - "allowed", "denied": the decision counts for the interval, in decimal
+//   - "top_rules": the most-hit matched rules as "name=count" pairs, comma
+//     separated, most hits first, at most five
+//
+// The background ticker runs until the interceptor's Close; the final
+// partial interval is summarized on Close.
+func WithPeriodicSummary(interval time.Duration, logger audit.Logger) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.summaryInterval = interval
+		o.summaryLogger = logger
+	})
+}
+
+// methodScope holds the compiled include and exclude patterns of
+// WithScopeMethods.
+type methodScope struct {
+	include []*stringPatternMatcher
+	exclude []*stringPatternMatcher
+}
+
+// contains reports whether the method is in scope: not matched by any exclude
+// pattern and, when include patterns are given, matched by one of them.
+func (s *methodScope) contains(method string) bool {
+	for _, m := range s.exclude {
+		if m.match(method) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, m := range s.include {
+		if m.match(method) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithScopeMethods restricts authorization to the methods matching the
+// include patterns, minus those matching the exclude patterns, so authz can
+// be adopted incrementally, e.g. enforced only for new "/v2.*" methods while
+// legacy methods keep passing through. Patterns use the same syntax as the
+// policy's "paths" matchers: "*" matches any method, a trailing "*" matches a
+// prefix and a leading "*" matches a suffix. An empty include list puts every
+// method in scope; exclude always wins over include.
+//
+// Out-of-scope methods bypass the engine entirely: the policy is not
+// evaluated and no audit events are emitted for them.
+func WithScopeMethods(include, exclude []string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		scope := &methodScope{}
+		for _, p := range include {
+			scope.include = append(scope.include, newStringPatternMatcher(p))
+		}
+		for _, p := range exclude {
+			scope.exclude = append(scope.exclude, newStringPatternMatcher(p))
+		}
+		o.scope = scope
+	})
+}
+
+// WithRuleHitCounts enables per-rule hit counting, readable at any time with
+// StaticInterceptor.GetRuleHitCounts. Counters are concurrency-safe and are
+// reset whenever the active policy is replaced, e.g. by AddRule, RemoveRule
+// or a candidate promotion; onReset, when non-nil, receives the final counts
+// of the replaced policy so no window is lost across reloads. onReset is
+// also invoked with the final counts when the interceptor is closed.
+func WithRuleHitCounts(onReset func(counts map[string]uint64)) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.ruleHitCounts = true
+		o.ruleHitReset = onReset
+	})
+}
+
+// WithSignedIdentityHeader trusts an identity forwarded by an authenticating
+// proxy only after verifying its signature. The proxy sends the identity in
+// the identityKey metadata header and, alongside it, the signatureKey header
+// holding the hex-encoded HMAC-SHA256 of the identity value computed with
+// hmacSecret. When the signature verifies, the identity becomes the RPC's
+// principal, matched by principal matchers and recorded in audit events with
+// principal source "signed_header:<identityKey>", taking precedence over
+// WithPrincipalSources. The signature comparison is constant time.
+//
+// When the identity header is present but the signature header is missing,
+// malformed, repeated or does not verify, the RPC is denied before any rule
+// is evaluated and audited with the distinct matched rule
+// "invalid_identity_signature". RPCs without the identity header are
+// evaluated normally with no principal set, so the proxy's signature is
+// required exactly when an identity is claimed.
+func WithSignedIdentityHeader(identityKey, signatureKey string, hmacSecret []byte) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.signedIdentity = &signedIdentityConfig{
+			identityKey:  strings.ToLower(identityKey),
+			signatureKey: strings.ToLower(signatureKey),
+			secret:       hmacSecret,
+		}
+	})
+}
+
+// defaultSensitiveMetadataKeys are the metadata keys redacted from captured
+// audit event metadata when WithSensitiveMetadataKeys is not used.
+var defaultSensitiveMetadataKeys = []string{"authorization", "proxy-authorization", "cookie", "set-cookie"}
+
+// funcOption wraps a function that modifies interceptorOptions into an
+// implementation of the Option interface.
+type funcOption struct {
+	f func(*interceptorOptions)
+}
+
+func (fo *funcOption) apply(o *interceptorOptions) {
+	fo.f(o)
+}
+
+func newFuncOption(f func(*interceptorOptions)) *funcOption {
+	return &funcOption{f: f}
+}
+
+// WithStreamLifecycleAudit makes the stream interceptor emit two audit events
+// per authorized stream instead of one: an "open" event when the stream is
+// authorized and a "close" event when the stream ends, carrying the stream
+// duration and its final status. Both events share a generated correlation ID
+// so they can be joined by consumers. Denied streams still produce a single
+// decision event.
+//
+// This is opt-in because it doubles the number of events emitted for
+// streaming RPCs.
+func WithStreamLifecycleAudit() Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.streamLifecycleAudit = true
+	})
+}
+
+// WithDenialMessage replaces the default "unauthorized RPC request rejected"
+// message returned to clients for denied RPCs with the given text. The
+// message is returned verbatim and, like the default, carries no rule or
+// principal details.
+func WithDenialMessage(msg string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.denialMessage = msg
+	})
+}
+
+// WithStreamFirstMessageExtractor defers the authorization decision for
+// streaming RPCs in which the client sends messages until the first message
+// arrives, and evaluates the policy with the inputs f extracts from it. This
+// supports protocols that carry authorization context, such as a session
+// token, in the first message of a stream rather than in headers.
+//
+// The returned principal, when non-empty, is matched by "principals" matchers
+// alongside any certificate identity and recorded in audit events. The
+// returned attributes are matched like headers.
+//
+// The first message is not consumed: the handler's first RecvMsg receives it
+// as usual, after the decision has been made. If the RPC is denied, RecvMsg
+// returns a PermissionDenied error instead and the same error is returned to
+// the client when the handler finishes. The option only applies to
+// client-streaming and bidirectional-streaming RPCs; server-streaming and
+// unary RPCs are evaluated at the usual time, before the handler runs.
+// Streams that end before any message is received are never evaluated.
+func WithStreamFirstMessageExtractor(f func(msg any) (principal string, attrs map[string]string)) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.streamFirstMessageExtractor = f
+	})
+}
+
+// WithPostHandlerAudit defers the audit event of allowed RPCs until the
+// handler finishes, so the event records the complete RPC outcome — the
+// handler's final status code and message — in audit.Event.ResultCode and
+// audit.Event.ResultMessage, turning the audit log into a combined authz and
+// access log. Deferred events carry audit.EventTypeResult. The authorization
+// decision itself is still made before the handler runs, and denied RPCs are
+// audited at decision time as usual, without result fields.
+//
+// For streaming RPCs WithStreamLifecycleAudit takes precedence when both are
+// configured: its close events already carry the stream's final status.
+func WithPostHandlerAudit() Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.postHandlerAudit = true
+	})
+}
+
+// WithDeadlineAudit records each audited RPC's declared timeout in
+// audit.Event.DeadlineMillis, letting analysts classify RPCs by deadline and
+// spot unusually long-deadline calls. The timeout arrives on the wire in the
+// "grpc-timeout" header (a value and a unit, e.g. "10S"); the transport
+// parses it into the context deadline, whose remaining time is recorded. RPCs
+// without a deadline are recorded as -1.
+func WithDeadlineAudit() Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.deadlineAudit = true
+	})
+}
+
+// WithMetrics invokes r once per authorization decision with the outcome,
+// policy name, matched rule and evaluation latency. The authz/otel package
+// adapts a MetricsRecorder onto an OpenTelemetry meter, recording the
+// decisions as a counter and the latency as a histogram; keeping the
+// interface here and the OpenTelemetry types there spares users of this
+// package the dependency. Cardinality is bounded by the number of rules in
+// the policy; no per-principal or per-method values are reported. When the
+// option is not used, nothing is recorded.
+func WithMetrics(r MetricsRecorder) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.metricsRecorder = r
+	})
+}
+
+// WithMetricsCollector makes the interceptor count every authorization
+// decision into c, keyed by outcome, policy name and full RPC method, so
+// scrape-based monitoring systems can chart allow/deny rates without parsing
+// audit logs. The authz/metrics package adapts a MetricsCollector into a
+// Prometheus collector; keeping the aggregation here and the Prometheus
+// types there spares users of this package the dependency. When the option
+// is not used, nothing is recorded.
+func WithMetricsCollector(c *MetricsCollector) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.metricsCollector = c
+	})
+}
+
+// WithMissingLoggerReport invokes f once during interceptor construction with
+// the names of the optional audit loggers the policy references that have no
+// registered builder. Optional loggers are silently skipped otherwise, which
+// hides misconfigurations; the report makes them visible without failing
+// startup. f is not invoked when no optional loggers are missing. Mandatory
+// loggers without a registered builder still fail construction.
+func WithMissingLoggerReport(f func(names []string)) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.missingLoggerReport = f
+	})
+}
+
+// WithCorrelationHeader populates audit.Event.CorrelationID from the given
+// metadata header, e.g. "x-correlation-id", so the audit events of RPCs
+// fanning out from one client request can be joined across services. When the
+// header is absent a new correlation ID is generated and injected into the
+// RPC's incoming metadata under the same header before the handler runs, so
+// the handler can forward it on downstream calls. Stream lifecycle events
+// carry the header's ID instead of a per-stream generated one.
+//
+// Generation can be turned off with WithoutCorrelationIDGeneration, in which
+// case RPCs arriving without the header are audited with an empty
+// CorrelationID and nothing is injected.
+func WithCorrelationHeader(header string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.correlationHeader = strings.ToLower(header)
+	})
+}
+
+// WithoutCorrelationIDGeneration stops WithCorrelationHeader from generating
+// correlation IDs for RPCs that arrive without the configured header, for
+// deployments where only edge services mint IDs and a missing header should
+// stay visible as such.
+func WithoutCorrelationIDGeneration() Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.noCorrelationGeneration = true
+	})
+}
+
+// WithPathMethodConsistency denies RPCs whose ":path" pseudo-header, when it
+// is visible in the incoming metadata, differs from the full method name the
+// server dispatched the RPC to, catching smuggling attempts where the headers
+// and the routing disagree. The method name comes from grpc.Method on the RPC
+// context; the ":path" value is read from the incoming metadata, where
+// well-behaved transports do not usually surface it, so the check is skipped
+// for RPCs without it and mismatches should be rare in healthy stacks.
+//
+// Mismatches are denied and audited with the distinct reason
+// "path_method_mismatch" as the matched rule.
+func WithPathMethodConsistency() Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.pathMethodConsistency = true
+	})
+}
+
+// WithRedirectDetails attaches the "redirect" hint of a matched deny rule to
+// the PermissionDenied status returned to the client, as an
+// errdetails.ErrorInfo detail with reason "REDIRECT", domain "grpc.authz" and
+// the target authority under the "authority" metadata key. Smart clients can
+// decode the detail and retry against the hinted authority, e.g. when a deny
+// means the caller reached the wrong region.
+//
+// This is opt-in because the detail reveals routing information; without the
+// option denials by redirect-carrying rules return the usual opaque message.
+func WithRedirectDetails() Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.redirectDetails = true
+	})
+}
+
+// WithSensitiveMetadataKeys replaces the default list of metadata keys whose
+// values are redacted from audit.Event.Metadata before the event reaches any
+// logger, so captured metadata cannot leak secrets regardless of logger
+// configuration. Keys are matched case-insensitively and redacted values are
+// replaced with "<redacted>". By default "authorization",
+// "proxy-authorization", "cookie" and "set-cookie" are redacted; the default
+// applies whether or not any option is used, and passing an empty list
+// disables redaction.
+func WithSensitiveMetadataKeys(keys ...string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		if keys == nil {
+			keys = []string{}
+		}
+		o.sensitiveMetadataKeys = keys
+	})
+}
+
+// WithAuditMetadataKeys copies the incoming metadata under the given keys
+// into audit.Event.Metadata on every emitted event, so audit consumers can
+// see what the caller sent without logging every header. Keys not in the
+// allowlist are omitted entirely; keys are matched case-insensitively per
+// gRPC metadata semantics. Values under keys the interceptor considers
+// sensitive are still redacted, see WithSensitiveMetadataKeys.
+func WithAuditMetadataKeys(keys ...string) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.auditMetadataKeys = keys
+	})
+}
+
+// WithEventEnricher invokes f once per audit event, after the authorization
+// decision and before the event is handed to the loggers, so deployments can
+// attach computed context, such as a team owning the calling principal, in
+// one place for all events. f typically enriches the event in place through
+// its Labels map, which is non-nil whenever an enricher is configured.
+//
+// f is not invoked when the policy's audit condition means no event will be
+// emitted. It runs on the RPC path, so it must be fast and must not block;
+// expensive lookups should be cached.
+func WithEventEnricher(f func(ctx context.Context, e *audit.Event)) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.eventEnricher = f
+	})
+}
+
+// WithPrincipalSources resolves the caller's principal from the given
+// sources instead of only the peer certificate, supporting deployments where
+// callers authenticate heterogeneously, e.g. by mTLS or by a JWT. The sources
+// are tried in the order given and the first one yielding a non-empty
+// principal wins; a source that cannot resolve a principal yields an empty
+// one and evaluation falls through to the next. When no source yields a
+// principal, the principal is empty.
+//
+// The resolved principal is matched by "principals" matchers alongside any
+// certificate identity and is recorded in audit events, with the winning
+// source's name recorded in audit.Event.PrincipalSource. A principal
+// extracted by a first-message extractor takes precedence over all sources.
+func WithPrincipalSources(sources ...PrincipalSource) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.principalSources = sources
+	})
+}
+
+// WithPrincipalFromJWTClaim resolves the caller's principal from the given
+// string claim, e.g. "sub", of the JWT bearer token in the "authorization"
+// header, for deployments whose clients authenticate with OAuth2 bearer
+// tokens rather than mTLS. A certificate identity takes precedence when both
+// are present: the option is shorthand for
+// WithPrincipalSources(PrincipalSourceCert(), PrincipalSourceJWTClaim(claim)).
+// When neither a certificate nor a token is present the principal is empty
+// and "principals" matchers do not match.
+func WithPrincipalFromJWTClaim(claim string) Option {
+	return WithPrincipalSources(PrincipalSourceCert(), PrincipalSourceJWTClaim(claim))
+}
+
+// WithLoggerErrorGracePeriod controls when delivery errors from a mandatory
+// audit logger fail RPCs closed. Only loggers implementing
+// audit.FallibleLogger report delivery errors; by default the first reported
+// error fails the RPC. With a grace period, RPCs proceed and errors are only
+// counted until the logger has been failing continuously for at least d,
+// smoothing over transient blips while still failing closed on sustained
+// outages. A successful delivery resets the streak.
+//
+// Failure streaks are tracked per logger instance. When a logger is wrapped,
+// for example by a buffering or sampling decorator, the grace period applies
+// to the errors the wrapper surfaces: a wrapper that accepts events into a
+// buffer and drops them later reports success at accept time and defeats
+// fail-closed tracking.
+func WithLoggerErrorGracePeriod(d time.Duration) Option {
+	return newFuncOption(func(o *interceptorOptions) {
+		o.loggerErrorGracePeriod = d
+	})
+}
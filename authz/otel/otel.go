@@ -0,0 +1,93 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package otel integrates the authz interceptors with OpenTelemetry. It
+// adapts an OpenTelemetry meter for authz.WithMetrics, and importing it makes
+// audit events carry the trace and span IDs of the RPC's span context. It
+// lives in its own module so that the core authz package does not carry the
+// OpenTelemetry API.
+package otel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/authz"
+	"google.golang.org/grpc/authz/internal"
+)
+
+func init() {
+	internal.SpanContextFromContext = spanContextFromContext
+}
+
+// spanContextFromContext backs the audit event trace stamping in the authz
+// package, which stays OpenTelemetry-free: importing this package makes audit
+// events carry the trace and span IDs of the RPC's span context.
+func spanContextFromContext(ctx context.Context) (traceID, spanID string, ok bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", "", false
+	}
+	return sc.TraceID().String(), sc.SpanID().String(), true
+}
+
+// NewMetricsRecorder returns an authz.MetricsRecorder, for authz.WithMetrics,
+// recording authorization metrics on the given OpenTelemetry meter,
+// integrating with whatever exporter the application already configures. Two
+// instruments are created:
+//
+//   - "grpc.authz.decisions", a counter of decisions
+//   - "grpc.authz.evaluation.duration", a histogram of policy evaluation
+//     latency in milliseconds
+//
+// Both carry the attributes "authorized", "policy" and "matched_rule".
+// Cardinality is bounded by the number of rules in the policy; no
+// per-principal or per-method attributes are recorded.
+func NewMetricsRecorder(meter metric.Meter) (authz.MetricsRecorder, error) {
+	decisions, err := meter.Int64Counter("grpc.authz.decisions",
+		metric.WithDescription("Number of authorization decisions made."),
+		metric.WithUnit("{decision}"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decisions counter: %v", err)
+	}
+	latency, err := meter.Float64Histogram("grpc.authz.evaluation.duration",
+		metric.WithDescription("Time taken to evaluate the authorization policy for an RPC."),
+		metric.WithUnit("ms"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create evaluation duration histogram: %v", err)
+	}
+	return &metricsRecorder{decisions: decisions, latency: latency}, nil
+}
+
+// metricsRecorder holds the instruments recorded per authorization decision.
+type metricsRecorder struct {
+	decisions metric.Int64Counter
+	latency   metric.Float64Histogram
+}
+
+func (r *metricsRecorder) RecordDecision(ctx context.Context, authorized bool, policyName, matchedRule string, latency time.Duration) {
+	attrs := metric.WithAttributes(
+		attribute.Bool("authorized", authorized),
+		attribute.String("policy", policyName),
+		attribute.String("matched_rule", matchedRule),
+	)
+	r.decisions.Add(ctx, 1, attrs)
+	r.latency.Record(ctx, float64(latency)/float64(time.Millisecond), attrs)
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package otel_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz"
+	"google.golang.org/grpc/authz/audit"
+	authzotel "google.golang.org/grpc/authz/otel"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/internal/grpctest"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// fakeServerTransportStream is a minimal grpc.ServerTransportStream carrying
+// the method name.
+type fakeServerTransportStream struct {
+	method string
+}
+
+func (s *fakeServerTransportStream) Method() string               { return s.method }
+func (s *fakeServerTransportStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeServerTransportStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeServerTransportStream) SetTrailer(metadata.MD) error { return nil }
+
+// rpcContext returns a context shaped like an incoming RPC for the given
+// method.
+func rpcContext(method string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}})
+	return grpc.NewContextWithServerTransportStream(ctx, &fakeServerTransportStream{method: method})
+}
+
+// testMeter is a metric.Meter returning recording instruments for the two
+// authorization instruments.
+type testMeter struct {
+	noop.Meter
+	decisions *testCounter
+	latency   *testHistogram
+}
+
+func (m *testMeter) Int64Counter(string, ...metric.Int64CounterOption) (metric.Int64Counter, error) {
+	return m.decisions, nil
+}
+
+func (m *testMeter) Float64Histogram(string, ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	return m.latency, nil
+}
+
+type testCounter struct {
+	noop.Int64Counter
+	mu    sync.Mutex
+	total int64
+	attrs []attribute.Set
+}
+
+func (c *testCounter) Add(_ context.Context, v int64, opts ...metric.AddOption) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total += v
+	c.attrs = append(c.attrs, metric.NewAddConfig(opts).Attributes())
+}
+
+type testHistogram struct {
+	noop.Float64Histogram
+	mu      sync.Mutex
+	records []float64
+}
+
+func (h *testHistogram) Record(_ context.Context, v float64, _ ...metric.RecordOption) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, v)
+}
+
+// TestMetricsRecorder verifies that decisions are counted with the documented
+// attributes and that evaluation latency is recorded.
+func (s) TestMetricsRecorder(t *testing.T) {
+	meter := &testMeter{decisions: &testCounter{}, latency: &testHistogram{}}
+	recorder, err := authzotel.NewMetricsRecorder(meter)
+	if err != nil {
+		t.Fatalf("NewMetricsRecorder() failed: %v", err)
+	}
+	i, err := authz.NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api"]}
+			}
+		]
+	}`, authz.WithMetrics(recorder))
+	if err != nil {
+		t.Fatalf("authz.NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api"), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("Allowed call failed: %v", err)
+	}
+	_, err = i.UnaryInterceptor(rpcContext("/pkg.Service/Other"), nil, &grpc.UnaryServerInfo{}, handler)
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Fatalf("Denied call = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := meter.decisions.total; got != 2 {
+		t.Fatalf("Decision counter = %d, want 2", got)
+	}
+	wantAttrs := attribute.NewSet(
+		attribute.Bool("authorized", true),
+		attribute.String("policy", "authz"),
+		attribute.String("matched_rule", "authz_allow_api"),
+	)
+	if got := meter.decisions.attrs[0]; !got.Equals(&wantAttrs) {
+		t.Errorf("First decision attributes = %v, want %v", got.ToSlice(), wantAttrs.ToSlice())
+	}
+	if got := len(meter.latency.records); got != 2 {
+		t.Errorf("Latency histogram has %d records, want 2", got)
+	}
+}
+
+// recordingLogger captures the audit events it is handed.
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (l *recordingLogger) Log(e *audit.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, *e)
+}
+
+type recordingLoggerConfig struct{ audit.LoggerConfig }
+
+// recordingLoggerBuilder builds the shared recording logger, so tests can
+// reach the events of a logger instantiated from a policy.
+type recordingLoggerBuilder struct {
+	logger *recordingLogger
+}
+
+func (b *recordingLoggerBuilder) Name() string { return "otel_test_recording_logger" }
+func (b *recordingLoggerBuilder) ParseLoggerConfig(json.RawMessage) (audit.LoggerConfig, error) {
+	return recordingLoggerConfig{}, nil
+}
+func (b *recordingLoggerBuilder) Build(audit.LoggerConfig) audit.Logger { return b.logger }
+
+// TestAuditEventTraceContext verifies that audit events carry the
+// OpenTelemetry trace and span IDs from the RPC context when one is present.
+func (s) TestAuditEventTraceContext(t *testing.T) {
+	rec := &recordingLogger{}
+	audit.RegisterLoggerBuilder(&recordingLoggerBuilder{logger: rec})
+	// The regex path forces the policy engine, which stamps the trace
+	// context; plain policies evaluate through the RBAC engines.
+	i, err := authz.NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"regex_paths": [".*"]}
+			}
+		],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY_AND_ALLOW",
+			"audit_loggers": [
+				{"name": "otel_test_recording_logger"}
+			]
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("authz.NewStatic() failed: %v", err)
+	}
+	defer i.Close()
+
+	traceID := trace.TraceID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10}
+	spanID := trace.SpanID{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+	ctx := trace.ContextWithSpanContext(rpcContext("/pkg.Service/Api"), sc)
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("RPC with span context failed: %v", err)
+	}
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api"), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("RPC without span context failed: %v", err)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.events) != 2 {
+		t.Fatalf("Logged %d events, want 2", len(rec.events))
+	}
+	if got, want := rec.events[0].TraceID, traceID.String(); got != want {
+		t.Errorf("First event TraceID = %q, want %q", got, want)
+	}
+	if got, want := rec.events[0].SpanID, spanID.String(); got != want {
+		t.Errorf("First event SpanID = %q, want %q", got, want)
+	}
+	if rec.events[1].TraceID != "" || rec.events[1].SpanID != "" {
+		t.Errorf("Event without span context has TraceID %q, SpanID %q, want empty", rec.events[1].TraceID, rec.events[1].SpanID)
+	}
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DumpPolicy returns the policy the interceptor is evaluating as normalized
+// JSON: fields are sorted, formatting is canonical and empty fields are
+// omitted, so dumps of semantically identical policies compare equal and can
+// be diffed against the policy source. The dump of a valid policy is itself a
+// valid policy.
+//
+// When redactLoggerConfigs is set, values of audit logger config fields whose
+// names suggest credentials (such as "token" or "password") are replaced with
+// "<redacted>" so the dump is safe to log or display.
+func (i *StaticInterceptor) DumpPolicy(redactLoggerConfigs bool) (string, error) {
+	i.mu.Lock()
+	raw, err := json.Marshal(i.policy)
+	i.mu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal policy: %v", err)
+	}
+	var policy map[string]any
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return "", fmt.Errorf("failed to normalize policy: %v", err)
+	}
+	if redactLoggerConfigs {
+		redactAuditLoggerConfigs(policy)
+	}
+	normalized, ok := pruneEmpty(policy).(map[string]any)
+	if !ok {
+		normalized = map[string]any{}
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(normalized); err != nil {
+		return "", fmt.Errorf("failed to marshal policy: %v", err)
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// pruneEmpty recursively drops object fields holding zero values (null, "",
+// false, empty objects and empty arrays), which json.Marshal emits for the
+// policy struct's unset fields. Array elements are normalized but never
+// dropped.
+func pruneEmpty(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			value = pruneEmpty(value)
+			if isEmptyValue(value) {
+				delete(v, key)
+				continue
+			}
+			v[key] = value
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = pruneEmpty(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isEmptyValue(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	default:
+		return false
+	}
+}
+
+// sensitiveConfigKeyParts flags audit logger config fields that likely hold
+// credentials.
+var sensitiveConfigKeyParts = []string{"password", "secret", "token", "credential", "key", "authorization"}
+
+func isSensitiveConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveConfigKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAuditLoggerConfigs replaces the values of sensitive-looking fields in
+// the policy's audit logger configs with "<redacted>".
+func redactAuditLoggerConfigs(policy map[string]any) {
+	options, _ := policy["audit_logging_options"].(map[string]any)
+	loggers, _ := options["audit_loggers"].([]any)
+	for _, l := range loggers {
+		logger, _ := l.(map[string]any)
+		config, _ := logger["config"].(map[string]any)
+		redactSensitiveFields(config)
+	}
+}
+
+func redactSensitiveFields(config map[string]any) {
+	for key, value := range config {
+		if isSensitiveConfigKey(key) {
+			config[key] = "<redacted>"
+			continue
+		}
+		if nested, ok := value.(map[string]any); ok {
+			redactSensitiveFields(nested)
+		}
+	}
+}
@@ -0,0 +1,1547 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v3rbacpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/authz/internal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/internal/grpcrand"
+	internalmatcher "google.golang.org/grpc/internal/xds/matcher"
+	"google.golang.org/grpc/metadata"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// policyEngine evaluates an authorization policy directly against incoming
+// RPCs. Policies that only use matchers with an RBAC proto representation are
+// translated and evaluated by the internal RBAC engine; policies using
+// extended matchers (such as "listener") are evaluated here instead. The
+// matching semantics for paths, headers and principals mirror the RBAC
+// translation exactly.
+type policyEngine struct {
+	policyName string
+	// policyHash is the stable hash of the policy, stamped on every audit
+	// event so fleet-wide policy divergence is detectable. See policyHash.
+	policyHash     string
+	denyRules      []*compiledRule
+	warnRules      []*compiledRule
+	allowRules     []*compiledRule
+	auditLoggers   []*auditLoggerState
+	auditCondition v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition
+	// auditPredicate is the compiled "audit_condition_expression", taking the
+	// place of the condition enum when set.
+	auditPredicate auditPredicate
+	opts           interceptorOptions
+	// largePolicy enables the method prefilter short-circuit in decide. It is
+	// set when the policy has at least prefilterRuleThreshold rules.
+	largePolicy bool
+	// lockouts are the policy's "lockout" matchers, which every decision
+	// outcome is reported back to so they can track denial streaks.
+	lockouts []*lockoutMatcher
+	// summary aggregates decisions for WithPeriodicSummary, or nil when not
+	// configured.
+	summary *summaryCollector
+	// ruleHits counts decisions per rule for WithRuleHitCounts, or nil when
+	// not configured.
+	ruleHits *ruleHitCounter
+	// streamLimits are the policy's "max_concurrent_streams" matchers, which
+	// the stream interceptor counts running streams into.
+	streamLimits []*concurrentStreamsMatcher
+}
+
+// prefilterRuleThreshold is the total number of rules from which a policy is
+// considered large enough for the method prefilter to pay for itself.
+const prefilterRuleThreshold = 16
+
+// newPolicyEngine compiles the given policy into a policyEngine. The policy
+// must already have passed the structural validation performed by the RBAC
+// translation.
+func newPolicyEngine(policy *authorizationPolicy, opts interceptorOptions) (*policyEngine, error) {
+	if len(policy.AllowRules) == 0 && !opts.defaultAllow {
+		return nil, fmt.Errorf(`"allow_rules" is not present and WithDefaultAllow is not set`)
+	}
+	e, err := compilePolicy(policy, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.initRuntime(policy, opts); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// initRuntime instantiates the engine's runtime state — audit loggers and the
+// periodic summary collector — and validates the interceptor options. It is
+// the side-effecting half of engine construction, shared by newPolicyEngine
+// and the compiled-policy load path.
+func (e *policyEngine) initRuntime(policy *authorizationPolicy, opts interceptorOptions) error {
+	var err error
+	if e.auditLoggers, err = buildAuditLoggers(policy.AuditLoggingOptions.AuditLoggers); err != nil {
+		return err
+	}
+	if opts.summaryInterval != 0 || opts.summaryLogger != nil {
+		if opts.summaryInterval <= 0 || opts.summaryLogger == nil {
+			return fmt.Errorf("WithPeriodicSummary requires a positive interval and a non-nil logger")
+		}
+		e.summary = newSummaryCollector(policy.Name, opts.summaryInterval, opts.summaryLogger)
+	}
+	if opts.forensicSampleRate != 0 || opts.forensicHeaderKeys != nil {
+		if opts.forensicSampleRate <= 0 || opts.forensicSampleRate > 1 {
+			return fmt.Errorf("WithForensicDenialSampling requires a rate in (0, 1], got %v", opts.forensicSampleRate)
+		}
+	}
+	if opts.evaluationTimeout < 0 {
+		return fmt.Errorf("WithEvaluationTimeout requires a positive duration, got %v", opts.evaluationTimeout)
+	}
+	if c := opts.signedIdentity; c != nil && (c.identityKey == "" || c.signatureKey == "" || len(c.secret) == 0) {
+		return fmt.Errorf("WithSignedIdentityHeader requires non-empty header keys and a non-empty secret")
+	}
+	return nil
+}
+
+// stop releases the engine's background resources: the periodic summary
+// ticker, and the policy's audit loggers, which are closed so buffering
+// sinks flush. It also delivers the final rule hit counts to the
+// WithRuleHitCounts callback, so a policy reload does not silently discard
+// them. It is safe on engines without any.
+func (e *policyEngine) stop() {
+	if e == nil {
+		return
+	}
+	if e.summary != nil {
+		e.summary.stop()
+	}
+	if e.ruleHits != nil && e.opts.ruleHitReset != nil {
+		e.opts.ruleHitReset(e.ruleHits.snapshot())
+	}
+	for _, state := range e.auditLoggers {
+		closeAuditLogger(state.logger)
+	}
+}
+
+// closeAuditLogger invokes the logger's Close method when it has one,
+// treating loggers without one as no-ops. Both the audit.Closer shape and
+// the plain Close() shape of the built-in sink loggers are recognized.
+func closeAuditLogger(l audit.Logger) {
+	switch c := l.(type) {
+	case interface{ Close() error }:
+		if err := c.Close(); err != nil {
+			logger.Warningf("closing audit logger: %v", err)
+		}
+	case interface{ Close() }:
+		c.Close()
+	}
+}
+
+// compilePolicy compiles the policy's rules and audit condition without
+// instantiating audit loggers or metrics instruments, so it is free of side
+// effects and usable for validation alone.
+func compilePolicy(policy *authorizationPolicy, opts interceptorOptions) (*policyEngine, error) {
+	e := &policyEngine{policyName: policy.Name, opts: opts}
+	var err error
+	if e.policyHash, err = policyHash(policy); err != nil {
+		return nil, err
+	}
+	if e.denyRules, e.warnRules, e.allowRules, err = compileRuleSets(policy); err != nil {
+		return nil, err
+	}
+	if e.auditCondition, err = parseAuditCondition(policy.AuditLoggingOptions.AuditCondition); err != nil {
+		return nil, err
+	}
+	if expr := policy.AuditLoggingOptions.AuditConditionExpression; expr != "" {
+		if policy.AuditLoggingOptions.AuditCondition != "" {
+			return nil, fmt.Errorf(`"audit_condition" and "audit_condition_expression" cannot both be set`)
+		}
+		if e.auditPredicate, err = parseAuditConditionExpression(expr); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.wireMatchers(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// compileRuleSets compiles the policy's deny, warn and allow rules, applying
+// the validations that span rule lists.
+func compileRuleSets(policy *authorizationPolicy) (deny, warn, allow []*compiledRule, err error) {
+	if deny, err = compileRules(policy.DenyRules, policy.Name); err != nil {
+		return nil, nil, nil, fmt.Errorf(`"deny_rules" %v`, err)
+	}
+	// Warn rules don't take part in the RBAC translation, so they are
+	// validated here by running them through the same rule parsing.
+	if _, err := parseRules(policy.WarnRules, policy.Name); err != nil {
+		return nil, nil, nil, fmt.Errorf(`"warn_rules" %v`, err)
+	}
+	if warn, err = compileRules(policy.WarnRules, policy.Name); err != nil {
+		return nil, nil, nil, fmt.Errorf(`"warn_rules" %v`, err)
+	}
+	if allow, err = compileRules(policy.AllowRules, policy.Name); err != nil {
+		return nil, nil, nil, fmt.Errorf(`"allow_rules" %v`, err)
+	}
+	for _, rules := range [][]rule{policy.WarnRules, policy.AllowRules} {
+		for _, r := range rules {
+			if r.DelayMillis != 0 {
+				return nil, nil, nil, fmt.Errorf(`"delay_ms" is only supported on deny rules`)
+			}
+			if r.Redirect != nil {
+				return nil, nil, nil, fmt.Errorf(`"redirect" is only supported on deny rules`)
+			}
+		}
+	}
+	return deny, warn, allow, nil
+}
+
+// wireMatchers connects the compiled rules' stateful extended matchers to the
+// engine and the interceptor options: lockout and concurrent-stream matchers
+// are registered for outcome reporting, and matchers depending on option-
+// provided collaborators are resolved against them. It runs after the rule
+// sets are in place, on both the compile and the compiled-load path.
+func (e *policyEngine) wireMatchers() error {
+	opts := e.opts
+	e.largePolicy = len(e.denyRules)+len(e.warnRules)+len(e.allowRules) >= prefilterRuleThreshold
+	if opts.ruleHitCounts {
+		e.ruleHits = newRuleHitCounter(e.denyRules, e.warnRules, e.allowRules)
+	}
+	knownMethods := make(map[string]bool, len(opts.knownMethods))
+	for _, method := range opts.knownMethods {
+		knownMethods[method] = true
+	}
+	for _, rules := range [][]*compiledRule{e.denyRules, e.warnRules, e.allowRules} {
+		for _, r := range rules {
+			for _, m := range r.ext {
+				switch m := m.(type) {
+				case *lockoutMatcher:
+					e.lockouts = append(e.lockouts, m)
+				case *knownMethodMatcher:
+					m.methods = knownMethods
+				case *dynamicListMatcher:
+					src, ok := opts.dynamicListSources[m.source]
+					if !ok {
+						return fmt.Errorf(`"dynamic_list" references source %q, which is not registered with WithDynamicListSource`, m.source)
+					}
+					m.list = src
+				case *geoipMatcher:
+					if opts.geoipResolver == nil {
+						return fmt.Errorf(`"geoip" requires a resolver registered with WithGeoIPResolver`)
+					}
+					m.resolver = opts.geoipResolver
+				case *concurrentStreamsMatcher:
+					e.streamLimits = append(e.streamLimits, m)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// policyHash computes the stable hash stamped on audit events: the SHA-256
+// digest, as lowercase hex, of the parsed policy re-serialized with
+// json.Marshal. The re-serialization canonicalizes the source JSON — field
+// order and whitespace differences disappear and unknown fields are dropped —
+// so two fleet members loading semantically identical policy files report the
+// same hash regardless of formatting.
+func policyHash(policy *authorizationPolicy) (string, error) {
+	canonical, err := json.Marshal(policy)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func parseAuditCondition(condition string) (v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition, error) {
+	if condition == "" {
+		return v3rbacpb.RBAC_AuditLoggingOptions_NONE, nil
+	}
+	rbacCondition, ok := v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition_value[condition]
+	if !ok {
+		return v3rbacpb.RBAC_AuditLoggingOptions_NONE, fmt.Errorf("failed to parse AuditCondition %v. Allowed values {NONE, ON_DENY, ON_ALLOW, ON_DENY_AND_ALLOW}", condition)
+	}
+	return v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition(rbacCondition), nil
+}
+
+// auditLoggerState pairs a configured audit logger with its policy flags and
+// its delivery failure tracking for loggers that report errors.
+type auditLoggerState struct {
+	logger   audit.Logger
+	optional bool
+	// principals are the logger's "principal_match" patterns; when non-empty,
+	// only events whose principal matches one of them are dispatched to the
+	// logger.
+	principals []*stringPatternMatcher
+
+	mu sync.Mutex
+	// failingSince is the start of the current streak of delivery failures,
+	// or the zero time when the last delivery succeeded.
+	failingSince time.Time
+}
+
+// recordResult tracks the delivery result and reports whether the logger has
+// now been failing continuously for at least the grace period. With a zero
+// grace period the first error qualifies.
+func (s *auditLoggerState) recordResult(err error, grace time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.failingSince = time.Time{}
+		return false
+	}
+	now := time.Now()
+	if s.failingSince.IsZero() {
+		s.failingSince = now
+	}
+	return now.Sub(s.failingSince) >= grace
+}
+
+// buildAuditLoggers instantiates the audit loggers configured in the policy
+// using the builders registered in the audit logger registry. A missing
+// builder for an optional logger is skipped; for a mandatory logger it is an
+// error.
+func buildAuditLoggers(configs []*auditLogger) ([]*auditLoggerState, error) {
+	var loggers []*auditLoggerState
+	for i, config := range configs {
+		if config.Name == "" {
+			return nil, fmt.Errorf("missing required field: name in audit_logging_options.audit_loggers[%v]", i)
+		}
+		builder := audit.GetLoggerBuilder(config.Name)
+		if builder == nil {
+			if config.IsOptional {
+				continue
+			}
+			return nil, fmt.Errorf("no builder registered for %v", config.Name)
+		}
+		rawJSON := json.RawMessage("{}")
+		if config.Config != nil {
+			var err error
+			if rawJSON, err = config.Config.MarshalJSON(); err != nil {
+				return nil, fmt.Errorf("error parsing custom audit logger config: %v", err)
+			}
+		}
+		loggerConfig, err := builder.ParseLoggerConfig(rawJSON)
+		if err != nil {
+			return nil, fmt.Errorf("custom config could not be parsed by registered factory. error: %v", err)
+		}
+		l := builder.Build(loggerConfig)
+		if hc, ok := l.(audit.HealthChecker); ok {
+			if err := hc.HealthCheck(); err != nil {
+				if !config.IsOptional {
+					return nil, fmt.Errorf("audit logger %q failed its health check: %v", config.Name, err)
+				}
+				logger.Warningf("optional audit logger %q failed its health check: %v", config.Name, err)
+			}
+		}
+		state := &auditLoggerState{logger: l, optional: config.IsOptional}
+		for _, pattern := range config.PrincipalMatch {
+			state.principals = append(state.principals, newStringPatternMatcher(pattern))
+		}
+		loggers = append(loggers, state)
+	}
+	return loggers, nil
+}
+
+// decision is the result of evaluating a policy for one RPC.
+type decision struct {
+	in          *rpcInput
+	authorized  bool
+	matchedRule string
+	// matchedRuleIndex is the zero-based position of the matched rule within
+	// its allow, warn or deny list, or -1 when no policy rule matched, e.g.
+	// for the default deny or synthetic rules like path_method_mismatch.
+	matchedRuleIndex int
+	// warn is set when the RPC was allowed by a warn rule. The precedence is
+	// deny > warn-then-allow > default deny.
+	warn bool
+	// rateLimited is set when the RPC was denied by a rule carrying a
+	// "rate_limit" matcher.
+	rateLimited bool
+	// lockedOut is set when the RPC was denied by a rule carrying a
+	// "lockout" matcher, i.e. because the caller is temporarily locked out.
+	lockedOut bool
+	// streamLimited is set when the RPC was denied by a rule carrying a
+	// "max_concurrent_streams" matcher.
+	streamLimited bool
+	// pathMismatch is set when the RPC was denied by the
+	// WithPathMethodConsistency check rather than by a policy rule.
+	pathMismatch bool
+	// invalidSignature is set when the RPC was denied by the
+	// WithSignedIdentityHeader verification rather than by a policy rule.
+	invalidSignature bool
+	// evalTimeout is set when the RPC was denied because policy evaluation
+	// exceeded the WithEvaluationTimeout bound rather than by a policy rule.
+	evalTimeout bool
+	// unenforced is set when the RPC would have been denied but the
+	// WithEnforcementGate callback turned enforcement off for it, so the RPC
+	// is allowed and the would-be denial is only audited.
+	unenforced bool
+	// decompressionBomb is set when the RPC was denied by a rule carrying a
+	// "max_decompression_ratio" matcher, so the denial names the reason.
+	decompressionBomb bool
+	// ocspStapled is set when the RPC was denied by a rule carrying a
+	// "require_ocsp_stapled" matcher, so the denial names the reason.
+	ocspStapled bool
+	// redirectAuthority is the routing hint of the matched deny rule's
+	// "redirect", or empty.
+	redirectAuthority string
+	// delay is the tarpit delay of the matched deny rule, applied before the
+	// denial is returned.
+	delay time.Duration
+	// auditCondition is the matched rule's "audit_condition" override, or
+	// nil when the rule carries none and the policy-level condition applies.
+	auditCondition *v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition
+	// latency is the time evaluate spent reaching the decision, on the
+	// monotonic clock. It is surfaced on audit events so pathological
+	// policies show up in the audit log.
+	latency time.Duration
+}
+
+// tarpit holds the goroutine for the matched deny rule's "delay_ms" before
+// the denial is returned, slowing down scanners probing the policy. It
+// returns early when the client cancels the RPC, so a cancelled caller never
+// pins the goroutine for the full delay. Each delayed RPC still occupies a
+// goroutine for up to the configured duration, so tarpits are meant for
+// narrow deny rules, not broad traffic classes.
+func (d *decision) tarpit() {
+	if d.delay <= 0 {
+		return
+	}
+	t := time.NewTimer(d.delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-d.in.ctx.Done():
+	}
+}
+
+// outcome returns the audit outcome string for the decision.
+func (d *decision) outcome() string {
+	switch {
+	case d.unenforced:
+		return audit.OutcomeUnenforced
+	case d.warn:
+		return audit.OutcomeWarn
+	case d.authorized:
+		return audit.OutcomeAllow
+	default:
+		return audit.OutcomeDeny
+	}
+}
+
+// statusErr returns the status error to surface for the decision, or nil when
+// the RPC is authorized.
+func (d *decision) statusErr() error {
+	if d.authorized || d.unenforced {
+		return nil
+	}
+	if d.rateLimited {
+		return status.Errorf(codes.ResourceExhausted, "incoming RPC exceeded the rate limit in policy %q", d.matchedRule)
+	}
+	if d.streamLimited {
+		return status.Errorf(codes.ResourceExhausted, "incoming RPC exceeded the concurrent stream limit in policy %q", d.matchedRule)
+	}
+	if d.lockedOut {
+		return status.Errorf(codes.PermissionDenied, "incoming RPC is temporarily locked out by policy %q after repeated denials", d.matchedRule)
+	}
+	if d.decompressionBomb {
+		return status.Errorf(codes.PermissionDenied, "incoming RPC rejected by policy %q: decompression ratio exceeds the configured maximum", d.matchedRule)
+	}
+	if d.ocspStapled {
+		return status.Errorf(codes.PermissionDenied, "incoming RPC matched a deny policy %q: connection presented a stapled OCSP response", d.matchedRule)
+	}
+	if d.evalTimeout {
+		return status.Errorf(codes.PermissionDenied, "incoming RPC denied by %q: policy evaluation exceeded the configured timeout", evalTimeoutRule)
+	}
+	if d.pathMismatch {
+		return status.Errorf(codes.PermissionDenied, "incoming RPC denied by %q: the :path pseudo-header does not match the dispatched method", pathMethodMismatchRule)
+	}
+	if d.invalidSignature {
+		return status.Errorf(codes.PermissionDenied, "incoming RPC denied by %q: the identity header signature does not verify", invalidIdentitySignatureRule)
+	}
+	if d.matchedRule != "" {
+		return status.Errorf(codes.PermissionDenied, "incoming RPC matched a deny policy %q", d.matchedRule)
+	}
+	return status.Errorf(codes.PermissionDenied, "incoming RPC did not match an allow policy")
+}
+
+// decide evaluates the incoming RPC against the deny rules followed by the
+// allow rules and returns the resulting decision without emitting any audit
+// events.
+//
+// Errors returned by this function are compatible with the status package.
+func (e *policyEngine) decide(ctx context.Context) (*decision, error) {
+	in, err := newRPCInput(ctx)
+	if err != nil {
+		logger.Errorf("newRPCInput: %v", err)
+		return nil, status.Errorf(codes.Internal, "gRPC authz: %v", err)
+	}
+	e.resolvePrincipal(in)
+	return e.evaluate(in), nil
+}
+
+// resolvePrincipal applies the configured principal sources, in order, until
+// one yields a non-empty principal. It is a no-op when the input already
+// carries an extracted principal, which takes precedence over all sources.
+func (e *policyEngine) resolvePrincipal(in *rpcInput) {
+	if in.extractedPrincipal != "" {
+		return
+	}
+	for _, s := range e.opts.principalSources {
+		if p := s.resolve(in); p != "" {
+			in.extractedPrincipal = p
+			in.principalSource = s.name
+			return
+		}
+	}
+}
+
+// decideExtracted evaluates the incoming RPC like decide, with a principal and
+// attributes extracted from the stream's first message merged into the input.
+// The attributes are matched like headers and the principal, when non-empty,
+// is matched by principal matchers alongside any certificate identity.
+func (e *policyEngine) decideExtracted(ctx context.Context, principal string, attrs map[string]string) (*decision, error) {
+	in, err := newRPCInput(ctx)
+	if err != nil {
+		logger.Errorf("newRPCInput: %v", err)
+		return nil, status.Errorf(codes.Internal, "gRPC authz: %v", err)
+	}
+	in = in.withExtracted(principal, attrs)
+	e.resolvePrincipal(in)
+	return e.evaluate(in), nil
+}
+
+// evaluate matches the input against the rules and reports the resulting
+// outcome back to the policy's lockout matchers, which track denial streaks.
+// Denials attributed to a lockout rule itself are not reported, so a lockout
+// cannot prolong itself.
+func (e *policyEngine) evaluate(in *rpcInput) *decision {
+	start := time.Now()
+	var d *decision
+	if c := e.opts.signedIdentity; c != nil && !c.apply(in) {
+		d = &decision{in: in, authorized: false, matchedRule: invalidIdentitySignatureRule, matchedRuleIndex: -1, invalidSignature: true}
+	} else if e.opts.pathMethodConsistency && pathMethodMismatch(in) {
+		d = &decision{in: in, authorized: false, matchedRule: pathMethodMismatchRule, matchedRuleIndex: -1, pathMismatch: true}
+	} else if e.opts.evaluationTimeout > 0 {
+		d = e.evaluateRulesBounded(in)
+	} else {
+		d = e.evaluateRules(in)
+	}
+	if !d.authorized && e.opts.enforcementGate != nil && !e.opts.enforcementGate(in.ctx, in.fullMethod) {
+		d.unenforced = true
+	}
+	d.latency = time.Since(start)
+	if r := e.opts.metricsRecorder; r != nil {
+		r.RecordDecision(d.in.ctx, d.authorized, e.policyName, d.matchedRule, d.latency)
+	}
+	if mc := e.opts.metricsCollector; mc != nil {
+		mc.record(e.policyName, in.fullMethod, d.authorized)
+	}
+	e.ruleHits.record(d.matchedRule)
+	if e.summary != nil {
+		e.summary.record(d)
+	}
+	if cb := e.opts.decisionCallback; cb != nil {
+		cb(DecisionInfo{FullMethodName: in.fullMethod, Authorized: d.authorized, MatchedRule: d.matchedRule})
+	}
+	if !d.lockedOut {
+		for _, lm := range e.lockouts {
+			lm.record(in, d.authorized)
+		}
+	}
+	return d
+}
+
+// evaluateRules matches the input against the deny rules, the warn rules and
+// the allow rules, in that order.
+func (e *policyEngine) evaluateRules(in *rpcInput) *decision {
+	// For large policies, skip full rule evaluation when no rule's paths can
+	// possibly match the incoming method. Deny rules are still fully
+	// evaluated whenever one of them could match, so the matched rule
+	// recorded for explicit denies is unchanged.
+	if e.largePolicy && !rulesMayMatchMethod(e.allowRules, in.fullMethod) && !rulesMayMatchMethod(e.warnRules, in.fullMethod) {
+		if rulesMayMatchMethod(e.denyRules, in.fullMethod) {
+			for _, r := range e.denyRules {
+				if r.match(in) {
+					return &decision{in: in, authorized: false, matchedRule: r.name, matchedRuleIndex: r.index, rateLimited: r.rateLimited, streamLimited: r.streamLimited, lockedOut: r.lockout, decompressionBomb: r.decompressionBomb, ocspStapled: r.ocspStapled, delay: r.delay, redirectAuthority: r.redirectAuthority, auditCondition: r.auditCondition}
+				}
+			}
+		}
+		return e.unmatchedDecision(in)
+	}
+	for _, r := range e.denyRules {
+		if r.match(in) {
+			return &decision{in: in, authorized: false, matchedRule: r.name, matchedRuleIndex: r.index, rateLimited: r.rateLimited, streamLimited: r.streamLimited, lockedOut: r.lockout, decompressionBomb: r.decompressionBomb, ocspStapled: r.ocspStapled, delay: r.delay, redirectAuthority: r.redirectAuthority, auditCondition: r.auditCondition}
+		}
+	}
+	for _, r := range e.warnRules {
+		if r.match(in) {
+			return &decision{in: in, authorized: true, matchedRule: r.name, matchedRuleIndex: r.index, warn: true, auditCondition: r.auditCondition}
+		}
+	}
+	for _, r := range e.allowRules {
+		if r.match(in) {
+			return &decision{in: in, authorized: true, matchedRule: r.name, matchedRuleIndex: r.index, auditCondition: r.auditCondition}
+		}
+	}
+	return e.unmatchedDecision(in)
+}
+
+// defaultAllowRule is the matched-rule name recorded for RPCs allowed only
+// because WithDefaultAllow is set and no rule matched. The angle brackets
+// keep it out of the namespace of qualified rule names, which are always
+// "<policy>_<rule>".
+const defaultAllowRule = "<default_allow>"
+
+// unmatchedDecision is the decision for an RPC no rule matched: the default
+// deny, or a default allow under WithDefaultAllow.
+func (e *policyEngine) unmatchedDecision(in *rpcInput) *decision {
+	if e.opts.defaultAllow {
+		return &decision{in: in, authorized: true, matchedRule: defaultAllowRule, matchedRuleIndex: -1}
+	}
+	return &decision{in: in, authorized: false, matchedRuleIndex: -1}
+}
+
+// pathMethodMismatchRule is the matched-rule name recorded for denials by the
+// WithPathMethodConsistency check, distinguishing them from policy rules.
+const pathMethodMismatchRule = "path_method_mismatch"
+
+// evalTimeoutRule is the matched-rule name recorded for RPCs denied because
+// policy evaluation exceeded the WithEvaluationTimeout bound. The angle
+// brackets keep it out of the namespace of qualified rule names, which are
+// always "<policy>_<rule>".
+const evalTimeoutRule = "<eval_timeout>"
+
+// evaluateRulesBounded runs evaluateRules under the configured evaluation
+// timeout. On timeout the RPC fails closed with evalTimeoutRule as the
+// matched rule and the evaluation goroutine is abandoned to finish in the
+// background; its late decision is discarded.
+func (e *policyEngine) evaluateRulesBounded(in *rpcInput) *decision {
+	ch := make(chan *decision, 1)
+	go func() { ch <- e.evaluateRules(in) }()
+	t := time.NewTimer(e.opts.evaluationTimeout)
+	defer t.Stop()
+	select {
+	case d := <-ch:
+		return d
+	case <-t.C:
+		logger.Warningf("policy %q evaluation for %q exceeded the %v timeout; failing closed", e.policyName, in.fullMethod, e.opts.evaluationTimeout)
+		return &decision{in: in, authorized: false, matchedRule: evalTimeoutRule, matchedRuleIndex: -1, evalTimeout: true}
+	}
+}
+
+// pathMethodMismatch reports whether the RPC's ":path" pseudo-header is
+// visible in the incoming metadata and disagrees with the dispatched method.
+func pathMethodMismatch(in *rpcInput) bool {
+	values := in.md.Get(":path")
+	return len(values) > 0 && values[0] != in.fullMethod
+}
+
+// rulesMayMatchMethod reports whether any rule's path matchers could match
+// the given method. A rule without path matchers may match any method.
+func rulesMayMatchMethod(rules []*compiledRule, method string) bool {
+	for _, r := range rules {
+		if r.mayMatchMethod(method) {
+			return true
+		}
+	}
+	return false
+}
+
+// mayMatchMethod is a cheap upper bound on match: it only consults the
+// rule's path matchers.
+func (cr *compiledRule) mayMatchMethod(method string) bool {
+	if len(cr.paths) == 0 && len(cr.pathRegexps) == 0 {
+		return true
+	}
+	for _, p := range cr.paths {
+		if p.match(method) {
+			return true
+		}
+	}
+	for _, re := range cr.pathRegexps {
+		if re.MatchString(method) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAuthorized determines if the incoming RPC is authorized, emitting a
+// single audit event for the decision.
+//
+// Errors returned by this function are compatible with the status package.
+func (e *policyEngine) isAuthorized(ctx context.Context) error {
+	_, err := e.authorize(ctx)
+	return err
+}
+
+// authorize determines if the incoming RPC is authorized, emitting a single
+// audit event for the decision, and returns the allowing decision so callers
+// can expose it to the handler.
+//
+// Errors returned by this function are compatible with the status package.
+func (e *policyEngine) authorize(ctx context.Context) (*decision, error) {
+	d, err := e.decide(ctx)
+	if err != nil {
+		return nil, err
+	}
+	auditErr := e.doAuditLogging(d, nil)
+	if stErr := d.statusErr(); stErr != nil {
+		d.tarpit()
+		return nil, e.withRedirectDetail(d, stErr)
+	}
+	if auditErr != nil {
+		return nil, auditErr
+	}
+	return d, nil
+}
+
+// withRedirectDetail attaches the matched deny rule's redirect hint to the
+// denial status as an errdetails.ErrorInfo detail, when redirect details are
+// opted in with WithRedirectDetails. Otherwise the error is returned as is.
+func (e *policyEngine) withRedirectDetail(d *decision, stErr error) error {
+	if !e.opts.redirectDetails || d.redirectAuthority == "" {
+		return stErr
+	}
+	st, err := status.Convert(stErr).WithDetails(&errdetails.ErrorInfo{
+		Reason:   "REDIRECT",
+		Domain:   "grpc.authz",
+		Metadata: map[string]string{"authority": d.redirectAuthority},
+	})
+	if err != nil {
+		return stErr
+	}
+	return st.Err()
+}
+
+// auditSequence numbers audit events process-wide in emission order, so a
+// consumer observing a gap in audit.Event.Sequence knows events were dropped.
+var auditSequence atomic.Uint64
+
+// auditRunID identifies this process run on audit events, so a consumer
+// seeing a new audit.Event.RunID can tell a sequence restart from lost
+// events.
+var auditRunID = uuid.NewString()
+
+// auditConditionEmits reports whether the condition emits an audit event for
+// the decision.
+func auditConditionEmits(c v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition, d *decision) bool {
+	switch c {
+	case v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY:
+		return !d.authorized
+	case v3rbacpb.RBAC_AuditLoggingOptions_ON_ALLOW:
+		return d.authorized
+	case v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW:
+		return true
+	}
+	return false
+}
+
+// doAuditLogging emits an audit event for the decision to the configured
+// loggers, subject to the policy's audit condition. The optional mutate
+// function customizes the event before it is dispatched, e.g. for stream
+// lifecycle events.
+//
+// The returned error is non-nil when a mandatory logger reporting delivery
+// errors (audit.FallibleLogger) has been failing continuously for longer
+// than the configured grace period, in which case the RPC should fail
+// closed.
+func (e *policyEngine) doAuditLogging(d *decision, mutate func(*audit.Event)) error {
+	var emit bool
+	switch {
+	case d.auditCondition != nil:
+		// A rule-level "audit_condition" overrides the policy-level
+		// condition, and the expression, for decisions the rule matched.
+		emit = auditConditionEmits(*d.auditCondition, d)
+	case e.auditPredicate != nil:
+		emit = e.auditPredicate(d)
+	default:
+		emit = auditConditionEmits(e.auditCondition, d)
+	}
+	if !emit || len(e.auditLoggers) == 0 {
+		return nil
+	}
+	event := &audit.Event{
+		FullMethodName:   d.in.fullMethod,
+		Principal:        d.in.principal(),
+		PolicyName:       e.policyName,
+		MatchedRule:      d.matchedRule,
+		MatchedRuleIndex: d.matchedRuleIndex,
+		Authorized:       d.authorized,
+		Outcome:          d.outcome(),
+	}
+	event.PolicyHash = e.policyHash
+	event.Latency = d.latency
+	if stErr := d.statusErr(); stErr != nil {
+		event.StatusCode = status.Code(stErr)
+	}
+	if pi := d.in.peerInfo; pi != nil && pi.Addr != nil {
+		event.PeerAddress = pi.Addr.String()
+	}
+	event.PrincipalSource = d.in.principalSource
+	event.CertFingerprintSHA256 = d.in.certFingerprint()
+	event.CertificateSubject = d.in.certSubject()
+	if r := e.opts.geoipResolver; r != nil {
+		if ip := peerIP(d.in); ip != "" {
+			if _, _, country, err := r.Lookup(ip); err == nil {
+				event.Country = country
+			}
+		}
+	}
+	event.CorrelationID = e.correlationID(d.in)
+	// The trace context extractor is registered by the authz/otel package,
+	// keeping the OpenTelemetry API out of this module; without it the trace
+	// fields stay empty.
+	if extract, ok := internal.SpanContextFromContext.(func(context.Context) (string, string, bool)); ok {
+		if traceID, spanID, valid := extract(d.in.ctx); valid {
+			event.TraceID = traceID
+			event.SpanID = spanID
+		}
+	}
+	if e.opts.deadlineAudit {
+		event.DeadlineMillis = d.in.deadlineMillis
+		if event.DeadlineMillis == 0 {
+			// 0 is reserved for "not recorded"; round sub-millisecond
+			// remainders up.
+			event.DeadlineMillis = 1
+		}
+	}
+	if mutate != nil {
+		mutate(event)
+	}
+	if vals := auditContextValues(d.in.ctx); len(vals) > 0 {
+		event.Labels = make(map[string]string, len(vals))
+		for k, v := range vals {
+			event.Labels[k] = v
+		}
+	}
+	if keys := e.opts.auditMetadataKeys; len(keys) > 0 {
+		event.Metadata = forensicHeaders(d.in.md, keys)
+	}
+	if e.opts.eventEnricher != nil {
+		if event.Labels == nil {
+			event.Labels = make(map[string]string)
+		}
+		e.opts.eventEnricher(d.in.ctx, event)
+	}
+	if !d.authorized && e.opts.forensicSampleRate > 0 && randFloat64() < e.opts.forensicSampleRate {
+		event.ForensicHeaders = forensicHeaders(d.in.md, e.opts.forensicHeaderKeys)
+	}
+	e.redactSensitiveMetadata(event)
+	event.Sequence = auditSequence.Add(1)
+	event.RunID = auditRunID
+	var failClosedErr error
+	for _, state := range e.auditLoggers {
+		if !state.wantsPrincipal(event.Principal) {
+			continue
+		}
+		failClosedErr = e.logEvent(state, event, failClosedErr)
+	}
+	return failClosedErr
+}
+
+// wantsPrincipal reports whether the logger should receive events for the
+// given principal, i.e. whether it has no "principal_match" filter or one of
+// its patterns matches.
+func (s *auditLoggerState) wantsPrincipal(principal string) bool {
+	if len(s.principals) == 0 {
+		return true
+	}
+	for _, m := range s.principals {
+		if m.match(principal) {
+			return true
+		}
+	}
+	return false
+}
+
+// correlationID returns the correlation ID the RPC carries under the
+// configured correlation header. It is empty when no header is configured,
+// or when the RPC arrived without the header and generation is disabled; with
+// generation enabled the interceptor injects a generated ID before the
+// engine runs.
+func (e *policyEngine) correlationID(in *rpcInput) string {
+	if e.opts.correlationHeader == "" {
+		return ""
+	}
+	if values := in.md.Get(e.opts.correlationHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// randFloat64 is the sampling source of the forensic denial sampling,
+// swappable in tests for deterministic sampling decisions.
+var randFloat64 = grpcrand.Float64
+
+// forensicHeaders copies the request headers for a sampled denial's forensic
+// dump, restricted to the requested keys when any are configured. Keys are
+// matched case-insensitively.
+func forensicHeaders(md metadata.MD, keys []string) map[string][]string {
+	dump := make(map[string][]string, len(md))
+	for mdKey, values := range md {
+		if len(keys) > 0 {
+			wanted := false
+			for _, key := range keys {
+				if strings.EqualFold(key, mdKey) {
+					wanted = true
+					break
+				}
+			}
+			if !wanted {
+				continue
+			}
+		}
+		dump[mdKey] = append([]string(nil), values...)
+	}
+	return dump
+}
+
+// redactSensitiveMetadata replaces the values of sensitive keys in the
+// event's captured metadata and forensic header dump with "<redacted>", so a
+// snapshot taken by an enricher or a sampled header dump cannot leak secrets
+// to loggers. The keys come from WithSensitiveMetadataKeys, defaulting to
+// common credential headers.
+func (e *policyEngine) redactSensitiveMetadata(event *audit.Event) {
+	if len(event.Metadata) == 0 && len(event.ForensicHeaders) == 0 {
+		return
+	}
+	keys := e.opts.sensitiveMetadataKeys
+	if keys == nil {
+		keys = defaultSensitiveMetadataKeys
+	}
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		for _, m := range []map[string][]string{event.Metadata, event.ForensicHeaders} {
+			for mdKey, values := range m {
+				if strings.ToLower(mdKey) != key {
+					continue
+				}
+				redacted := make([]string, len(values))
+				for i := range redacted {
+					redacted[i] = "<redacted>"
+				}
+				m[mdKey] = redacted
+			}
+		}
+	}
+}
+
+// logEvent dispatches the event to the logger, tracking delivery failures
+// for loggers that report them. prevErr carries an earlier logger's
+// fail-closed error through the dispatch loop so all loggers still receive
+// the event.
+func (e *policyEngine) logEvent(state *auditLoggerState, event *audit.Event, prevErr error) error {
+	fl, ok := state.logger.(audit.FallibleLogger)
+	if !ok {
+		state.logger.Log(event)
+		return prevErr
+	}
+	err := fl.LogWithError(event)
+	if err != nil {
+		logger.Warningf("audit logger failed to deliver event: %v", err)
+	}
+	if state.recordResult(err, e.opts.loggerErrorGracePeriod) && !state.optional && prevErr == nil {
+		return status.Errorf(codes.Unavailable, "gRPC authz: mandatory audit logging failed: %v", err)
+	}
+	return prevErr
+}
+
+// rpcInput wraps data pulled from an incoming RPC that the policy engine
+// needs to find a matching rule.
+type rpcInput struct {
+	// ctx is the RPC context, used by extended matchers that read values
+	// piped in by interceptors or stats handlers.
+	ctx context.Context
+	// md is the HTTP Headers that are present in the incoming RPC.
+	md metadata.MD
+	// peerInfo is information about the downstream peer.
+	peerInfo *grpcpeer.Peer
+	// fullMethod is the method name being called on the upstream service.
+	fullMethod string
+	// authType is the type of authentication e.g. "tls".
+	authType string
+	// certs are the certificates presented by the peer during a TLS
+	// handshake.
+	certs []*x509.Certificate
+	// extractedPrincipal is a caller identity extracted from the stream's
+	// first message or resolved by a configured principal source.
+	extractedPrincipal string
+	// principalSource names the principal source that resolved
+	// extractedPrincipal, when principal sources are configured.
+	principalSource string
+	// deadlineMillis is the time remaining until the RPC's deadline in
+	// milliseconds, or -1 when the RPC has no deadline.
+	deadlineMillis int64
+}
+
+// withExtracted returns a copy of the input augmented with a principal and
+// attributes extracted from the stream's first message. The attributes are
+// merged into the metadata so header matchers see them.
+func (in *rpcInput) withExtracted(principal string, attrs map[string]string) *rpcInput {
+	out := *in
+	out.extractedPrincipal = principal
+	if len(attrs) > 0 {
+		out.md = metadata.Join(in.md, metadata.New(attrs))
+	}
+	return &out
+}
+
+// newRPCInput populates an rpcInput from the incoming context. The caller
+// should populate metadata, peer info and method name in the context, as the
+// grpc.Server does for unary and streaming interceptors.
+func newRPCInput(ctx context.Context) (*rpcInput, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, errors.New("missing metadata in incoming context")
+	}
+	pi, ok := grpcpeer.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("missing peer info in incoming context")
+	}
+	mn, ok := grpc.Method(ctx)
+	if !ok {
+		return nil, errors.New("missing method in incoming context")
+	}
+	var authType string
+	var peerCertificates []*x509.Certificate
+	if pi.AuthInfo != nil {
+		tlsInfo, ok := pi.AuthInfo.(credentials.TLSInfo)
+		if ok {
+			authType = pi.AuthInfo.AuthType()
+			peerCertificates = tlsInfo.State.PeerCertificates
+		}
+	}
+	deadlineMillis := int64(-1)
+	if deadline, ok := ctx.Deadline(); ok {
+		deadlineMillis = time.Until(deadline).Milliseconds()
+		if deadlineMillis < 0 {
+			deadlineMillis = 0
+		}
+	}
+	return &rpcInput{
+		ctx:            ctx,
+		md:             md,
+		peerInfo:       pi,
+		fullMethod:     mn,
+		authType:       authType,
+		certs:          peerCertificates,
+		deadlineMillis: deadlineMillis,
+	}, nil
+}
+
+// principal returns the identity recorded in audit events for the RPC: the
+// extracted principal when one is present, otherwise the SPIFFE ID of the
+// peer.
+func (in *rpcInput) principal() string {
+	if in.extractedPrincipal != "" {
+		return in.extractedPrincipal
+	}
+	return in.spiffeID()
+}
+
+// certFingerprint returns the SHA-256 fingerprint of the peer's leaf
+// certificate as lowercase hex over its DER encoding, or an empty string
+// when the peer presented no certificate.
+func (in *rpcInput) certFingerprint() string {
+	if len(in.certs) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(in.certs[0].Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// certSubject returns the subject distinguished name of the peer's leaf
+// certificate in RFC 2253 form, or an empty string when the peer presented
+// no certificate.
+func (in *rpcInput) certSubject() string {
+	if len(in.certs) == 0 {
+		return ""
+	}
+	return in.certs[0].Subject.String()
+}
+
+// spiffeID returns the SPIFFE ID of the peer, or an empty string when the
+// connection is not authenticated with a certificate carrying one.
+func (in *rpcInput) spiffeID() string {
+	if in.peerInfo != nil && in.peerInfo.AuthInfo != nil && in.peerInfo.AuthInfo.AuthType() == "tls" {
+		tlsInfo := in.peerInfo.AuthInfo.(credentials.TLSInfo)
+		if tlsInfo.SPIFFEID != nil {
+			return tlsInfo.SPIFFEID.String()
+		}
+	}
+	return ""
+}
+
+// extMatcher is implemented by matchers that check properties of an incoming
+// RPC which have no RBAC proto representation.
+type extMatcher interface {
+	match(in *rpcInput) bool
+}
+
+// compiledRule is a single allow or deny rule compiled into its matchers. A
+// rule matches when one of its principals (if any), one of its paths (if
+// any), all of its headers and all of its extended matchers match.
+type compiledRule struct {
+	name string
+	// index is the zero-based position of the rule within its allow, warn or
+	// deny list, recorded on audit events to disambiguate rules sharing a
+	// name.
+	index      int
+	principals []*principalPatternMatcher
+	paths      []*stringPatternMatcher
+	// pathRegexps are the rule's compiled "regex_paths", forming a union
+	// with paths: the rule's path constraint is satisfied when either kind
+	// matches the full method name.
+	pathRegexps []*regexp.Regexp
+	headers     [][]internalmatcher.HeaderMatcher
+	ext         []extMatcher
+	// lockout marks rules carrying a "lockout" matcher, whose denials are
+	// surfaced with a distinct lockout status message.
+	lockout bool
+	// delay is how long denials by this rule are held before returning, for
+	// deny rules carrying "delay_ms".
+	delay time.Duration
+	// rateLimited marks rules carrying a "rate_limit" matcher, whose denials
+	// surface as RESOURCE_EXHAUSTED instead of PERMISSION_DENIED.
+	rateLimited bool
+	// streamLimited marks rules carrying a "max_concurrent_streams" matcher,
+	// whose denials surface as RESOURCE_EXHAUSTED instead of
+	// PERMISSION_DENIED.
+	streamLimited bool
+	// decompressionBomb marks rules carrying a "max_decompression_ratio"
+	// matcher, whose denials name the reason in the status message.
+	decompressionBomb bool
+	// ocspStapled marks rules carrying "require_ocsp_stapled", whose denials
+	// name the reason in the status message.
+	ocspStapled bool
+	// redirectAuthority is the routing hint of a deny rule carrying
+	// "redirect", attached to denials as a status detail when opted in.
+	redirectAuthority string
+	// auditCondition, when non-nil, is the rule's "audit_condition", which
+	// overrides the policy-level condition for decisions this rule matched.
+	auditCondition *v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition
+}
+
+func compileRules(rules []rule, prefixName string) ([]*compiledRule, error) {
+	compiled := make([]*compiledRule, 0, len(rules))
+	for i, r := range rules {
+		cr, err := compileRule(r, prefixName)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", i, err)
+		}
+		cr.index = i
+		compiled = append(compiled, cr)
+	}
+	return compiled, nil
+}
+
+func compileRule(r rule, prefixName string) (*compiledRule, error) {
+	cr := &compiledRule{name: prefixName + "_" + r.Name}
+	for _, principal := range r.Source.Principals {
+		cr.principals = append(cr.principals, &principalPatternMatcher{m: newStringPatternMatcher(principal)})
+	}
+	for _, path := range r.Request.Paths {
+		cr.paths = append(cr.paths, newStringPatternMatcher(path))
+	}
+	for _, pattern := range r.Request.RegexPaths {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf(`"regex_paths" entry %q: %v`, pattern, err)
+		}
+		cr.pathRegexps = append(cr.pathRegexps, re)
+	}
+	for _, h := range r.Request.Headers {
+		key := strings.ToLower(h.Key)
+		values := make([]internalmatcher.HeaderMatcher, 0, len(h.Values))
+		for _, value := range h.Values {
+			values = append(values, newHeaderPatternMatcher(key, value))
+		}
+		cr.headers = append(cr.headers, values)
+	}
+	ext, err := compileRuleExt(r)
+	if err != nil {
+		return nil, err
+	}
+	cr.ext = ext
+	cr.rateLimited = r.Request.RateLimit != nil
+	cr.streamLimited = r.Request.MaxConcurrentStreams != nil
+	cr.lockout = r.Request.Lockout != nil
+	cr.decompressionBomb = r.Request.MaxDecompressionRatio != nil
+	cr.ocspStapled = r.Request.RequireOCSPStapled != nil
+	if r.DelayMillis < 0 {
+		return nil, fmt.Errorf(`"delay_ms" must not be negative`)
+	}
+	cr.delay = time.Duration(r.DelayMillis) * time.Millisecond
+	if r.Redirect != nil {
+		if r.Redirect.Authority == "" {
+			return nil, fmt.Errorf(`"redirect" requires "authority"`)
+		}
+		cr.redirectAuthority = r.Redirect.Authority
+	}
+	if r.AuditCondition != "" {
+		c, err := parseAuditCondition(r.AuditCondition)
+		if err != nil {
+			return nil, err
+		}
+		cr.auditCondition = &c
+	}
+	return cr, nil
+}
+
+// compileRuleExt compiles the rule's extended matchers and its "condition"
+// expression, when present. It is also the rebuild step of the compiled-load
+// path: extended matchers hold process-local state, such as rate-limiter
+// buckets and functions registered by extension modules, and so have no
+// serializable form.
+func compileRuleExt(r rule) ([]extMatcher, error) {
+	ext, err := compileExtMatchers(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Condition != "" {
+		m, err := newConditionMatcher(r.Condition)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	return ext, nil
+}
+
+// compileExtMatchers compiles the extended matchers the rule carries, in the
+// order they were introduced to the policy schema.
+func compileExtMatchers(r rule) ([]extMatcher, error) {
+	var ext []extMatcher
+	if r.Request.Listener != nil {
+		m, err := newListenerMatcher(r.Request.Listener)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.RetryAttempt != nil {
+		m, err := newRetryAttemptMatcher(r.Request.RetryAttempt)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.TimeoutBucket != nil {
+		m, err := newTimeoutBucketMatcher(r.Request.TimeoutBucket)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.JWTAudience != nil {
+		m, err := newJWTAudienceMatcher(r.Request.JWTAudience)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.CertExtension != nil {
+		m, err := newCertExtensionMatcher(r.Request.CertExtension)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.CertFingerprints != nil {
+		m, err := newCertFingerprintsMatcher(r.Request.CertFingerprints)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.RequestCompression != nil {
+		m, err := newRequestCompressionMatcher(r.Request.RequestCompression)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.MaxDecompressionRatio != nil {
+		m, err := newDecompressionRatioMatcher(*r.Request.MaxDecompressionRatio)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.UserAgent != nil {
+		m, err := newUserAgentMatcher(r.Request.UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.RateLimit != nil {
+		m, err := newRateLimitMatcher(r.Request.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.Lockout != nil {
+		m, err := newLockoutMatcher(r.Request.Lockout)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.RequireOCSPStapled != nil {
+		m, err := newOCSPStapledMatcher(r.Request.RequireOCSPStapled)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.SharedSecret != nil {
+		m, err := newSharedSecretMatcher(r.Request.SharedSecret)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.ConnectionAge != nil {
+		m, err := newConnectionAgeMatcher(r.Request.ConnectionAge)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.KnownMethod != nil {
+		m, err := newKnownMethodMatcher(r.Request.KnownMethod)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.TLS != nil {
+		m, err := newTLSMatcher(r.Request.TLS)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.DynamicList != nil {
+		m, err := newDynamicListMatcher(r.Request.DynamicList)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.TrustBoundary != nil {
+		m, err := newTrustBoundaryMatcher(r.Request.TrustBoundary)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.MetadataCardinality != nil {
+		m, err := newMetadataCardinalityMatcher(r.Request.MetadataCardinality)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.GeoIP != nil {
+		m, err := newGeoIPMatcher(r.Request.GeoIP)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	if r.Request.MaxConcurrentStreams != nil {
+		m, err := newConcurrentStreamsMatcher(r.Request.MaxConcurrentStreams)
+		if err != nil {
+			return nil, err
+		}
+		ext = append(ext, m)
+	}
+	return ext, nil
+}
+
+func (cr *compiledRule) match(in *rpcInput) bool {
+	if len(cr.principals) > 0 {
+		matched := false
+		for _, p := range cr.principals {
+			if p.match(in) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(cr.paths) > 0 || len(cr.pathRegexps) > 0 {
+		matched := false
+		for _, p := range cr.paths {
+			if p.match(in.fullMethod) {
+				matched = true
+				break
+			}
+		}
+		for _, re := range cr.pathRegexps {
+			if matched {
+				break
+			}
+			matched = re.MatchString(in.fullMethod)
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, values := range cr.headers {
+		matched := false
+		for _, m := range values {
+			if m.Match(in.md) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, m := range cr.ext {
+		if !m.match(in) {
+			return false
+		}
+	}
+	return true
+}
+
+// stringPatternMatcher matches a string against a policy pattern, using the
+// same pattern syntax the RBAC translation supports: "*" matches any
+// non-empty string, a trailing "*" matches a prefix, a leading "*" matches a
+// suffix and anything else matches exactly.
+type stringPatternMatcher struct {
+	kind    patternKind
+	pattern string
+}
+
+type patternKind int
+
+const (
+	patternExact patternKind = iota
+	patternPrefix
+	patternSuffix
+	patternAny
+)
+
+func newStringPatternMatcher(pattern string) *stringPatternMatcher {
+	switch {
+	case pattern == "*":
+		return &stringPatternMatcher{kind: patternAny}
+	case strings.HasSuffix(pattern, "*"):
+		return &stringPatternMatcher{kind: patternPrefix, pattern: strings.TrimSuffix(pattern, "*")}
+	case strings.HasPrefix(pattern, "*"):
+		return &stringPatternMatcher{kind: patternSuffix, pattern: strings.TrimPrefix(pattern, "*")}
+	default:
+		return &stringPatternMatcher{kind: patternExact, pattern: pattern}
+	}
+}
+
+func (m *stringPatternMatcher) match(s string) bool {
+	switch m.kind {
+	case patternAny:
+		return s != ""
+	case patternPrefix:
+		return strings.HasPrefix(s, m.pattern)
+	case patternSuffix:
+		return strings.HasSuffix(s, m.pattern)
+	default:
+		return s == m.pattern
+	}
+}
+
+// newHeaderPatternMatcher builds a header matcher for the given key and
+// pattern with the same semantics the RBAC translation produces.
+func newHeaderPatternMatcher(key, pattern string) internalmatcher.HeaderMatcher {
+	m := newStringPatternMatcher(pattern)
+	return headerMatcherForKind(key, m.kind, m.pattern)
+}
+
+// headerMatcherForKind builds a header matcher from an already classified
+// pattern, so the compiled-load path can skip re-classification.
+func headerMatcherForKind(key string, kind patternKind, pattern string) internalmatcher.HeaderMatcher {
+	switch kind {
+	case patternAny:
+		return internalmatcher.NewHeaderRegexMatcher(key, regexp.MustCompile(".+"), false)
+	case patternPrefix:
+		return internalmatcher.NewHeaderPrefixMatcher(key, pattern, false)
+	case patternSuffix:
+		return internalmatcher.NewHeaderSuffixMatcher(key, pattern, false)
+	default:
+		return internalmatcher.NewHeaderExactMatcher(key, pattern, false)
+	}
+}
+
+// principalPatternMatcher matches the peer identity against a policy pattern
+// with the same semantics as the RBAC authenticated matcher: the peer must be
+// authenticated over TLS and the pattern is matched against the URI SANs, DNS
+// SANs and subject of the peer certificate, in that order. A principal
+// extracted from the stream's first message, when present, is matched as well.
+type principalPatternMatcher struct {
+	m *stringPatternMatcher
+}
+
+func (pm *principalPatternMatcher) match(in *rpcInput) bool {
+	if in.extractedPrincipal != "" && pm.m.match(in.extractedPrincipal) {
+		return true
+	}
+	if in.authType != "tls" {
+		// Connection is not authenticated.
+		return false
+	}
+	if len(in.certs) == 0 {
+		return pm.m.match("")
+	}
+	cert := in.certs[0]
+	for _, uriSAN := range cert.URIs {
+		if pm.m.match(uriSAN.String()) {
+			return true
+		}
+	}
+	for _, dnsSAN := range cert.DNSNames {
+		if pm.m.match(dnsSAN) {
+			return true
+		}
+	}
+	return pm.m.match(cert.Subject.String())
+}
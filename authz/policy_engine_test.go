@@ -0,0 +1,4180 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	v3rbacpb "github.com/envoyproxy/go-control-plane/envoy/config/rbac/v3"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz/audit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/internal/transport"
+	"google.golang.org/grpc/metadata"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServerTransportStream is a minimal grpc.ServerTransportStream carrying
+// a method name.
+type fakeServerTransportStream struct {
+	method string
+}
+
+func (s *fakeServerTransportStream) Method() string               { return s.method }
+func (s *fakeServerTransportStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeServerTransportStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeServerTransportStream) SetTrailer(metadata.MD) error { return nil }
+
+// testConn returns a connection to attach to test contexts, shared across
+// tests, as the RBAC engines resolve the local address from it.
+var testConn = func() func() net.Conn {
+	var once sync.Once
+	var conn net.Conn
+	return func() net.Conn {
+		once.Do(func() {
+			lis, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				panic(err)
+			}
+			go func() {
+				c, _ := lis.Accept()
+				if c != nil {
+					defer c.Close()
+				}
+			}()
+			if conn, err = net.Dial("tcp", lis.Addr().String()); err != nil {
+				panic(err)
+			}
+		})
+		return conn
+	}
+}()
+
+// rpcContext builds an incoming context with the metadata, peer info, method
+// name and connection the authorization engines need.
+func rpcContext(method string, md metadata.MD) context.Context {
+	if md == nil {
+		md = metadata.MD{}
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), md)
+	ctx = grpcpeer.NewContext(ctx, &grpcpeer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}})
+	ctx = transport.SetConnection(ctx, testConn())
+	return grpc.NewContextWithServerTransportStream(ctx, &fakeServerTransportStream{method: method})
+}
+
+// largeTestPolicy returns a policy with enough rules to enable the method
+// prefilter.
+func largeTestPolicy() string {
+	policy := `{"name": "authz", "deny_rules": [`
+	for i := 0; i < prefilterRuleThreshold/2; i++ {
+		if i > 0 {
+			policy += ","
+		}
+		policy += fmt.Sprintf(`{"name": "deny_%d", "request": {"paths": ["/pkg.Service/Deny%d"], "headers": [{"key": "key-abc", "values": ["val-abc"]}]}}`, i, i)
+	}
+	policy += `], "allow_rules": [`
+	for i := 0; i < prefilterRuleThreshold; i++ {
+		if i > 0 {
+			policy += ","
+		}
+		policy += fmt.Sprintf(`{"name": "allow_%d", "request": {"paths": ["/pkg.Service/Method%d"]}}`, i, i)
+	}
+	policy += `]}`
+	return policy
+}
+
+// TestPolicyEnginePrefilterDecisions verifies that the method prefilter used
+// for large policies never changes a decision or the matched rule recorded
+// for it.
+func TestPolicyEnginePrefilterDecisions(t *testing.T) {
+	policy, err := parseAuthorizationPolicy(largeTestPolicy())
+	if err != nil {
+		t.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	optimized, err := newPolicyEngine(policy, interceptorOptions{})
+	if err != nil {
+		t.Fatalf("newPolicyEngine() failed: %v", err)
+	}
+	reference, err := newPolicyEngine(policy, interceptorOptions{})
+	if err != nil {
+		t.Fatalf("newPolicyEngine() failed: %v", err)
+	}
+	if !optimized.largePolicy {
+		t.Fatal("Expected the test policy to enable the method prefilter")
+	}
+	reference.largePolicy = false
+
+	inputs := []struct {
+		method string
+		md     metadata.MD
+	}{
+		{method: "/pkg.Service/Method0"},
+		{method: "/pkg.Service/Method7"},
+		{method: "/pkg.Service/Deny0", md: metadata.Pairs("key-abc", "val-abc")},
+		{method: "/pkg.Service/Deny0"},
+		{method: "/pkg.Service/Unknown"},
+		{method: "/other.Service/Method0"},
+	}
+	for _, input := range inputs {
+		ctx := rpcContext(input.method, input.md)
+		got, err := optimized.decide(ctx)
+		if err != nil {
+			t.Fatalf("optimized.decide(%v) failed: %v", input.method, err)
+		}
+		want, err := reference.decide(ctx)
+		if err != nil {
+			t.Fatalf("reference.decide(%v) failed: %v", input.method, err)
+		}
+		if got.authorized != want.authorized || got.matchedRule != want.matchedRule {
+			t.Errorf("decide(%v, %v) = (%v, %q), want (%v, %q)", input.method, input.md, got.authorized, got.matchedRule, want.authorized, want.matchedRule)
+		}
+	}
+}
+
+// BenchmarkPolicyEnginePrefilter compares evaluation of a large policy for a
+// method no rule can match, with and without the prefilter.
+func BenchmarkPolicyEnginePrefilter(b *testing.B) {
+	policy, err := parseAuthorizationPolicy(largeTestPolicy())
+	if err != nil {
+		b.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	for name, prefilter := range map[string]bool{"Prefilter": true, "FullScan": false} {
+		b.Run(name, func(b *testing.B) {
+			engine, err := newPolicyEngine(policy, interceptorOptions{})
+			if err != nil {
+				b.Fatalf("newPolicyEngine() failed: %v", err)
+			}
+			engine.largePolicy = prefilter
+			ctx := rpcContext("/pkg.Service/Unknown", metadata.Pairs("key-abc", "val-abc"))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := engine.decide(ctx); err != nil {
+					b.Fatalf("decide() failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// TestWarnRules verifies the precedence of warn rules (deny > warn-then-allow
+// > default deny) and the outcome recorded for them.
+func TestWarnRules(t *testing.T) {
+	policyStr := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_blocked",
+				"request": {"paths": ["/pkg.Service/Blocked"]}
+			}
+		],
+		"warn_rules": [
+			{
+				"name": "warn_legacy",
+				"request": {"paths": ["/pkg.Service/Legacy*", "/pkg.Service/Blocked"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api"]}
+			}
+		]
+	}`
+	policy, err := parseAuthorizationPolicy(policyStr)
+	if err != nil {
+		t.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	engine, err := newPolicyEngine(policy, interceptorOptions{})
+	if err != nil {
+		t.Fatalf("newPolicyEngine() failed: %v", err)
+	}
+	tests := []struct {
+		method          string
+		wantAuthorized  bool
+		wantMatchedRule string
+		wantOutcome     string
+	}{
+		{method: "/pkg.Service/Api", wantAuthorized: true, wantMatchedRule: "authz_allow_api", wantOutcome: "allow"},
+		{method: "/pkg.Service/LegacyCall", wantAuthorized: true, wantMatchedRule: "authz_warn_legacy", wantOutcome: "warn"},
+		{method: "/pkg.Service/Blocked", wantAuthorized: false, wantMatchedRule: "authz_deny_blocked", wantOutcome: "deny"},
+		{method: "/pkg.Service/Unknown", wantAuthorized: false, wantMatchedRule: "", wantOutcome: "deny"},
+	}
+	for _, test := range tests {
+		d, err := engine.decide(rpcContext(test.method, nil))
+		if err != nil {
+			t.Fatalf("decide(%v) failed: %v", test.method, err)
+		}
+		if d.authorized != test.wantAuthorized || d.matchedRule != test.wantMatchedRule || d.outcome() != test.wantOutcome {
+			t.Errorf("decide(%v) = (%v, %q, %q), want (%v, %q, %q)", test.method, d.authorized, d.matchedRule, d.outcome(), test.wantAuthorized, test.wantMatchedRule, test.wantOutcome)
+		}
+	}
+}
+
+// TestWithDenialMessage verifies that the configured denial message replaces
+// the default text returned for denied RPCs.
+func TestWithDenialMessage(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api"]}
+			}
+		]
+	}`
+	i, err := NewStatic(policy, WithDenialMessage("access denied, contact the service owner"))
+	if err != nil {
+		t.Fatalf("NewStatic(%v) failed: %v", policy, err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("UnaryInterceptor on allowed RPC failed: %v", err)
+	}
+	_, err = i.UnaryInterceptor(rpcContext("/pkg.Service/Other", nil), nil, &grpc.UnaryServerInfo{}, handler)
+	if got, want := status.Convert(err).Message(), "access denied, contact the service owner"; got != want || status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("UnaryInterceptor on denied RPC = %v, want %v with code %v", err, want, codes.PermissionDenied)
+	}
+}
+
+// fakeServerStream is a minimal grpc.ServerStream feeding queued string
+// messages to RecvMsg.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	msgs []string
+}
+
+func (s *fakeServerStream) Context() context.Context { return s.ctx }
+
+func (s *fakeServerStream) RecvMsg(m any) error {
+	if len(s.msgs) == 0 {
+		return io.EOF
+	}
+	*(m.(*string)) = s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return nil
+}
+
+// TestStreamFirstMessageExtractor verifies that client-streaming RPCs are
+// evaluated against the inputs extracted from the first message, that the
+// message still reaches the handler and that denials surface on RecvMsg.
+func TestStreamFirstMessageExtractor(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_admin",
+				"source": {"principals": ["spiffe://foo.com/admin"]},
+				"request": {"headers": [{"key": "session-role", "values": ["admin"]}]}
+			}
+		]
+	}`
+	extractor := func(msg any) (string, map[string]string) {
+		token := *(msg.(*string))
+		if token == "admin-token" {
+			return "spiffe://foo.com/admin", map[string]string{"session-role": "admin"}
+		}
+		return "", nil
+	}
+	i, err := NewStatic(policy, WithStreamFirstMessageExtractor(extractor))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	tests := []struct {
+		name     string
+		firstMsg string
+		wantCode codes.Code
+	}{
+		{name: "allowed", firstMsg: "admin-token", wantCode: codes.OK},
+		{name: "denied", firstMsg: "other-token", wantCode: codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received []string
+			handler := func(_ any, ss grpc.ServerStream) error {
+				for {
+					var msg string
+					if err := ss.RecvMsg(&msg); err != nil {
+						if err == io.EOF {
+							return nil
+						}
+						return err
+					}
+					received = append(received, msg)
+				}
+			}
+			ss := &fakeServerStream{ctx: rpcContext("/pkg.Service/Stream", nil), msgs: []string{test.firstMsg, "payload"}}
+			err := i.StreamInterceptor(nil, ss, &grpc.StreamServerInfo{IsClientStream: true}, handler)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("StreamInterceptor() = %v, want code %v", err, test.wantCode)
+			}
+			if test.wantCode == codes.OK {
+				if want := []string{test.firstMsg, "payload"}; !cmp.Equal(received, want) {
+					t.Fatalf("handler received %v, want %v", received, want)
+				}
+			} else if len(received) != 0 {
+				t.Fatalf("handler received %v, want no messages on denied stream", received)
+			}
+		})
+	}
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Log(*audit.Event) {}
+
+type noopLoggerConfig struct{ audit.LoggerConfig }
+
+// noopLoggerBuilder accepts any config, for tests that exercise logger
+// configuration handling rather than logging itself.
+type noopLoggerBuilder struct{}
+
+func (noopLoggerBuilder) Name() string { return "test_noop_logger" }
+func (noopLoggerBuilder) ParseLoggerConfig(json.RawMessage) (audit.LoggerConfig, error) {
+	return noopLoggerConfig{}, nil
+}
+func (noopLoggerBuilder) Build(audit.LoggerConfig) audit.Logger { return noopLogger{} }
+
+// TestDumpPolicy verifies that policy dumps are stable across a dump/re-parse
+// round trip and that logger config redaction hides credential-like fields.
+func TestDumpPolicy(t *testing.T) {
+	audit.RegisterLoggerBuilder(noopLoggerBuilder{})
+	policy := `{
+		"name":    "authz",
+		"allow_rules": [{"name": "allow_api",
+			"request": {"paths": ["/pkg.Service/Api"], "headers": []}}],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY",
+			"audit_loggers": [
+				{
+					"name": "test_noop_logger",
+					"config": {"endpoint": "https://audit.example.com", "api_token": "s3cr3t", "tls": {"client_key": "pem"}}
+				}
+			]
+		}
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	dump, err := i.DumpPolicy(false)
+	if err != nil {
+		t.Fatalf("DumpPolicy(false) failed: %v", err)
+	}
+	reparsed, err := NewStatic(dump)
+	if err != nil {
+		t.Fatalf("NewStatic() on dumped policy failed: %v", err)
+	}
+	redump, err := reparsed.DumpPolicy(false)
+	if err != nil {
+		t.Fatalf("DumpPolicy(false) on re-parsed policy failed: %v", err)
+	}
+	if dump != redump {
+		t.Errorf("Policy dump is not round-trip stable:\nfirst:\n%s\nsecond:\n%s", dump, redump)
+	}
+	redacted, err := i.DumpPolicy(true)
+	if err != nil {
+		t.Fatalf("DumpPolicy(true) failed: %v", err)
+	}
+	for _, secret := range []string{"s3cr3t", "pem"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("DumpPolicy(true) = %s, contains sensitive value %q", redacted, secret)
+		}
+	}
+	if !strings.Contains(redacted, "<redacted>") || !strings.Contains(redacted, "https://audit.example.com") {
+		t.Errorf("DumpPolicy(true) = %s, want non-sensitive fields kept and sensitive values replaced with %q", redacted, "<redacted>")
+	}
+}
+
+// TestDynamicRules verifies that AddRule and RemoveRule change subsequent
+// decisions, reject invalid input and leave the active policy untouched on
+// failure.
+func TestDynamicRules(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api"]}
+			}
+		]
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	checkDecision := func(t *testing.T, method string, wantCode codes.Code) {
+		t.Helper()
+		_, err := i.UnaryInterceptor(rpcContext(method, nil), nil, &grpc.UnaryServerInfo{}, handler)
+		if got := status.Code(err); got != wantCode {
+			t.Fatalf("UnaryInterceptor(%v) = %v, want code %v", method, err, wantCode)
+		}
+	}
+
+	checkDecision(t, "/pkg.Service/Extra", codes.PermissionDenied)
+	if err := i.AddRule("allow", `{"name": "allow_extra", "request": {"paths": ["/pkg.Service/Extra"]}}`); err != nil {
+		t.Fatalf("AddRule() failed: %v", err)
+	}
+	checkDecision(t, "/pkg.Service/Extra", codes.OK)
+
+	if err := i.AddRule("deny", `{"name": "deny_extra", "request": {"paths": ["/pkg.Service/Extra"]}}`); err != nil {
+		t.Fatalf("AddRule() failed: %v", err)
+	}
+	checkDecision(t, "/pkg.Service/Extra", codes.PermissionDenied)
+	if err := i.RemoveRule("deny_extra"); err != nil {
+		t.Fatalf("RemoveRule() failed: %v", err)
+	}
+	checkDecision(t, "/pkg.Service/Extra", codes.OK)
+
+	if err := i.RemoveRule("nonexistent"); err == nil {
+		t.Error("RemoveRule(nonexistent) succeeded, want error")
+	}
+	if err := i.AddRule("block", `{"name": "r"}`); err == nil {
+		t.Error(`AddRule("block", ...) succeeded, want error`)
+	}
+	// A rule without a name fails policy validation and must not change the
+	// active policy.
+	if err := i.AddRule("allow", `{"request": {"paths": ["/pkg.Service/Other"]}}`); err == nil {
+		t.Error("AddRule() with unnamed rule succeeded, want error")
+	}
+	checkDecision(t, "/pkg.Service/Extra", codes.OK)
+	checkDecision(t, "/pkg.Service/Other", codes.PermissionDenied)
+}
+
+// TestRetryAttemptMatcher verifies matching on the
+// "grpc-previous-rpc-attempts" header, including its absence meaning attempt
+// 0.
+func TestRetryAttemptMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_retries",
+				"request": {"paths": ["/pkg.Service/Expensive"], "retry_attempt": {"min": 2}}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{name: "no header", md: nil, wantCode: codes.OK},
+		{name: "first retry", md: metadata.Pairs("grpc-previous-rpc-attempts", "1"), wantCode: codes.OK},
+		{name: "second retry", md: metadata.Pairs("grpc-previous-rpc-attempts", "2"), wantCode: codes.PermissionDenied},
+		{name: "unparsable header", md: metadata.Pairs("grpc-previous-rpc-attempts", "zero"), wantCode: codes.OK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Expensive", test.md), nil, &grpc.UnaryServerInfo{}, handler)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("UnaryInterceptor() = %v, want code %v", err, test.wantCode)
+			}
+		})
+	}
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"retry_attempt": {}}}]}`); err == nil {
+		t.Error(`NewStatic() with "retry_attempt" missing "min" succeeded, want error`)
+	}
+}
+
+// recordingTestLogger collects the events it is asked to log.
+type recordingTestLogger struct {
+	mu     sync.Mutex
+	events []*audit.Event
+}
+
+func (l *recordingTestLogger) Log(e *audit.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+// TestTimeoutBucketMatcher verifies bucket matching on the declared timeout
+// and recording of DeadlineMillis when deadline auditing is enabled.
+func TestTimeoutBucketMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_long_deadline",
+				"request": {"timeout_bucket": {"min_millis": 60000}}
+			},
+			{
+				"name": "deny_no_deadline",
+				"request": {"timeout_bucket": {"no_deadline": true}}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`
+	policyParsed, err := parseAuthorizationPolicy(policy)
+	if err != nil {
+		t.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	rec := &recordingTestLogger{}
+	engine, err := newPolicyEngine(policyParsed, interceptorOptions{deadlineAudit: true})
+	if err != nil {
+		t.Fatalf("newPolicyEngine() failed: %v", err)
+	}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	tests := []struct {
+		name               string
+		timeout            time.Duration
+		wantCode           codes.Code
+		wantDeadlineMillis func(int64) bool
+	}{
+		{name: "short deadline", timeout: time.Second, wantCode: codes.OK, wantDeadlineMillis: func(ms int64) bool { return ms > 0 && ms <= 1000 }},
+		{name: "long deadline", timeout: 10 * time.Minute, wantCode: codes.PermissionDenied, wantDeadlineMillis: func(ms int64) bool { return ms > 60000 }},
+		{name: "no deadline", timeout: 0, wantCode: codes.PermissionDenied, wantDeadlineMillis: func(ms int64) bool { return ms == -1 }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := rpcContext("/pkg.Service/Api", nil)
+			if test.timeout != 0 {
+				var cancel context.CancelFunc
+				deadline := time.Now().Add(test.timeout)
+				ctx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+			err := engine.isAuthorized(ctx)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("isAuthorized() = %v, want code %v", err, test.wantCode)
+			}
+			rec.mu.Lock()
+			event := rec.events[len(rec.events)-1]
+			rec.mu.Unlock()
+			if !test.wantDeadlineMillis(event.DeadlineMillis) {
+				t.Errorf("Audit event DeadlineMillis = %v for timeout %v", event.DeadlineMillis, test.timeout)
+			}
+		})
+	}
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"timeout_bucket": {}}}]}`); err == nil {
+		t.Error(`NewStatic() with empty "timeout_bucket" succeeded, want error`)
+	}
+}
+
+// testJWT builds an unsigned JWT carrying the given claims. Signature
+// verification is out of scope for the matchers, so the signature part is a
+// placeholder.
+func testJWT(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to marshal claims: %v", err)
+	}
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+// TestJWTAudienceMatcher verifies audience matching including multi-valued
+// "aud" claims, missing claims and malformed tokens.
+func TestJWTAudienceMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_service",
+				"request": {"jwt_audience": {"values": ["my-service"]}}
+			}
+		]
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	tests := []struct {
+		name     string
+		authz    string
+		wantCode codes.Code
+	}{
+		{name: "matching audience", authz: "Bearer " + testJWT(t, map[string]any{"aud": "my-service"}), wantCode: codes.OK},
+		{name: "matching audience in list", authz: "bearer " + testJWT(t, map[string]any{"aud": []string{"other", "my-service"}}), wantCode: codes.OK},
+		{name: "mismatched audience", authz: "Bearer " + testJWT(t, map[string]any{"aud": "other-service"}), wantCode: codes.PermissionDenied},
+		{name: "missing aud claim", authz: "Bearer " + testJWT(t, map[string]any{"sub": "user"}), wantCode: codes.PermissionDenied},
+		{name: "malformed token", authz: "Bearer not.a.jwt", wantCode: codes.PermissionDenied},
+		{name: "no token", authz: "", wantCode: codes.PermissionDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			md := metadata.MD{}
+			if test.authz != "" {
+				md = metadata.Pairs("authorization", test.authz)
+			}
+			_, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", md), nil, &grpc.UnaryServerInfo{}, handler)
+			if got := status.Code(err); got != test.wantCode {
+				t.Fatalf("UnaryInterceptor() = %v, want code %v", err, test.wantCode)
+			}
+		})
+	}
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"jwt_audience": {"values": []}}}]}`); err == nil {
+		t.Error(`NewStatic() with empty "jwt_audience" values succeeded, want error`)
+	}
+}
+
+// failingTestLogger reports a delivery error for every event once set to
+// fail.
+type failingTestLogger struct {
+	recordingTestLogger
+	fail bool
+}
+
+func (l *failingTestLogger) LogWithError(e *audit.Event) error {
+	l.Log(e)
+	if l.fail {
+		return fmt.Errorf("sink unreachable")
+	}
+	return nil
+}
+
+// TestLoggerErrorGracePeriod verifies that mandatory logger delivery errors
+// fail RPCs closed immediately by default, and only after a sustained outage
+// when a grace period is configured.
+func TestLoggerErrorGracePeriod(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`
+	policyParsed, err := parseAuthorizationPolicy(policy)
+	if err != nil {
+		t.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	newEngine := func(t *testing.T, opts interceptorOptions, l audit.Logger, optional bool) *policyEngine {
+		t.Helper()
+		engine, err := newPolicyEngine(policyParsed, opts)
+		if err != nil {
+			t.Fatalf("newPolicyEngine() failed: %v", err)
+		}
+		engine.auditLoggers = []*auditLoggerState{{logger: l, optional: optional}}
+		engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+		return engine
+	}
+	ctx := rpcContext("/pkg.Service/Api", nil)
+
+	// Default: the first mandatory-logger error fails the RPC closed.
+	failing := &failingTestLogger{fail: true}
+	engine := newEngine(t, interceptorOptions{}, failing, false)
+	if err := engine.isAuthorized(ctx); status.Code(err) != codes.Unavailable {
+		t.Errorf("isAuthorized() with failing mandatory logger = %v, want code %v", err, codes.Unavailable)
+	}
+
+	// Optional loggers never fail RPCs.
+	engine = newEngine(t, interceptorOptions{}, &failingTestLogger{fail: true}, true)
+	if err := engine.isAuthorized(ctx); err != nil {
+		t.Errorf("isAuthorized() with failing optional logger = %v, want success", err)
+	}
+
+	// With a grace period, errors within it do not fail RPCs.
+	failing = &failingTestLogger{fail: true}
+	engine = newEngine(t, interceptorOptions{loggerErrorGracePeriod: time.Hour}, failing, false)
+	if err := engine.isAuthorized(ctx); err != nil {
+		t.Errorf("isAuthorized() within grace period = %v, want success", err)
+	}
+	// A sustained outage longer than the grace period fails closed.
+	engine.auditLoggers[0].failingSince = time.Now().Add(-2 * time.Hour)
+	if err := engine.isAuthorized(ctx); status.Code(err) != codes.Unavailable {
+		t.Errorf("isAuthorized() after sustained outage = %v, want code %v", err, codes.Unavailable)
+	}
+	// A successful delivery resets the streak.
+	failing.fail = false
+	if err := engine.isAuthorized(ctx); err != nil {
+		t.Errorf("isAuthorized() after recovery = %v, want success", err)
+	}
+	failing.fail = true
+	if err := engine.isAuthorized(ctx); err != nil {
+		t.Errorf("isAuthorized() on first error after recovery = %v, want success", err)
+	}
+}
+
+// testCertWithExtension generates a self-signed certificate carrying a
+// custom X.509 extension.
+func testCertWithExtension(t *testing.T, oid asn1.ObjectIdentifier, value []byte) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "test-client"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: oid, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+// TestCertExtensionMatcher verifies matching on custom peer certificate
+// extensions in both raw and ASN.1 string encodings.
+func TestCertExtensionMatcher(t *testing.T) {
+	oid := asn1.ObjectIdentifier{1, 2, 3, 4, 5}
+	asn1Value, err := asn1.Marshal("dept-a")
+	if err != nil {
+		t.Fatalf("Failed to marshal ASN.1 string: %v", err)
+	}
+	rawCert := testCertWithExtension(t, oid, []byte("dept-a"))
+	asn1Cert := testCertWithExtension(t, oid, asn1Value)
+	otherCert := testCertWithExtension(t, oid, []byte("dept-b"))
+
+	compile := func(t *testing.T, matcherJSON string) *compiledRule {
+		t.Helper()
+		var r rule
+		if err := json.Unmarshal([]byte(`{"name": "r", "request": {"cert_extension": `+matcherJSON+`}}`), &r); err != nil {
+			t.Fatalf("Failed to unmarshal rule: %v", err)
+		}
+		cr, err := compileRule(r, "authz")
+		if err != nil {
+			t.Fatalf("compileRule() failed: %v", err)
+		}
+		return cr
+	}
+	rawMatcher := compile(t, `{"oid": "1.2.3.4.5", "values": ["dept-a"]}`)
+	asn1Matcher := compile(t, `{"oid": "1.2.3.4.5", "values": ["dept-a"], "encoding": "asn1_string"}`)
+
+	tlsInput := func(cert *x509.Certificate) *rpcInput {
+		return &rpcInput{authType: "tls", certs: []*x509.Certificate{cert}, fullMethod: "/pkg.Service/Api", md: metadata.MD{}}
+	}
+	tests := []struct {
+		name    string
+		matcher *compiledRule
+		in      *rpcInput
+		want    bool
+	}{
+		{name: "raw match", matcher: rawMatcher, in: tlsInput(rawCert), want: true},
+		{name: "raw mismatch", matcher: rawMatcher, in: tlsInput(otherCert), want: false},
+		{name: "asn1 match", matcher: asn1Matcher, in: tlsInput(asn1Cert), want: true},
+		{name: "asn1 against raw bytes", matcher: asn1Matcher, in: tlsInput(rawCert), want: false},
+		{name: "no mTLS", matcher: rawMatcher, in: &rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.MD{}}, want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.matcher.match(test.in); got != test.want {
+				t.Errorf("match() = %v, want %v", got, test.want)
+			}
+		})
+	}
+	for _, bad := range []string{
+		`{"values": ["dept-a"]}`,
+		`{"oid": "1.2.x", "values": ["dept-a"]}`,
+		`{"oid": "1.2.3.4.5", "values": []}`,
+		`{"oid": "1.2.3.4.5", "values": ["dept-a"], "encoding": "hex"}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"cert_extension": ` + bad + `}}]}`); err == nil {
+			t.Errorf("NewStatic() with cert_extension %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestRateLimitMatcher verifies token-bucket throttling through a deny rule,
+// including the RESOURCE_EXHAUSTED status and per-key isolation.
+func TestRateLimitMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "throttle",
+				"request": {"paths": ["/pkg.Service/Expensive"], "rate_limit": {"requests_per_second": 0.0001, "burst": 2, "per": "principal_method"}}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(method string) codes.Code {
+		_, err := i.UnaryInterceptor(rpcContext(method, nil), nil, &grpc.UnaryServerInfo{}, handler)
+		return status.Code(err)
+	}
+	for n := 0; n < 2; n++ {
+		if got := call("/pkg.Service/Expensive"); got != codes.OK {
+			t.Fatalf("Call %d = %v, want %v", n, got, codes.OK)
+		}
+	}
+	if got := call("/pkg.Service/Expensive"); got != codes.ResourceExhausted {
+		t.Fatalf("Call over burst = %v, want %v", got, codes.ResourceExhausted)
+	}
+	// Other methods have their own bucket and are unaffected.
+	if got := call("/pkg.Service/Cheap"); got != codes.OK {
+		t.Fatalf("Call to unthrottled method = %v, want %v", got, codes.OK)
+	}
+	for _, bad := range []string{
+		`{"burst": 2}`,
+		`{"requests_per_second": 10, "burst": 0.5}`,
+		`{"requests_per_second": 10, "per": "peer"}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "r", "request": {"rate_limit": ` + bad + `}}], "allow_rules": [{"name": "a"}]}`); err == nil {
+			t.Errorf("NewStatic() with rate_limit %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestCompositeInterceptor verifies deny-overrides across composed policies
+// and that exactly one audit event is emitted, through the decisive policy's
+// loggers.
+func TestCompositeInterceptor(t *testing.T) {
+	corporate, err := NewStatic(`{
+		"name": "corporate",
+		"deny_rules": [
+			{
+				"name": "deny_blocked",
+				"request": {"paths": ["/pkg.Service/Blocked"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	team, err := NewStatic(`{
+		"name": "team",
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api", "/pkg.Service/Blocked"]}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	composite, err := NewComposite(corporate, team)
+	if err != nil {
+		t.Fatalf("NewComposite() failed: %v", err)
+	}
+	defer composite.Close()
+	corporateRec, teamRec := &recordingTestLogger{}, &recordingTestLogger{}
+	for i, rec := range []*recordingTestLogger{corporateRec, teamRec} {
+		composite.engines[i].policyEngine.auditLoggers = []*auditLoggerState{{logger: rec}}
+		composite.engines[i].policyEngine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(method string) codes.Code {
+		_, err := composite.UnaryInterceptor(rpcContext(method, nil), nil, &grpc.UnaryServerInfo{}, handler)
+		return status.Code(err)
+	}
+
+	// Allowed by both policies: one event, through the first policy.
+	if got := call("/pkg.Service/Api"); got != codes.OK {
+		t.Fatalf("Call allowed by both policies = %v, want %v", got, codes.OK)
+	}
+	if got, want := len(corporateRec.events), 1; got != want {
+		t.Fatalf("Decisive policy logged %d events, want %d", got, want)
+	}
+	if got := len(teamRec.events); got != 0 {
+		t.Fatalf("Non-decisive policy logged %d events, want 0", got)
+	}
+	// Denied by the first policy even though the second allows it.
+	if got := call("/pkg.Service/Blocked"); got != codes.PermissionDenied {
+		t.Fatalf("Call denied by first policy = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got, want := corporateRec.events[len(corporateRec.events)-1].MatchedRule, "corporate_deny_blocked"; got != want {
+		t.Fatalf("Deny event MatchedRule = %q, want %q", got, want)
+	}
+	// Not allowed by the second policy: the second policy is decisive.
+	if got := call("/pkg.Service/Other"); got != codes.PermissionDenied {
+		t.Fatalf("Call denied by second policy = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := len(teamRec.events); got != 1 {
+		t.Fatalf("Second policy logged %d events, want 1", got)
+	}
+	if _, err := NewComposite(); err == nil {
+		t.Error("NewComposite() with no policies succeeded, want error")
+	}
+}
+
+// TestCompositeHoldsEngineReferences verifies that the composite keeps a
+// reference on each member's engine, so closing a member does not close
+// audit loggers the composite still logs through, and that the composite's
+// Close releases them.
+func TestCompositeHoldsEngineReferences(t *testing.T) {
+	b := &closeCountingLoggerBuilder{}
+	audit.RegisterLoggerBuilder(b)
+	policy := `{
+		"name": "authz",
+		"allow_rules": [{"name": "all", "request": {"regex_paths": [".*"]}}],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY_AND_ALLOW",
+			"audit_loggers": [{"name": "test_close_counting_logger"}]
+		}
+	}`
+	member, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	composite, err := NewComposite(member)
+	if err != nil {
+		t.Fatalf("NewComposite() failed: %v", err)
+	}
+	member.Close()
+	if built, closed := b.counts(); built != 1 || closed != 0 {
+		t.Fatalf("After member Close, loggers built = %d and closed = %d, want 1 and 0", built, closed)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := composite.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("Call after member Close failed: %v", err)
+	}
+	composite.Close()
+	if built, closed := b.counts(); built != 1 || closed != 1 {
+		t.Errorf("After composite Close, loggers built = %d and closed = %d, want 1 and 1", built, closed)
+	}
+	if _, err := NewComposite(member); err == nil {
+		t.Error("NewComposite() with a closed member succeeded, want error")
+	}
+}
+
+// TestPrincipalSources verifies that principal sources are tried in order
+// until one yields a non-empty principal and that the winning source is
+// recorded in the audit event.
+func TestPrincipalSources(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "test",
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`, WithPrincipalSources(
+		PrincipalSourceCert(),
+		PrincipalSourceJWTClaim("sub"),
+		PrincipalSourceHeader("x-forwarded-user"),
+	))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	tests := []struct {
+		name          string
+		md            metadata.MD
+		wantPrincipal string
+		wantSource    string
+	}{
+		{
+			name:          "jwt claim",
+			md:            metadata.Pairs("authorization", "Bearer "+testJWT(t, map[string]any{"sub": "spiffe://example.org/billing"}), "x-forwarded-user", "fallback"),
+			wantPrincipal: "spiffe://example.org/billing",
+			wantSource:    "jwt_claim:sub",
+		},
+		{
+			name:          "header fallback",
+			md:            metadata.Pairs("x-forwarded-user", "proxy-user"),
+			wantPrincipal: "proxy-user",
+			wantSource:    "header:x-forwarded-user",
+		},
+		{
+			name: "no source resolves",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := engine.isAuthorized(rpcContext("/pkg.Service/Method", test.md)); err != nil {
+				t.Fatalf("isAuthorized() failed: %v", err)
+			}
+			got := rec.events[len(rec.events)-1]
+			if got.Principal != test.wantPrincipal {
+				t.Errorf("Event Principal = %q, want %q", got.Principal, test.wantPrincipal)
+			}
+			if got.PrincipalSource != test.wantSource {
+				t.Errorf("Event PrincipalSource = %q, want %q", got.PrincipalSource, test.wantSource)
+			}
+		})
+	}
+}
+
+// TestEventEnricher verifies the enricher runs once per emitted event, can
+// attach labels, and is skipped when the audit condition suppresses the
+// event.
+func TestEventEnricher(t *testing.T) {
+	enriched := 0
+	i, err := NewStatic(`{
+		"name": "test",
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`, WithEventEnricher(func(_ context.Context, e *audit.Event) {
+		enriched++
+		e.Labels["team"] = "billing"
+	}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+
+	// ON_DENY with an allowed RPC: no event, enricher skipped.
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Method", nil)); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	if enriched != 0 {
+		t.Fatalf("Enricher ran %d times for a suppressed event, want 0", enriched)
+	}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Method", nil)); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	if enriched != 1 {
+		t.Fatalf("Enricher ran %d times, want 1", enriched)
+	}
+	if got, want := rec.events[0].Labels["team"], "billing"; got != want {
+		t.Errorf("Event Labels[%q] = %q, want %q", "team", got, want)
+	}
+}
+
+// TestCertFingerprintsMatcher verifies fingerprint-based matching in a deny
+// rule and that the fingerprint is recorded in audit events.
+func TestCertFingerprintsMatcher(t *testing.T) {
+	blockedCert := testCertWithExtension(t, asn1.ObjectIdentifier{1, 2, 3, 4, 5}, []byte("blocked"))
+	otherCert := testCertWithExtension(t, asn1.ObjectIdentifier{1, 2, 3, 4, 5}, []byte("other"))
+	sum := sha256.Sum256(blockedCert.Raw)
+	blockedFP := hex.EncodeToString(sum[:])
+
+	var r rule
+	matcherJSON := `{"name": "r", "request": {"cert_fingerprints": {"sha256": ["` + strings.ToUpper(blockedFP) + `"]}}}`
+	if err := json.Unmarshal([]byte(matcherJSON), &r); err != nil {
+		t.Fatalf("Failed to unmarshal rule: %v", err)
+	}
+	cr, err := compileRule(r, "authz")
+	if err != nil {
+		t.Fatalf("compileRule() failed: %v", err)
+	}
+	tlsInput := func(cert *x509.Certificate) *rpcInput {
+		return &rpcInput{authType: "tls", certs: []*x509.Certificate{cert}, fullMethod: "/pkg.Service/Api", md: metadata.MD{}}
+	}
+	if !cr.match(tlsInput(blockedCert)) {
+		t.Error("match() with the blocked certificate = false, want true")
+	}
+	if cr.match(tlsInput(otherCert)) {
+		t.Error("match() with another certificate = true, want false")
+	}
+	if cr.match(&rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.MD{}}) {
+		t.Error("match() without mTLS = true, want false")
+	}
+	if got := tlsInput(blockedCert).certFingerprint(); got != blockedFP {
+		t.Errorf("certFingerprint() = %q, want %q", got, blockedFP)
+	}
+	for _, bad := range []string{
+		`{"sha256": []}`,
+		`{"sha256": ["zz12"]}`,
+		`{"sha256": ["ab12"]}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "d", "request": {"cert_fingerprints": ` + bad + `}}]}`); err == nil {
+			t.Errorf("NewStatic() with cert_fingerprints %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestLockoutMatcher verifies that a principal crossing the denial threshold
+// is locked out with a distinct status message, that an allow clears the
+// streak, and that lockout denials do not prolong the lockout.
+func TestLockoutMatcher(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "lockout",
+				"request": {"lockout": {"threshold": 2, "window_ms": 60000}}
+			},
+			{
+				"name": "deny_admin",
+				"request": {"paths": ["/pkg.Service/Admin"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api"]}
+			}
+		]
+	}`, WithPrincipalSources(PrincipalSourceHeader("x-user")))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	md := metadata.Pairs("x-user", "prober")
+	call := func(method string) error {
+		d, err := engine.decide(rpcContext(method, md))
+		if err != nil {
+			t.Fatalf("decide() failed: %v", err)
+		}
+		return d.statusErr()
+	}
+
+	// Two denials cross the threshold; the third call is locked out even
+	// though the method is allowed.
+	for j := 0; j < 2; j++ {
+		if got := status.Code(call("/pkg.Service/Admin")); got != codes.PermissionDenied {
+			t.Fatalf("Denied call %d = %v, want %v", j, got, codes.PermissionDenied)
+		}
+	}
+	err = call("/pkg.Service/Api")
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Fatalf("Locked-out call = %v, want %v", got, codes.PermissionDenied)
+	}
+	if want := "temporarily locked out"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("Locked-out call error = %q, want containing %q", err.Error(), want)
+	}
+	// Lockout denials do not extend the streak: clearing it manually and
+	// allowing once resets the matcher.
+	lm := engine.lockouts[0]
+	lm.mu.Lock()
+	lm.streaks["prober"].last = time.Now().Add(-2 * time.Minute)
+	lm.mu.Unlock()
+	if err := call("/pkg.Service/Api"); err != nil {
+		t.Fatalf("Call after lockout window = %v, want success", err)
+	}
+	// One denial, then an allow, then another denial: no lockout since the
+	// allow cleared the streak.
+	call("/pkg.Service/Admin")
+	call("/pkg.Service/Api")
+	call("/pkg.Service/Admin")
+	if err := call("/pkg.Service/Api"); err != nil {
+		t.Fatalf("Call after interleaved allow = %v, want success", err)
+	}
+	for _, bad := range []string{
+		`{"window_ms": 1000}`,
+		`{"threshold": 5}`,
+		`{"threshold": 5, "window_ms": 1000, "per": "method"}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "l", "request": {"lockout": ` + bad + `}}]}`); err == nil {
+			t.Errorf("NewStatic() with lockout %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestAuditContextValue verifies that values attached upstream with
+// WithAuditContextValue appear in audit event labels through both the unary
+// and the stream interceptors.
+func TestAuditContextValue(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`, WithDeadlineAudit())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	ctx := WithAuditContextValue(rpcContext("/pkg.Service/Method", nil), "myapp.request_id", "req-1")
+	ctx = WithAuditContextValue(ctx, "myapp.tenant", "acme")
+	if _, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(context.Context, any) (any, error) { return nil, nil }); err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+	want := map[string]string{"myapp.request_id": "req-1", "myapp.tenant": "acme"}
+	if diff := cmp.Diff(want, rec.events[0].Labels); diff != "" {
+		t.Errorf("Unary event labels mismatch (-want +got):\n%s", diff)
+	}
+
+	ss := &fakeServerStream{ctx: ctx}
+	handler := func(any, grpc.ServerStream) error { return nil }
+	if err := i.StreamInterceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Method"}, handler); err != nil {
+		t.Fatalf("StreamInterceptor() failed: %v", err)
+	}
+	if diff := cmp.Diff(want, rec.events[1].Labels); diff != "" {
+		t.Errorf("Stream event labels mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestMissingLoggerReport verifies that optional loggers without a registered
+// builder are reported in one callback and that registered or mandatory
+// loggers are not included.
+func TestMissingLoggerReport(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY",
+			"audit_loggers": [
+				{"name": "test_noop_logger", "is_optional": true},
+				{"name": "unregistered_logger_a", "is_optional": true},
+				{"name": "unregistered_logger_b", "is_optional": true}
+			]
+		}
+	}`
+	var got []string
+	calls := 0
+	if _, err := NewStatic(policy, WithMissingLoggerReport(func(names []string) {
+		calls++
+		got = names
+	})); err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Missing-logger report invoked %d times, want 1", calls)
+	}
+	want := []string{"unregistered_logger_a", "unregistered_logger_b"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Reported missing loggers mismatch (-want +got):\n%s", diff)
+	}
+	// Nothing missing: the callback is not invoked.
+	calls = 0
+	policyAllRegistered := strings.Replace(policy, `{"name": "unregistered_logger_a", "is_optional": true},
+				{"name": "unregistered_logger_b", "is_optional": true}`, `{"name": "test_noop_logger", "is_optional": true}`, 1)
+	if _, err := NewStatic(policyAllRegistered, WithMissingLoggerReport(func([]string) { calls++ })); err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("Missing-logger report invoked %d times with no missing loggers, want 0", calls)
+	}
+}
+
+// TestNewStaticProfile verifies profile selection, the default-profile
+// fallback and the errors for absent profiles.
+func TestNewStaticProfile(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"profiles": {
+			"prod": {
+				"allow_rules": [
+					{
+						"name": "allow_api",
+						"request": {"paths": ["/pkg.Service/Api"]}
+					}
+				]
+			},
+			"default": {
+				"allow_rules": [
+					{
+						"name": "allow_all",
+						"request": {"paths": ["*"]}
+					}
+				]
+			}
+		}
+	}`
+	call := func(i *StaticInterceptor, method string) codes.Code {
+		handler := func(context.Context, any) (any, error) { return nil, nil }
+		_, err := i.UnaryInterceptor(rpcContext(method, nil), nil, &grpc.UnaryServerInfo{}, handler)
+		return status.Code(err)
+	}
+	prod, err := NewStaticProfile(policy, "prod")
+	if err != nil {
+		t.Fatalf("NewStaticProfile(prod) failed: %v", err)
+	}
+	if got := call(prod, "/pkg.Service/Other"); got != codes.PermissionDenied {
+		t.Errorf("prod profile call to unlisted method = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := call(prod, "/pkg.Service/Api"); got != codes.OK {
+		t.Errorf("prod profile call to allowed method = %v, want %v", got, codes.OK)
+	}
+	// An unknown profile falls back to "default".
+	dev, err := NewStaticProfile(policy, "dev")
+	if err != nil {
+		t.Fatalf("NewStaticProfile(dev) failed: %v", err)
+	}
+	if got := call(dev, "/pkg.Service/Other"); got != codes.OK {
+		t.Errorf("default profile call = %v, want %v", got, codes.OK)
+	}
+	// No matching profile and no default is an error.
+	noDefault := strings.Replace(policy, `"default"`, `"staging"`, 1)
+	if _, err := NewStaticProfile(noDefault, "dev"); err == nil {
+		t.Error("NewStaticProfile() with absent profile and no default succeeded, want error")
+	}
+	for _, bad := range []string{
+		`{"profiles": {"default": {"allow_rules": [{"name": "a", "request": {"paths": ["*"]}}]}}}`,
+		`{"name": "authz"}`,
+		`{"name": "authz", "profiles": {"default": {}}}`,
+		`{"name": "authz", "allow_rules": [], "profiles": {}}`,
+	} {
+		if _, err := NewStaticProfile(bad, "prod"); err == nil {
+			t.Errorf("NewStaticProfile(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+// healthCheckTestLogger fails its health check when built with
+// {"healthy": false}.
+type healthCheckTestLogger struct {
+	noopLogger
+	healthy bool
+}
+
+func (l *healthCheckTestLogger) HealthCheck() error {
+	if !l.healthy {
+		return fmt.Errorf("backend unreachable")
+	}
+	return nil
+}
+
+type healthCheckLoggerConfig struct {
+	audit.LoggerConfig
+	healthy bool
+}
+
+type healthCheckLoggerBuilder struct{}
+
+func (healthCheckLoggerBuilder) Name() string { return "test_healthcheck_logger" }
+func (healthCheckLoggerBuilder) ParseLoggerConfig(raw json.RawMessage) (audit.LoggerConfig, error) {
+	c := struct {
+		Healthy *bool `json:"healthy"`
+	}{}
+	if len(raw) != 0 {
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return nil, err
+		}
+	}
+	return &healthCheckLoggerConfig{healthy: c.Healthy == nil || *c.Healthy}, nil
+}
+func (healthCheckLoggerBuilder) Build(c audit.LoggerConfig) audit.Logger {
+	return &healthCheckTestLogger{healthy: c.(*healthCheckLoggerConfig).healthy}
+}
+
+// TestLoggerHealthCheck verifies that a mandatory logger failing its health
+// check fails interceptor construction while an optional one does not.
+func TestLoggerHealthCheck(t *testing.T) {
+	audit.RegisterLoggerBuilder(healthCheckLoggerBuilder{})
+	policyFor := func(loggerJSON string) string {
+		return `{
+			"name": "authz",
+			"allow_rules": [{"name": "allow_all", "request": {"paths": ["*"]}}],
+			"audit_logging_options": {
+				"audit_condition": "ON_DENY",
+				"audit_loggers": [` + loggerJSON + `]
+			}
+		}`
+	}
+	// The health check only runs for engines built by the authz policy
+	// engine, so pass an option to force that path.
+	opt := WithDeadlineAudit()
+	_, err := NewStatic(policyFor(`{"name": "test_healthcheck_logger", "config": {"healthy": false}}`), opt)
+	if err == nil || !strings.Contains(err.Error(), "failed its health check") {
+		t.Errorf("NewStatic() with unhealthy mandatory logger = %v, want health check error", err)
+	}
+	if _, err := NewStatic(policyFor(`{"name": "test_healthcheck_logger", "config": {"healthy": false}, "is_optional": true}`), opt); err != nil {
+		t.Errorf("NewStatic() with unhealthy optional logger failed: %v", err)
+	}
+	if _, err := NewStatic(policyFor(`{"name": "test_healthcheck_logger"}`), opt); err != nil {
+		t.Errorf("NewStatic() with healthy mandatory logger failed: %v", err)
+	}
+}
+
+// TestDenyRuleDelay verifies that denials from a rule carrying "delay_ms"
+// are held for the configured duration, that cancellation cuts the delay
+// short and that the field is rejected outside deny rules.
+func TestDenyRuleDelay(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "tarpit",
+				"request": {"paths": ["/pkg.Service/Probe"]},
+				"delay_ms": 200
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`, WithDeadlineAudit())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+
+	start := time.Now()
+	if got := status.Code(engine.isAuthorized(rpcContext("/pkg.Service/Probe", nil))); got != codes.PermissionDenied {
+		t.Fatalf("Tarpitted call = %v, want %v", got, codes.PermissionDenied)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Tarpitted denial returned after %v, want at least 200ms", elapsed)
+	}
+	// A cancelled context cuts the delay short.
+	ctx, cancel := context.WithCancel(rpcContext("/pkg.Service/Probe", nil))
+	cancel()
+	start = time.Now()
+	if got := status.Code(engine.isAuthorized(ctx)); got != codes.PermissionDenied {
+		t.Fatalf("Tarpitted call with cancelled context = %v, want %v", got, codes.PermissionDenied)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Cancelled tarpitted denial returned after %v, want well under the delay", elapsed)
+	}
+	// Allowed RPCs are not delayed.
+	start = time.Now()
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Fatalf("Allowed call failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Allowed call returned after %v, want no delay", elapsed)
+	}
+	for _, bad := range []string{
+		`{"name": "authz", "deny_rules": [{"name": "d", "request": {"paths": ["*"]}, "delay_ms": -1}], "allow_rules": [{"name": "a", "request": {"paths": ["*"]}}]}`,
+		`{"name": "authz", "allow_rules": [{"name": "a", "request": {"paths": ["*"]}, "delay_ms": 100}]}`,
+	} {
+		if _, err := NewStatic(bad); err == nil {
+			t.Errorf("NewStatic(%s) succeeded, want error", bad)
+		}
+	}
+}
+
+// TestRequestCompressionMatcher verifies matching on the "grpc-encoding"
+// header, with an absent header treated as uncompressed.
+func TestRequestCompressionMatcher(t *testing.T) {
+	var r rule
+	if err := json.Unmarshal([]byte(`{"name": "r", "request": {"request_compression": {"required": true}}}`), &r); err != nil {
+		t.Fatalf("Failed to unmarshal rule: %v", err)
+	}
+	cr, err := compileRule(r, "authz")
+	if err != nil {
+		t.Fatalf("compileRule() failed: %v", err)
+	}
+	input := func(md metadata.MD) *rpcInput {
+		return &rpcInput{fullMethod: "/pkg.Service/Api", md: md}
+	}
+	if !cr.match(input(metadata.MD{})) {
+		t.Error("match() without grpc-encoding = false, want true")
+	}
+	if !cr.match(input(metadata.Pairs("grpc-encoding", "identity"))) {
+		t.Error(`match() with grpc-encoding "identity" = false, want true`)
+	}
+	if cr.match(input(metadata.Pairs("grpc-encoding", "gzip"))) {
+		t.Error(`match() with grpc-encoding "gzip" = true, want false`)
+	}
+	if err := json.Unmarshal([]byte(`{"name": "r", "request": {"request_compression": {"required": false}}}`), &r); err != nil {
+		t.Fatalf("Failed to unmarshal rule: %v", err)
+	}
+	if cr, err = compileRule(r, "authz"); err != nil {
+		t.Fatalf("compileRule() failed: %v", err)
+	}
+	if !cr.match(input(metadata.Pairs("grpc-encoding", "gzip"))) {
+		t.Error(`match() with "required": false and grpc-encoding "gzip" = false, want true`)
+	}
+	if cr.match(input(metadata.MD{})) {
+		t.Error(`match() with "required": false and no grpc-encoding = true, want false`)
+	}
+	if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "d", "request": {"request_compression": {}}}]}`); err == nil {
+		t.Error(`NewStatic() with empty request_compression succeeded, want error`)
+	}
+}
+
+// TestReplay verifies that replaying a captured request log against a policy
+// reproduces the runtime decisions and aggregates per-rule hit counts.
+func TestReplay(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_admin",
+				"request": {"paths": ["/pkg.Service/Admin"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_foo",
+				"source": {"principals": ["spiffe://foo.com/*"]},
+				"request": {"paths": ["/pkg.Service/*"]}
+			}
+		]
+	}`
+	stats, err := Replay(policy, []CapturedRequest{
+		{FullMethodName: "/pkg.Service/Api", Principal: "spiffe://foo.com/workload"},
+		{FullMethodName: "/pkg.Service/Api", Principal: "spiffe://foo.com/workload"},
+		{FullMethodName: "/pkg.Service/Admin", Principal: "spiffe://foo.com/workload"},
+		{FullMethodName: "/pkg.Service/Api", Principal: "spiffe://bar.com/workload"},
+		{FullMethodName: "/pkg.Service/Api"},
+	})
+	if err != nil {
+		t.Fatalf("Replay() failed: %v", err)
+	}
+	want := ReplayStats{
+		Allowed: 2,
+		Denied:  3,
+		RuleHits: map[string]int{
+			"authz_allow_foo":  2,
+			"authz_deny_admin": 1,
+		},
+	}
+	if diff := cmp.Diff(want, stats); diff != "" {
+		t.Errorf("Replay() returned unexpected stats (-want +got):\n%s", diff)
+	}
+	if _, err := Replay(`{"name": "authz"}`, nil); err == nil {
+		t.Error("Replay() with an invalid policy succeeded, want error")
+	}
+}
+
+// TestSensitiveMetadataRedaction verifies that sensitive keys in captured
+// event metadata are redacted before the event reaches loggers, by default
+// and with a custom key list.
+func TestSensitiveMetadataRedaction(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want map[string][]string
+	}{
+		{
+			name: "default keys",
+			want: map[string][]string{
+				"authorization": {"<redacted>", "<redacted>"},
+				"x-team":        {"core"},
+			},
+		},
+		{
+			name: "custom keys",
+			opts: []Option{WithSensitiveMetadataKeys("X-Team")},
+			want: map[string][]string{
+				"authorization": {"Bearer secret", "Basic secret"},
+				"x-team":        {"<redacted>"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			capture := func(ctx context.Context, e *audit.Event) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				e.Metadata = map[string][]string{
+					"authorization": md.Get("authorization"),
+					"x-team":        md.Get("x-team"),
+				}
+			}
+			opts := append([]Option{WithEventEnricher(capture)}, test.opts...)
+			i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, opts...)
+			if err != nil {
+				t.Fatalf("NewStatic() failed: %v", err)
+			}
+			engine := i.currentEngine().policyEngine
+			rec := &recordingTestLogger{}
+			engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+			engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+			md := metadata.Pairs("authorization", "Bearer secret", "authorization", "Basic secret", "x-team", "core")
+			if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", md)); err != nil {
+				t.Fatalf("isAuthorized() failed: %v", err)
+			}
+			if got := len(rec.events); got != 1 {
+				t.Fatalf("Got %d audit events, want 1", got)
+			}
+			if diff := cmp.Diff(test.want, rec.events[0].Metadata); diff != "" {
+				t.Errorf("Event metadata mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestWithScopeMethods verifies that out-of-scope methods bypass the engine
+// without emitting audit events, and the precedence of exclude over include.
+func TestWithScopeMethods(t *testing.T) {
+	i, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "all"}], "allow_rules": [{"name": "none", "request": {"paths": ["/unused"]}}]}`,
+		WithScopeMethods([]string{"/v2.*"}, []string{"/v2.Service/Health"}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+	call := func(method string) error {
+		_, err := i.UnaryInterceptor(rpcContext(method, nil), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+	if got := status.Code(call("/v2.Service/New")); got != codes.PermissionDenied {
+		t.Errorf("In-scope method = %v, want %v", got, codes.PermissionDenied)
+	}
+	if err := call("/v1.Service/Legacy"); err != nil {
+		t.Errorf("Out-of-scope method failed: %v", err)
+	}
+	if err := call("/v2.Service/Health"); err != nil {
+		t.Errorf("Excluded method failed: %v", err)
+	}
+	if got := len(rec.events); got != 1 {
+		t.Errorf("Got %d audit events, want 1 (bypassed methods must not be audited)", got)
+	}
+}
+
+// TestCorrelationHeader verifies that audit events carry the correlation ID
+// from the configured header, that one is generated and injected when the
+// header is absent, and that generation can be disabled.
+func TestCorrelationHeader(t *testing.T) {
+	newInterceptor := func(t *testing.T, opts ...Option) (*StaticInterceptor, *recordingTestLogger) {
+		t.Helper()
+		opts = append([]Option{WithCorrelationHeader("x-correlation-id")}, opts...)
+		i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, opts...)
+		if err != nil {
+			t.Fatalf("NewStatic() failed: %v", err)
+		}
+		engine := i.currentEngine().policyEngine
+		rec := &recordingTestLogger{}
+		engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+		engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+		return i, rec
+	}
+	call := func(t *testing.T, i *StaticInterceptor, md metadata.MD) metadata.MD {
+		t.Helper()
+		var handlerMD metadata.MD
+		handler := func(ctx context.Context, _ any) (any, error) {
+			handlerMD, _ = metadata.FromIncomingContext(ctx)
+			return nil, nil
+		}
+		if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", md), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Api"}, handler); err != nil {
+			t.Fatalf("UnaryInterceptor() failed: %v", err)
+		}
+		return handlerMD
+	}
+
+	i, rec := newInterceptor(t)
+	call(t, i, metadata.Pairs("x-correlation-id", "req-123"))
+	if got := rec.events[0].CorrelationID; got != "req-123" {
+		t.Errorf("CorrelationID with header = %q, want %q", got, "req-123")
+	}
+	handlerMD := call(t, i, nil)
+	generated := rec.events[1].CorrelationID
+	if generated == "" {
+		t.Error("CorrelationID without header is empty, want a generated ID")
+	}
+	if got := handlerMD.Get("x-correlation-id"); len(got) != 1 || got[0] != generated {
+		t.Errorf("Handler metadata correlation ID = %v, want [%q]", got, generated)
+	}
+
+	i, rec = newInterceptor(t, WithoutCorrelationIDGeneration())
+	handlerMD = call(t, i, nil)
+	if got := rec.events[0].CorrelationID; got != "" {
+		t.Errorf("CorrelationID with generation disabled = %q, want empty", got)
+	}
+	if got := handlerMD.Get("x-correlation-id"); len(got) != 0 {
+		t.Errorf("Handler metadata correlation ID = %v, want none", got)
+	}
+}
+
+// TestCompiledPolicy verifies that a compiled policy loads without
+// re-translation and decides identically to NewStatic, and that version
+// mismatches and garbage are rejected.
+func TestCompiledPolicy(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_admin",
+				"request": {"paths": ["/pkg.Service/Admin"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/*"]}
+			}
+		]
+	}`
+	compiled, err := Compile(policy)
+	if err != nil {
+		t.Fatalf("Compile() failed: %v", err)
+	}
+	for _, opts := range [][]Option{nil, {WithDeadlineAudit()}} {
+		i, err := NewFromCompiled(compiled, opts...)
+		if err != nil {
+			t.Fatalf("NewFromCompiled() with opts %v failed: %v", opts, err)
+		}
+		e := i.currentEngine()
+		if len(opts) > 0 && e.policyEngine == nil {
+			t.Fatal("NewFromCompiled() with options did not build a policy engine")
+		}
+		if err := e.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+			t.Errorf("Allowed call failed: %v", err)
+		}
+		if got := status.Code(e.isAuthorized(rpcContext("/pkg.Service/Admin", nil))); got != codes.PermissionDenied {
+			t.Errorf("Denied call = %v, want %v", got, codes.PermissionDenied)
+		}
+	}
+	// A policy on the policy-engine path loads its compiled matcher set:
+	// classified patterns as serialized, regex programs recompiled from their
+	// serialized sources.
+	engineCompiled, err := Compile(`{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_admin",
+				"request": {"regex_paths": ["/pkg\\.Service/Admin.*"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {
+					"paths": ["/pkg.Service/*"],
+					"headers": [{"key": "x-env", "values": ["prod*"]}]
+				}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("Compile() failed: %v", err)
+	}
+	i, err := NewFromCompiled(engineCompiled)
+	if err != nil {
+		t.Fatalf("NewFromCompiled() failed: %v", err)
+	}
+	defer i.Close()
+	engine := i.currentEngine()
+	if engine.policyEngine == nil {
+		t.Fatal("NewFromCompiled() with regex paths did not build a policy engine")
+	}
+	prod := metadata.Pairs("x-env", "production")
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", prod)); err != nil {
+		t.Errorf("Allowed call failed: %v", err)
+	}
+	if got := status.Code(engine.isAuthorized(rpcContext("/pkg.Service/AdminApi", prod))); got != codes.PermissionDenied {
+		t.Errorf("Regex-denied call = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := status.Code(engine.isAuthorized(rpcContext("/pkg.Service/Api", metadata.Pairs("x-env", "staging")))); got != codes.PermissionDenied {
+		t.Errorf("Header-mismatched call = %v, want %v", got, codes.PermissionDenied)
+	}
+	if _, err := Compile(`{"name": "authz"}`); err == nil {
+		t.Error("Compile() with an invalid policy succeeded, want error")
+	}
+	if _, err := NewFromCompiled([]byte("not a compiled policy")); err == nil {
+		t.Error("NewFromCompiled() with garbage succeeded, want error")
+	}
+	var cp struct {
+		Version    string
+		PolicyName string
+	}
+	cp.Version = "v0"
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&cp); err != nil {
+		t.Fatalf("Failed to encode envelope: %v", err)
+	}
+	if _, err := NewFromCompiled(buf.Bytes()); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("NewFromCompiled() with a mismatched version returned %v, want a version error", err)
+	}
+}
+
+// TestCompiledPolicyClose verifies that an interceptor loaded from a compiled
+// policy closes its audit loggers on Close, like one built with NewStatic.
+func TestCompiledPolicyClose(t *testing.T) {
+	b := &closeCountingLoggerBuilder{}
+	audit.RegisterLoggerBuilder(b)
+	compiled, err := Compile(`{
+		"name": "authz",
+		"allow_rules": [{"name": "all", "request": {"regex_paths": [".*"]}}],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY_AND_ALLOW",
+			"audit_loggers": [{"name": "test_close_counting_logger"}]
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("Compile() failed: %v", err)
+	}
+	i, err := NewFromCompiled(compiled)
+	if err != nil {
+		t.Fatalf("NewFromCompiled() failed: %v", err)
+	}
+	i.Close()
+	if built, closed := b.counts(); built != 1 || closed != 1 {
+		t.Errorf("After Close, loggers built = %d and closed = %d, want 1 and 1", built, closed)
+	}
+}
+
+// TestDecompressionRatioMatcher verifies that RPCs whose piped-in wire sizes
+// exceed the configured ratio are denied with a distinct reason, and that
+// RPCs without size information are not matched.
+func TestDecompressionRatioMatcher(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "zip_bomb",
+				"request": {"paths": ["/pkg.Service/Upload"], "max_decompression_ratio": 10}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all"
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	sized := func(compressed, decompressed int64) context.Context {
+		return WithMessageSizes(rpcContext("/pkg.Service/Upload", nil), compressed, decompressed)
+	}
+	err = engine.isAuthorized(sized(100, 5000))
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Fatalf("Oversized ratio = %v, want %v", got, codes.PermissionDenied)
+	}
+	if !strings.Contains(err.Error(), "decompression ratio") {
+		t.Errorf("Denial message %q does not name the decompression ratio", err.Error())
+	}
+	if err := engine.isAuthorized(sized(100, 900)); err != nil {
+		t.Errorf("In-bounds ratio failed: %v", err)
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Upload", nil)); err != nil {
+		t.Errorf("Call without size information failed: %v", err)
+	}
+	if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "d", "request": {"max_decompression_ratio": 0.5}}]}`); err == nil {
+		t.Error("NewStatic() with a ratio below 1 succeeded, want error")
+	}
+}
+
+// TestAuditConditionExpression verifies expression-based audit conditions,
+// including nesting, negation and the method and principal predicates, and
+// that malformed expressions are rejected.
+func TestAuditConditionExpression(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_probe",
+				"request": {"paths": ["/pkg.Service/Probe"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all"
+			}
+		],
+		"audit_logging_options": {
+			"audit_condition_expression": "deny or (allow and method(\"/admin.*\"))"
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.isAuthorized(rpcContext("/pkg.Service/Probe", nil))  // denied: audited
+	engine.isAuthorized(rpcContext("/pkg.Service/Api", nil))    // allowed, not admin: not audited
+	engine.isAuthorized(rpcContext("/admin.Service/Drop", nil)) // allowed admin method: audited
+	var methods []string
+	for _, e := range rec.events {
+		methods = append(methods, e.FullMethodName)
+	}
+	want := []string{"/pkg.Service/Probe", "/admin.Service/Drop"}
+	if diff := cmp.Diff(want, methods); diff != "" {
+		t.Errorf("Audited methods mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, test := range []struct {
+		expr string
+		d    *decision
+		want bool
+	}{
+		{"not deny", &decision{authorized: true}, true},
+		{"warn", &decision{authorized: true, warn: true}, true},
+		{"allow", &decision{authorized: true, warn: true}, false},
+		{`principal("spiffe://foo.com/*") and deny`, &decision{in: &rpcInput{extractedPrincipal: "spiffe://foo.com/svc"}}, true},
+		{`principal("spiffe://foo.com/*") and deny`, &decision{in: &rpcInput{extractedPrincipal: "spiffe://bar.com/svc"}}, false},
+	} {
+		pred, err := parseAuditConditionExpression(test.expr)
+		if err != nil {
+			t.Errorf("parseAuditConditionExpression(%q) failed: %v", test.expr, err)
+			continue
+		}
+		if got := pred(test.d); got != test.want {
+			t.Errorf("Predicate %q = %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"allow extra",
+		"oops",
+		"(allow",
+		`method(/admin.*)`,
+		`method("/admin.*"`,
+		"allow and",
+	} {
+		if _, err := parseAuditConditionExpression(bad); err == nil {
+			t.Errorf("parseAuditConditionExpression(%q) succeeded, want error", bad)
+		}
+	}
+
+	if _, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [{"name": "all"}],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY",
+			"audit_condition_expression": "deny"
+		}
+	}`); err == nil {
+		t.Error("NewStatic() with both an audit condition and an expression succeeded, want error")
+	}
+}
+
+// TestUserAgentMatcher verifies regex and pattern matching on the user-agent
+// header and that RPCs without the header never match.
+func TestUserAgentMatcher(t *testing.T) {
+	var r rule
+	if err := json.Unmarshal([]byte(`{"name": "r", "request": {"user_agent": {"regex_match": "grpc-go/1\\.5[0-9].*", "values": ["grpc-java/*"]}}}`), &r); err != nil {
+		t.Fatalf("Failed to unmarshal rule: %v", err)
+	}
+	cr, err := compileRule(r, "authz")
+	if err != nil {
+		t.Fatalf("compileRule() failed: %v", err)
+	}
+	input := func(ua ...string) *rpcInput {
+		md := metadata.MD{}
+		if len(ua) > 0 {
+			md.Set("user-agent", ua...)
+		}
+		return &rpcInput{fullMethod: "/pkg.Service/Api", md: md}
+	}
+	for ua, want := range map[string]bool{
+		"grpc-go/1.59.0":  true,
+		"grpc-go/1.62.0":  false,
+		"grpc-java/1.3.0": true,
+		"grpc-node/1.5.0": false,
+	} {
+		if got := cr.match(input(ua)); got != want {
+			t.Errorf("match() with user-agent %q = %v, want %v", ua, got, want)
+		}
+	}
+	if cr.match(input()) {
+		t.Error("match() without a user-agent header = true, want false")
+	}
+	for _, bad := range []string{
+		`{}`,
+		`{"regex_match": "("}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "d", "request": {"user_agent": ` + bad + `}}], "allow_rules": [{"name": "all"}]}`); err == nil {
+			t.Errorf("NewStatic() with user_agent %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestCandidatePolicy verifies staging, shadow decision reporting, atomic
+// promotion and discarding of a candidate policy.
+func TestCandidatePolicy(t *testing.T) {
+	var mu sync.Mutex
+	var reports []DecisionInfo
+	i, err := NewStatic(`{"name": "active", "allow_rules": [{"name": "all"}]}`,
+		WithDecisionCallback(func(info DecisionInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, info)
+		}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	if err := i.PromoteCandidate(); err == nil {
+		t.Error("PromoteCandidate() without a staged candidate succeeded, want error")
+	}
+	if err := i.StageCandidate(`{"name": "candidate", "deny_rules": [{"name": "deny_api", "request": {"paths": ["/pkg.Service/Api"]}}], "allow_rules": [{"name": "all"}]}`); err != nil {
+		t.Fatalf("StageCandidate() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Api"}, handler); err != nil {
+		t.Fatalf("UnaryInterceptor() with a staged candidate failed: %v", err)
+	}
+	mu.Lock()
+	want := []DecisionInfo{
+		{FullMethodName: "/pkg.Service/Api", Authorized: false, MatchedRule: "candidate_deny_api", Shadow: true},
+		{FullMethodName: "/pkg.Service/Api", Authorized: true, MatchedRule: "active_all"},
+	}
+	if diff := cmp.Diff(want, reports); diff != "" {
+		t.Errorf("Decision reports mismatch (-want +got):\n%s", diff)
+	}
+	mu.Unlock()
+	if err := i.PromoteCandidate(); err != nil {
+		t.Fatalf("PromoteCandidate() failed: %v", err)
+	}
+	if got := status.Code(i.currentEngine().isAuthorized(rpcContext("/pkg.Service/Api", nil))); got != codes.PermissionDenied {
+		t.Errorf("Promoted policy decision = %v, want %v", got, codes.PermissionDenied)
+	}
+	if err := i.StageCandidate(`{"name": "next", "allow_rules": [{"name": "all"}]}`); err != nil {
+		t.Fatalf("StageCandidate() failed: %v", err)
+	}
+	i.DiscardCandidate()
+	if err := i.PromoteCandidate(); err == nil {
+		t.Error("PromoteCandidate() after DiscardCandidate() succeeded, want error")
+	}
+	if err := i.StageCandidate(`{"name": "bad"}`); err == nil {
+		t.Error("StageCandidate() with an invalid policy succeeded, want error")
+	}
+}
+
+// TestCanaryPrincipals verifies that designated canary principals are
+// enforced against the staged candidate policy, with audit events carrying
+// the candidate's policy hash, while other callers stay on the active policy.
+func TestCanaryPrincipals(t *testing.T) {
+	i, err := NewStatic(`{"name": "active", "allow_rules": [{"name": "all"}]}`,
+		WithPrincipalSources(PrincipalSourceHeader("x-forwarded-user")),
+		WithCanaryPrincipals("canary-user"))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	canaryCtx := func() context.Context {
+		return rpcContext("/pkg.Service/Api", metadata.Pairs("x-forwarded-user", "canary-user"))
+	}
+	call := func(ctx context.Context) codes.Code {
+		_, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Api"}, handler)
+		return status.Code(err)
+	}
+	// Without a staged candidate the canary principal uses the active policy.
+	if got := call(canaryCtx()); got != codes.OK {
+		t.Fatalf("Canary call without a candidate = %v, want %v", got, codes.OK)
+	}
+	if err := i.StageCandidate(`{"name": "candidate", "deny_rules": [{"name": "deny_api", "request": {"paths": ["/pkg.Service/Api"]}}], "allow_rules": [{"name": "all"}]}`); err != nil {
+		t.Fatalf("StageCandidate() failed: %v", err)
+	}
+	cs := (*candidateState)(atomic.LoadPointer(&i.candidate))
+	rec := &recordingTestLogger{}
+	cs.engine.policyEngine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	cs.engine.policyEngine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	if got := call(canaryCtx()); got != codes.PermissionDenied {
+		t.Errorf("Canary call with a staged candidate = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := call(rpcContext("/pkg.Service/Api", nil)); got != codes.OK {
+		t.Errorf("Non-canary call with a staged candidate = %v, want %v", got, codes.OK)
+	}
+	rec.mu.Lock()
+	if len(rec.events) != 1 {
+		t.Fatalf("Candidate audit events = %d, want 1", len(rec.events))
+	}
+	if got, want := rec.events[0].PolicyHash, cs.engine.policyEngine.policyHash; got != want {
+		t.Errorf("Event PolicyHash = %q, want candidate hash %q", got, want)
+	}
+	if active := i.currentEngine().policyEngine.policyHash; rec.events[0].PolicyHash == active {
+		t.Errorf("Event PolicyHash = active policy hash %q, want the candidate's", active)
+	}
+	rec.mu.Unlock()
+	// Promotion ends the split: everyone is on the promoted policy.
+	if err := i.PromoteCandidate(); err != nil {
+		t.Fatalf("PromoteCandidate() failed: %v", err)
+	}
+	if got := call(canaryCtx()); got != codes.PermissionDenied {
+		t.Errorf("Canary call after promotion = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := call(rpcContext("/pkg.Service/Api", nil)); got != codes.PermissionDenied {
+		t.Errorf("Non-canary call after promotion = %v, want %v", got, codes.PermissionDenied)
+	}
+}
+
+// TestRedirectDetails verifies that denials by a redirect-carrying deny rule
+// surface the hinted authority as a status detail when opted in, and stay
+// opaque otherwise.
+func TestRedirectDetails(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "wrong_region",
+				"request": {"paths": ["/pkg.Service/EUOnly"]},
+				"redirect": {"authority": "eu.example.com"}
+			}
+		],
+		"allow_rules": [{"name": "all"}]
+	}`
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(t *testing.T, opts ...Option) error {
+		t.Helper()
+		i, err := NewStatic(policy, opts...)
+		if err != nil {
+			t.Fatalf("NewStatic() failed: %v", err)
+		}
+		_, err = i.UnaryInterceptor(rpcContext("/pkg.Service/EUOnly", nil), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/EUOnly"}, handler)
+		return err
+	}
+
+	err := call(t, WithRedirectDetails())
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Fatalf("Denied call = %v, want %v", got, codes.PermissionDenied)
+	}
+	details := status.Convert(err).Details()
+	if len(details) != 1 {
+		t.Fatalf("Denial carries %d status details, want 1", len(details))
+	}
+	info, ok := details[0].(*errdetails.ErrorInfo)
+	if !ok {
+		t.Fatalf("Status detail is %T, want *errdetails.ErrorInfo", details[0])
+	}
+	if info.GetReason() != "REDIRECT" || info.GetDomain() != "grpc.authz" || info.GetMetadata()["authority"] != "eu.example.com" {
+		t.Errorf("Unexpected redirect detail: %v", info)
+	}
+
+	err = call(t, WithDeadlineAudit())
+	if got := len(status.Convert(err).Details()); got != 0 {
+		t.Errorf("Denial without WithRedirectDetails carries %d details, want 0", got)
+	}
+
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all", "redirect": {"authority": "x"}}]}`); err == nil {
+		t.Error("NewStatic() with redirect on an allow rule succeeded, want error")
+	}
+	if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "d", "redirect": {}}], "allow_rules": [{"name": "all"}]}`); err == nil {
+		t.Error("NewStatic() with redirect lacking authority succeeded, want error")
+	}
+}
+
+// TestPathMethodConsistency verifies that WithPathMethodConsistency denies
+// RPCs whose ":path" pseudo-header disagrees with the dispatched method, that
+// the denial is audited under the distinct "path_method_mismatch" reason, and
+// that the check is skipped when the pseudo-header is not surfaced.
+func TestPathMethodConsistency(t *testing.T) {
+	i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithPathMethodConsistency())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(md metadata.MD) error {
+		_, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", md), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Api"}, handler)
+		return err
+	}
+
+	if err := call(metadata.Pairs(":path", "/pkg.Service/Api")); err != nil {
+		t.Errorf("Consistent :path denied: %v", err)
+	}
+	if err := call(nil); err != nil {
+		t.Errorf("Absent :path denied: %v", err)
+	}
+	err = call(metadata.Pairs(":path", "/pkg.Service/Other"))
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Fatalf("Mismatched :path = %v, want %v", got, codes.PermissionDenied)
+	}
+	d := engine.evaluate(&rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.Pairs(":path", "/pkg.Service/Other")})
+	if msg := status.Convert(d.statusErr()).Message(); !strings.Contains(msg, "path_method_mismatch") {
+		t.Errorf("Engine denial message %q does not name path_method_mismatch", msg)
+	}
+	last := rec.events[len(rec.events)-1]
+	if last.Authorized || last.MatchedRule != "path_method_mismatch" {
+		t.Errorf("Mismatch audit event = {Authorized: %v, MatchedRule: %q}, want denied with path_method_mismatch", last.Authorized, last.MatchedRule)
+	}
+}
+
+// TestValidateDir verifies per-file results for a directory mixing valid and
+// invalid policies, and that files outside the glob are ignored.
+func TestValidateDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"svc-a.json": {Data: []byte(`{"name": "a", "allow_rules": [{"name": "all"}]}`)},
+		"svc-b.json": {Data: []byte(`{"name": "b"}`)},
+		"svc-c.json": {Data: []byte(`{"name": "c", "allow_rules": [{"name": "ua", "request": {"user_agent": {"regex_match": "("}}}]}`)},
+		"README.md":  {Data: []byte("not a policy")},
+	}
+	results, err := ValidateDir(fsys, "*.json")
+	if err != nil {
+		t.Fatalf("ValidateDir() failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("ValidateDir() returned %d results, want 3: %v", len(results), results)
+	}
+	if err := results["svc-a.json"]; err != nil {
+		t.Errorf("svc-a.json = %v, want valid", err)
+	}
+	if err := results["svc-b.json"]; err == nil || !strings.Contains(err.Error(), `"allow_rules" is not present`) {
+		t.Errorf(`svc-b.json = %v, want "allow_rules" is not present`, err)
+	}
+	if err := results["svc-c.json"]; err == nil || !strings.Contains(err.Error(), `"regex_match"`) {
+		t.Errorf(`svc-c.json = %v, want invalid "regex_match" error`, err)
+	}
+	if _, err := ValidateDir(fsys, "[invalid"); err == nil {
+		t.Error("ValidateDir() with a malformed glob succeeded, want error")
+	}
+}
+
+// TestOCSPStapledMatcher verifies the config validation of the
+// "require_ocsp_stapled" matcher: false is rejected, and true requires the
+// authz/ocsp package, which core tests do not import. The matching itself is
+// exercised in that package's tests.
+func TestOCSPStapledMatcher(t *testing.T) {
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"require_ocsp_stapled": false}}]}`); err == nil {
+		t.Error("NewStatic() with require_ocsp_stapled false succeeded, want error")
+	}
+	_, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"require_ocsp_stapled": true}}]}`)
+	if err == nil || !strings.Contains(err.Error(), "authz/ocsp") {
+		t.Errorf("NewStatic() with require_ocsp_stapled true = %v, want error mentioning authz/ocsp", err)
+	}
+}
+
+// TestSharedSecretMatcher verifies matching on plaintext and HMAC-hidden
+// shared secrets, that the matching key's principal is recorded in audit
+// events, and the config error cases.
+func TestSharedSecretMatcher(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("hmac-key"))
+	mac.Write([]byte("hmac-secret"))
+	hmacDigest := hex.EncodeToString(mac.Sum(nil))
+
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "legacy",
+				"request": {"shared_secret": {
+					"header": "X-Api-Key",
+					"hmac_key": "hmac-key",
+					"keys": [
+						{"principal": "legacy-batch", "value": "plain-secret"},
+						{"principal": "legacy-report", "hmac_sha256": "` + hmacDigest + `"}
+					]
+				}}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	call := func(md metadata.MD) error {
+		return engine.isAuthorized(rpcContext("/pkg.Service/Api", md))
+	}
+
+	if err := call(metadata.Pairs("x-api-key", "plain-secret")); err != nil {
+		t.Errorf("Plaintext secret denied: %v", err)
+	}
+	if err := call(metadata.Pairs("x-api-key", "hmac-secret")); err != nil {
+		t.Errorf("HMAC-hidden secret denied: %v", err)
+	}
+	if err := call(metadata.Pairs("x-api-key", "wrong")); err == nil {
+		t.Error("Wrong secret allowed, want denied")
+	}
+	if err := call(nil); err == nil {
+		t.Error("Absent secret allowed, want denied")
+	}
+	wantPrincipals := []string{"legacy-batch", "legacy-report", "", ""}
+	if len(rec.events) != len(wantPrincipals) {
+		t.Fatalf("Got %d audit events, want %d", len(rec.events), len(wantPrincipals))
+	}
+	for n, want := range wantPrincipals {
+		if got := rec.events[n].Principal; got != want {
+			t.Errorf("Event %d Principal = %q, want %q", n, got, want)
+		}
+	}
+	if got := rec.events[0].PrincipalSource; got != "shared_secret" {
+		t.Errorf("Event 0 PrincipalSource = %q, want %q", got, "shared_secret")
+	}
+
+	for _, bad := range []string{
+		`{"keys": [{"principal": "p", "value": "s"}]}`,
+		`{"header": "x-api-key"}`,
+		`{"header": "x-api-key", "keys": [{"value": "s"}]}`,
+		`{"header": "x-api-key", "keys": [{"principal": "p"}]}`,
+		`{"header": "x-api-key", "keys": [{"principal": "p", "value": "s", "hmac_sha256": "ab"}]}`,
+		`{"header": "x-api-key", "keys": [{"principal": "p", "hmac_sha256": "ab12"}]}`,
+		`{"header": "x-api-key", "hmac_key": "k", "keys": [{"principal": "p", "hmac_sha256": "zz"}]}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"shared_secret": ` + bad + `}}]}`); err == nil {
+			t.Errorf("NewStatic() with shared_secret %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestPrincipalMatchLoggerFilter verifies that a logger carrying
+// "principal_match" only receives events for matching principals while an
+// unfiltered logger receives everything.
+func TestPrincipalMatchLoggerFilter(t *testing.T) {
+	policy, err := parseAuthorizationPolicy(`{"name": "authz", "allow_rules": [{"name": "all"}], "audit_logging_options": {"audit_condition": "ON_DENY_AND_ALLOW"}}`)
+	if err != nil {
+		t.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	engine, err := newPolicyEngine(policy, interceptorOptions{})
+	if err != nil {
+		t.Fatalf("newPolicyEngine() failed: %v", err)
+	}
+	all := &recordingTestLogger{}
+	scoped := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{
+		{logger: all},
+		{logger: scoped, principals: []*stringPatternMatcher{newStringPatternMatcher("spiffe://corp/billing/*")}},
+	}
+	call := func(principal string) {
+		in := &rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.MD{}, extractedPrincipal: principal, deadlineMillis: -1, ctx: context.Background()}
+		if err := engine.doAuditLogging(engine.evaluate(in), nil); err != nil {
+			t.Fatalf("doAuditLogging() failed: %v", err)
+		}
+	}
+	call("spiffe://corp/billing/batch")
+	call("spiffe://corp/web/frontend")
+	call("")
+	if got := len(all.events); got != 3 {
+		t.Errorf("Unfiltered logger received %d events, want 3", got)
+	}
+	if got := len(scoped.events); got != 1 {
+		t.Fatalf("Filtered logger received %d events, want 1", got)
+	}
+	if got := scoped.events[0].Principal; got != "spiffe://corp/billing/batch" {
+		t.Errorf("Filtered logger received event for %q, want the billing principal", got)
+	}
+
+	// A policy using principal_match compiles on the policy engine path.
+	policy, err = parseAuthorizationPolicy(`{"name": "authz", "allow_rules": [{"name": "all"}], "audit_logging_options": {"audit_loggers": [{"name": "stdout_logger", "principal_match": ["spiffe://corp/billing/*"]}]}}`)
+	if err != nil {
+		t.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	if !policy.requiresPolicyEngine() {
+		t.Error("requiresPolicyEngine() with principal_match = false, want true")
+	}
+}
+
+// TestWithPeriodicSummary verifies the rollup event's counts and top rules,
+// that empty windows emit nothing, and that Close emits the final partial
+// window and stops the ticker.
+func TestWithPeriodicSummary(t *testing.T) {
+	rec := &recordingTestLogger{}
+	i, err := NewStatic(`{
+		"name": "authz",
+		"deny_rules": [{"name": "blocked", "request": {"paths": ["/pkg.Service/Blocked"]}}],
+		"allow_rules": [{"name": "all"}]
+	}`, WithPeriodicSummary(time.Hour, rec))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	engine.isAuthorized(rpcContext("/pkg.Service/Api", nil))
+	engine.isAuthorized(rpcContext("/pkg.Service/Api", nil))
+	engine.isAuthorized(rpcContext("/pkg.Service/Blocked", nil))
+	i.Close()
+	if got := len(rec.events); got != 1 {
+		t.Fatalf("Summary logger received %d events, want 1", got)
+	}
+	event := rec.events[0]
+	if event.EventType != audit.EventTypeSummary || event.PolicyName != "authz" {
+		t.Errorf("Summary event = {EventType: %q, PolicyName: %q}, want the summary type for policy authz", event.EventType, event.PolicyName)
+	}
+	wantLabels := map[string]string{
+		"allowed":   "2",
+		"denied":    "1",
+		"top_rules": "authz_all=2,authz_blocked=1",
+	}
+	if diff := cmp.Diff(wantLabels, event.Labels); diff != "" {
+		t.Errorf("Summary labels mismatch (-want +got):\n%s", diff)
+	}
+
+	// An engine that made no decisions emits no summary on Close.
+	rec2 := &recordingTestLogger{}
+	i2, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithPeriodicSummary(time.Hour, rec2))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	i2.Close()
+	if got := len(rec2.events); got != 0 {
+		t.Errorf("Idle summary logger received %d events, want 0", got)
+	}
+
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithPeriodicSummary(0, rec)); err == nil {
+		t.Error("NewStatic() with a zero summary interval succeeded, want error")
+	}
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithPeriodicSummary(time.Hour, nil)); err == nil {
+		t.Error("NewStatic() with a nil summary logger succeeded, want error")
+	}
+}
+
+// TestConnectionAgeMatcher verifies matching on the connection establishment
+// time stamped by the ConnectionAgeTracking stats handler, and that RPCs
+// without a recorded time never match.
+func TestConnectionAgeMatcher(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"deny_rules": [{"name": "stale", "request": {"connection_age": {"max_ms": 60000}}}],
+		"allow_rules": [{"name": "all"}]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	callAt := func(established time.Time) error {
+		ctx := context.WithValue(rpcContext("/pkg.Service/Api", nil), connAgeKey{}, established)
+		return engine.isAuthorized(ctx)
+	}
+	if err := callAt(time.Now().Add(-time.Second)); err != nil {
+		t.Errorf("Fresh connection denied: %v", err)
+	}
+	if err := callAt(time.Now().Add(-2 * time.Minute)); err == nil {
+		t.Error("Stale connection allowed, want denied")
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("Connection without a recorded establishment time denied: %v", err)
+	}
+
+	// The stats handler stamps the establishment time into the connection
+	// context.
+	tagged := (&connAgeTracker{}).TagConn(context.Background(), nil)
+	if _, ok := tagged.Value(connAgeKey{}).(time.Time); !ok {
+		t.Error("TagConn() did not record the establishment time")
+	}
+
+	for _, bad := range []string{`{}`, `{"max_ms": 0}`, `{"max_ms": -5}`} {
+		if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "d", "request": {"connection_age": ` + bad + `}}], "allow_rules": [{"name": "all"}]}`); err == nil {
+			t.Errorf("NewStatic() with connection_age %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestEnforcementGate verifies that a gate turning enforcement off allows
+// would-be denials, audits them with the unenforced outcome, and that denials
+// apply as usual while the gate is on.
+func TestEnforcementGate(t *testing.T) {
+	enforce := true
+	var gated []string
+	i, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "blocked", "request": {"paths": ["/pkg.Service/Blocked"]}}], "allow_rules": [{"name": "all"}]}`,
+		WithEnforcementGate(func(_ context.Context, fullMethod string) bool {
+			gated = append(gated, fullMethod)
+			return enforce
+		}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(method string) error {
+		_, err := i.UnaryInterceptor(rpcContext(method, nil), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return err
+	}
+
+	if got := status.Code(call("/pkg.Service/Blocked")); got != codes.PermissionDenied {
+		t.Fatalf("Denied method with enforcement on = %v, want %v", got, codes.PermissionDenied)
+	}
+	enforce = false
+	if err := call("/pkg.Service/Blocked"); err != nil {
+		t.Fatalf("Denied method with enforcement off = %v, want allowed", err)
+	}
+	last := rec.events[len(rec.events)-1]
+	if last.Authorized || last.MatchedRule != "authz_blocked" || last.Outcome != audit.OutcomeUnenforced {
+		t.Errorf("Gated-off denial audit event = {Authorized: %v, MatchedRule: %q, Outcome: %q}, want the would-be denial with outcome %q", last.Authorized, last.MatchedRule, last.Outcome, audit.OutcomeUnenforced)
+	}
+
+	// The gate is only consulted for would-be denials; allows never invoke it.
+	gated = nil
+	if err := call("/pkg.Service/Api"); err != nil {
+		t.Fatalf("Allowed method failed: %v", err)
+	}
+	if len(gated) != 0 {
+		t.Errorf("Gate consulted for an allowed RPC: %v", gated)
+	}
+	if last := rec.events[len(rec.events)-1]; !last.Authorized || last.Outcome != audit.OutcomeAllow {
+		t.Errorf("Allow audit event = {Authorized: %v, Outcome: %q}, want a regular allow", last.Authorized, last.Outcome)
+	}
+}
+
+// TestForensicDenialSampling verifies the sampled header dump on denial
+// events: the attach and skip paths of the sampler, the key restriction,
+// sensitive-key redaction and that allows are never sampled.
+func TestForensicDenialSampling(t *testing.T) {
+	origRand := randFloat64
+	defer func() { randFloat64 = origRand }()
+	sample := 0.0
+	randFloat64 = func() float64 { return sample }
+
+	newInterceptor := func(opts ...Option) (*StaticInterceptor, *recordingTestLogger) {
+		i, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "blocked", "request": {"paths": ["/pkg.Service/Blocked"]}}], "allow_rules": [{"name": "all"}]}`, opts...)
+		if err != nil {
+			t.Fatalf("NewStatic() failed: %v", err)
+		}
+		engine := i.currentEngine().policyEngine
+		rec := &recordingTestLogger{}
+		engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+		engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+		return i, rec
+	}
+	md := metadata.Pairs("authorization", "Bearer secret", "x-request-id", "req-1", "user-agent", "test-agent/1.0")
+	call := func(i *StaticInterceptor, method string) {
+		handler := func(context.Context, any) (any, error) { return nil, nil }
+		i.UnaryInterceptor(rpcContext(method, md), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+
+	i, rec := newInterceptor(WithForensicDenialSampling(0.5))
+	call(i, "/pkg.Service/Blocked")
+	got := rec.events[len(rec.events)-1].ForensicHeaders
+	want := map[string][]string{
+		"authorization": {"<redacted>"},
+		"x-request-id":  {"req-1"},
+		"user-agent":    {"test-agent/1.0"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Sampled denial ForensicHeaders mismatch (-want +got):\n%s", diff)
+	}
+
+	// A draw at or above the rate skips the dump.
+	sample = 0.5
+	call(i, "/pkg.Service/Blocked")
+	if got := rec.events[len(rec.events)-1].ForensicHeaders; got != nil {
+		t.Errorf("Unsampled denial carries ForensicHeaders: %v", got)
+	}
+
+	// Allowed RPCs are never sampled.
+	sample = 0.0
+	call(i, "/pkg.Service/Api")
+	if last := rec.events[len(rec.events)-1]; !last.Authorized || last.ForensicHeaders != nil {
+		t.Errorf("Allow event = {Authorized: %v, ForensicHeaders: %v}, want authorized without a dump", last.Authorized, last.ForensicHeaders)
+	}
+
+	// The dump can be restricted to named headers.
+	i, rec = newInterceptor(WithForensicDenialSampling(1, "X-Request-Id"))
+	call(i, "/pkg.Service/Blocked")
+	if got, want := rec.events[len(rec.events)-1].ForensicHeaders, map[string][]string{"x-request-id": {"req-1"}}; !cmp.Equal(want, got) {
+		t.Errorf("Restricted ForensicHeaders = %v, want %v", got, want)
+	}
+
+	for _, rate := range []float64{0, -0.1, 1.5} {
+		if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithForensicDenialSampling(rate)); err == nil {
+			t.Errorf("NewStatic() with sampling rate %v succeeded, want error", rate)
+		}
+	}
+}
+
+// TestKnownMethodMatcher verifies denying probes for methods outside the
+// known-method set while known methods fall through to the allow rules, and
+// the inverted and unconfigured forms of the matcher.
+func TestKnownMethodMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [{"name": "unknown_probe", "request": {"known_method": false}}],
+		"allow_rules": [{"name": "all"}]
+	}`
+	i, err := NewStatic(policy, WithKnownMethods([]string{"/pkg.Service/Api", "/pkg.Service/Other"}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("Known method denied: %v", err)
+	}
+	err = engine.isAuthorized(rpcContext("/pkg.Service/DoesNotExist", nil))
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(status.Convert(err).Message(), "authz_unknown_probe") {
+		t.Errorf("Unknown method probe = %v, want PermissionDenied by authz_unknown_probe", err)
+	}
+
+	// "known_method": true restricts a rule to implemented methods.
+	i, err = NewStatic(`{"name": "authz", "allow_rules": [{"name": "known", "request": {"known_method": true}}]}`,
+		WithKnownMethods([]string{"/pkg.Service/Api"}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine = i.currentEngine().policyEngine
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("Known method denied: %v", err)
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/DoesNotExist", nil)); err == nil {
+		t.Error("Unknown method allowed by a known-only rule, want denied")
+	}
+
+	// Without WithKnownMethods the set is empty and no method is known.
+	i, err = NewStatic(`{"name": "authz", "allow_rules": [{"name": "known", "request": {"known_method": true}}]}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	if err := i.currentEngine().policyEngine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err == nil {
+		t.Error("Method allowed without a known-method set, want denied")
+	}
+}
+
+// slowTestMatcher is an extended matcher standing in for a pathologically
+// expensive custom extension, used to exercise the evaluation timeout.
+type slowTestMatcher struct {
+	delay time.Duration
+}
+
+func (m *slowTestMatcher) match(*rpcInput) bool {
+	time.Sleep(m.delay)
+	return true
+}
+
+// TestEvaluationTimeout verifies that a slow matcher trips the evaluation
+// timeout into a fail-closed denial with the distinct "<eval_timeout>" audit
+// event, while fast evaluations are unaffected by the bound.
+func TestEvaluationTimeout(t *testing.T) {
+	i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithEvaluationTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("Fast evaluation denied: %v", err)
+	}
+
+	engine.allowRules[0].ext = append(engine.allowRules[0].ext, &slowTestMatcher{delay: time.Second})
+	err = engine.isAuthorized(rpcContext("/pkg.Service/Api", nil))
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(status.Convert(err).Message(), "<eval_timeout>") {
+		t.Errorf("Slow evaluation = %v, want PermissionDenied naming <eval_timeout>", err)
+	}
+	last := rec.events[len(rec.events)-1]
+	if last.Authorized || last.MatchedRule != "<eval_timeout>" {
+		t.Errorf("Timeout audit event = {Authorized: %v, MatchedRule: %q}, want denied with <eval_timeout>", last.Authorized, last.MatchedRule)
+	}
+
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithEvaluationTimeout(-time.Second)); err == nil {
+		t.Error("NewStatic() with a negative evaluation timeout succeeded, want error")
+	}
+}
+
+// TestPolicyHash verifies the stability of the policy hash across formatting
+// differences, that distinct policies hash differently, and that audit events
+// carry the hash.
+func TestPolicyHash(t *testing.T) {
+	newEngine := func(policy string) *policyEngine {
+		t.Helper()
+		i, err := NewStatic(policy, WithPathMethodConsistency())
+		if err != nil {
+			t.Fatalf("NewStatic() failed: %v", err)
+		}
+		return i.currentEngine().policyEngine
+	}
+	a := newEngine(`{"name": "authz", "allow_rules": [{"name": "all"}]}`)
+	b := newEngine("{\n\t\"allow_rules\": [ {\"name\": \"all\"} ],\n\t\"name\": \"authz\"\n}")
+	if a.policyHash != b.policyHash {
+		t.Errorf("Reformatted policy hashes differ: %q vs %q", a.policyHash, b.policyHash)
+	}
+	if len(a.policyHash) != 64 {
+		t.Errorf("Policy hash %q is not SHA-256 hex", a.policyHash)
+	}
+	if c := newEngine(`{"name": "authz", "allow_rules": [{"name": "some", "request": {"paths": ["/pkg.Service/*"]}}]}`); c.policyHash == a.policyHash {
+		t.Error("Distinct policies share a hash")
+	}
+
+	rec := &recordingTestLogger{}
+	a.auditLoggers = []*auditLoggerState{{logger: rec}}
+	a.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	if err := a.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	if got := rec.events[0].PolicyHash; got != a.policyHash {
+		t.Errorf("Audit event PolicyHash = %q, want %q", got, a.policyHash)
+	}
+}
+
+// TestTLSMatcher verifies version and cipher suite matching against the
+// negotiated TLS connection state, that non-TLS connections never match, and
+// the config validation.
+func TestTLSMatcher(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [{"name": "modern", "request": {"tls": {"min_version": "1.3"}}}]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	input := func(state tls.ConnectionState) *rpcInput {
+		return &rpcInput{
+			peerInfo:   &grpcpeer.Peer{AuthInfo: credentials.TLSInfo{State: state}},
+			authType:   "tls",
+			fullMethod: "/pkg.Service/Api",
+			md:         metadata.MD{},
+		}
+	}
+	if d := engine.evaluate(input(tls.ConnectionState{Version: tls.VersionTLS13})); !d.authorized {
+		t.Error("TLS 1.3 connection denied, want allowed")
+	}
+	if d := engine.evaluate(input(tls.ConnectionState{Version: tls.VersionTLS12})); d.authorized {
+		t.Error("TLS 1.2 connection allowed by a 1.3-only rule, want denied")
+	}
+	if d := engine.evaluate(&rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.MD{}}); d.authorized {
+		t.Error("Non-TLS connection allowed by a TLS-requiring rule, want denied")
+	}
+
+	i, err = NewStatic(`{
+		"name": "authz",
+		"deny_rules": [{"name": "weak_cipher", "request": {"tls": {"cipher_suites": ["TLS_RSA_WITH_RC4_128_SHA"]}}}],
+		"allow_rules": [{"name": "all"}]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine = i.currentEngine().policyEngine
+	weak := tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_RSA_WITH_RC4_128_SHA}
+	if d := engine.evaluate(input(weak)); d.authorized || d.matchedRule != "authz_weak_cipher" {
+		t.Errorf("Weak cipher decision = {authorized: %v, matchedRule: %q}, want denied by authz_weak_cipher", d.authorized, d.matchedRule)
+	}
+	strong := tls.ConnectionState{Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_256_GCM_SHA384}
+	if d := engine.evaluate(input(strong)); !d.authorized {
+		t.Error("Strong cipher denied by a weak-cipher deny rule, want allowed")
+	}
+
+	for _, bad := range []string{
+		`{}`,
+		`{"min_version": "1.4"}`,
+		`{"min_version": "tls1.2"}`,
+		`{"cipher_suites": ["NOT_A_SUITE"]}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "t", "request": {"tls": ` + bad + `}}]}`); err == nil {
+			t.Errorf("NewStatic() with tls config %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestPostHandlerAudit verifies that allowed RPCs are audited after the
+// handler with its final status recorded, while denials are audited at
+// decision time without result fields.
+func TestPostHandlerAudit(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"deny_rules": [{"name": "blocked", "request": {"paths": ["/pkg.Service/Blocked"]}}],
+		"allow_rules": [{"name": "all"}]
+	}`, WithPostHandlerAudit())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	handlerErr := status.Error(codes.NotFound, "no such widget")
+	handlerRan := false
+	handler := func(context.Context, any) (any, error) {
+		handlerRan = true
+		if len(rec.events) != 0 {
+			t.Error("Allowed RPC audited before the handler ran")
+		}
+		return nil, handlerErr
+	}
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Api"}, handler); err != handlerErr {
+		t.Fatalf("UnaryInterceptor() = %v, want the handler's error", err)
+	}
+	if !handlerRan {
+		t.Fatal("Handler did not run")
+	}
+	got := rec.events[0]
+	if got.EventType != audit.EventTypeResult || got.ResultCode != codes.NotFound || got.ResultMessage != "no such widget" || !got.Authorized {
+		t.Errorf("Result event = {EventType: %q, ResultCode: %v, ResultMessage: %q, Authorized: %v}, want an authorized result event with the handler's status", got.EventType, got.ResultCode, got.ResultMessage, got.Authorized)
+	}
+
+	// A successful handler records codes.OK.
+	ok := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Api"}, ok); err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+	if got := rec.events[1]; got.ResultCode != codes.OK || got.EventType != audit.EventTypeResult {
+		t.Errorf("Successful result event = {EventType: %q, ResultCode: %v}, want an OK result event", got.EventType, got.ResultCode)
+	}
+
+	// Denials are audited at decision time, without result fields.
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Blocked", nil), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Blocked"}, ok); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Denied method = %v, want %v", err, codes.PermissionDenied)
+	}
+	if got := rec.events[2]; got.Authorized || got.EventType != "" || got.ResultCode != codes.OK || got.ResultMessage != "" {
+		t.Errorf("Denial event = {Authorized: %v, EventType: %q, ResultCode: %v, ResultMessage: %q}, want a plain decision-time denial", got.Authorized, got.EventType, got.ResultCode, got.ResultMessage)
+	}
+}
+
+// stubListSource is a DynamicListSource backed by a fixed member set.
+type stubListSource struct {
+	members map[string]bool
+	err     error
+}
+
+func (s *stubListSource) Contains(key string) (bool, error) {
+	return s.members[key], s.err
+}
+
+// TestDynamicListMatcher verifies lookups keyed by principal, method and
+// header, the no-match behavior on source errors, and the config validation.
+func TestDynamicListMatcher(t *testing.T) {
+	blocklist := &stubListSource{members: map[string]bool{
+		"spiffe://corp/ns/bad": true,
+		"/pkg.Service/Legacy":  true,
+		"revoked-key":          true,
+	}}
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{"name": "bad_principal", "request": {"dynamic_list": {"source": "blocklist"}}},
+			{"name": "bad_method", "request": {"dynamic_list": {"source": "blocklist", "key": "method"}}},
+			{"name": "bad_key", "request": {"dynamic_list": {"source": "blocklist", "key": "header:x-api-key"}}}
+		],
+		"allow_rules": [{"name": "all"}]
+	}`
+	i, err := NewStatic(policy, WithDynamicListSource("blocklist", blocklist))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	tests := []struct {
+		name     string
+		in       *rpcInput
+		wantRule string
+	}{
+		{"listed principal", &rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.MD{}, extractedPrincipal: "spiffe://corp/ns/bad"}, "authz_bad_principal"},
+		{"unlisted principal", &rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.MD{}, extractedPrincipal: "spiffe://corp/ns/ok"}, ""},
+		{"listed method", &rpcInput{fullMethod: "/pkg.Service/Legacy", md: metadata.MD{}}, "authz_bad_method"},
+		{"listed header", &rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.Pairs("x-api-key", "revoked-key")}, "authz_bad_key"},
+		{"unlisted header", &rpcInput{fullMethod: "/pkg.Service/Api", md: metadata.Pairs("x-api-key", "good-key")}, ""},
+	}
+	for _, test := range tests {
+		d := engine.evaluate(test.in)
+		if test.wantRule == "" {
+			if !d.authorized {
+				t.Errorf("%s: denied by %q, want allowed", test.name, d.matchedRule)
+			}
+		} else if d.authorized || d.matchedRule != test.wantRule {
+			t.Errorf("%s: decision = {authorized: %v, matchedRule: %q}, want denied by %q", test.name, d.authorized, d.matchedRule, test.wantRule)
+		}
+	}
+
+	// An erroring source never matches, so these deny rules fail open.
+	blocklist.err = errors.New("redis unavailable")
+	if d := engine.evaluate(&rpcInput{fullMethod: "/pkg.Service/Legacy", md: metadata.MD{}}); !d.authorized {
+		t.Errorf("Unavailable source denied the RPC via %q, want the deny rule to fail open", d.matchedRule)
+	}
+
+	if _, err := NewStatic(policy); err == nil || !strings.Contains(err.Error(), `not registered`) {
+		t.Errorf("NewStatic() without the source = %v, want unregistered-source error", err)
+	}
+	for _, bad := range []string{`{}`, `{"source": "blocklist", "key": "peer"}`, `{"source": "blocklist", "key": "header:"}`} {
+		if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "l", "request": {"dynamic_list": `+bad+`}}]}`, WithDynamicListSource("blocklist", blocklist)); err == nil {
+			t.Errorf("NewStatic() with dynamic_list %s succeeded, want error", bad)
+		}
+	}
+}
+
+func TestTrustBoundaryMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [{"name": "external", "request": {"paths": ["/pkg.Service/Internal"], "trust_boundary": {"external": true}}}],
+		"allow_rules": [{"name": "all"}]
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	external := metadata.Pairs("x-from-external", "true")
+	err = engine.isAuthorized(rpcContext("/pkg.Service/Internal", external))
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(status.Convert(err).Message(), "authz_external") {
+		t.Errorf("Externally originated RPC = %v, want PermissionDenied by authz_external", err)
+	}
+	// The header value is irrelevant: presence marks the boundary crossing.
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Internal", metadata.Pairs("x-from-external", "false"))); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Externally tagged RPC = %v, want PermissionDenied regardless of the header value", err)
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Internal", nil)); err != nil {
+		t.Errorf("Internal RPC denied: %v", err)
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Public", external)); err != nil {
+		t.Errorf("External RPC to an unrestricted method denied: %v", err)
+	}
+
+	// A custom header and "external": false restricting a rule to internal
+	// traffic.
+	i, err = NewStatic(`{"name": "authz", "allow_rules": [{"name": "internal", "request": {"trust_boundary": {"external": false, "header": "X-Ingress"}}}]}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine = i.currentEngine().policyEngine
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("Internal RPC denied by an internal-only allow rule: %v", err)
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", metadata.Pairs("x-ingress", "gw-1"))); err == nil {
+		t.Error("External RPC allowed by an internal-only allow rule, want denied")
+	}
+
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "bad", "request": {"trust_boundary": {}}}]}`); err == nil || !strings.Contains(err.Error(), `"trust_boundary" requires "external"`) {
+		t.Errorf(`NewStatic() with an empty "trust_boundary" = %v, want the missing "external" error`, err)
+	}
+}
+
+func TestDefaultAllow(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [{"name": "blocked", "request": {"paths": ["/pkg.Service/Admin"]}}]
+	}`
+	var decisions []DecisionInfo
+	i, err := NewStatic(policy, WithDefaultAllow(), WithDecisionCallback(func(d DecisionInfo) { decisions = append(decisions, d) }))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	err = engine.isAuthorized(rpcContext("/pkg.Service/Admin", nil))
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(status.Convert(err).Message(), "authz_blocked") {
+		t.Errorf("Explicitly denied RPC = %v, want PermissionDenied by authz_blocked", err)
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Anything", nil)); err != nil {
+		t.Errorf("Unmatched RPC under WithDefaultAllow denied: %v", err)
+	}
+	if len(decisions) != 2 || decisions[1].MatchedRule != "<default_allow>" || !decisions[1].Authorized {
+		t.Errorf("Decisions = %+v, want the second allowed with matched rule %q", decisions, "<default_allow>")
+	}
+
+	// An unmatched RPC is also allowed when allow rules exist but none match.
+	i, err = NewStatic(`{"name": "authz", "deny_rules": [{"name": "blocked", "request": {"paths": ["/pkg.Service/Admin"]}}], "allow_rules": [{"name": "peers", "source": {"principals": ["spiffe://corp/*"]}}]}`, WithDefaultAllow())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	if err := i.currentEngine().policyEngine.isAuthorized(rpcContext("/pkg.Service/Anything", nil)); err != nil {
+		t.Errorf("Unmatched RPC under WithDefaultAllow denied: %v", err)
+	}
+
+	// Without the option a deny-list-only policy is rejected, preserving the
+	// default-deny contract.
+	if _, err := NewStatic(policy); err == nil || !strings.Contains(err.Error(), "WithDefaultAllow") {
+		t.Errorf("NewStatic() without WithDefaultAllow = %v, want the missing-option error", err)
+	}
+	if _, err := NewStatic(policy, WithDenialMessage("no")); err == nil || !strings.Contains(err.Error(), "WithDefaultAllow") {
+		t.Errorf("NewStatic() with unrelated options = %v, want the missing-option error", err)
+	}
+}
+
+func TestMetadataCardinalityMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [{"name": "injected", "request": {"metadata_cardinality": {"key": "x-route", "max_values": 3}}}],
+		"allow_rules": [{"name": "all"}]
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	md := metadata.MD{"x-route": {"a", "b", "c", "d"}}
+	err = engine.isAuthorized(rpcContext("/pkg.Service/Api", md))
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(status.Convert(err).Message(), "authz_injected") {
+		t.Errorf("RPC with 4 x-route values = %v, want PermissionDenied by authz_injected", err)
+	}
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", metadata.MD{"x-route": {"a", "b", "c"}})); err != nil {
+		t.Errorf("RPC at the value limit denied: %v", err)
+	}
+	// An absent key has zero values and never exceeds the limit.
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("RPC without the key denied: %v", err)
+	}
+	// Metadata keys are case-insensitive.
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", metadata.MD{"X-Route": {"a", "b", "c", "d"}})); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("RPC with mixed-case key = %v, want PermissionDenied", err)
+	}
+
+	for name, bad := range map[string]string{
+		"missing key":        `{"max_values": 3}`,
+		"missing max_values": `{"key": "x-route"}`,
+		"negative":           `{"key": "x-route", "max_values": -1}`,
+	} {
+		p := `{"name": "authz", "allow_rules": [{"name": "a", "request": {"metadata_cardinality": ` + bad + `}}]}`
+		if _, err := NewStatic(p); err == nil {
+			t.Errorf("NewStatic() with %s succeeded, want error", name)
+		}
+	}
+}
+
+// stubGeoIPResolver resolves every IP to a fixed location.
+type stubGeoIPResolver struct {
+	country string
+	err     error
+	lookups int
+}
+
+func (r *stubGeoIPResolver) Lookup(string) (float64, float64, string, error) {
+	r.lookups++
+	if r.err != nil {
+		return 0, 0, "", r.err
+	}
+	return 0, 0, r.country, nil
+}
+
+func TestGeoIPMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [{"name": "offshore", "request": {"geoip": {"allowed_countries": ["US", "CA"]}}}],
+		"allow_rules": [{"name": "all"}]
+	}`
+	resolver := &stubGeoIPResolver{country: "US"}
+	policyParsed, err := parseAuthorizationPolicy(policy)
+	if err != nil {
+		t.Fatalf("parseAuthorizationPolicy() failed: %v", err)
+	}
+	rec := &recordingTestLogger{}
+	engine, err := newPolicyEngine(policyParsed, interceptorOptions{geoipResolver: resolver})
+	if err != nil {
+		t.Fatalf("newPolicyEngine() failed: %v", err)
+	}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("RPC from an allowed country denied: %v", err)
+	}
+	if len(rec.events) != 1 || rec.events[0].Country != "US" {
+		t.Fatalf("Audit events = %+v, want one event with Country %q", rec.events, "US")
+	}
+	resolver.country = "KP"
+	err = engine.isAuthorized(rpcContext("/pkg.Service/Api", nil))
+	if status.Code(err) != codes.PermissionDenied || !strings.Contains(status.Convert(err).Message(), "authz_offshore") {
+		t.Errorf("RPC from outside the allowed set = %v, want PermissionDenied by authz_offshore", err)
+	}
+	if got := rec.events[1].Country; got != "KP" {
+		t.Errorf("Denied event Country = %q, want %q", got, "KP")
+	}
+	// A failing lookup means no match: the deny rule fails open, and the
+	// event carries no country.
+	resolver.err = errors.New("database unavailable")
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Errorf("RPC with a failing resolver denied: %v", err)
+	}
+	if got := rec.events[2].Country; got != "" {
+		t.Errorf("Event Country with a failing resolver = %q, want empty", got)
+	}
+
+	// A policy with "geoip" matchers requires a registered resolver.
+	if _, err := NewStatic(policy); err == nil || !strings.Contains(err.Error(), "WithGeoIPResolver") {
+		t.Errorf("NewStatic() without a resolver = %v, want the missing-resolver error", err)
+	}
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "a", "request": {"geoip": {}}}]}`, WithGeoIPResolver(resolver)); err == nil || !strings.Contains(err.Error(), `"allowed_countries"`) {
+		t.Errorf(`NewStatic() with an empty "geoip" = %v, want the missing "allowed_countries" error`, err)
+	}
+}
+
+func TestRuleHitCounts(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [{"name": "blocked", "request": {"paths": ["/pkg.Service/Admin"]}}],
+		"allow_rules": [
+			{"name": "api", "request": {"paths": ["/pkg.Service/Api"]}},
+			{"name": "unused", "request": {"paths": ["/pkg.Service/Never"]}}
+		]
+	}`
+	var mu sync.Mutex
+	var resets []map[string]uint64
+	i, err := NewStatic(policy, WithRuleHitCounts(func(counts map[string]uint64) {
+		mu.Lock()
+		defer mu.Unlock()
+		resets = append(resets, counts)
+	}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 25; n++ {
+				engine.isAuthorized(rpcContext("/pkg.Service/Api", nil))
+				engine.isAuthorized(rpcContext("/pkg.Service/Admin", nil))
+			}
+		}()
+	}
+	wg.Wait()
+	// One unmatched RPC: the default deny has no rule name and is not counted.
+	engine.isAuthorized(rpcContext("/pkg.Service/Other", nil))
+	want := map[string]uint64{"authz_api": 100, "authz_blocked": 100, "authz_unused": 0}
+	if got := i.GetRuleHitCounts(); !cmp.Equal(got, want) {
+		t.Errorf("GetRuleHitCounts() = %v, want %v", got, want)
+	}
+
+	// A policy mutation swaps in fresh counters and delivers the final counts
+	// of the replaced policy.
+	if err := i.AddRule("deny", `{"name": "extra", "request": {"paths": ["/pkg.Service/Extra"]}}`); err != nil {
+		t.Fatalf("AddRule() failed: %v", err)
+	}
+	mu.Lock()
+	if len(resets) != 1 || !cmp.Equal(resets[0], want) {
+		t.Errorf("Reset callback deliveries = %v, want one with %v", resets, want)
+	}
+	mu.Unlock()
+	counts := i.GetRuleHitCounts()
+	if counts["authz_api"] != 0 {
+		t.Errorf("Counts after reload = %v, want zeroed", counts)
+	}
+	if _, ok := counts["authz_extra"]; !ok {
+		t.Errorf("Counts after reload = %v, want the added rule present", counts)
+	}
+
+	// Without the option there are no counters.
+	plain, err := NewStatic(policy, WithDenialMessage("no"))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	if got := plain.GetRuleHitCounts(); got != nil {
+		t.Errorf("GetRuleHitCounts() without WithRuleHitCounts = %v, want nil", got)
+	}
+}
+
+func TestConcurrentStreamsMatcher(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "too_many_streams",
+				"request": {"paths": ["*"], "max_concurrent_streams": {"limit": 2, "per": "principal"}}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`
+	i, err := NewStatic(policy)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	stream := func(handler grpc.StreamHandler) error {
+		ss := &fakeServerStream{ctx: rpcContext("/pkg.Service/Stream", nil)}
+		return i.StreamInterceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: "/pkg.Service/Stream"}, handler)
+	}
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	errCh := make(chan error, 2)
+	blocking := func(any, grpc.ServerStream) error {
+		started <- struct{}{}
+		<-unblock
+		return nil
+	}
+	for n := 0; n < 2; n++ {
+		go func() { errCh <- stream(blocking) }()
+		<-started
+	}
+	instant := func(any, grpc.ServerStream) error { return nil }
+	if got := status.Code(stream(instant)); got != codes.ResourceExhausted {
+		t.Fatalf("Stream over limit = %v, want %v", got, codes.ResourceExhausted)
+	}
+	// Ending one stream frees its slot for the next caller.
+	unblock <- struct{}{}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Blocked stream failed: %v", err)
+	}
+	if err := stream(instant); err != nil {
+		t.Fatalf("Stream after release failed: %v", err)
+	}
+	// Unary RPCs are evaluated against the stream counts but never held
+	// against the limit themselves.
+	unary := func(context.Context, any) (any, error) { return nil, nil }
+	for n := 0; n < 3; n++ {
+		if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Unary", nil), nil, &grpc.UnaryServerInfo{}, unary); err != nil {
+			t.Fatalf("Unary call %d failed: %v", n, err)
+		}
+	}
+	unblock <- struct{}{}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Blocked stream failed: %v", err)
+	}
+	for _, bad := range []string{
+		`{"per": "principal"}`,
+		`{"limit": 0}`,
+		`{"limit": 5, "per": "peer"}`,
+	} {
+		if _, err := NewStatic(`{"name": "authz", "deny_rules": [{"name": "r", "request": {"max_concurrent_streams": ` + bad + `}}], "allow_rules": [{"name": "a"}]}`); err == nil {
+			t.Errorf("NewStatic() with max_concurrent_streams %s succeeded, want error", bad)
+		}
+	}
+}
+
+// TestSignedIdentityHeader verifies that a proxy-forwarded identity is
+// trusted as the principal only when its HMAC signature verifies, and that
+// failed verification denies the RPC with the distinct
+// "invalid_identity_signature" rule.
+func TestSignedIdentityHeader(t *testing.T) {
+	secret := []byte("proxy-shared-secret")
+	sign := func(identity string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(identity))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	var mu sync.Mutex
+	var last DecisionInfo
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_proxy_users",
+				"source": {"principals": ["proxy-user"]}
+			}
+		]
+	}`,
+		WithSignedIdentityHeader("x-forwarded-user", "x-forwarded-user-sig", secret),
+		WithDecisionCallback(func(info DecisionInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			last = info
+		}))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	call := func(md metadata.MD) codes.Code {
+		_, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", md), nil, &grpc.UnaryServerInfo{}, handler)
+		return status.Code(err)
+	}
+	matchedRule := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return last.MatchedRule
+	}
+	if got := call(metadata.Pairs("x-forwarded-user", "proxy-user", "x-forwarded-user-sig", sign("proxy-user"))); got != codes.OK {
+		t.Fatalf("Call with a valid signature = %v, want %v", got, codes.OK)
+	}
+	rec.mu.Lock()
+	if len(rec.events) != 1 {
+		t.Fatalf("Audit events = %d, want 1", len(rec.events))
+	}
+	if got, want := rec.events[0].Principal, "proxy-user"; got != want {
+		t.Errorf("Event Principal = %q, want %q", got, want)
+	}
+	if got, want := rec.events[0].PrincipalSource, "signed_header:x-forwarded-user"; got != want {
+		t.Errorf("Event PrincipalSource = %q, want %q", got, want)
+	}
+	rec.mu.Unlock()
+	for name, md := range map[string]metadata.MD{
+		"signature over another identity": metadata.Pairs("x-forwarded-user", "proxy-user", "x-forwarded-user-sig", sign("someone-else")),
+		"missing signature":               metadata.Pairs("x-forwarded-user", "proxy-user"),
+		"malformed signature":             metadata.Pairs("x-forwarded-user", "proxy-user", "x-forwarded-user-sig", "not-hex"),
+	} {
+		if got := call(md); got != codes.PermissionDenied {
+			t.Errorf("Call with %s = %v, want %v", name, got, codes.PermissionDenied)
+		}
+		if got := matchedRule(); got != "invalid_identity_signature" {
+			t.Errorf("Matched rule with %s = %q, want %q", name, got, "invalid_identity_signature")
+		}
+	}
+	// Without the identity header the RPC is evaluated normally: no principal
+	// is set, so the allow rule does not match, and the denial is not
+	// attributed to signature verification.
+	if got := call(nil); got != codes.PermissionDenied {
+		t.Errorf("Call without an identity header = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := matchedRule(); got != "" {
+		t.Errorf("Matched rule without an identity header = %q, want empty", got)
+	}
+	if _, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithSignedIdentityHeader("x-user", "x-user-sig", nil)); err == nil {
+		t.Error("NewStatic() with an empty secret succeeded, want error")
+	}
+}
+
+// TestLint verifies detection of rules shadowed by an unconditional deny, of
+// allow rules whose paths a path-only deny rule entirely covers, and of
+// duplicate rules, and that clean policies produce no warnings.
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   []LintWarning
+	}{
+		{
+			name:   "clean policy",
+			policy: `{"name": "authz", "deny_rules": [{"name": "deny_admin", "request": {"paths": ["/pkg.Admin/*"]}}], "allow_rules": [{"name": "allow_api", "request": {"paths": ["/pkg.Service/*"]}}]}`,
+		},
+		{
+			name:   "unconditional deny shadows everything after it",
+			policy: `{"name": "authz", "deny_rules": [{"name": "deny_all"}, {"name": "deny_admin", "request": {"paths": ["/pkg.Admin/*"]}}], "allow_rules": [{"name": "allow_api", "request": {"paths": ["/pkg.Service/*"]}}]}`,
+			want: []LintWarning{
+				{Rule: "authz_deny_admin", Message: `unreachable: deny rule "authz_deny_all" matches every RPC and is evaluated first`},
+				{Rule: "authz_allow_api", Message: `unreachable: deny rule "authz_deny_all" matches every RPC and is evaluated first`},
+			},
+		},
+		{
+			name:   "path-only deny covers allow paths",
+			policy: `{"name": "authz", "deny_rules": [{"name": "deny_service", "request": {"paths": ["/pkg.Service/*"]}}], "allow_rules": [{"name": "allow_api", "request": {"paths": ["/pkg.Service/Api", "/pkg.Service/Other"]}}, {"name": "allow_health", "request": {"paths": ["/pkg.Health/Check"]}}]}`,
+			want: []LintWarning{
+				{Rule: "authz_allow_api", Message: `unreachable: every path is covered by deny rule "authz_deny_service", which has no other constraints`},
+			},
+		},
+		{
+			name:   "deny with principal constraint does not shadow",
+			policy: `{"name": "authz", "deny_rules": [{"name": "deny_bad_user", "source": {"principals": ["spiffe://bad"]}, "request": {"paths": ["/pkg.Service/*"]}}], "allow_rules": [{"name": "allow_api", "request": {"paths": ["/pkg.Service/Api"]}}]}`,
+		},
+		{
+			name:   "duplicate allow rules",
+			policy: `{"name": "authz", "allow_rules": [{"name": "allow_api", "request": {"paths": ["/pkg.Service/Api"]}}, {"name": "allow_api_again", "request": {"paths": ["/pkg.Service/Api"]}}]}`,
+			want: []LintWarning{
+				{Rule: "authz_allow_api_again", Message: `duplicate: identical to earlier rule "authz_allow_api"`},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Lint(test.policy)
+			if err != nil {
+				t.Fatalf("Lint() failed: %v", err)
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Lint() warnings mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if _, err := Lint(`{"name": "bad"}`); err == nil {
+		t.Error("Lint() with an invalid policy succeeded, want error")
+	}
+}
+
+// TestAuditEventSequence verifies that emitted audit events carry a strictly
+// increasing process-wide sequence number and a stable run ID.
+func TestAuditEventSequence(t *testing.T) {
+	i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	for n := 0; n < 3; n++ {
+		if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+			t.Fatalf("UnaryInterceptor() call %d failed: %v", n, err)
+		}
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.events) != 3 {
+		t.Fatalf("Audit events = %d, want 3", len(rec.events))
+	}
+	for n, e := range rec.events {
+		if e.Sequence == 0 {
+			t.Errorf("Event %d Sequence = 0, want non-zero", n)
+		}
+		if e.RunID == "" {
+			t.Errorf("Event %d RunID is empty", n)
+		}
+		if n == 0 {
+			continue
+		}
+		if e.Sequence <= rec.events[n-1].Sequence {
+			t.Errorf("Event %d Sequence = %d, want greater than %d", n, e.Sequence, rec.events[n-1].Sequence)
+		}
+		if e.RunID != rec.events[0].RunID {
+			t.Errorf("Event %d RunID = %q, want %q", n, e.RunID, rec.events[0].RunID)
+		}
+	}
+}
+
+// closingTestLogger counts Close calls through the audit.Closer shape.
+type closingTestLogger struct {
+	recordingTestLogger
+	closed int
+}
+
+func (l *closingTestLogger) Close() error {
+	l.closed++
+	return nil
+}
+
+// plainClosingTestLogger counts Close calls through the errorless Close()
+// shape of the built-in sink loggers.
+type plainClosingTestLogger struct {
+	recordingTestLogger
+	closed int
+}
+
+func (l *plainClosingTestLogger) Close() {
+	l.closed++
+}
+
+// TestAuditLoggerClose verifies that tearing down the interceptor closes
+// loggers implementing either Close shape, and leaves plain loggers alone.
+func TestAuditLoggerClose(t *testing.T) {
+	i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	closer := &closingTestLogger{}
+	plainCloser := &plainClosingTestLogger{}
+	plain := &recordingTestLogger{}
+	engine := i.currentEngine().policyEngine
+	engine.auditLoggers = []*auditLoggerState{{logger: closer}, {logger: plainCloser}, {logger: plain}}
+	i.Close()
+	if closer.closed != 1 {
+		t.Errorf("Closer logger Close calls = %d, want 1", closer.closed)
+	}
+	if plainCloser.closed != 1 {
+		t.Errorf("Plain-shape logger Close calls = %d, want 1", plainCloser.closed)
+	}
+}
+
+// TestAuditEventPeerAddress verifies that emitted audit events carry the
+// peer's network address, and leave it empty when the connection has none.
+func TestAuditEventPeerAddress(t *testing.T) {
+	i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+	rec.mu.Lock()
+	if len(rec.events) != 1 {
+		t.Fatalf("Audit events = %d, want 1", len(rec.events))
+	}
+	if got, want := rec.events[0].PeerAddress, "127.0.0.1:9000"; got != want {
+		t.Errorf("Event PeerAddress = %q, want %q", got, want)
+	}
+	rec.mu.Unlock()
+	// A peer without an address must not panic and leaves the field empty.
+	if err := engine.doAuditLogging(&decision{in: &rpcInput{peerInfo: &grpcpeer.Peer{}, fullMethod: "/pkg.Service/Api", md: metadata.MD{}, ctx: context.Background()}, authorized: true}, nil); err != nil {
+		t.Fatalf("doAuditLogging() failed: %v", err)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if got := rec.events[len(rec.events)-1].PeerAddress; got != "" {
+		t.Errorf("Event PeerAddress without an address = %q, want empty", got)
+	}
+}
+
+// TestAuditEventStatusCode verifies that decision events record the terminal
+// status the engine observed: the denial status on denied events, OK on
+// allowed events, and the handler's final status under post-handler
+// auditing.
+func TestAuditEventStatusCode(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_blocked",
+				"request": {"paths": ["/pkg.Service/Blocked"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`
+	i, err := NewStatic(policy, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	i.UnaryInterceptor(rpcContext("/pkg.Service/Blocked", nil), nil, &grpc.UnaryServerInfo{}, handler)
+	i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, handler)
+	rec.mu.Lock()
+	if len(rec.events) != 2 {
+		t.Fatalf("Audit events = %d, want 2", len(rec.events))
+	}
+	if got := rec.events[0].StatusCode; got != codes.PermissionDenied {
+		t.Errorf("Denied event StatusCode = %v, want %v", got, codes.PermissionDenied)
+	}
+	if got := rec.events[1].StatusCode; got != codes.OK {
+		t.Errorf("Allowed event StatusCode = %v, want %v", got, codes.OK)
+	}
+	rec.mu.Unlock()
+
+	// Under post-handler auditing the allowed event carries the handler's
+	// final status.
+	i, err = NewStatic(policy, WithPostHandlerAudit())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine = i.currentEngine().policyEngine
+	rec = &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	failing := func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.NotFound, "no such resource")
+	}
+	i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, failing)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.events) != 1 {
+		t.Fatalf("Audit events = %d, want 1", len(rec.events))
+	}
+	if got := rec.events[0].StatusCode; got != codes.NotFound {
+		t.Errorf("Post-handler event StatusCode = %v, want %v", got, codes.NotFound)
+	}
+}
+
+// TestConditionRequiresCELModule verifies that a policy using the
+// "condition" field is rejected with guidance when the CEL evaluator module
+// is not linked in. The evaluator itself is tested in the authz/cel module.
+func TestConditionRequiresCELModule(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "tenant_acme",
+				"request": {"paths": ["/pkg.Service/*"]},
+				"condition": "request.headers['x-tenant'] == 'acme'"
+			}
+		]
+	}`
+	if _, err := NewStatic(policy); err == nil || !strings.Contains(err.Error(), "authz/cel") {
+		t.Errorf("NewStatic() with a condition returned error %v, want one pointing at the authz/cel module", err)
+	}
+}
+
+// TestAuditEventLatency verifies that decision events record the time spent
+// on policy evaluation.
+func TestAuditEventLatency(t *testing.T) {
+	policy := `{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`
+	i, err := NewStatic(policy, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.events) != 1 {
+		t.Fatalf("Audit events = %d, want 1", len(rec.events))
+	}
+	if got := rec.events[0].Latency; got <= 0 {
+		t.Errorf("Event Latency = %v, want > 0", got)
+	}
+}
+
+// TestPrincipalFromJWTClaim verifies that WithPrincipalFromJWTClaim derives
+// the principal from the bearer token, that a certificate identity wins when
+// both are present, and that the principal stays empty when neither is.
+func TestPrincipalFromJWTClaim(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_billing",
+				"source": {"principals": ["spiffe://example.org/billing"]}
+			}
+		]
+	}`, WithPrincipalFromJWTClaim("sub"))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	// A token whose "sub" claim matches the rule authorizes the RPC.
+	md := metadata.Pairs("authorization", "Bearer "+testJWT(t, map[string]any{"sub": "spiffe://example.org/billing"}))
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", md)); err != nil {
+		t.Fatalf("isAuthorized() with a matching token failed: %v", err)
+	}
+	got := rec.events[len(rec.events)-1]
+	if got.Principal != "spiffe://example.org/billing" || got.PrincipalSource != "jwt_claim:sub" {
+		t.Errorf("Event Principal, PrincipalSource = %q, %q, want the token subject from jwt_claim:sub", got.Principal, got.PrincipalSource)
+	}
+
+	// With neither a certificate nor a token the principal is empty and the
+	// rule does not match.
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("isAuthorized() without an identity returned %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	if got := rec.events[len(rec.events)-1].Principal; got != "" {
+		t.Errorf("Event Principal without an identity = %q, want empty", got)
+	}
+
+	// A certificate identity wins over the token when both are present.
+	ctx := rpcContext("/pkg.Service/Api", metadata.Pairs(
+		"authorization", "Bearer "+testJWT(t, map[string]any{"sub": "spiffe://example.org/billing"}),
+	))
+	ctx = grpcpeer.NewContext(ctx, &grpcpeer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000},
+		AuthInfo: credentials.TLSInfo{
+			SPIFFEID: &url.URL{Scheme: "spiffe", Host: "example.org", Path: "/frontend"},
+		},
+	})
+	if err := engine.isAuthorized(ctx); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("isAuthorized() with a non-matching certificate returned %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	got = rec.events[len(rec.events)-1]
+	if got.Principal != "spiffe://example.org/frontend" || got.PrincipalSource != "cert" {
+		t.Errorf("Event Principal, PrincipalSource = %q, %q, want the certificate identity from cert", got.Principal, got.PrincipalSource)
+	}
+}
+
+// TestRuleAuditCondition verifies that a rule-level "audit_condition"
+// overrides the policy-level condition for decisions the rule matched, and
+// that unknown values are rejected.
+func TestRuleAuditCondition(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY"
+		},
+		"allow_rules": [
+			{
+				"name": "allow_sensitive",
+				"request": {"paths": ["/pkg.Service/Sensitive"]},
+				"audit_condition": "ON_DENY_AND_ALLOW"
+			},
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/*"]}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+
+	// An allow by the ordinary rule is not audited under the global ON_DENY.
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	if got := len(rec.events); got != 0 {
+		t.Fatalf("Audit events after an ordinary allow = %d, want 0", got)
+	}
+	// An allow by the sensitive rule is audited by its override.
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Sensitive", nil)); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	if got := len(rec.events); got != 1 {
+		t.Fatalf("Audit events after a sensitive allow = %d, want 1", got)
+	}
+	if got := rec.events[0].MatchedRule; got != "authz_allow_sensitive" {
+		t.Errorf("Event MatchedRule = %q, want %q", got, "authz_allow_sensitive")
+	}
+	// A denial still follows the global ON_DENY.
+	if err := engine.isAuthorized(rpcContext("/other.Service/Api", nil)); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("isAuthorized() for an unmatched method returned %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	if got := len(rec.events); got != 2 {
+		t.Fatalf("Audit events after a denial = %d, want 2", got)
+	}
+
+	if _, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "all",
+				"request": {"paths": ["*"]},
+				"audit_condition": "SOMETIMES"
+			}
+		]
+	}`); err == nil || !strings.Contains(err.Error(), "AuditCondition") {
+		t.Errorf(`NewStatic() with an unknown rule "audit_condition" returned error %v, want one naming AuditCondition`, err)
+	}
+}
+
+// TestAuditMetadataKeys verifies that only allowlisted metadata keys are
+// copied into audit events, matched case-insensitively, and that sensitive
+// allowlisted keys are still redacted.
+func TestAuditMetadataKeys(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`, WithAuditMetadataKeys("X-Team", "x-request-id", "authorization"))
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	md := metadata.Pairs(
+		"x-team", "core",
+		"X-Request-Id", "req-1",
+		"x-secret", "hunter2",
+		"authorization", "Bearer token",
+	)
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", md)); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	got := rec.events[len(rec.events)-1].Metadata
+	want := map[string][]string{
+		"x-team":        {"core"},
+		"x-request-id":  {"req-1"},
+		"authorization": {"<redacted>"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Event Metadata mismatch (-want +got):\n%s", diff)
+	}
+
+	// Without the option no metadata is captured at all.
+	i, err = NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "all",
+				"request": {"paths": ["*"]}
+			}
+		]
+	}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine = i.currentEngine().policyEngine
+	rec = &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", md)); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	if got := rec.events[len(rec.events)-1].Metadata; got != nil {
+		t.Errorf("Event Metadata without the option = %v, want nil", got)
+	}
+}
+
+func TestDecisionFromContext(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api"]}
+			}
+		]
+	}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	ctx := rpcContext("/pkg.Service/Api", nil)
+	ctx = grpcpeer.NewContext(ctx, &grpcpeer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000},
+		AuthInfo: credentials.TLSInfo{
+			SPIFFEID: &url.URL{Scheme: "spiffe", Host: "example.org", Path: "/frontend"},
+		},
+	})
+	want := &Decision{
+		PolicyName:  "authz",
+		MatchedRule: "authz_allow_api",
+		Principal:   "spiffe://example.org/frontend",
+	}
+
+	// The unary handler sees the decision of the allowing rule.
+	handler := func(ctx context.Context, _ any) (any, error) {
+		d, ok := DecisionFromContext(ctx)
+		if !ok {
+			t.Fatal("DecisionFromContext() in the handler found no Decision")
+		}
+		if diff := cmp.Diff(want, d); diff != "" {
+			t.Errorf("DecisionFromContext() returned an unexpected Decision (-want +got):\n%s", diff)
+		}
+		return nil, nil
+	}
+	if _, err := i.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+
+	// The stream handler sees it through the stream's context.
+	streamHandler := func(_ any, ss grpc.ServerStream) error {
+		d, ok := DecisionFromContext(ss.Context())
+		if !ok {
+			t.Fatal("DecisionFromContext() in the stream handler found no Decision")
+		}
+		if diff := cmp.Diff(want, d); diff != "" {
+			t.Errorf("DecisionFromContext() returned an unexpected Decision (-want +got):\n%s", diff)
+		}
+		return nil
+	}
+	ss := &fakeServerStream{ctx: ctx}
+	if err := i.StreamInterceptor(nil, ss, &grpc.StreamServerInfo{}, streamHandler); err != nil {
+		t.Fatalf("StreamInterceptor() failed: %v", err)
+	}
+
+	// Policies translated to RBAC engines do not record a Decision.
+	rbacOnly, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [{"name": "allow_all"}]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	if _, err := rbacOnly.UnaryInterceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ any) (any, error) {
+		if _, ok := DecisionFromContext(ctx); ok {
+			t.Error("DecisionFromContext() found a Decision under an RBAC engine, want none")
+		}
+		return nil, nil
+	}); err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+}
+
+func TestMatchedRuleIndex(t *testing.T) {
+	// Two allow rules deliberately share a name; the recorded index keeps
+	// their audit events distinguishable.
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow",
+				"request": {"paths": ["/pkg.Service/First"]}
+			},
+			{
+				"name": "allow",
+				"request": {"paths": ["/pkg.Service/Second"]}
+			}
+		]
+	}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	for method, wantIndex := range map[string]int{
+		"/pkg.Service/First":  0,
+		"/pkg.Service/Second": 1,
+		"/pkg.Service/Other":  -1,
+	} {
+		if err := engine.isAuthorized(rpcContext(method, nil)); err != nil && status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("isAuthorized(%v) failed: %v", method, err)
+		}
+		got := rec.events[len(rec.events)-1]
+		if got.MatchedRuleIndex != wantIndex {
+			t.Errorf("Event MatchedRuleIndex for %v = %d, want %d", method, got.MatchedRuleIndex, wantIndex)
+		}
+	}
+}
+
+func TestAuditEventCertificateSubject(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/Api"]}
+			}
+		]
+	}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	rec := &recordingTestLogger{}
+	engine.auditLoggers = []*auditLoggerState{{logger: rec}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+
+	// A certificate with a meaningful subject DN and no SPIFFE URI SAN: the
+	// subject is surfaced even though the principal stays empty.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "internal-client", Organization: []string{"Example Corp"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	ctx := rpcContext("/pkg.Service/Api", nil)
+	ctx = grpcpeer.NewContext(ctx, &grpcpeer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000},
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+		},
+	})
+	if err := engine.isAuthorized(ctx); err != nil {
+		t.Fatalf("isAuthorized() failed: %v", err)
+	}
+	got := rec.events[len(rec.events)-1]
+	if want := cert.Subject.String(); got.CertificateSubject != want {
+		t.Errorf("Event CertificateSubject = %q, want %q", got.CertificateSubject, want)
+	}
+	if got.Principal != "" {
+		t.Errorf("Event Principal = %q, want empty without a SPIFFE ID", got.Principal)
+	}
+
+	// Without mTLS the subject stays empty.
+	if err := engine.isAuthorized(rpcContext("/pkg.Service/Api", nil)); err != nil {
+		t.Fatalf("isAuthorized() without TLS failed: %v", err)
+	}
+	if got := rec.events[len(rec.events)-1].CertificateSubject; got != "" {
+		t.Errorf("Event CertificateSubject without TLS = %q, want empty", got)
+	}
+}
+
+func TestRegexPaths(t *testing.T) {
+	i, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_admin",
+				"request": {
+					"paths": ["/pkg.Service/Health"],
+					"regex_paths": [".*Admin$"]
+				}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	engine := i.currentEngine().policyEngine
+	if engine == nil {
+		t.Fatal("NewStatic() with regex_paths did not build a policy engine")
+	}
+	for method, wantCode := range map[string]codes.Code{
+		"/pkg.Service/DeleteAdmin": codes.OK,
+		"/pkg.Service/Health":      codes.OK,
+		"/pkg.Service/AdminList":   codes.PermissionDenied,
+		"/pkg.Service/Get":         codes.PermissionDenied,
+	} {
+		if got := status.Code(engine.isAuthorized(rpcContext(method, nil))); got != wantCode {
+			t.Errorf("isAuthorized(%v) returned code %v, want %v", method, got, wantCode)
+		}
+	}
+
+	if _, err := NewStatic(`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_admin",
+				"request": {"regex_paths": ["*Admin"]}
+			}
+		]
+	}`); err == nil {
+		t.Error("NewStatic() with a malformed regex_paths pattern succeeded, want error")
+	}
+}
+
+// TestPolicyReloadQuiescesOldEngine verifies that swapping in a new policy
+// does not close the replaced engine's audit loggers while an RPC admitted
+// under it is still in flight, and closes them once it finishes.
+func TestPolicyReloadQuiescesOldEngine(t *testing.T) {
+	i, err := NewStatic(`{"name": "authz", "allow_rules": [{"name": "all"}]}`, WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("NewStatic() failed: %v", err)
+	}
+	closer := &closingTestLogger{}
+	engine := i.currentEngine().policyEngine
+	engine.auditLoggers = []*auditLoggerState{{logger: closer}}
+	engine.auditCondition = v3rbacpb.RBAC_AuditLoggingOptions_ON_DENY_AND_ALLOW
+	entered := make(chan struct{})
+	proceed := make(chan struct{})
+	done := make(chan error, 1)
+	handler := func(context.Context, any) (any, error) {
+		close(entered)
+		<-proceed
+		return nil, nil
+	}
+	go func() {
+		_, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api", nil), nil, &grpc.UnaryServerInfo{}, handler)
+		done <- err
+	}()
+	<-entered
+	if err := i.AddRule("deny", `{"name": "block", "request": {"paths": ["/other.Service/Method"]}}`); err != nil {
+		t.Fatalf("AddRule() failed: %v", err)
+	}
+	if closer.closed != 0 {
+		t.Errorf("Audit logger Close calls during in-flight RPC = %d, want 0", closer.closed)
+	}
+	close(proceed)
+	if err := <-done; err != nil {
+		t.Fatalf("UnaryInterceptor() failed: %v", err)
+	}
+	if closer.closed != 1 {
+		t.Errorf("Audit logger Close calls after RPC finished = %d, want 1", closer.closed)
+	}
+}
+
+// closeCountingLoggerBuilder counts the logger instances it builds and how
+// many of them have been closed, for tests that exercise logger shutdown
+// across policy reloads.
+type closeCountingLoggerBuilder struct {
+	mu     sync.Mutex
+	built  int
+	closed int
+}
+
+func (b *closeCountingLoggerBuilder) Name() string { return "test_close_counting_logger" }
+func (b *closeCountingLoggerBuilder) ParseLoggerConfig(json.RawMessage) (audit.LoggerConfig, error) {
+	return nil, nil
+}
+func (b *closeCountingLoggerBuilder) Build(audit.LoggerConfig) audit.Logger {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.built++
+	return &closeCountingLogger{b: b}
+}
+
+func (b *closeCountingLoggerBuilder) counts() (built, closed int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.built, b.closed
+}
+
+type closeCountingLogger struct {
+	b *closeCountingLoggerBuilder
+}
+
+func (l *closeCountingLogger) Log(*audit.Event) {}
+func (l *closeCountingLogger) Close() error {
+	l.b.mu.Lock()
+	defer l.b.mu.Unlock()
+	l.b.closed++
+	return nil
+}
+
+// TestFileWatcherClosesAuditLoggers verifies that a file-watcher reload
+// closes the replaced policy's audit loggers and that Close closes the
+// current policy's, so buffered sinks are flushed rather than leaked.
+func TestFileWatcherClosesAuditLoggers(t *testing.T) {
+	b := &closeCountingLoggerBuilder{}
+	audit.RegisterLoggerBuilder(b)
+	// The regex_paths matcher routes the policy through the authz policy
+	// engine, which owns and closes its audit loggers.
+	policy := func(ruleName string) []byte {
+		return []byte(fmt.Sprintf(`{
+			"name": "authz",
+			"allow_rules": [{"name": %q, "request": {"regex_paths": [".*"]}}],
+			"audit_logging_options": {
+				"audit_condition": "ON_DENY_AND_ALLOW",
+				"audit_loggers": [{"name": "test_close_counting_logger"}]
+			}
+		}`, ruleName))
+	}
+	file := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(file, policy("all"), 0600); err != nil {
+		t.Fatalf("Failed to write policy file: %v", err)
+	}
+	i, err := NewFileWatcher(file, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewFileWatcher() failed: %v", err)
+	}
+	if err := os.WriteFile(file, policy("everyone"), 0600); err != nil {
+		t.Fatalf("Failed to rewrite policy file: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		built, closed := b.counts()
+		if built == 2 && closed == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			i.Close()
+			t.Fatalf("After reload, loggers built = %d and closed = %d, want 2 and 1", built, closed)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	i.Close()
+	if built, closed := b.counts(); built != 2 || closed != 2 {
+		t.Errorf("After Close, loggers built = %d and closed = %d, want 2 and 2", built, closed)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"strings"
+	"testing"
+)
+
+// fuzzSeedPolicies are valid policies exercising every matcher the parser
+// accepts, so the fuzzer starts from inputs that reach matcher compilation.
+var fuzzSeedPolicies = []string{
+	`{
+		"name": "authz",
+		"allow_rules": [
+			{
+				"name": "allow_all"
+			}
+		]
+	}`,
+	`{
+		"name": "authz",
+		"deny_rules": [
+			{
+				"name": "deny_policy_1",
+				"source": {"principals": ["spiffe://foo.abc", "spiffe://bar*", "*baz", "spiffe://abc.*.com"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_policy_1",
+				"source": {"principals": ["*"]},
+				"request": {"paths": ["path-foo*"], "headers": [{"key": "key-abc", "values": ["val-abc", "*"]}]}
+			}
+		],
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY",
+			"audit_loggers": [
+				{
+					"name": "stdout_logger",
+					"config": {},
+					"is_optional": false
+				}
+			]
+		}
+	}`,
+	`{
+		"name": "authz",
+		"warn_rules": [
+			{
+				"name": "warn_legacy",
+				"request": {"paths": ["/pkg.Service/Legacy*"], "listener": {"names": ["admin"]}}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_ext",
+				"request": {"retry_attempt": {"min": 1}, "timeout_bucket": {"min_millis": 0, "max_millis": 5000}}
+			}
+		]
+	}`,
+}
+
+// FuzzNewStatic checks that arbitrary policy input never makes NewStatic
+// panic or hang: it must either build an interceptor or return an error.
+func FuzzNewStatic(f *testing.F) {
+	for _, policy := range fuzzSeedPolicies {
+		f.Add(policy)
+	}
+	f.Add(`{"name": "authz", "allow_rules": [{"name": "` + strings.Repeat("a", 4096) + `"}]}`)
+	f.Add(`{"name": "�", "allow_rules": [{"name": "\xff"}]}`)
+	f.Add(strings.Repeat(`{"allow_rules": [`, 128))
+	f.Fuzz(func(_ *testing.T, policy string) {
+		// Neither result needs checking: the fuzzer only hunts for panics and
+		// hangs in parsing and matcher compilation.
+		i, _ := NewStatic(policy)
+		if i != nil {
+			_, _ = i.DumpPolicy(true)
+		}
+	})
+}
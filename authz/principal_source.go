@@ -0,0 +1,71 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+// PrincipalSource resolves the caller's principal from one aspect of an
+// incoming RPC, such as the peer certificate or a request header. Sources are
+// combined with WithPrincipalSources.
+type PrincipalSource struct {
+	name    string
+	resolve func(in *rpcInput) string
+}
+
+// PrincipalSourceCert resolves the principal from the SPIFFE ID of the peer
+// certificate. It yields an empty principal when the connection is not
+// authenticated with a certificate carrying one.
+func PrincipalSourceCert() PrincipalSource {
+	return PrincipalSource{
+		name:    "cert",
+		resolve: (*rpcInput).spiffeID,
+	}
+}
+
+// PrincipalSourceJWTClaim resolves the principal from the given string claim
+// of the JWT bearer token in the "authorization" header, e.g. "sub". It
+// yields an empty principal when there is no bearer token, the token does not
+// decode, or the claim is absent or not a string. Like the "jwt_audience"
+// matcher, the token's signature is not verified; see that matcher's
+// documentation for the trust model.
+func PrincipalSourceJWTClaim(claim string) PrincipalSource {
+	return PrincipalSource{
+		name: "jwt_claim:" + claim,
+		resolve: func(in *rpcInput) string {
+			claims, ok := jwtClaims(in)
+			if !ok {
+				return ""
+			}
+			v, _ := claims[claim].(string)
+			return v
+		},
+	}
+}
+
+// PrincipalSourceHeader resolves the principal from the first value of the
+// given request header. It yields an empty principal when the header is
+// absent. The header should be one stripped from client control, e.g. set by
+// a trusted proxy.
+func PrincipalSourceHeader(header string) PrincipalSource {
+	return PrincipalSource{
+		name: "header:" + header,
+		resolve: func(in *rpcInput) string {
+			if vals := in.md.Get(header); len(vals) > 0 {
+				return vals[0]
+			}
+			return ""
+		},
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+)
+
+// policyProfile is one environment's rule sets and audit options within a
+// profiled policy document.
+type policyProfile struct {
+	DenyRules           []rule              `json:"deny_rules"`
+	WarnRules           []rule              `json:"warn_rules"`
+	AllowRules          []rule              `json:"allow_rules"`
+	AuditLoggingOptions auditLoggingOptions `json:"audit_logging_options"`
+}
+
+// profiledPolicy is the shape of a policy document carrying per-environment
+// profiles instead of top-level rules.
+type profiledPolicy struct {
+	Name     string                    `json:"name"`
+	Profiles map[string]*policyProfile `json:"profiles"`
+}
+
+// NewStaticProfile returns a StaticInterceptor for the named profile of a
+// profiled authorization policy. A profiled policy keeps the rule sets and
+// audit options of several environments in one document, under a top-level
+// "profiles" object keyed by profile name:
+//
+//	{
+//	  "name": "example-policy",
+//	  "profiles": {
+//	    "prod": {"allow_rules": [...], "audit_logging_options": {...}},
+//	    "dev":  {"allow_rules": [...]},
+//	    "default": {"allow_rules": [...]}
+//	  }
+//	}
+//
+// The "default" profile, when present, applies when the requested profile is
+// absent. It is an error when neither exists. The selected profile is
+// validated like a plain policy, so it must carry at least one allow rule.
+func NewStaticProfile(authzPolicy string, profileName string, opts ...Option) (*StaticInterceptor, error) {
+	pp := &profiledPolicy{}
+	d := json.NewDecoder(bytes.NewReader([]byte(authzPolicy)))
+	d.DisallowUnknownFields()
+	if err := d.Decode(pp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy: %v", err)
+	}
+	if pp.Name == "" {
+		return nil, fmt.Errorf(`"name" is not present`)
+	}
+	if len(pp.Profiles) == 0 {
+		return nil, fmt.Errorf(`"profiles" is not present`)
+	}
+	profile, ok := pp.Profiles[profileName]
+	if !ok {
+		if profile, ok = pp.Profiles["default"]; !ok {
+			return nil, fmt.Errorf(`profile %q is not present and there is no "default" profile`, profileName)
+		}
+	}
+	policy := &authorizationPolicy{
+		Name:                pp.Name,
+		DenyRules:           profile.DenyRules,
+		WarnRules:           profile.WarnRules,
+		AllowRules:          profile.AllowRules,
+		AuditLoggingOptions: profile.AuditLoggingOptions,
+	}
+	if len(policy.AllowRules) == 0 {
+		return nil, fmt.Errorf(`"allow_rules" is not present`)
+	}
+	engine, err := newStaticEngine(policy, opts)
+	if err != nil {
+		return nil, err
+	}
+	i := &StaticInterceptor{policy: policy, opts: opts}
+	atomic.StorePointer(&i.engine, unsafe.Pointer(engine))
+	reportMissingLoggers(policy, opts)
+	return i, nil
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bucket map housekeeping: once the matcher tracks more than sweepThreshold
+// keys, buckets that have not been used for sweepIdleAge are dropped, at most
+// once per sweepInterval. An idle bucket is full by construction, so dropping
+// and later recreating it does not change admission decisions.
+const (
+	sweepThreshold = 1024
+	sweepIdleAge   = 10 * time.Minute
+	sweepInterval  = time.Minute
+)
+
+// rateLimitMatch is the JSON shape of the "rate_limit" matcher.
+type rateLimitMatch struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             float64 `json:"burst"`
+	Per               string  `json:"per"`
+}
+
+// rateLimitMatcher matches RPCs that exceed a token-bucket rate limit, so a
+// deny rule carrying it throttles the selected traffic; exceeded RPCs are
+// denied with RESOURCE_EXHAUSTED and audited like any other deny. Buckets are
+// keyed by the RPC's principal, method or both, per "per", and refill at
+// requests_per_second up to a capacity of burst.
+//
+// Each evaluation of the matcher consumes a token, so the matcher is meant
+// to appear in a single deny rule. All state is guarded by a single mutex,
+// making the matcher safe for concurrent RPCs.
+type rateLimitMatcher struct {
+	rps   float64
+	burst float64
+	per   string
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimitMatcher(m *rateLimitMatch) (*rateLimitMatcher, error) {
+	if m.RequestsPerSecond <= 0 {
+		return nil, fmt.Errorf(`"rate_limit" requires a positive "requests_per_second"`)
+	}
+	burst := m.Burst
+	if burst == 0 {
+		burst = 1
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf(`"rate_limit" requires "burst" of at least 1`)
+	}
+	switch m.Per {
+	case "principal", "method", "principal_method":
+	case "":
+		m.Per = "principal_method"
+	default:
+		return nil, fmt.Errorf(`"rate_limit" has unsupported "per" %q, must be one of "principal", "method", "principal_method"`, m.Per)
+	}
+	return &rateLimitMatcher{
+		rps:       m.RequestsPerSecond,
+		burst:     burst,
+		per:       m.Per,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// key returns the bucket key for the RPC per the configured scope.
+func (m *rateLimitMatcher) key(in *rpcInput) string {
+	switch m.per {
+	case "principal":
+		return in.principal()
+	case "method":
+		return in.fullMethod
+	default:
+		return in.principal() + "|" + in.fullMethod
+	}
+}
+
+// match takes a token from the RPC's bucket and reports true when none is
+// available, i.e. when the rate limit is exceeded.
+func (m *rateLimitMatcher) match(in *rpcInput) bool {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maybeSweep(now)
+	key := m.key(in)
+	bucket := m.buckets[key]
+	if bucket == nil {
+		bucket = &tokenBucket{tokens: m.burst, last: now}
+		m.buckets[key] = bucket
+	} else {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * m.rps
+		if bucket.tokens > m.burst {
+			bucket.tokens = m.burst
+		}
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		return true
+	}
+	bucket.tokens--
+	return false
+}
+
+// maybeSweep drops idle buckets. The caller must hold m.mu.
+func (m *rateLimitMatcher) maybeSweep(now time.Time) {
+	if len(m.buckets) <= sweepThreshold || now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.last) > sweepIdleAge {
+			delete(m.buckets, key)
+		}
+	}
+}
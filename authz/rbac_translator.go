@@ -42,40 +42,187 @@ import (
 const typeURLPrefix = "grpc.authz.audit_logging/"
 
 type header struct {
-	Key    string
-	Values []string
+	Key    string   `json:"key"`
+	Values []string `json:"values"`
 }
 
 type peer struct {
-	Principals []string
+	Principals []string `json:"principals"`
 }
 
 type request struct {
-	Paths   []string
-	Headers []header
+	Paths []string `json:"paths"`
+	// RegexPaths are RE2 patterns matched against the full method name,
+	// forming a union with Paths within the rule. It has no RBAC proto
+	// representation and is evaluated by the authz policy engine.
+	RegexPaths []string `json:"regex_paths"`
+	Headers    []header `json:"headers"`
+	// Listener restricts the rule to RPCs arriving over a server tagged via
+	// ListenerTag. It has no RBAC proto representation and is evaluated by
+	// the authz policy engine.
+	Listener *listenerMatch `json:"listener"`
+	// RetryAttempt restricts the rule to RPCs that are retries, based on the
+	// "grpc-previous-rpc-attempts" metadata header. It has no RBAC proto
+	// representation and is evaluated by the authz policy engine.
+	RetryAttempt *retryAttemptMatch `json:"retry_attempt"`
+	// TimeoutBucket restricts the rule to RPCs whose declared timeout falls
+	// in an operator-defined bucket. It has no RBAC proto representation and
+	// is evaluated by the authz policy engine.
+	TimeoutBucket *timeoutBucketMatch `json:"timeout_bucket"`
+	// JWTAudience restricts the rule to RPCs bearing a JWT whose "aud" claim
+	// contains one of the given values. It has no RBAC proto representation
+	// and is evaluated by the authz policy engine.
+	JWTAudience *jwtAudienceMatch `json:"jwt_audience"`
+	// CertExtension restricts the rule to peers whose certificate carries a
+	// custom X.509 extension with a matching value. It has no RBAC proto
+	// representation and is evaluated by the authz policy engine.
+	CertExtension *certExtensionMatch `json:"cert_extension"`
+	// CertFingerprints restricts the rule to peers presenting one of the
+	// listed certificates, identified by SHA-256 fingerprint. It has no RBAC
+	// proto representation and is evaluated by the authz policy engine.
+	CertFingerprints *certFingerprintsMatch `json:"cert_fingerprints"`
+	// RequestCompression restricts the rule to RPCs by whether the request
+	// payload is compressed, based on the "grpc-encoding" metadata header. It
+	// has no RBAC proto representation and is evaluated by the authz policy
+	// engine.
+	RequestCompression *requestCompressionMatch `json:"request_compression"`
+	// MaxDecompressionRatio matches RPCs whose decompressed-to-compressed
+	// payload size ratio exceeds the given maximum, guarding against
+	// decompression bombs. It has no RBAC proto representation and is
+	// evaluated by the authz policy engine.
+	MaxDecompressionRatio *float64 `json:"max_decompression_ratio"`
+	// UserAgent restricts the rule to RPCs whose "user-agent" metadata header
+	// matches, e.g. to block outdated client library versions. It has no RBAC
+	// proto representation and is evaluated by the authz policy engine.
+	UserAgent *userAgentMatch `json:"user_agent"`
+	// RateLimit matches RPCs exceeding a token-bucket rate limit, denying
+	// them with RESOURCE_EXHAUSTED when used in a deny rule. It has no RBAC
+	// proto representation and is evaluated by the authz policy engine.
+	RateLimit *rateLimitMatch `json:"rate_limit"`
+	// Lockout matches callers that have crossed a threshold of consecutive
+	// denials, imposing a temporary lockout when used in a deny rule. It has
+	// no RBAC proto representation and is evaluated by the authz policy
+	// engine.
+	Lockout *lockoutMatch `json:"lockout"`
+	// RequireOCSPStapled restricts the rule to connections whose TLS
+	// handshake carried a valid stapled OCSP response, for methods that need
+	// a freshness guarantee on the peer certificate. It has no RBAC proto
+	// representation and is evaluated by the authz policy engine.
+	RequireOCSPStapled *bool `json:"require_ocsp_stapled"`
+	// SharedSecret restricts the rule to RPCs presenting a configured shared
+	// secret in a metadata header, for legacy clients without mTLS or JWT
+	// credentials. It has no RBAC proto representation and is evaluated by
+	// the authz policy engine.
+	SharedSecret *sharedSecretMatch `json:"shared_secret"`
+	// ConnectionAge restricts the rule to RPCs on connections older than a
+	// threshold, tracked by the ConnectionAgeTracking stats handler. It has
+	// no RBAC proto representation and is evaluated by the authz policy
+	// engine.
+	ConnectionAge *connectionAgeMatch `json:"connection_age"`
+	// KnownMethod restricts the rule to methods that are (true) or are not
+	// (false) in the known-method set supplied with WithKnownMethods. It has
+	// no RBAC proto representation and is evaluated by the authz policy
+	// engine.
+	KnownMethod *bool `json:"known_method"`
+	// TLS restricts the rule to connections whose negotiated TLS protocol
+	// version and cipher suite meet the configured bar; non-TLS connections
+	// never match. It has no RBAC proto representation and is evaluated by
+	// the authz policy engine.
+	TLS *tlsMatch `json:"tls"`
+	// DynamicList restricts the rule to RPCs whose selected attribute is in
+	// an externally maintained list registered with WithDynamicListSource.
+	// It has no RBAC proto representation and is evaluated by the authz
+	// policy engine.
+	DynamicList *dynamicListMatch `json:"dynamic_list"`
+	// TrustBoundary restricts the rule to RPCs that did (true) or did not
+	// (false) cross the mesh trust boundary, read from a header trusted
+	// ingress sets. It has no RBAC proto representation and is evaluated by
+	// the authz policy engine.
+	TrustBoundary *trustBoundaryMatch `json:"trust_boundary"`
+	// MetadataCardinality restricts the rule to RPCs sending more than a
+	// configured number of values for one metadata key. It has no RBAC proto
+	// representation and is evaluated by the authz policy engine.
+	MetadataCardinality *metadataCardinalityMatch `json:"metadata_cardinality"`
+	// GeoIP restricts the rule to RPCs whose peer IP resolves to a country
+	// outside an allowed set, via the resolver registered with
+	// WithGeoIPResolver. It has no RBAC proto representation and is evaluated
+	// by the authz policy engine.
+	GeoIP *geoipMatch `json:"geoip"`
+	// MaxConcurrentStreams restricts the rule to RPCs admitted while the
+	// caller already has a configured number of streams running. It has no
+	// RBAC proto representation and is evaluated by the authz policy engine.
+	MaxConcurrentStreams *concurrentStreamsMatch `json:"max_concurrent_streams"`
+}
+
+type listenerMatch struct {
+	Names []string `json:"names"`
 }
 
 type rule struct {
-	Name    string
-	Source  peer
-	Request request
+	Name    string  `json:"name"`
+	Source  peer    `json:"source"`
+	Request request `json:"request"`
+	// Condition is a CEL expression over the request attributes that must
+	// additionally evaluate to true for the rule to match, for requirements
+	// combining attributes the structural matchers cannot express. It has no
+	// RBAC proto representation and is evaluated by the authz policy engine.
+	Condition string `json:"condition"`
+	// DelayMillis holds matching RPCs for the given duration before the
+	// denial is returned, to tarpit abusive callers. It is only supported on
+	// deny rules, has no RBAC proto representation and is applied by the
+	// authz policy engine.
+	DelayMillis int64 `json:"delay_ms"`
+	// Redirect attaches a routing hint to denials by this rule, e.g. the
+	// authority of the region the caller should have called. It is only
+	// supported on deny rules, has no RBAC proto representation and is
+	// applied by the authz policy engine.
+	Redirect *redirectHint `json:"redirect"`
+	// AuditCondition, when present, overrides the policy-level
+	// "audit_condition" for decisions this rule matched, so e.g. allows can
+	// be audited for one sensitive method only. It takes the same enum
+	// values, has no RBAC proto representation and is applied by the authz
+	// policy engine.
+	AuditCondition string `json:"audit_condition"`
+}
+
+// redirectHint is the JSON shape of a deny rule's "redirect" field.
+type redirectHint struct {
+	Authority string `json:"authority"`
 }
 
 type auditLogger struct {
 	Name       string           `json:"name"`
 	Config     *structpb.Struct `json:"config"`
 	IsOptional bool             `json:"is_optional"`
+	// PrincipalMatch restricts the logger to events whose principal matches
+	// one of the patterns, using the same syntax as rule "principals": "*"
+	// matches any non-empty principal, a trailing or leading "*" matches a
+	// prefix or suffix, anything else matches exactly. An event is dispatched
+	// to every logger whose filter it passes, so a dedicated sink for one
+	// principal can run alongside an unfiltered one. It has no RBAC proto
+	// representation and is applied by the authz policy engine.
+	PrincipalMatch []string `json:"principal_match"`
 }
 
 type auditLoggingOptions struct {
-	AuditCondition string         `json:"audit_condition"`
-	AuditLoggers   []*auditLogger `json:"audit_loggers"`
+	AuditCondition string `json:"audit_condition"`
+	// AuditConditionExpression generalizes AuditCondition to a boolean
+	// expression over the decision's outcome, method and principal. It has no
+	// RBAC proto representation and is evaluated by the authz policy engine;
+	// the enum remains as shorthand for the common cases.
+	AuditConditionExpression string         `json:"audit_condition_expression"`
+	AuditLoggers             []*auditLogger `json:"audit_loggers"`
 }
 
 // Represents the SDK authorization policy provided by user.
 type authorizationPolicy struct {
-	Name                string
-	DenyRules           []rule              `json:"deny_rules"`
+	Name      string `json:"name"`
+	DenyRules []rule `json:"deny_rules"`
+	// WarnRules are evaluated between deny and allow rules: a matching warn
+	// rule allows the RPC but flags its audit event with the "warn" outcome.
+	// They have no RBAC proto representation and are evaluated by the authz
+	// policy engine.
+	WarnRules           []rule              `json:"warn_rules"`
 	AllowRules          []rule              `json:"allow_rules"`
 	AuditLoggingOptions auditLoggingOptions `json:"audit_logging_options"`
 }
@@ -355,22 +502,76 @@ func toDenyCondition(condition v3rbacpb.RBAC_AuditLoggingOptions_AuditCondition)
 	}
 }
 
-// translatePolicy translates SDK authorization policy in JSON format to two
-// Envoy RBAC polices (deny followed by allow policy) or only one Envoy RBAC
-// allow policy. Also returns the overall policy name. If the input policy
-// cannot be parsed or is invalid, an error will be returned.
-func translatePolicy(policyStr string) ([]*v3rbacpb.RBAC, string, error) {
+// parseAuthorizationPolicy parses and validates the top-level structure of an
+// SDK authorization policy in JSON format.
+func parseAuthorizationPolicy(policyStr string) (*authorizationPolicy, error) {
 	policy := &authorizationPolicy{}
 	d := json.NewDecoder(bytes.NewReader([]byte(policyStr)))
 	d.DisallowUnknownFields()
 	if err := d.Decode(policy); err != nil {
-		return nil, "", fmt.Errorf("failed to unmarshal policy: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal policy: %v", err)
 	}
 	if policy.Name == "" {
-		return nil, "", fmt.Errorf(`"name" is not present`)
+		return nil, fmt.Errorf(`"name" is not present`)
+	}
+	// A policy without allow rules is only usable as a pure deny list under
+	// WithDefaultAllow; the engine constructors enforce that pairing.
+	if len(policy.AllowRules) == 0 && len(policy.DenyRules) == 0 {
+		return nil, fmt.Errorf(`"allow_rules" is not present`)
+	}
+	warnDuplicateRuleNames(policy.Name, "deny_rules", policy.DenyRules)
+	warnDuplicateRuleNames(policy.Name, "warn_rules", policy.WarnRules)
+	warnDuplicateRuleNames(policy.Name, "allow_rules", policy.AllowRules)
+	return policy, nil
+}
+
+// warnDuplicateRuleNames logs a warning for rules sharing a name within a
+// rule list. Duplicates are permitted for backward compatibility, but they
+// make the matched-rule name recorded on audit events ambiguous; the
+// matched-rule index disambiguates them.
+func warnDuplicateRuleNames(policyName, listName string, rules []rule) {
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if seen[r.Name] {
+			logger.Warningf("authorization policy %q: duplicate rule name %q in %q", policyName, r.Name, listName)
+		}
+		seen[r.Name] = true
 	}
-	if len(policy.AllowRules) == 0 {
-		return nil, "", fmt.Errorf(`"allow_rules" is not present`)
+}
+
+// requiresPolicyEngine reports whether the policy uses extended matchers that
+// have no RBAC proto representation and must therefore be evaluated by the
+// authz policy engine.
+func (policy *authorizationPolicy) requiresPolicyEngine() bool {
+	if len(policy.WarnRules) > 0 {
+		return true
+	}
+	if policy.AuditLoggingOptions.AuditConditionExpression != "" {
+		return true
+	}
+	for _, l := range policy.AuditLoggingOptions.AuditLoggers {
+		if len(l.PrincipalMatch) > 0 {
+			return true
+		}
+	}
+	for _, rules := range [][]rule{policy.DenyRules, policy.AllowRules} {
+		for _, r := range rules {
+			if len(r.Request.RegexPaths) > 0 || r.Request.Listener != nil || r.Request.RetryAttempt != nil || r.Request.TimeoutBucket != nil || r.Request.JWTAudience != nil || r.Request.CertExtension != nil || r.Request.CertFingerprints != nil || r.Request.RequestCompression != nil || r.Request.MaxDecompressionRatio != nil || r.Request.UserAgent != nil || r.Request.RateLimit != nil || r.Request.Lockout != nil || r.Request.RequireOCSPStapled != nil || r.Request.SharedSecret != nil || r.Request.ConnectionAge != nil || r.Request.KnownMethod != nil || r.Request.TLS != nil || r.Request.DynamicList != nil || r.Request.TrustBoundary != nil || r.Request.MetadataCardinality != nil || r.Request.GeoIP != nil || r.Request.MaxConcurrentStreams != nil || r.Condition != "" || r.DelayMillis != 0 || r.Redirect != nil || r.AuditCondition != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// translatePolicy translates SDK authorization policy in JSON format to two
+// Envoy RBAC polices (deny followed by allow policy) or only one Envoy RBAC
+// allow policy. Also returns the overall policy name. If the input policy
+// cannot be parsed or is invalid, an error will be returned.
+func translatePolicy(policyStr string) ([]*v3rbacpb.RBAC, string, error) {
+	policy, err := parseAuthorizationPolicy(policyStr)
+	if err != nil {
+		return nil, "", err
 	}
 	allowLogger, denyLogger, err := policy.AuditLoggingOptions.toProtos()
 	if err != nil {
@@ -0,0 +1,15 @@
+module google.golang.org/grpc/authz/redislist
+
+go 1.19
+
+require (
+	github.com/redis/go-redis/v9 v9.5.1
+	google.golang.org/grpc v1.59.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+)
+
+replace google.golang.org/grpc => ../..
@@ -0,0 +1,99 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package redislist provides a Redis-backed dynamic list source for authz
+// "dynamic_list" matchers, so policies can consult allow and block lists that
+// security automation maintains in a Redis set.
+package redislist
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lookupTimeout bounds one Redis round trip. Lookups run on the RPC path, so
+// a slow or unreachable server must not stall RPCs for longer than this.
+const lookupTimeout = 100 * time.Millisecond
+
+// pruneThreshold is the cache size from which expired entries are swept
+// before inserting a new one.
+const pruneThreshold = 4096
+
+// client is the subset of the go-redis API the source uses. It is satisfied
+// by *redis.Client and the other go-redis client types; tests inject fakes.
+type client interface {
+	SIsMember(ctx context.Context, key string, member any) *redis.BoolCmd
+}
+
+// Source answers membership questions from a Redis set, caching results
+// locally so the RPC path does not pay a Redis round trip per RPC.
+type Source struct {
+	client client
+	set    string
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// cacheEntry is one cached lookup result; failed lookups are cached like
+// successful ones.
+type cacheEntry struct {
+	contains bool
+	err      error
+	expires  time.Time
+}
+
+// New returns a Source consulting the Redis set stored at key set through
+// client, typically a *redis.Client. Results — including lookup failures —
+// are cached for ttl, so each distinct key costs at most one SISMEMBER round
+// trip per ttl and list updates in Redis become visible within ttl. A round
+// trip is bounded to 100ms; when it fails, Contains returns the error (which
+// "dynamic_list" matchers treat as no match) and the failure is cached so an
+// unavailable server does not stall every RPC.
+func New(client client, set string, ttl time.Duration) *Source {
+	return &Source{client: client, set: set, ttl: ttl, cache: make(map[string]cacheEntry)}
+}
+
+// Contains implements authz.DynamicListSource.
+func (s *Source) Contains(key string) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	if e, ok := s.cache[key]; ok && now.Before(e.expires) {
+		s.mu.Unlock()
+		return e.contains, e.err
+	}
+	s.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	contains, err := s.client.SIsMember(ctx, s.set, key).Result()
+	s.mu.Lock()
+	if len(s.cache) >= pruneThreshold {
+		for k, e := range s.cache {
+			if !now.Before(e.expires) {
+				delete(s.cache, k)
+			}
+		}
+	}
+	s.cache[key] = cacheEntry{contains: contains, err: err, expires: now.Add(s.ttl)}
+	s.mu.Unlock()
+	return contains, err
+}
@@ -0,0 +1,99 @@
+/*
+ *
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package redislist
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/internal/grpctest"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// fakeClient answers SISMEMBER from a fixed member set and counts round
+// trips.
+type fakeClient struct {
+	members map[string]bool
+	err     error
+	calls   int
+}
+
+func (c *fakeClient) SIsMember(_ context.Context, _ string, member any) *redis.BoolCmd {
+	c.calls++
+	if c.err != nil {
+		return redis.NewBoolResult(false, c.err)
+	}
+	return redis.NewBoolResult(c.members[member.(string)], nil)
+}
+
+func (s) TestSourceCachesLookups(t *testing.T) {
+	fc := &fakeClient{members: map[string]bool{"spiffe://corp/blocked": true}}
+	src := New(fc, "blocklist", time.Minute)
+	for i := 0; i < 3; i++ {
+		if got, err := src.Contains("spiffe://corp/blocked"); err != nil || !got {
+			t.Fatalf("Contains(blocked member) = %v, %v, want true, nil", got, err)
+		}
+		if got, err := src.Contains("spiffe://corp/ok"); err != nil || got {
+			t.Fatalf("Contains(non-member) = %v, %v, want false, nil", got, err)
+		}
+	}
+	if fc.calls != 2 {
+		t.Errorf("Redis was consulted %d times for two keys, want 2", fc.calls)
+	}
+}
+
+func (s) TestSourceTTLExpiry(t *testing.T) {
+	fc := &fakeClient{members: map[string]bool{}}
+	src := New(fc, "blocklist", 10*time.Millisecond)
+	src.Contains("key")
+	fc.members["key"] = true
+	if got, _ := src.Contains("key"); got {
+		t.Error("Cached entry ignored before expiry")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got, err := src.Contains("key"); err != nil || !got {
+		t.Errorf("Contains() after TTL expiry = %v, %v, want the refreshed true, nil", got, err)
+	}
+	if fc.calls != 2 {
+		t.Errorf("Redis was consulted %d times, want 2: once before and once after expiry", fc.calls)
+	}
+}
+
+func (s) TestSourceCachesFailures(t *testing.T) {
+	fc := &fakeClient{err: errors.New("connection refused")}
+	src := New(fc, "blocklist", time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := src.Contains("key"); err == nil {
+			t.Fatal("Contains() with an unavailable server succeeded, want error")
+		}
+	}
+	if fc.calls != 1 {
+		t.Errorf("Redis was consulted %d times while failing, want the 1 cached failure", fc.calls)
+	}
+}
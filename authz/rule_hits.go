@@ -0,0 +1,86 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"sync"
+)
+
+// ruleHitCounter counts decisions per qualified rule name. The key set is
+// fixed at construction to the policy's rules, so rules that never match
+// still appear with a zero count and synthetic matched-rule names such as
+// "<default_allow>" are not counted.
+type ruleHitCounter struct {
+	mu   sync.Mutex
+	hits map[string]uint64
+}
+
+// newRuleHitCounter returns a counter over the qualified names of the given
+// compiled rule lists, all starting at zero.
+func newRuleHitCounter(ruleLists ...[]*compiledRule) *ruleHitCounter {
+	c := &ruleHitCounter{hits: make(map[string]uint64)}
+	for _, rules := range ruleLists {
+		for _, r := range rules {
+			c.hits[r.name] = 0
+		}
+	}
+	return c
+}
+
+// record counts one decision by the named rule. Names outside the policy's
+// rule set, including the empty name of unmatched decisions, are ignored. It
+// is safe on a nil counter.
+func (c *ruleHitCounter) record(ruleName string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.hits[ruleName]; ok {
+		c.hits[ruleName]++
+	}
+}
+
+// snapshot returns a copy of the current counts.
+func (c *ruleHitCounter) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]uint64, len(c.hits))
+	for k, v := range c.hits {
+		out[k] = v
+	}
+	return out
+}
+
+// GetRuleHitCounts returns how many RPCs each rule of the active policy has
+// decided since the policy was loaded, keyed by qualified rule name in the
+// "<policy>_<rule>" form audit events use. Rules that never matched are
+// present with a zero count, so operators can identify dead rules for
+// cleanup and spot unexpectedly hot ones. It returns nil unless the
+// interceptor was built with WithRuleHitCounts.
+//
+// The counts cover the currently active policy only: a policy mutation or
+// promotion swaps in fresh zeroed counters, with the final counts of the
+// replaced policy delivered to the WithRuleHitCounts callback, if one was
+// given.
+func (i *StaticInterceptor) GetRuleHitCounts() map[string]uint64 {
+	e := i.currentEngine().policyEngine
+	if e == nil || e.ruleHits == nil {
+		return nil
+	}
+	return e.ruleHits.snapshot()
+}
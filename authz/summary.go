@@ -0,0 +1,139 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/authz/audit"
+)
+
+// summaryTopRules is how many matched rules a summary event names, ordered by
+// hit count.
+const summaryTopRules = 5
+
+// summaryCollector aggregates decision outcomes and periodically emits a
+// rollup event to the logger configured with WithPeriodicSummary.
+type summaryCollector struct {
+	policyName string
+	interval   time.Duration
+	logger     audit.Logger
+
+	mu       sync.Mutex
+	allowed  uint64
+	denied   uint64
+	ruleHits map[string]uint64
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+func newSummaryCollector(policyName string, interval time.Duration, logger audit.Logger) *summaryCollector {
+	c := &summaryCollector{
+		policyName: policyName,
+		interval:   interval,
+		logger:     logger,
+		ruleHits:   make(map[string]uint64),
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// record counts the decision into the current summary window.
+func (c *summaryCollector) record(d *decision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d.authorized {
+		c.allowed++
+	} else {
+		c.denied++
+	}
+	if d.matchedRule != "" {
+		c.ruleHits[d.matchedRule]++
+	}
+}
+
+// run emits a summary every interval until stop is called, then emits the
+// final partial window.
+func (c *summaryCollector) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.emit()
+		case <-c.stopCh:
+			c.emit()
+			return
+		}
+	}
+}
+
+// emit logs the counts collected since the last summary and resets them.
+// Windows without any decisions emit nothing.
+func (c *summaryCollector) emit() {
+	c.mu.Lock()
+	allowed, denied, ruleHits := c.allowed, c.denied, c.ruleHits
+	c.allowed, c.denied = 0, 0
+	c.ruleHits = make(map[string]uint64)
+	c.mu.Unlock()
+	if allowed == 0 && denied == 0 {
+		return
+	}
+	rules := make([]string, 0, len(ruleHits))
+	for name := range ruleHits {
+		rules = append(rules, name)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if ruleHits[rules[i]] != ruleHits[rules[j]] {
+			return ruleHits[rules[i]] > ruleHits[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+	if len(rules) > summaryTopRules {
+		rules = rules[:summaryTopRules]
+	}
+	top := make([]string, len(rules))
+	for i, name := range rules {
+		top[i] = fmt.Sprintf("%s=%d", name, ruleHits[name])
+	}
+	c.logger.Log(&audit.Event{
+		EventType:  audit.EventTypeSummary,
+		PolicyName: c.policyName,
+		Labels: map[string]string{
+			"allowed":   strconv.FormatUint(allowed, 10),
+			"denied":    strconv.FormatUint(denied, 10),
+			"top_rules": strings.Join(top, ","),
+		},
+	})
+}
+
+// stop halts the ticker after emitting the current partial window. It is safe
+// to call more than once.
+func (c *summaryCollector) stop() {
+	c.stopOnce.Do(func() { close(c.stopCh) })
+	<-c.done
+}
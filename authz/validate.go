@@ -0,0 +1,69 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// Validate checks that the given authorization policy is well-formed: that
+// it parses, translates and compiles exactly as NewStatic would compile it.
+// Unlike NewStatic, it does not instantiate audit loggers, so policies naming
+// loggers whose builders are only registered in the serving binary still
+// validate. A nil return means NewStatic would accept the policy, except for
+// audit logger instantiation failures; a policy with deny rules but no allow
+// rules validates, since NewStatic accepts it when paired with
+// WithDefaultAllow.
+func Validate(authzPolicy string) error {
+	policy, err := parseAuthorizationPolicy(authzPolicy)
+	if err != nil {
+		return err
+	}
+	if _, _, err := translatePolicy(authzPolicy); err != nil {
+		return err
+	}
+	_, err = compilePolicy(policy, interceptorOptions{})
+	return err
+}
+
+// ValidateDir validates every policy file in fsys whose path matches glob,
+// which uses the path.Match syntax, and returns the per-file results keyed by
+// file path: a nil value means the policy is valid, a non-nil value carries
+// the validation or read error. The non-nil error return is reserved for
+// problems with the directory walk itself, such as a malformed glob pattern.
+//
+// It is intended for CI-style linting of a directory of per-service policy
+// files, e.g.:
+//
+//	results, err := authz.ValidateDir(os.DirFS("policies"), "*.json")
+func ValidateDir(fsys fs.FS, glob string) (map[string]error, error) {
+	matches, err := fs.Glob(fsys, glob)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]error, len(matches))
+	for _, name := range matches {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			results[name] = fmt.Errorf("failed to read policy file: %v", err)
+			continue
+		}
+		results[name] = Validate(string(data))
+	}
+	return results, nil
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package yamlpolicy provides authorization interceptors configured by
+// policies written in YAML instead of JSON. It lives in its own module so
+// that the core authz package does not carry a YAML dependency.
+package yamlpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/authz"
+	"google.golang.org/grpc/authz/internal"
+	"gopkg.in/yaml.v3"
+)
+
+// newFileWatcherWithConverter is the authz constructor backing NewFileWatcher,
+// reached through the internal hook since it is unexported there.
+var newFileWatcherWithConverter = internal.NewFileWatcherWithConverter.(func(string, time.Duration, func(string) (string, error)) (*authz.FileWatcherInterceptor, error))
+
+// yamlPolicyToJSON converts a YAML authorization policy document into its
+// JSON equivalent, so the YAML constructors reuse the JSON parsing and
+// validation unchanged. Anchors, aliases and multi-document streams are
+// rejected: a policy is security configuration and should read exactly as it
+// evaluates, without indirection.
+func yamlPolicyToJSON(authzPolicy string) (string, error) {
+	dec := yaml.NewDecoder(strings.NewReader(authzPolicy))
+	var root yaml.Node
+	if err := dec.Decode(&root); err != nil {
+		return "", fmt.Errorf("failed to parse YAML authorization policy: %v", err)
+	}
+	if err := rejectYAMLIndirection(&root); err != nil {
+		return "", err
+	}
+	if err := dec.Decode(&yaml.Node{}); err != io.EOF {
+		return "", fmt.Errorf("multi-document YAML authorization policies are not supported")
+	}
+	var v any
+	if err := root.Decode(&v); err != nil {
+		return "", fmt.Errorf("failed to parse YAML authorization policy: %v", err)
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert YAML authorization policy to JSON: %v", err)
+	}
+	return string(raw), nil
+}
+
+// rejectYAMLIndirection returns an error when the document defines an anchor
+// or references one through an alias.
+func rejectYAMLIndirection(n *yaml.Node) error {
+	if n.Anchor != "" {
+		return fmt.Errorf("YAML anchors are not supported in authorization policies: anchor %q", n.Anchor)
+	}
+	if n.Kind == yaml.AliasNode {
+		return fmt.Errorf("YAML aliases are not supported in authorization policies: alias of %q", n.Value)
+	}
+	for _, c := range n.Content {
+		if err := rejectYAMLIndirection(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewStatic returns a new authz.StaticInterceptor like authz.NewStatic, from
+// a static authorization policy written in YAML instead of JSON. The policy
+// carries the same fields as the JSON form, including the
+// "audit_logging_options" block, and goes through the same validation.
+// Anchors, aliases and multi-document YAML are rejected.
+func NewStatic(authzPolicy string, opts ...authz.Option) (*authz.StaticInterceptor, error) {
+	raw, err := yamlPolicyToJSON(authzPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return authz.NewStatic(raw, opts...)
+}
+
+// NewFileWatcher returns a new authz.FileWatcherInterceptor like
+// authz.NewFileWatcher, from a policy file containing YAML instead of JSON.
+// Each refresh converts the file like NewStatic before parsing, with the same
+// rejection of anchors, aliases and multi-document YAML.
+func NewFileWatcher(file string, duration time.Duration) (*authz.FileWatcherInterceptor, error) {
+	return newFileWatcherWithConverter(file, duration, yamlPolicyToJSON)
+}
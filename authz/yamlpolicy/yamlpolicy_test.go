@@ -0,0 +1,204 @@
+/*
+ * Copyright 2023 gRPC authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package yamlpolicy_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/authz"
+	"google.golang.org/grpc/authz/yamlpolicy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/internal/grpctest"
+	"google.golang.org/grpc/internal/transport"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type s struct {
+	grpctest.Tester
+}
+
+func Test(t *testing.T) {
+	grpctest.RunSubTests(t, s{})
+}
+
+// fakeServerTransportStream is a minimal grpc.ServerTransportStream carrying
+// the method name.
+type fakeServerTransportStream struct {
+	method string
+}
+
+func (s *fakeServerTransportStream) Method() string               { return s.method }
+func (s *fakeServerTransportStream) SetHeader(metadata.MD) error  { return nil }
+func (s *fakeServerTransportStream) SendHeader(metadata.MD) error { return nil }
+func (s *fakeServerTransportStream) SetTrailer(metadata.MD) error { return nil }
+
+// testConn returns a connection to attach to test contexts, shared across
+// tests, as the RBAC engines resolve the local address from it.
+var testConn = func() func() net.Conn {
+	var once sync.Once
+	var conn net.Conn
+	return func() net.Conn {
+		once.Do(func() {
+			lis, err := net.Listen("tcp", "localhost:0")
+			if err != nil {
+				panic(err)
+			}
+			go func() {
+				c, _ := lis.Accept()
+				if c != nil {
+					defer c.Close()
+				}
+			}()
+			if conn, err = net.Dial("tcp", lis.Addr().String()); err != nil {
+				panic(err)
+			}
+		})
+		return conn
+	}
+}()
+
+// rpcContext returns a context shaped like an incoming RPC for the given
+// method.
+func rpcContext(method string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.MD{})
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 9000}})
+	ctx = transport.SetConnection(ctx, testConn())
+	return grpc.NewContextWithServerTransportStream(ctx, &fakeServerTransportStream{method: method})
+}
+
+// TestNewStatic verifies that a YAML policy and its JSON equivalent produce
+// the same authorization outcomes, and that YAML indirection and
+// multi-document streams are rejected.
+func (s) TestNewStatic(t *testing.T) {
+	yamlPolicy := `
+name: authz
+audit_logging_options:
+  audit_condition: ON_DENY
+  audit_loggers:
+    - name: stdout_logger
+      is_optional: true
+deny_rules:
+  - name: deny_blocked
+    request:
+      paths:
+        - /pkg.Service/Blocked
+allow_rules:
+  - name: allow_api
+    request:
+      paths:
+        - /pkg.Service/*
+`
+	jsonPolicy := `{
+		"name": "authz",
+		"audit_logging_options": {
+			"audit_condition": "ON_DENY",
+			"audit_loggers": [
+				{"name": "stdout_logger", "is_optional": true}
+			]
+		},
+		"deny_rules": [
+			{
+				"name": "deny_blocked",
+				"request": {"paths": ["/pkg.Service/Blocked"]}
+			}
+		],
+		"allow_rules": [
+			{
+				"name": "allow_api",
+				"request": {"paths": ["/pkg.Service/*"]}
+			}
+		]
+	}`
+	fromYAML, err := yamlpolicy.NewStatic(yamlPolicy, authz.WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("yamlpolicy.NewStatic() failed: %v", err)
+	}
+	fromJSON, err := authz.NewStatic(jsonPolicy, authz.WithoutCorrelationIDGeneration())
+	if err != nil {
+		t.Fatalf("authz.NewStatic() failed: %v", err)
+	}
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	for _, method := range []string{"/pkg.Service/Api", "/pkg.Service/Blocked", "/other.Service/Api"} {
+		_, yamlErr := fromYAML.UnaryInterceptor(rpcContext(method), nil, &grpc.UnaryServerInfo{}, handler)
+		_, jsonErr := fromJSON.UnaryInterceptor(rpcContext(method), nil, &grpc.UnaryServerInfo{}, handler)
+		if status.Code(yamlErr) != status.Code(jsonErr) {
+			t.Errorf("Outcome for %v differs: YAML %v, JSON %v", method, status.Code(yamlErr), status.Code(jsonErr))
+		}
+	}
+
+	rejected := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{
+			name:   "anchor",
+			policy: "name: &n authz\nallow_rules:\n  - name: *n\n",
+			want:   "anchors are not supported",
+		},
+		{
+			name:   "multi-document",
+			policy: "name: authz\n---\nname: other\n",
+			want:   "multi-document",
+		},
+		{
+			name:   "malformed",
+			policy: "name: [unclosed\n",
+			want:   "failed to parse YAML",
+		},
+	}
+	for _, test := range rejected {
+		if _, err := yamlpolicy.NewStatic(test.policy); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("yamlpolicy.NewStatic() with %v policy returned error %v, want one containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+// TestNewFileWatcher verifies that the file-watcher variant parses YAML
+// policy files.
+func (s) TestNewFileWatcher(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := "name: authz\nallow_rules:\n  - name: allow_api\n    request:\n      paths:\n        - /pkg.Service/Api\n"
+	if err := os.WriteFile(file, []byte(policy), 0o600); err != nil {
+		t.Fatalf("os.WriteFile() failed: %v", err)
+	}
+	i, err := yamlpolicy.NewFileWatcher(file, time.Minute)
+	if err != nil {
+		t.Fatalf("yamlpolicy.NewFileWatcher() failed: %v", err)
+	}
+	defer i.Close()
+	handler := func(context.Context, any) (any, error) { return nil, nil }
+	if _, err := i.UnaryInterceptor(rpcContext("/pkg.Service/Api"), nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+		t.Errorf("Allowed RPC failed: %v", err)
+	}
+	if _, err := i.UnaryInterceptor(rpcContext("/other.Service/Api"), nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Denied RPC returned %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	if _, err := yamlpolicy.NewFileWatcher(filepath.Join(t.TempDir(), "missing.yaml"), time.Minute); err == nil {
+		t.Error("yamlpolicy.NewFileWatcher() with a missing file succeeded, want error")
+	}
+}